@@ -7,6 +7,7 @@ import (
 type AppError struct {
 	Code    int
 	Message string
+	Details any
 }
 
 func (e AppError) Error() string {
@@ -54,3 +55,74 @@ func NewUnprocessableEntity(message string) error {
 		Message: message,
 	}
 }
+
+func NewTooManyRequestsError(message string) error {
+	return AppError{
+		Code:    http.StatusTooManyRequests,
+		Message: message,
+	}
+}
+
+// NewPasswordPolicyError carries the rules a password broke as details, so
+// clients can show all of them at once.
+func NewPasswordPolicyError(violations any) error {
+	return AppError{
+		Code:    http.StatusUnprocessableEntity,
+		Message: "password does not meet the policy",
+		Details: violations,
+	}
+}
+
+// OAuthError is rendered as an RFC 6749 error response by the OAuth handlers.
+type OAuthError struct {
+	Code        int
+	ErrorCode   string
+	Description string
+}
+
+func (e OAuthError) Error() string {
+	return e.Description
+}
+
+func NewOAuthError(errorCode string, description string) error {
+	return OAuthError{
+		Code:        http.StatusBadRequest,
+		ErrorCode:   errorCode,
+		Description: description,
+	}
+}
+
+func NewOAuthClientError(description string) error {
+	return OAuthError{
+		Code:        http.StatusUnauthorized,
+		ErrorCode:   "invalid_client",
+		Description: description,
+	}
+}
+
+func NewOAuthServerError() error {
+	return OAuthError{
+		Code:        http.StatusInternalServerError,
+		ErrorCode:   "server_error",
+		Description: "unexpected error",
+	}
+}
+
+// ScimError is rendered as an RFC 7644 error response by the SCIM handlers.
+type ScimError struct {
+	Code     int
+	ScimType string
+	Detail   string
+}
+
+func (e ScimError) Error() string {
+	return e.Detail
+}
+
+func NewScimError(code int, scimType string, detail string) error {
+	return ScimError{
+		Code:     code,
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
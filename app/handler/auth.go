@@ -2,7 +2,6 @@ package handler
 
 import (
 	"lazy-auth/app/model"
-	"lazy-auth/app/repository"
 	"lazy-auth/app/service"
 
 	"github.com/gin-gonic/gin"
@@ -91,18 +90,16 @@ func (h authHandler) Logout(c *gin.Context) {
 		return
 	}
 
-	err = h.authService.Logout(body)
+	logoutResponse, err := h.authService.Logout(body)
 	if err != nil {
 		HandleError(c, err)
 		return
 	}
 
-	HandleOk(c, nil, nil)
+	HandleOk(c, logoutResponse, nil)
 }
 
 func (h authHandler) ChangePassword(c *gin.Context) {
-	session, _ := c.Get("session")
-
 	var body model.ChangePasswordRequest
 	err := ValidationPipe(c, &body, ValidateBody)
 	if err != nil {
@@ -110,7 +107,7 @@ func (h authHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	err = h.authService.ChangePassword(session.(*repository.Session).UserID, body)
+	err = h.authService.ChangePassword(c.GetString("user_id"), body)
 	if err != nil {
 		HandleError(c, err)
 		return
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type emailOtpHandler struct {
+	emailOtpService service.EmailOtpService
+}
+
+func NewEmailOtpHandler(emailOtpService service.EmailOtpService) emailOtpHandler {
+	return emailOtpHandler{emailOtpService: emailOtpService}
+}
+
+func (h emailOtpHandler) RequestLoginCode(c *gin.Context) {
+	var body model.EmailOtpRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	err = h.emailOtpService.RequestLoginCode(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, nil, nil)
+}
+
+func (h emailOtpHandler) VerifyLoginCode(c *gin.Context) {
+	var body model.VerifyEmailOtpRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	token, err := h.emailOtpService.VerifyLoginCode(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, token, nil)
+}
+
+func (h emailOtpHandler) VerifyMfa(c *gin.Context) {
+	var body model.VerifyMfaRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	token, err := h.emailOtpService.VerifyMfa(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, token, nil)
+}
+
+func (h emailOtpHandler) SendSetupCode(c *gin.Context) {
+	session, _ := c.Get("session")
+
+	err := h.emailOtpService.SendSetupCode(session.(*repository.Session).UserID)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, nil, nil)
+}
+
+func (h emailOtpHandler) UpdateEmailMfa(c *gin.Context) {
+	session, _ := c.Get("session")
+
+	var body model.UpdateEmailMfaRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	err = h.emailOtpService.UpdateEmailMfa(session.(*repository.Session).UserID, body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, nil, nil)
+}
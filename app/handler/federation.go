@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"net/http"
+
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// externalAuthCookie holds the browser binding of an external sign in, it
+// covers the login and the identity link callbacks.
+const (
+	externalAuthCookie     = "external_auth_binding"
+	externalAuthCookiePath = "/api"
+)
+
+type federationHandler struct {
+	federationService service.FederationService
+}
+
+func NewFederationHandler(federationService service.FederationService) federationHandler {
+	return federationHandler{federationService: federationService}
+}
+
+func (h federationHandler) GetLoginProviders(c *gin.Context) {
+	providers, err := h.federationService.GetLoginProviders()
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, providers, nil)
+}
+
+func (h federationHandler) Authorize(c *gin.Context) {
+	authorizeResponse, binding, err := h.federationService.Authorize(c.Param("slug"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	setExternalAuthCookie(c, binding)
+	HandleOk(c, authorizeResponse, nil)
+}
+
+func (h federationHandler) Callback(c *gin.Context) {
+	var body model.ExternalCallbackRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	binding, _ := c.Cookie(externalAuthCookie)
+	token, err := h.federationService.Callback(c.Param("slug"), body, binding)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	clearExternalAuthCookie(c)
+	HandleOk(c, token, nil)
+}
+
+func (h federationHandler) GetMyIdentities(c *gin.Context) {
+	session, _ := c.Get("session")
+	identities, err := h.federationService.GetIdentities(session.(*repository.Session).UserID)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, identities, nil)
+}
+
+func (h federationHandler) LinkAuthorize(c *gin.Context) {
+	session, _ := c.Get("session")
+	authorizeResponse, binding, err := h.federationService.LinkAuthorize(
+		session.(*repository.Session).UserID,
+		c.Param("slug"),
+	)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	setExternalAuthCookie(c, binding)
+	HandleOk(c, authorizeResponse, nil)
+}
+
+func (h federationHandler) LinkCallback(c *gin.Context) {
+	session, _ := c.Get("session")
+
+	var body model.ExternalCallbackRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	binding, _ := c.Cookie(externalAuthCookie)
+	identity, err := h.federationService.LinkCallback(
+		session.(*repository.Session).UserID,
+		c.Param("slug"),
+		body,
+		binding,
+	)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	clearExternalAuthCookie(c)
+	HandleOk(c, identity, nil)
+}
+
+func (h federationHandler) UnlinkIdentity(c *gin.Context) {
+	session, _ := c.Get("session")
+	err := h.federationService.UnlinkIdentity(session.(*repository.Session).UserID, c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, nil, nil)
+}
+
+func setExternalAuthCookie(c *gin.Context, binding string) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(externalAuthCookie, binding, 0, externalAuthCookiePath, "", secure, true)
+}
+
+func clearExternalAuthCookie(c *gin.Context) {
+	c.SetCookie(externalAuthCookie, "", -1, externalAuthCookiePath, "", false, true)
+}
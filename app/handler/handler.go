@@ -2,6 +2,7 @@ package handler
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"lazy-auth/app/errs"
@@ -26,7 +27,11 @@ func HandleOk(c *gin.Context, data any, meta any) {
 func HandleError(c *gin.Context, err interface{}) {
 	switch e := err.(type) {
 	case errs.AppError:
-		c.AbortWithStatusJSON(e.Code, gin.H{"status": "error", "message": e.Message, "timestamp": time.Now()})
+		body := gin.H{"status": "error", "message": e.Message, "timestamp": time.Now()}
+		if e.Details != nil {
+			body["details"] = e.Details
+		}
+		c.AbortWithStatusJSON(e.Code, body)
 
 	case validator.ValidationErrors:
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"status": "error", "message": e.Error(), "timestamp": time.Now()})
@@ -36,6 +41,67 @@ func HandleError(c *gin.Context, err interface{}) {
 	}
 }
 
+// HandleOAuthOk writes data as-is, OAuth clients expect the bare RFC 6749 shape.
+func HandleOAuthOk(c *gin.Context, data any) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.JSON(http.StatusOK, data)
+}
+
+func HandleOAuthError(c *gin.Context, err interface{}) {
+	switch e := err.(type) {
+	case errs.OAuthError:
+		if e.Code == http.StatusUnauthorized {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		c.AbortWithStatusJSON(e.Code, gin.H{"error": e.ErrorCode, "error_description": e.Description})
+
+	case errs.AppError:
+		c.AbortWithStatusJSON(e.Code, gin.H{"error": "invalid_request", "error_description": e.Message})
+
+	case validator.ValidationErrors:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": e.Error()})
+
+	case error:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": e.Error()})
+	}
+}
+
+const scimErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+// HandleScimOk writes data as-is with the SCIM media type.
+func HandleScimOk(c *gin.Context, code int, data any) {
+	c.Header("Content-Type", "application/scim+json; charset=utf-8")
+	if data == nil {
+		c.Status(code)
+		return
+	}
+	c.JSON(code, data)
+}
+
+func HandleScimError(c *gin.Context, err interface{}) {
+	c.Header("Content-Type", "application/scim+json; charset=utf-8")
+	switch e := err.(type) {
+	case errs.ScimError:
+		body := gin.H{"schemas": []string{scimErrorSchema}, "status": strconv.Itoa(e.Code), "detail": e.Detail}
+		if e.ScimType != "" {
+			body["scimType"] = e.ScimType
+		}
+		c.AbortWithStatusJSON(e.Code, body)
+
+	case errs.AppError:
+		c.AbortWithStatusJSON(e.Code, gin.H{"schemas": []string{scimErrorSchema}, "status": strconv.Itoa(e.Code), "detail": e.Message})
+
+	case error:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"schemas":  []string{scimErrorSchema},
+			"status":   strconv.Itoa(http.StatusBadRequest),
+			"scimType": "invalidSyntax",
+			"detail":   e.Error(),
+		})
+	}
+}
+
 type ValidateType int
 
 const (
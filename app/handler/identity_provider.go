@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"lazy-auth/app/model"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type identityProviderHandler struct {
+	identityProviderService service.IdentityProviderService
+}
+
+func NewIdentityProviderHandler(
+	identityProviderService service.IdentityProviderService,
+) identityProviderHandler {
+	return identityProviderHandler{identityProviderService: identityProviderService}
+}
+
+func (h identityProviderHandler) CreateProvider(c *gin.Context) {
+	var body model.CreateIdentityProviderRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	provider, err := h.identityProviderService.CreateProvider(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, provider, nil)
+}
+
+func (h identityProviderHandler) GetProviders(c *gin.Context) {
+	var query model.QueryIdentityProvider
+	err := ValidationPipe(c, &query, ValidateQuery)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	providerResponse, err := h.identityProviderService.GetProviders(query)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, providerResponse.Data, providerResponse.Meta)
+}
+
+func (h identityProviderHandler) GetProvider(c *gin.Context) {
+	provider, err := h.identityProviderService.GetProviderById(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, provider, nil)
+}
+
+func (h identityProviderHandler) UpdateProvider(c *gin.Context) {
+	var body model.UpdateIdentityProviderRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	provider, err := h.identityProviderService.UpdateProviderById(c.Param("id"), body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, provider, nil)
+}
+
+func (h identityProviderHandler) DeleteProvider(c *gin.Context) {
+	err := h.identityProviderService.DeleteProviderById(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, nil, nil)
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"lazy-auth/app/model"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ldapSyncHandler struct {
+	ldapSyncService service.LdapSyncService
+}
+
+func NewLdapSyncHandler(ldapSyncService service.LdapSyncService) ldapSyncHandler {
+	return ldapSyncHandler{ldapSyncService: ldapSyncService}
+}
+
+func (h ldapSyncHandler) Sync(c *gin.Context) {
+	var body model.LdapSyncRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	run, err := h.ldapSyncService.Sync(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, run, nil)
+}
+
+func (h ldapSyncHandler) GetStatus(c *gin.Context) {
+	status, err := h.ldapSyncService.GetStatus()
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, status, nil)
+}
+
+func (h ldapSyncHandler) GetRuns(c *gin.Context) {
+	var query model.QueryLdapSyncRun
+	err := ValidationPipe(c, &query, ValidateQuery)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	runResponse, err := h.ldapSyncService.GetRuns(query)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, runResponse.Data, runResponse.Meta)
+}
+
+func (h ldapSyncHandler) GetRun(c *gin.Context) {
+	run, err := h.ldapSyncService.GetRunById(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, run, nil)
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+
+	"lazy-auth/app/model"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type logoutHandler struct {
+	logoutService service.LogoutService
+}
+
+func NewLogoutHandler(logoutService service.LogoutService) logoutHandler {
+	return logoutHandler{logoutService: logoutService}
+}
+
+func (h logoutHandler) EndSession(c *gin.Context) {
+	var body model.EndSessionRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	endSessionResponse, err := h.logoutService.EndSession(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	// The relying party sent the browser here, so it is sent back with a
+	// redirect. Only API callers asking for JSON get the response body.
+	if endSessionResponse.RedirectTo != "" && c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) != gin.MIMEJSON {
+		c.Redirect(http.StatusFound, endSessionResponse.RedirectTo)
+		return
+	}
+
+	HandleOk(c, endSessionResponse, nil)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+
+	"lazy-auth/app/model"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	magicLinkCookie     = "magic_link_binding"
+	magicLinkCookiePath = "/api/auth/magic-link"
+)
+
+type magicLinkHandler struct {
+	magicLinkService service.MagicLinkService
+}
+
+func NewMagicLinkHandler(magicLinkService service.MagicLinkService) magicLinkHandler {
+	return magicLinkHandler{magicLinkService: magicLinkService}
+}
+
+func (h magicLinkHandler) RequestMagicLink(c *gin.Context) {
+	var body model.MagicLinkRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	binding, err := h.magicLinkService.RequestMagicLink(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	if binding != "" {
+		secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(magicLinkCookie, binding, 0, magicLinkCookiePath, "", secure, true)
+	}
+
+	HandleOk(c, nil, nil)
+}
+
+func (h magicLinkHandler) ConsumeMagicLink(c *gin.Context) {
+	var body model.ConsumeMagicLinkRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	binding, _ := c.Cookie(magicLinkCookie)
+	token, err := h.magicLinkService.ConsumeMagicLink(body, binding)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.SetCookie(magicLinkCookie, "", -1, magicLinkCookiePath, "", false, true)
+	HandleOk(c, token, nil)
+}
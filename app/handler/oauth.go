@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type oauthHandler struct {
+	oauthService service.OAuthService
+}
+
+func NewOAuthHandler(oauthService service.OAuthService) oauthHandler {
+	return oauthHandler{oauthService: oauthService}
+}
+
+func (h oauthHandler) Authorize(c *gin.Context) {
+	session, _ := c.Get("session")
+
+	var query model.AuthorizeRequest
+	err := ValidationPipe(c, &query, ValidateQuery)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	authorizeResponse, err := h.oauthService.Authorize(session.(*repository.Session), query)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, authorizeResponse, nil)
+}
+
+func (h oauthHandler) Decide(c *gin.Context) {
+	session, _ := c.Get("session")
+
+	var body model.AuthorizeDecisionRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	authorizeResponse, err := h.oauthService.Decide(session.(*repository.Session), body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, authorizeResponse, nil)
+}
+
+func (h oauthHandler) Token(c *gin.Context) {
+	var body model.OAuthTokenRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleOAuthError(c, err)
+		return
+	}
+	bindClientCredentials(c, &body.ClientID, &body.ClientSecret)
+
+	token, err := h.oauthService.Token(body)
+	if err != nil {
+		HandleOAuthError(c, err)
+		return
+	}
+
+	HandleOAuthOk(c, token)
+}
+
+func (h oauthHandler) AuthorizeDevice(c *gin.Context) {
+	var body model.DeviceAuthorizationRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleOAuthError(c, err)
+		return
+	}
+	bindClientCredentials(c, &body.ClientID, &body.ClientSecret)
+
+	deviceAuthorization, err := h.oauthService.AuthorizeDevice(body)
+	if err != nil {
+		HandleOAuthError(c, err)
+		return
+	}
+
+	HandleOAuthOk(c, deviceAuthorization)
+}
+
+func (h oauthHandler) GetDeviceVerification(c *gin.Context) {
+	session, _ := c.Get("session")
+
+	var query model.QueryDeviceVerification
+	err := ValidationPipe(c, &query, ValidateQuery)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	verification, err := h.oauthService.GetDeviceVerification(
+		session.(*repository.Session),
+		query.UserCode,
+	)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, verification, nil)
+}
+
+func (h oauthHandler) VerifyDevice(c *gin.Context) {
+	session, _ := c.Get("session")
+
+	var body model.DeviceVerificationRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	verification, err := h.oauthService.VerifyDevice(session.(*repository.Session), body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, verification, nil)
+}
+
+func (h oauthHandler) Introspect(c *gin.Context) {
+	var body model.TokenIntrospectionRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleOAuthError(c, err)
+		return
+	}
+	bindClientCredentials(c, &body.ClientID, &body.ClientSecret)
+
+	introspection, err := h.oauthService.Introspect(body)
+	if err != nil {
+		HandleOAuthError(c, err)
+		return
+	}
+
+	HandleOAuthOk(c, introspection)
+}
+
+func (h oauthHandler) Revoke(c *gin.Context) {
+	var body model.TokenRevocationRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleOAuthError(c, err)
+		return
+	}
+	bindClientCredentials(c, &body.ClientID, &body.ClientSecret)
+
+	err = h.oauthService.Revoke(body)
+	if err != nil {
+		HandleOAuthError(c, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (h oauthHandler) GetUserInfo(c *gin.Context) {
+	session, _ := c.Get("session")
+	scope := c.GetString("scope")
+
+	userInfo, err := h.oauthService.GetUserInfo(session.(*repository.Session).UserID, scope)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOAuthOk(c, userInfo)
+}
+
+func (h oauthHandler) GetOpenIDConfiguration(c *gin.Context) {
+	c.JSON(http.StatusOK, h.oauthService.GetOpenIDConfiguration())
+}
+
+func (h oauthHandler) GetJwks(c *gin.Context) {
+	c.JSON(http.StatusOK, h.oauthService.GetJwks())
+}
+
+// bindClientCredentials prefers HTTP Basic client authentication (RFC 6749
+// section 2.3.1) over credentials sent in the request body.
+func bindClientCredentials(c *gin.Context, clientId *string, clientSecret *string) {
+	username, password, ok := c.Request.BasicAuth()
+	if !ok {
+		return
+	}
+
+	if id, err := url.QueryUnescape(username); err == nil {
+		*clientId = id
+	}
+	if secret, err := url.QueryUnescape(password); err == nil {
+		*clientSecret = secret
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"lazy-auth/app/model"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type oauthClientHandler struct {
+	oauthClientService service.OAuthClientService
+}
+
+func NewOAuthClientHandler(oauthClientService service.OAuthClientService) oauthClientHandler {
+	return oauthClientHandler{oauthClientService: oauthClientService}
+}
+
+func (h oauthClientHandler) CreateClient(c *gin.Context) {
+	var body model.CreateOAuthClientRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	client, err := h.oauthClientService.CreateClient(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, client, nil)
+}
+
+func (h oauthClientHandler) GetClients(c *gin.Context) {
+	var query model.QueryOAuthClient
+	err := ValidationPipe(c, &query, ValidateQuery)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	clientResponse, err := h.oauthClientService.GetClients(query)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, clientResponse.Data, clientResponse.Meta)
+}
+
+func (h oauthClientHandler) GetClient(c *gin.Context) {
+	client, err := h.oauthClientService.GetClientById(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, client, nil)
+}
+
+func (h oauthClientHandler) UpdateClient(c *gin.Context) {
+	var body model.UpdateOAuthClientRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	client, err := h.oauthClientService.UpdateClientById(c.Param("id"), body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, client, nil)
+}
+
+func (h oauthClientHandler) RotateSecret(c *gin.Context) {
+	client, err := h.oauthClientService.RotateSecret(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, client, nil)
+}
+
+func (h oauthClientHandler) DeleteClient(c *gin.Context) {
+	err := h.oauthClientService.DeleteClientById(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, nil, nil)
+}
+
+func (h oauthClientHandler) RegisterClient(c *gin.Context) {
+	var body model.ClientRegistrationRequest
+	err := c.ShouldBindJSON(&body)
+	if err != nil {
+		HandleOAuthError(c, err)
+		return
+	}
+
+	initialAccessToken := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	client, err := h.oauthClientService.RegisterClient(initialAccessToken, body)
+	if err != nil {
+		HandleOAuthError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, client)
+}
@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type passwordPolicyHandler struct {
+	passwordPolicyService service.PasswordPolicyService
+}
+
+func NewPasswordPolicyHandler(passwordPolicyService service.PasswordPolicyService) passwordPolicyHandler {
+	return passwordPolicyHandler{passwordPolicyService: passwordPolicyService}
+}
+
+func (h passwordPolicyHandler) GetPasswordPolicy(c *gin.Context) {
+	HandleOk(c, h.passwordPolicyService.GetPasswordPolicy(), nil)
+}
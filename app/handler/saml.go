@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+
+	"lazy-auth/app/model"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type samlHandler struct {
+	samlService service.SamlService
+}
+
+func NewSamlHandler(samlService service.SamlService) samlHandler {
+	return samlHandler{samlService: samlService}
+}
+
+func (h samlHandler) GetMetadata(c *gin.Context) {
+	metadata, err := h.samlService.GetMetadata(c.Param("slug"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+func (h samlHandler) Login(c *gin.Context) {
+	loginResponse, err := h.samlService.Login(c.Param("slug"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, loginResponse, nil)
+}
+
+func (h samlHandler) Acs(c *gin.Context) {
+	var body model.SamlAcsRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	token, err := h.samlService.Acs(c.Param("slug"), body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, token, nil)
+}
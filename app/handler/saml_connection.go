@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"lazy-auth/app/model"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type samlConnectionHandler struct {
+	samlConnectionService service.SamlConnectionService
+}
+
+func NewSamlConnectionHandler(
+	samlConnectionService service.SamlConnectionService,
+) samlConnectionHandler {
+	return samlConnectionHandler{samlConnectionService: samlConnectionService}
+}
+
+func (h samlConnectionHandler) CreateConnection(c *gin.Context) {
+	var body model.CreateSamlConnectionRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	connection, err := h.samlConnectionService.CreateConnection(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, connection, nil)
+}
+
+func (h samlConnectionHandler) GetConnections(c *gin.Context) {
+	var query model.QuerySamlConnection
+	err := ValidationPipe(c, &query, ValidateQuery)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	connectionResponse, err := h.samlConnectionService.GetConnections(query)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, connectionResponse.Data, connectionResponse.Meta)
+}
+
+func (h samlConnectionHandler) GetConnection(c *gin.Context) {
+	connection, err := h.samlConnectionService.GetConnectionById(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, connection, nil)
+}
+
+func (h samlConnectionHandler) UpdateConnection(c *gin.Context) {
+	var body model.UpdateSamlConnectionRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	connection, err := h.samlConnectionService.UpdateConnectionById(c.Param("id"), body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, connection, nil)
+}
+
+func (h samlConnectionHandler) DeleteConnection(c *gin.Context) {
+	err := h.samlConnectionService.DeleteConnectionById(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, nil, nil)
+}
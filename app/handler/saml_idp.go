@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"net/http"
+
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type samlIdpHandler struct {
+	samlIdpService service.SamlIdpService
+}
+
+func NewSamlIdpHandler(samlIdpService service.SamlIdpService) samlIdpHandler {
+	return samlIdpHandler{samlIdpService: samlIdpService}
+}
+
+func (h samlIdpHandler) GetMetadata(c *gin.Context) {
+	metadata, err := h.samlIdpService.GetMetadata()
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+func (h samlIdpHandler) Sso(c *gin.Context) {
+	session, _ := c.Get("session")
+
+	var body model.SamlSsoRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	ssoResponse, err := h.samlIdpService.Sso(session.(*repository.Session), body, c.ClientIP())
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, ssoResponse, nil)
+}
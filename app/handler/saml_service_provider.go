@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"lazy-auth/app/model"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type samlServiceProviderHandler struct {
+	samlServiceProviderService service.SamlServiceProviderService
+}
+
+func NewSamlServiceProviderHandler(
+	samlServiceProviderService service.SamlServiceProviderService,
+) samlServiceProviderHandler {
+	return samlServiceProviderHandler{samlServiceProviderService: samlServiceProviderService}
+}
+
+func (h samlServiceProviderHandler) CreateServiceProvider(c *gin.Context) {
+	var body model.CreateSamlServiceProviderRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	serviceProvider, err := h.samlServiceProviderService.CreateServiceProvider(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, serviceProvider, nil)
+}
+
+func (h samlServiceProviderHandler) GetServiceProviders(c *gin.Context) {
+	var query model.QuerySamlServiceProvider
+	err := ValidationPipe(c, &query, ValidateQuery)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	serviceProviderResponse, err := h.samlServiceProviderService.GetServiceProviders(query)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, serviceProviderResponse.Data, serviceProviderResponse.Meta)
+}
+
+func (h samlServiceProviderHandler) GetServiceProvider(c *gin.Context) {
+	serviceProvider, err := h.samlServiceProviderService.GetServiceProviderById(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, serviceProvider, nil)
+}
+
+func (h samlServiceProviderHandler) UpdateServiceProvider(c *gin.Context) {
+	var body model.UpdateSamlServiceProviderRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	serviceProvider, err := h.samlServiceProviderService.UpdateServiceProviderById(c.Param("id"), body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, serviceProvider, nil)
+}
+
+func (h samlServiceProviderHandler) DeleteServiceProvider(c *gin.Context) {
+	err := h.samlServiceProviderService.DeleteServiceProviderById(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, nil, nil)
+}
@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"net/http"
+
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type scimHandler struct {
+	scimService service.ScimService
+}
+
+func NewScimHandler(scimService service.ScimService) scimHandler {
+	return scimHandler{scimService: scimService}
+}
+
+// SCIM clients send application/scim+json, which gin's content type binding
+// doesn't know, so bodies are always bound as JSON.
+
+func getScimTenant(c *gin.Context) *repository.ScimTenant {
+	tenant, _ := c.Get("scim_tenant")
+	return tenant.(*repository.ScimTenant)
+}
+
+func (h scimHandler) GetUsers(c *gin.Context) {
+	var query model.QueryScim
+	err := c.ShouldBindQuery(&query)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	users, err := h.scimService.GetUsers(getScimTenant(c), query)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	HandleScimOk(c, http.StatusOK, users)
+}
+
+func (h scimHandler) GetUser(c *gin.Context) {
+	user, err := h.scimService.GetUserById(getScimTenant(c), c.Param("id"))
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	HandleScimOk(c, http.StatusOK, user)
+}
+
+func (h scimHandler) CreateUser(c *gin.Context) {
+	var body model.ScimUser
+	err := c.ShouldBindJSON(&body)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	user, err := h.scimService.CreateUser(getScimTenant(c), body)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	c.Header("Location", user.Meta.Location)
+	HandleScimOk(c, http.StatusCreated, user)
+}
+
+func (h scimHandler) ReplaceUser(c *gin.Context) {
+	var body model.ScimUser
+	err := c.ShouldBindJSON(&body)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	user, err := h.scimService.ReplaceUser(getScimTenant(c), c.Param("id"), body)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	HandleScimOk(c, http.StatusOK, user)
+}
+
+func (h scimHandler) PatchUser(c *gin.Context) {
+	var body model.ScimPatchRequest
+	err := c.ShouldBindJSON(&body)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	user, err := h.scimService.PatchUser(getScimTenant(c), c.Param("id"), body)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	HandleScimOk(c, http.StatusOK, user)
+}
+
+func (h scimHandler) DeleteUser(c *gin.Context) {
+	err := h.scimService.DeleteUser(getScimTenant(c), c.Param("id"))
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	HandleScimOk(c, http.StatusNoContent, nil)
+}
+
+func (h scimHandler) GetGroups(c *gin.Context) {
+	var query model.QueryScim
+	err := c.ShouldBindQuery(&query)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	groups, err := h.scimService.GetGroups(getScimTenant(c), query)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	HandleScimOk(c, http.StatusOK, groups)
+}
+
+func (h scimHandler) GetGroup(c *gin.Context) {
+	var query model.QueryScim
+	err := c.ShouldBindQuery(&query)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	group, err := h.scimService.GetGroupById(getScimTenant(c), c.Param("id"), query)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	HandleScimOk(c, http.StatusOK, group)
+}
+
+func (h scimHandler) CreateGroup(c *gin.Context) {
+	var body model.ScimGroup
+	err := c.ShouldBindJSON(&body)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	group, err := h.scimService.CreateGroup(getScimTenant(c), body)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	c.Header("Location", group.Meta.Location)
+	HandleScimOk(c, http.StatusCreated, group)
+}
+
+func (h scimHandler) ReplaceGroup(c *gin.Context) {
+	var body model.ScimGroup
+	err := c.ShouldBindJSON(&body)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	group, err := h.scimService.ReplaceGroup(getScimTenant(c), c.Param("id"), body)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	HandleScimOk(c, http.StatusOK, group)
+}
+
+func (h scimHandler) PatchGroup(c *gin.Context) {
+	var body model.ScimPatchRequest
+	err := c.ShouldBindJSON(&body)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	group, err := h.scimService.PatchGroup(getScimTenant(c), c.Param("id"), body)
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	HandleScimOk(c, http.StatusOK, group)
+}
+
+func (h scimHandler) DeleteGroup(c *gin.Context) {
+	err := h.scimService.DeleteGroup(getScimTenant(c), c.Param("id"))
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	HandleScimOk(c, http.StatusNoContent, nil)
+}
+
+func (h scimHandler) GetServiceProviderConfig(c *gin.Context) {
+	HandleScimOk(c, http.StatusOK, h.scimService.GetServiceProviderConfig())
+}
+
+func (h scimHandler) GetResourceTypes(c *gin.Context) {
+	HandleScimOk(c, http.StatusOK, h.scimService.GetResourceTypes())
+}
+
+func (h scimHandler) GetResourceType(c *gin.Context) {
+	resourceType, err := h.scimService.GetResourceTypeById(c.Param("id"))
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	HandleScimOk(c, http.StatusOK, resourceType)
+}
+
+func (h scimHandler) GetSchemas(c *gin.Context) {
+	HandleScimOk(c, http.StatusOK, h.scimService.GetSchemas())
+}
+
+func (h scimHandler) GetSchema(c *gin.Context) {
+	schema, err := h.scimService.GetSchemaById(c.Param("id"))
+	if err != nil {
+		HandleScimError(c, err)
+		return
+	}
+
+	HandleScimOk(c, http.StatusOK, schema)
+}
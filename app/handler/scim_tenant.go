@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"lazy-auth/app/model"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type scimTenantHandler struct {
+	scimTenantService service.ScimTenantService
+}
+
+func NewScimTenantHandler(scimTenantService service.ScimTenantService) scimTenantHandler {
+	return scimTenantHandler{scimTenantService: scimTenantService}
+}
+
+func (h scimTenantHandler) CreateScimTenant(c *gin.Context) {
+	var body model.CreateScimTenantRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	scimTenant, err := h.scimTenantService.CreateScimTenant(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, scimTenant, nil)
+}
+
+func (h scimTenantHandler) GetScimTenants(c *gin.Context) {
+	var query model.QueryScimTenant
+	err := ValidationPipe(c, &query, ValidateQuery)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	scimTenantResponse, err := h.scimTenantService.GetScimTenants(query)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, scimTenantResponse.Data, scimTenantResponse.Meta)
+}
+
+func (h scimTenantHandler) GetScimTenant(c *gin.Context) {
+	scimTenant, err := h.scimTenantService.GetScimTenantById(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, scimTenant, nil)
+}
+
+func (h scimTenantHandler) UpdateScimTenant(c *gin.Context) {
+	var body model.UpdateScimTenantRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	scimTenant, err := h.scimTenantService.UpdateScimTenantById(c.Param("id"), body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, scimTenant, nil)
+}
+
+func (h scimTenantHandler) RotateToken(c *gin.Context) {
+	scimTenant, err := h.scimTenantService.RotateToken(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, scimTenant, nil)
+}
+
+func (h scimTenantHandler) DeleteScimTenant(c *gin.Context) {
+	err := h.scimTenantService.DeleteScimTenantById(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, nil, nil)
+}
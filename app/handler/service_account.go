@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"lazy-auth/app/model"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type serviceAccountHandler struct {
+	serviceAccountService service.ServiceAccountService
+}
+
+func NewServiceAccountHandler(
+	serviceAccountService service.ServiceAccountService,
+) serviceAccountHandler {
+	return serviceAccountHandler{serviceAccountService: serviceAccountService}
+}
+
+func (h serviceAccountHandler) CreateServiceAccount(c *gin.Context) {
+	var body model.CreateServiceAccountRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	serviceAccount, err := h.serviceAccountService.CreateServiceAccount(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, serviceAccount, nil)
+}
+
+func (h serviceAccountHandler) GetServiceAccounts(c *gin.Context) {
+	var query model.QueryServiceAccount
+	err := ValidationPipe(c, &query, ValidateQuery)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	serviceAccountResponse, err := h.serviceAccountService.GetServiceAccounts(query)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, serviceAccountResponse.Data, serviceAccountResponse.Meta)
+}
+
+func (h serviceAccountHandler) GetServiceAccount(c *gin.Context) {
+	serviceAccount, err := h.serviceAccountService.GetServiceAccountById(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, serviceAccount, nil)
+}
+
+func (h serviceAccountHandler) UpdateServiceAccount(c *gin.Context) {
+	var body model.UpdateServiceAccountRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	serviceAccount, err := h.serviceAccountService.UpdateServiceAccountById(c.Param("id"), body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, serviceAccount, nil)
+}
+
+func (h serviceAccountHandler) RotateSecret(c *gin.Context) {
+	serviceAccount, err := h.serviceAccountService.RotateSecret(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, serviceAccount, nil)
+}
+
+func (h serviceAccountHandler) DeleteServiceAccount(c *gin.Context) {
+	err := h.serviceAccountService.DeleteServiceAccountById(c.Param("id"))
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, nil, nil)
+}
+
+func (h serviceAccountHandler) IssueToken(c *gin.Context) {
+	var body model.ServiceAccountTokenRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	token, err := h.serviceAccountService.IssueToken(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, token, nil)
+}
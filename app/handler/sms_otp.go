@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type smsOtpHandler struct {
+	smsOtpService service.SmsOtpService
+}
+
+func NewSmsOtpHandler(smsOtpService service.SmsOtpService) smsOtpHandler {
+	return smsOtpHandler{smsOtpService: smsOtpService}
+}
+
+func (h smsOtpHandler) RequestLoginCode(c *gin.Context) {
+	var body model.SmsOtpRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	err = h.smsOtpService.RequestLoginCode(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, nil, nil)
+}
+
+func (h smsOtpHandler) VerifyLoginCode(c *gin.Context) {
+	var body model.VerifySmsOtpRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	token, err := h.smsOtpService.VerifyLoginCode(body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, token, nil)
+}
+
+func (h smsOtpHandler) UpdatePhone(c *gin.Context) {
+	session, _ := c.Get("session")
+
+	var body model.UpdatePhoneRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	err = h.smsOtpService.UpdatePhone(session.(*repository.Session).UserID, body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, nil, nil)
+}
+
+func (h smsOtpHandler) VerifyPhone(c *gin.Context) {
+	session, _ := c.Get("session")
+
+	var body model.VerifyPhoneRequest
+	err := ValidationPipe(c, &body, ValidateBody)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	err = h.smsOtpService.VerifyPhone(session.(*repository.Session).UserID, body)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, nil, nil)
+}
+
+func (h smsOtpHandler) RemovePhone(c *gin.Context) {
+	session, _ := c.Get("session")
+
+	err := h.smsOtpService.RemovePhone(session.(*repository.Session).UserID)
+	if err != nil {
+		HandleError(c, err)
+		return
+	}
+
+	HandleOk(c, nil, nil)
+}
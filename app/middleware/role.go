@@ -24,10 +24,9 @@ func NewRoleGuard(
 
 func (r roleGuard) ValidateRole(role ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		session, _ := c.Get("session")
-		user, _ := r.userRepository.GetById(session.(*repository.Session).UserID)
+		roleName := r.getRoleName(c)
 		for _, v := range role {
-			if user.Role.Name == v {
+			if roleName == v {
 				c.Next()
 				return
 			}
@@ -35,3 +34,20 @@ func (r roleGuard) ValidateRole(role ...string) gin.HandlerFunc {
 		handler.HandleError(c, errs.NewForbiddenError("forbidden"))
 	}
 }
+
+func (r roleGuard) getRoleName(c *gin.Context) string {
+	if serviceAccount, ok := c.Get("service_account"); ok {
+		return serviceAccount.(*repository.ServiceAccount).Role.Name
+	}
+
+	session, ok := c.Get("session")
+	if !ok {
+		return ""
+	}
+
+	user, err := r.userRepository.GetById(session.(*repository.Session).UserID)
+	if err != nil {
+		return ""
+	}
+	return user.Role.Name
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/handler"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+type scimGuard struct {
+	scimTenantRepository repository.ScimTenantRepository
+}
+
+type ScimGuard interface {
+	ValidateScimToken() gin.HandlerFunc
+}
+
+func NewScimGuard(scimTenantRepository repository.ScimTenantRepository) ScimGuard {
+	return scimGuard{scimTenantRepository: scimTenantRepository}
+}
+
+// ValidateScimToken authenticates a SCIM client by its tenant token and sets
+// "scim_tenant" on the context.
+func (r scimGuard) ValidateScimToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorization := c.GetHeader("Authorization")
+		token, ok := strings.CutPrefix(authorization, "Bearer ")
+		if !ok || token == "" {
+			handler.HandleScimError(c, errs.NewScimError(http.StatusUnauthorized, "", "invalid token"))
+			return
+		}
+
+		scimTenant, err := r.scimTenantRepository.GetByTokenHash(common.HashToken(token))
+		if err != nil || scimTenant.DisabledFlag {
+			handler.HandleScimError(c, errs.NewScimError(http.StatusUnauthorized, "", "invalid token"))
+			return
+		}
+
+		// Provisioning clients call often, only record access once a minute.
+		if time.Since(scimTenant.LastAccessAt) > time.Minute {
+			scimTenant.LastAccessAt = time.Now()
+			if err := r.scimTenantRepository.Update(scimTenant); err != nil {
+				zlog.Error(err)
+			}
+		}
+
+		c.Set("scim_tenant", scimTenant)
+		c.Next()
+	}
+}
@@ -13,43 +13,172 @@ import (
 )
 
 type tokenGuard struct {
-	sessionRepository repository.SessionRepository
-	config            config.ConfigEnv
+	sessionRepository        repository.SessionRepository
+	serviceAccountRepository repository.ServiceAccountRepository
+	config                   config.ConfigEnv
 }
 
 type TokenGuard interface {
 	ValidateToken() gin.HandlerFunc
+	ValidateScopedToken() gin.HandlerFunc
+	ValidateAnyToken() gin.HandlerFunc
+	ValidatePasswordChangeToken() gin.HandlerFunc
 }
 
 func NewTokenGuard(
 	sessionRepository repository.SessionRepository,
+	serviceAccountRepository repository.ServiceAccountRepository,
 	config config.ConfigEnv,
 ) TokenGuard {
-	return tokenGuard{sessionRepository: sessionRepository, config: config}
+	return tokenGuard{
+		sessionRepository:        sessionRepository,
+		serviceAccountRepository: serviceAccountRepository,
+		config:                   config,
+	}
 }
 
+// ValidateToken only accepts first-party user tokens and sets "session" on
+// the context.
 func (r tokenGuard) ValidateToken() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authorization := c.GetHeader("Authorization")
-		if !strings.HasPrefix(authorization, "Bearer") {
+		claims, ok := r.parseToken(c)
+		if !ok || claims.SubjectType != common.SubjectTypeUser {
+			handler.HandleError(c, errs.NewUnauthorizedError("invalid token"))
+			return
+		}
+
+		if !r.setSession(c, claims, false) {
+			handler.HandleError(c, errs.NewUnauthorizedError("invalid token"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// ValidateScopedToken also accepts user tokens issued to OAuth clients and
+// sets "session" and "scope" on the context. Routes behind it must check the
+// granted scope.
+func (r tokenGuard) ValidateScopedToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := r.parseToken(c)
+		if !ok || claims.SubjectType != common.SubjectTypeUser {
 			handler.HandleError(c, errs.NewUnauthorizedError("invalid token"))
 			return
 		}
 
-		splits := strings.Split(authorization, " ")
-		claims, valid := common.ValidateToken(splits[1], r.config.JwtTokenSecret)
-		if !valid {
+		if !r.setSession(c, claims, true) {
 			handler.HandleError(c, errs.NewUnauthorizedError("invalid token"))
 			return
 		}
+		c.Next()
+	}
+}
 
-		session, err := r.sessionRepository.GetById(claims.Id)
-		if err != nil {
+// ValidateAnyToken accepts user and service account tokens. Service account
+// requests get "service_account" on the context instead of "session".
+func (r tokenGuard) ValidateAnyToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := r.parseToken(c)
+		if !ok {
 			handler.HandleError(c, errs.NewUnauthorizedError("invalid token"))
 			return
 		}
 
-		c.Set("session", session)
+		switch claims.SubjectType {
+		case common.SubjectTypeUser:
+			ok = r.setSession(c, claims, false)
+		case common.SubjectTypeServiceAccount:
+			ok = r.setServiceAccount(c, claims)
+		default:
+			ok = false
+		}
+
+		if !ok {
+			handler.HandleError(c, errs.NewUnauthorizedError("invalid token"))
+			return
+		}
 		c.Next()
 	}
 }
+
+// ValidatePasswordChangeToken accepts user tokens and the restricted tokens
+// issued for expired passwords, both set "user_id" on the context.
+func (r tokenGuard) ValidatePasswordChangeToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := r.parseToken(c)
+		if !ok {
+			handler.HandleError(c, errs.NewUnauthorizedError("invalid token"))
+			return
+		}
+
+		switch claims.SubjectType {
+		case common.SubjectTypeUser:
+			ok = r.setSession(c, claims, false)
+		case common.SubjectTypePasswordChange:
+			ok = true
+		default:
+			ok = false
+		}
+
+		if !ok {
+			handler.HandleError(c, errs.NewUnauthorizedError("invalid token"))
+			return
+		}
+		c.Set("user_id", claims.Subject)
+		c.Next()
+	}
+}
+
+func (r tokenGuard) parseToken(c *gin.Context) (*common.TokenClaims, bool) {
+	authorization := c.GetHeader("Authorization")
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return nil, false
+	}
+
+	splits := strings.Split(authorization, " ")
+	claims, ok := common.ValidateToken(splits[1], r.config.JwtTokenSecret)
+	if !ok {
+		return nil, false
+	}
+
+	// Delegated tokens are audience-restricted to downstream services.
+	if claims.Act != nil {
+		return nil, false
+	}
+	return claims, true
+}
+
+// setSession rejects tokens issued to OAuth clients unless allowClient is set,
+// their access is limited to the granted scope.
+func (r tokenGuard) setSession(
+	c *gin.Context,
+	claims *common.TokenClaims,
+	allowClient bool,
+) bool {
+	if claims.ClientID != "" && !allowClient {
+		return false
+	}
+
+	session, err := r.sessionRepository.GetById(claims.Id)
+	if err != nil {
+		return false
+	}
+
+	if session.ClientID != "" && !allowClient {
+		return false
+	}
+
+	c.Set("session", session)
+	c.Set("scope", claims.Scope)
+	return true
+}
+
+func (r tokenGuard) setServiceAccount(c *gin.Context, claims *common.TokenClaims) bool {
+	serviceAccount, err := r.serviceAccountRepository.GetById(claims.Subject)
+	if err != nil || serviceAccount.DisabledFlag {
+		return false
+	}
+
+	c.Set("service_account", serviceAccount)
+	return true
+}
@@ -0,0 +1,20 @@
+package model
+
+type EmailOtpRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type VerifyEmailOtpRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Code  string `json:"code"  binding:"required,len=6,numeric"`
+}
+
+type VerifyMfaRequest struct {
+	MfaToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code"      binding:"required,len=6,numeric"`
+}
+
+type UpdateEmailMfaRequest struct {
+	Enabled *bool  `json:"enabled" binding:"required"`
+	Code    string `json:"code"    binding:"required,len=6,numeric"`
+}
@@ -0,0 +1,91 @@
+package model
+
+import "time"
+
+type QueryIdentityProvider struct {
+	QueryPagination
+	Keyword      *string `form:"keyword"`
+	DisabledFlag *bool   `form:"disabled_flag"`
+}
+
+type CreateIdentityProviderRequest struct {
+	Slug                  string            `json:"slug"                   binding:"required,alphanum,lowercase"`
+	Name                  string            `json:"name"                   binding:"required"`
+	Issuer                string            `json:"issuer"`
+	ClientID              string            `json:"client_id"              binding:"required"`
+	ClientSecret          string            `json:"client_secret"`
+	Scopes                []string          `json:"scopes"`
+	ClaimMapping          map[string]string `json:"claim_mapping"`
+	AuthorizationEndpoint string            `json:"authorization_endpoint"`
+	TokenEndpoint         string            `json:"token_endpoint"`
+	UserinfoEndpoint      string            `json:"userinfo_endpoint"`
+	JwksURI               string            `json:"jwks_uri"`
+	RedirectURI           string            `json:"redirect_uri"           binding:"required"`
+	AllowSignUp           bool              `json:"allow_sign_up"`
+	LinkByVerifiedEmail   bool              `json:"link_by_verified_email"`
+}
+
+type UpdateIdentityProviderRequest struct {
+	Name                  *string            `json:"name"`
+	Issuer                *string            `json:"issuer"`
+	ClientID              *string            `json:"client_id"`
+	ClientSecret          *string            `json:"client_secret"`
+	Scopes                *[]string          `json:"scopes"`
+	ClaimMapping          *map[string]string `json:"claim_mapping"`
+	AuthorizationEndpoint *string            `json:"authorization_endpoint"`
+	TokenEndpoint         *string            `json:"token_endpoint"`
+	UserinfoEndpoint      *string            `json:"userinfo_endpoint"`
+	JwksURI               *string            `json:"jwks_uri"`
+	RedirectURI           *string            `json:"redirect_uri"`
+	AllowSignUp           *bool              `json:"allow_sign_up"`
+	LinkByVerifiedEmail   *bool              `json:"link_by_verified_email"`
+	DisabledFlag          *bool              `json:"disabled_flag"`
+}
+
+type IdentityProviderResponse struct {
+	ID                    string            `json:"id"`
+	Slug                  string            `json:"slug"`
+	Name                  string            `json:"name"`
+	Issuer                string            `json:"issuer"`
+	ClientID              string            `json:"client_id"`
+	Scopes                []string          `json:"scopes"`
+	ClaimMapping          map[string]string `json:"claim_mapping"`
+	AuthorizationEndpoint string            `json:"authorization_endpoint"`
+	TokenEndpoint         string            `json:"token_endpoint"`
+	UserinfoEndpoint      string            `json:"userinfo_endpoint"`
+	JwksURI               string            `json:"jwks_uri"`
+	RedirectURI           string            `json:"redirect_uri"`
+	AllowSignUp           bool              `json:"allow_sign_up"`
+	LinkByVerifiedEmail   bool              `json:"link_by_verified_email"`
+	DisabledFlag          bool              `json:"disabled_flag"`
+	CreatedAt             time.Time         `json:"created_at"`
+}
+
+type IdentityProviderPageResponse struct {
+	Meta MetaPagination             `json:"meta"`
+	Data []IdentityProviderResponse `json:"data"`
+}
+
+type LoginProviderResponse struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+type ExternalAuthorizeResponse struct {
+	RedirectTo string `json:"redirect_to"`
+	State      string `json:"state"`
+}
+
+type ExternalCallbackRequest struct {
+	Code  string `json:"code"  form:"code"  binding:"required"`
+	State string `json:"state" form:"state" binding:"required"`
+}
+
+type UserIdentityResponse struct {
+	ID           string    `json:"id"`
+	Provider     string    `json:"provider"`
+	ProviderName string    `json:"provider_name"`
+	Email        string    `json:"email"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastLoginAt  time.Time `json:"last_login_at"`
+}
@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+type QueryLdapSyncRun struct {
+	QueryPagination
+	DryRun *bool   `form:"dry_run"`
+	Status *string `form:"status"  binding:"omitempty,oneof=running succeeded failed"`
+}
+
+type LdapSyncRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// LdapSyncChange is one difference between the directory and the local
+// users, applied or, on a dry run, only reported.
+type LdapSyncChange struct {
+	Action   string   `json:"action"`
+	DN       string   `json:"dn"`
+	Username string   `json:"username"`
+	Email    string   `json:"email,omitempty"`
+	Role     string   `json:"role,omitempty"`
+	Fields   []string `json:"fields,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+type LdapSyncRunResponse struct {
+	ID          string           `json:"id"`
+	DryRun      bool             `json:"dry_run"`
+	Trigger     string           `json:"trigger"`
+	Status      string           `json:"status"`
+	Error       string           `json:"error,omitempty"`
+	Created     int              `json:"created"`
+	Updated     int              `json:"updated"`
+	Deactivated int              `json:"deactivated"`
+	Reactivated int              `json:"reactivated"`
+	Skipped     int              `json:"skipped"`
+	Unchanged   int              `json:"unchanged"`
+	Changes     []LdapSyncChange `json:"changes,omitempty"`
+	StartedAt   time.Time        `json:"started_at"`
+	FinishedAt  *time.Time       `json:"finished_at"`
+}
+
+type LdapSyncRunPageResponse struct {
+	Meta MetaPagination        `json:"meta"`
+	Data []LdapSyncRunResponse `json:"data"`
+}
+
+type LdapSyncStatusResponse struct {
+	Enabled   bool                 `json:"enabled"`
+	Running   bool                 `json:"running"`
+	NextRunAt *time.Time           `json:"next_run_at"`
+	LastRun   *LdapSyncRunResponse `json:"last_run"`
+}
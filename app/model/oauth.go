@@ -0,0 +1,177 @@
+package model
+
+type AuthorizeRequest struct {
+	ResponseType        string `form:"response_type"         json:"response_type"         binding:"required"`
+	ClientID            string `form:"client_id"             json:"client_id"             binding:"required"`
+	RedirectURI         string `form:"redirect_uri"          json:"redirect_uri"`
+	Scope               string `form:"scope"                 json:"scope"`
+	State               string `form:"state"                 json:"state"`
+	CodeChallenge       string `form:"code_challenge"        json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+	Prompt              string `form:"prompt"                json:"prompt"`
+	Nonce               string `form:"nonce"                 json:"nonce"`
+}
+
+type AuthorizeDecisionRequest struct {
+	AuthorizeRequest
+	Approve bool `form:"approve" json:"approve"`
+}
+
+type AuthorizeResponse struct {
+	ConsentRequired bool     `json:"consent_required"`
+	ClientID        string   `json:"client_id"`
+	ClientName      string   `json:"client_name"`
+	Scopes          []string `json:"scopes"`
+	RedirectTo      string   `json:"redirect_to,omitempty"`
+}
+
+type OAuthTokenRequest struct {
+	GrantType    string `form:"grant_type"    json:"grant_type"    binding:"required"`
+	Code         string `form:"code"          json:"code"`
+	RedirectURI  string `form:"redirect_uri"  json:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier" json:"code_verifier"`
+	RefreshToken string `form:"refresh_token" json:"refresh_token"`
+	DeviceCode   string `form:"device_code"   json:"device_code"`
+	Scope        string `form:"scope"         json:"scope"`
+	ClientID     string `form:"client_id"     json:"client_id"`
+	ClientSecret string `form:"client_secret" json:"client_secret"`
+
+	SubjectToken       string `form:"subject_token"        json:"subject_token"`
+	SubjectTokenType   string `form:"subject_token_type"   json:"subject_token_type"`
+	ActorToken         string `form:"actor_token"          json:"actor_token"`
+	Audience           string `form:"audience"             json:"audience"`
+	RequestedTokenType string `form:"requested_token_type" json:"requested_token_type"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// ActorClaim is the RFC 8693 "act" claim, nested for each delegation hop.
+type ActorClaim struct {
+	Subject string      `json:"sub"`
+	Act     *ActorClaim `json:"act,omitempty"`
+}
+
+type DeviceAuthorizationRequest struct {
+	Scope        string `form:"scope"         json:"scope"`
+	ClientID     string `form:"client_id"     json:"client_id"`
+	ClientSecret string `form:"client_secret" json:"client_secret"`
+}
+
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type QueryDeviceVerification struct {
+	UserCode string `form:"user_code" binding:"required"`
+}
+
+type DeviceVerificationRequest struct {
+	UserCode string `json:"user_code" binding:"required"`
+	Approve  bool   `json:"approve"`
+}
+
+type DeviceVerificationResponse struct {
+	ClientID   string   `json:"client_id"`
+	ClientName string   `json:"client_name"`
+	Scopes     []string `json:"scopes"`
+	Status     string   `json:"status"`
+}
+
+type TokenIntrospectionRequest struct {
+	Token         string `form:"token"           json:"token"           binding:"required"`
+	TokenTypeHint string `form:"token_type_hint" json:"token_type_hint"`
+	ClientID      string `form:"client_id"       json:"client_id"`
+	ClientSecret  string `form:"client_secret"   json:"client_secret"`
+}
+
+type TokenIntrospectionResponse struct {
+	Active           bool   `json:"active"`
+	Scope            string `json:"scope,omitempty"`
+	ClientID         string `json:"client_id,omitempty"`
+	Username         string `json:"username,omitempty"`
+	TokenType        string `json:"token_type,omitempty"`
+	Exp              int64  `json:"exp,omitempty"`
+	Iat              int64  `json:"iat,omitempty"`
+	Sub              string `json:"sub,omitempty"`
+	Aud              string `json:"aud,omitempty"`
+	Iss              string `json:"iss,omitempty"`
+	Jti              string `json:"jti,omitempty"`
+	SessionID        string `json:"sid,omitempty"`
+	SessionExpiresAt int64  `json:"session_expires_at,omitempty"`
+
+	Act *ActorClaim `json:"act,omitempty"`
+}
+
+type TokenRevocationRequest struct {
+	Token         string `form:"token"           json:"token"           binding:"required"`
+	TokenTypeHint string `form:"token_type_hint" json:"token_type_hint"`
+	ClientID      string `form:"client_id"       json:"client_id"`
+	ClientSecret  string `form:"client_secret"   json:"client_secret"`
+}
+
+type OpenIDConfigurationResponse struct {
+	Issuer                             string   `json:"issuer"`
+	AuthorizationEndpoint              string   `json:"authorization_endpoint"`
+	TokenEndpoint                      string   `json:"token_endpoint"`
+	UserinfoEndpoint                   string   `json:"userinfo_endpoint"`
+	JwksURI                            string   `json:"jwks_uri"`
+	IntrospectionEndpoint              string   `json:"introspection_endpoint"`
+	RevocationEndpoint                 string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint        string   `json:"device_authorization_endpoint"`
+	EndSessionEndpoint                 string   `json:"end_session_endpoint"`
+	RegistrationEndpoint               string   `json:"registration_endpoint,omitempty"`
+	ScopesSupported                    []string `json:"scopes_supported"`
+	ResponseTypesSupported             []string `json:"response_types_supported"`
+	GrantTypesSupported                []string `json:"grant_types_supported"`
+	SubjectTypesSupported              []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported   []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported  []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported      []string `json:"code_challenge_methods_supported"`
+	BackchannelLogoutSupported         bool     `json:"backchannel_logout_supported"`
+	BackchannelLogoutSessionSupported  bool     `json:"backchannel_logout_session_supported"`
+	FrontchannelLogoutSupported        bool     `json:"frontchannel_logout_supported"`
+	FrontchannelLogoutSessionSupported bool     `json:"frontchannel_logout_session_supported"`
+	ClaimsSupported                    []string `json:"claims_supported"`
+}
+
+type JsonWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JwksResponse struct {
+	Keys []JsonWebKey `json:"keys"`
+}
+
+type EndSessionRequest struct {
+	IDTokenHint           string `form:"id_token_hint"            json:"id_token_hint"`
+	ClientID              string `form:"client_id"                json:"client_id"`
+	PostLogoutRedirectURI string `form:"post_logout_redirect_uri" json:"post_logout_redirect_uri"`
+	State                 string `form:"state"                    json:"state"`
+}
+
+type EndSessionResponse struct {
+	RedirectTo             string   `json:"redirect_to,omitempty"`
+	FrontchannelLogoutURIs []string `json:"frontchannel_logout_uris"`
+}
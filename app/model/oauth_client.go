@@ -0,0 +1,97 @@
+package model
+
+import "time"
+
+type QueryOAuthClient struct {
+	QueryPagination
+	Keyword    *string `form:"keyword"`
+	ClientType *string `form:"client_type"`
+}
+
+type CreateOAuthClientRequest struct {
+	Name                   string   `json:"name"                     binding:"required"`
+	ClientType             string   `json:"client_type"              binding:"required,oneof=public confidential"`
+	RedirectURIs           []string `json:"redirect_uris"`
+	GrantTypes             []string `json:"grant_types"              binding:"required,min=1"`
+	Scopes                 []string `json:"scopes"`
+	LogoURI                string   `json:"logo_uri"`
+	TokenExpiresIn         string   `json:"token_expires_in"`
+	RefreshTokenExpiresIn  string   `json:"refresh_token_expires_in"`
+	TokenExchangeAudiences []string `json:"token_exchange_audiences"`
+	BackchannelLogoutURI   string   `json:"backchannel_logout_uri"`
+	FrontchannelLogoutURI  string   `json:"frontchannel_logout_uri"`
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris"`
+}
+
+type UpdateOAuthClientRequest struct {
+	Name                   *string   `json:"name"`
+	RedirectURIs           *[]string `json:"redirect_uris"`
+	GrantTypes             *[]string `json:"grant_types"`
+	Scopes                 *[]string `json:"scopes"`
+	LogoURI                *string   `json:"logo_uri"`
+	TokenExpiresIn         *string   `json:"token_expires_in"`
+	RefreshTokenExpiresIn  *string   `json:"refresh_token_expires_in"`
+	TokenExchangeAudiences *[]string `json:"token_exchange_audiences"`
+	BackchannelLogoutURI   *string   `json:"backchannel_logout_uri"`
+	FrontchannelLogoutURI  *string   `json:"frontchannel_logout_uri"`
+	PostLogoutRedirectURIs *[]string `json:"post_logout_redirect_uris"`
+}
+
+type OAuthClientResponse struct {
+	ID                     string    `json:"id"`
+	ClientID               string    `json:"client_id"`
+	Name                   string    `json:"name"`
+	ClientType             string    `json:"client_type"`
+	RedirectURIs           []string  `json:"redirect_uris"`
+	GrantTypes             []string  `json:"grant_types"`
+	Scopes                 []string  `json:"scopes"`
+	LogoURI                string    `json:"logo_uri"`
+	TokenExpiresIn         string    `json:"token_expires_in"`
+	RefreshTokenExpiresIn  string    `json:"refresh_token_expires_in"`
+	TokenExchangeAudiences []string  `json:"token_exchange_audiences"`
+	BackchannelLogoutURI   string    `json:"backchannel_logout_uri"`
+	FrontchannelLogoutURI  string    `json:"frontchannel_logout_uri"`
+	PostLogoutRedirectURIs []string  `json:"post_logout_redirect_uris"`
+	CreatedAt              time.Time `json:"created_at"`
+}
+
+type OAuthClientSecretResponse struct {
+	OAuthClientResponse
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+type OAuthClientPageResponse struct {
+	Meta MetaPagination        `json:"meta"`
+	Data []OAuthClientResponse `json:"data"`
+}
+
+// ClientRegistrationRequest is the RFC 7591 client metadata document.
+type ClientRegistrationRequest struct {
+	RedirectURIs            []string `json:"redirect_uris"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+	ClientName              string   `json:"client_name"`
+	LogoURI                 string   `json:"logo_uri"`
+	Scope                   string   `json:"scope"`
+	BackchannelLogoutURI    string   `json:"backchannel_logout_uri"`
+	FrontchannelLogoutURI   string   `json:"frontchannel_logout_uri"`
+	PostLogoutRedirectURIs  []string `json:"post_logout_redirect_uris"`
+}
+
+type ClientRegistrationResponse struct {
+	ClientID                string   `json:"client_id"`
+	ClientSecret            string   `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64    `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   *int64   `json:"client_secret_expires_at,omitempty"`
+	RedirectURIs            []string `json:"redirect_uris"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+	ClientName              string   `json:"client_name"`
+	LogoURI                 string   `json:"logo_uri,omitempty"`
+	Scope                   string   `json:"scope"`
+	BackchannelLogoutURI    string   `json:"backchannel_logout_uri,omitempty"`
+	FrontchannelLogoutURI   string   `json:"frontchannel_logout_uri,omitempty"`
+	PostLogoutRedirectURIs  []string `json:"post_logout_redirect_uris,omitempty"`
+}
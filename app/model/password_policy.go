@@ -0,0 +1,23 @@
+package model
+
+type PasswordPolicy struct {
+	MinLength        int      `json:"min_length"`
+	MaxLength        int      `json:"max_length"`
+	MaxBytes         int      `json:"max_bytes,omitempty"`
+	RequireLowercase bool     `json:"require_lowercase"`
+	RequireUppercase bool     `json:"require_uppercase"`
+	RequireDigit     bool     `json:"require_digit"`
+	RequireSymbol    bool     `json:"require_symbol"`
+	MaxRepeated      int      `json:"max_repeated"`
+	MinEntropy       float64  `json:"min_entropy"`
+	ForbiddenWords   []string `json:"forbidden_words"`
+	ForbidUserInfo   bool     `json:"forbid_user_info"`
+	RejectBreached   bool     `json:"reject_breached"`
+	History          int      `json:"history"`
+	MaxAgeDays       int      `json:"max_age_days"`
+}
+
+type PasswordPolicyViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
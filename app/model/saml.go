@@ -0,0 +1,128 @@
+package model
+
+import "time"
+
+type QuerySamlConnection struct {
+	QueryPagination
+	Keyword      *string `form:"keyword"`
+	DisabledFlag *bool   `form:"disabled_flag"`
+}
+
+type CreateSamlConnectionRequest struct {
+	Slug             string            `json:"slug"              binding:"required,alphanum,lowercase"`
+	Name             string            `json:"name"              binding:"required"`
+	IdPMetadataXML   string            `json:"idp_metadata_xml"`
+	IdPMetadataURL   string            `json:"idp_metadata_url"`
+	AcsURL           string            `json:"acs_url"           binding:"required"`
+	NameIDFormat     string            `json:"name_id_format"    binding:"omitempty,oneof=email persistent unspecified"`
+	AttributeMapping map[string]string `json:"attribute_mapping"`
+	AllowSignUp      bool              `json:"allow_sign_up"`
+	LinkByEmail      bool              `json:"link_by_email"`
+	EmailDomains     []string          `json:"email_domains"`
+}
+
+type UpdateSamlConnectionRequest struct {
+	Name             *string            `json:"name"`
+	IdPMetadataXML   *string            `json:"idp_metadata_xml"`
+	IdPMetadataURL   *string            `json:"idp_metadata_url"`
+	AcsURL           *string            `json:"acs_url"`
+	NameIDFormat     *string            `json:"name_id_format"    binding:"omitempty,oneof=email persistent unspecified"`
+	AttributeMapping *map[string]string `json:"attribute_mapping"`
+	AllowSignUp      *bool              `json:"allow_sign_up"`
+	LinkByEmail      *bool              `json:"link_by_email"`
+	EmailDomains     *[]string          `json:"email_domains"`
+	DisabledFlag     *bool              `json:"disabled_flag"`
+}
+
+type SamlConnectionResponse struct {
+	ID               string            `json:"id"`
+	Slug             string            `json:"slug"`
+	Name             string            `json:"name"`
+	IdPEntityID      string            `json:"idp_entity_id"`
+	AcsURL           string            `json:"acs_url"`
+	SpEntityID       string            `json:"sp_entity_id"`
+	NameIDFormat     string            `json:"name_id_format"`
+	AttributeMapping map[string]string `json:"attribute_mapping"`
+	AllowSignUp      bool              `json:"allow_sign_up"`
+	LinkByEmail      bool              `json:"link_by_email"`
+	EmailDomains     []string          `json:"email_domains"`
+	DisabledFlag     bool              `json:"disabled_flag"`
+	CreatedAt        time.Time         `json:"created_at"`
+}
+
+type SamlConnectionPageResponse struct {
+	Meta MetaPagination           `json:"meta"`
+	Data []SamlConnectionResponse `json:"data"`
+}
+
+type SamlLoginResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+// SamlAcsRequest is the HTTP-POST binding form the UI forwards from the IdP.
+type SamlAcsRequest struct {
+	SAMLResponse string `form:"SAMLResponse" json:"saml_response" binding:"required"`
+	RelayState   string `form:"RelayState"   json:"relay_state"   binding:"required"`
+}
+
+type QuerySamlServiceProvider struct {
+	QueryPagination
+	Keyword      *string `form:"keyword"`
+	DisabledFlag *bool   `form:"disabled_flag"`
+}
+
+type CreateSamlServiceProviderRequest struct {
+	Name             string            `json:"name"               binding:"required"`
+	MetadataXML      string            `json:"metadata_xml"`
+	MetadataURL      string            `json:"metadata_url"`
+	EntityID         string            `json:"entity_id"`
+	AcsURL           string            `json:"acs_url"`
+	NameIDFormat     string            `json:"name_id_format"     binding:"omitempty,oneof=email persistent unspecified"`
+	NameIDField      string            `json:"name_id_field"      binding:"omitempty,oneof=id email username"`
+	AttributeMapping map[string]string `json:"attribute_mapping"`
+}
+
+type UpdateSamlServiceProviderRequest struct {
+	Name             *string            `json:"name"`
+	MetadataXML      *string            `json:"metadata_xml"`
+	MetadataURL      *string            `json:"metadata_url"`
+	EntityID         *string            `json:"entity_id"`
+	AcsURL           *string            `json:"acs_url"`
+	NameIDFormat     *string            `json:"name_id_format"     binding:"omitempty,oneof=email persistent unspecified"`
+	NameIDField      *string            `json:"name_id_field"      binding:"omitempty,oneof=id email username"`
+	AttributeMapping *map[string]string `json:"attribute_mapping"`
+	DisabledFlag     *bool              `json:"disabled_flag"`
+}
+
+type SamlServiceProviderResponse struct {
+	ID               string            `json:"id"`
+	Name             string            `json:"name"`
+	EntityID         string            `json:"entity_id"`
+	AcsURLs          []string          `json:"acs_urls"`
+	NameIDFormat     string            `json:"name_id_format"`
+	NameIDField      string            `json:"name_id_field"`
+	AttributeMapping map[string]string `json:"attribute_mapping"`
+	DisabledFlag     bool              `json:"disabled_flag"`
+	CreatedAt        time.Time         `json:"created_at"`
+}
+
+type SamlServiceProviderPageResponse struct {
+	Meta MetaPagination                `json:"meta"`
+	Data []SamlServiceProviderResponse `json:"data"`
+}
+
+// SamlSsoRequest carries the AuthnRequest the UI received from a service
+// provider, or the service provider to start an IdP-initiated sign in for.
+type SamlSsoRequest struct {
+	SAMLRequest       string `form:"SAMLRequest"         json:"saml_request"`
+	RelayState        string `form:"RelayState"          json:"relay_state"`
+	ServiceProviderID string `form:"service_provider_id" json:"service_provider_id"`
+}
+
+// SamlSsoResponse is the HTTP-POST binding form the UI submits to the
+// service provider.
+type SamlSsoResponse struct {
+	AcsURL       string `json:"acs_url"`
+	SAMLResponse string `json:"saml_response"`
+	RelayState   string `json:"relay_state"`
+}
@@ -0,0 +1,56 @@
+package model
+
+import "time"
+
+type QueryServiceAccount struct {
+	QueryPagination
+	Keyword *string `form:"keyword"`
+}
+
+type CreateServiceAccountRequest struct {
+	Name        string `json:"name"        binding:"required"`
+	Description string `json:"description"`
+	Role        string `json:"role"        binding:"required"`
+	PublicKey   string `json:"public_key"`
+}
+
+type UpdateServiceAccountRequest struct {
+	Description  *string `json:"description"`
+	Role         *string `json:"role"`
+	PublicKey    *string `json:"public_key"`
+	DisabledFlag *bool   `json:"disabled_flag"`
+}
+
+type ServiceAccountTokenRequest struct {
+	ClientID            string `json:"client_id"             form:"client_id"             binding:"required"`
+	ClientSecret        string `json:"client_secret"         form:"client_secret"`
+	ClientAssertionType string `json:"client_assertion_type" form:"client_assertion_type"`
+	ClientAssertion     string `json:"client_assertion"      form:"client_assertion"`
+}
+
+type ServiceAccountResponse struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Role         string    `json:"role"`
+	ClientID     string    `json:"client_id"`
+	PublicKey    string    `json:"public_key"`
+	DisabledFlag bool      `json:"disabled_flag"`
+	LastAccessAt time.Time `json:"last_access_at"`
+}
+
+type ServiceAccountSecretResponse struct {
+	ServiceAccountResponse
+	ClientSecret string `json:"client_secret"`
+}
+
+type ServiceAccountPageResponse struct {
+	Meta MetaPagination           `json:"meta"`
+	Data []ServiceAccountResponse `json:"data"`
+}
+
+type AccessTokenResponse struct {
+	TokenType      string    `json:"token_type"`
+	AccessToken    string    `json:"access_token"`
+	TokenExpiresAt time.Time `json:"token_expires_at"`
+}
@@ -16,10 +16,17 @@ type LogoutRequest struct {
 	IsAll        bool   `json:"is_all"`
 }
 
+type LogoutResponse struct {
+	FrontchannelLogoutURIs []string `json:"frontchannel_logout_uris"`
+}
+
 type TokenResponse struct {
 	TokenType             string    `json:"token_type"`
 	AccessToken           string    `json:"access_token"`
 	TokenExpiresAt        time.Time `json:"token_expires_at"`
 	RefreshToken          string    `json:"refresh_token"`
 	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	MfaRequired           bool      `json:"mfa_required,omitempty"`
+	MfaToken              string    `json:"mfa_token,omitempty"`
+	PasswordExpired       bool      `json:"password_expired,omitempty"`
 }
@@ -0,0 +1,18 @@
+package model
+
+type SmsOtpRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required"`
+}
+
+type VerifySmsOtpRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required"`
+	Code        string `json:"code"         binding:"required,len=6,numeric"`
+}
+
+type UpdatePhoneRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required"`
+}
+
+type VerifyPhoneRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
@@ -9,7 +9,7 @@ type QueryUser struct {
 type CreateUserRequest struct {
 	Email       string `json:"email"        binding:"required,email"`
 	Username    string `json:"username"     binding:"required,min=1"`
-	Password    string `json:"password"     binding:"required,password"`
+	Password    string `json:"password"     binding:"required"`
 	DisplayName string `json:"display_name" binding:"required"`
 	FirstName   string `json:"first_name"   binding:"required"`
 	LastName    string `json:"last_name"    binding:"required"`
@@ -22,8 +22,8 @@ type UpdateUserRequest struct {
 }
 
 type ChangePasswordRequest struct {
-	OldPassword string `json:"old_password" binding:"required,password"`
-	NewPassword string `json:"new_password" binding:"required,password"`
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
 }
 
 type ForgotPasswordRequest struct {
@@ -32,17 +32,23 @@ type ForgotPasswordRequest struct {
 
 type ResetPasswordRequest struct {
 	Ticket   string `json:"ticket"`
-	Password string `json:"password" binding:"required,password"`
+	Password string `json:"password" binding:"required"`
 }
 
 type UserResponse struct {
-	ID          string `json:"id"`
-	Username    string `json:"username"`
-	Email       string `json:"email"`
-	DisplayName string `json:"display_name"`
-	FirstName   string `json:"first_name"`
-	LastName    string `json:"last_name"`
-	VerifyFlag  bool   `json:"verify_flag"`
+	ID              string `json:"id"`
+	Username        string `json:"username"`
+	Email           string `json:"email"`
+	DisplayName     string `json:"display_name"`
+	FirstName       string `json:"first_name"`
+	LastName        string `json:"last_name"`
+	VerifyFlag      bool   `json:"verify_flag"`
+	EmailMfaFlag    bool   `json:"email_mfa_flag"`
+	PhoneNumber     string `json:"phone_number"`
+	PhoneVerifyFlag bool   `json:"phone_verify_flag"`
+
+	UsernameConflictFlag bool `json:"username_conflict_flag"`
+	EmailConflictFlag    bool `json:"email_conflict_flag"`
 }
 
 type UserPageResponse struct {
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ClientAssertion records the jti of a consumed private_key_jwt assertion
+// until it expires so the same assertion cannot be replayed.
+type ClientAssertion struct {
+	gorm.Model
+	ID        string    `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	ClientID  string    `gorm:"uniqueIndex:idx_client_assertion_client_id_jti"`
+	JTI       string    `gorm:"uniqueIndex:idx_client_assertion_client_id_jti"`
+	ExpiresAt time.Time `gorm:"index:idx_client_assertion_expires_at"`
+}
+
+type ClientAssertionRepository interface {
+	Create(assertion *ClientAssertion) error
+}
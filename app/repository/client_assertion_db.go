@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+type clientAssertionRepository struct {
+	db *gorm.DB
+}
+
+func NewClientAssertionRepository(db *gorm.DB) ClientAssertionRepository {
+	return clientAssertionRepository{db}
+}
+
+// Create fails with gorm.ErrDuplicatedKey when the assertion was already used.
+func (r clientAssertionRepository) Create(assertion *ClientAssertion) error {
+	tx := r.db.Create(&assertion)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
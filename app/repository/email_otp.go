@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type EmailOtp struct {
+	gorm.Model
+	ID           string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	UserID       string `gorm:"index:idx_email_otp_user_id"`
+	Purpose      string
+	CodeHash     string
+	MfaTokenHash string `gorm:"index:idx_email_otp_mfa_token_hash"`
+	Attempts     int
+	UsedFlag     bool `gorm:"default:false"`
+	ExpiresAt    time.Time
+}
+
+type EmailOtpRepository interface {
+	Create(emailOtp *EmailOtp) error
+	GetLatest(userId string, purpose string) (*EmailOtp, error)
+	GetByMfaTokenHash(mfaTokenHash string) (*EmailOtp, error)
+	CountSince(userId string, since time.Time) (int, error)
+	IncrementAttempts(id string, maxAttempts int) error
+	MarkUsed(id string) error
+	DeleteByUserIdBefore(userId string, before time.Time) error
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type emailOtpRepository struct {
+	db *gorm.DB
+}
+
+func NewEmailOtpRepository(db *gorm.DB) EmailOtpRepository {
+	return emailOtpRepository{db}
+}
+
+func (r emailOtpRepository) Create(emailOtp *EmailOtp) error {
+	tx := r.db.Create(&emailOtp)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+// GetLatest returns the newest usable code, sending a new code replaces the
+// older ones.
+func (r emailOtpRepository) GetLatest(userId string, purpose string) (*EmailOtp, error) {
+	var emailOtp EmailOtp
+	tx := r.db.Where("user_id = ? AND purpose = ?", userId, purpose).
+		Order("created_at DESC").
+		Take(&emailOtp)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if emailOtp.UsedFlag || emailOtp.ExpiresAt.Before(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &emailOtp, nil
+}
+
+func (r emailOtpRepository) GetByMfaTokenHash(mfaTokenHash string) (*EmailOtp, error) {
+	var emailOtp EmailOtp
+	tx := r.db.Where(
+		"mfa_token_hash = ? AND used_flag = ? AND expires_at > ?",
+		mfaTokenHash,
+		false,
+		time.Now(),
+	).Take(&emailOtp)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &emailOtp, nil
+}
+
+func (r emailOtpRepository) CountSince(userId string, since time.Time) (int, error) {
+	var total int64
+	tx := r.db.Model(&EmailOtp{}).Where("user_id = ? AND created_at > ?", userId, since).Count(&total)
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+	return int(total), nil
+}
+
+// IncrementAttempts uses up one attempt and returns gorm.ErrRecordNotFound
+// once there are none left, so parallel guesses cannot exceed the limit.
+func (r emailOtpRepository) IncrementAttempts(id string, maxAttempts int) error {
+	tx := r.db.Model(&EmailOtp{}).
+		Where("id = ? AND attempts < ?", id, maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// MarkUsed returns gorm.ErrRecordNotFound when the code was already used, so
+// concurrent requests cannot both redeem it.
+func (r emailOtpRepository) MarkUsed(id string) error {
+	tx := r.db.Model(&EmailOtp{}).Where("id = ? AND used_flag = ?", id, false).Update("used_flag", true)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r emailOtpRepository) DeleteByUserIdBefore(userId string, before time.Time) error {
+	tx := r.db.Unscoped().Where("user_id = ? AND created_at < ?", userId, before).Delete(&EmailOtp{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
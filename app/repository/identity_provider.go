@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"lazy-auth/app/model"
+
+	"gorm.io/gorm"
+)
+
+// IdentityProvider is an external OpenID Connect or OAuth 2.0 provider users
+// can sign in with. Endpoints are discovered from Issuer unless set
+// explicitly, which is required for plain OAuth 2.0 providers.
+type IdentityProvider struct {
+	gorm.Model
+	ID                    string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	Slug                  string `gorm:"uniqueIndex:idx_identity_provider_slug"`
+	Name                  string
+	Issuer                string
+	ClientID              string
+	ClientSecretEncrypted string
+	Scopes                []string          `gorm:"serializer:json"`
+	ClaimMapping          map[string]string `gorm:"serializer:json"`
+	AuthorizationEndpoint string
+	TokenEndpoint         string
+	UserinfoEndpoint      string
+	JwksURI               string
+	RedirectURI           string
+	AllowSignUp           bool
+	LinkByVerifiedEmail   bool
+	DisabledFlag          bool `gorm:"default:false"`
+}
+
+type IdentityProviderRepository interface {
+	GetMany(query model.QueryIdentityProvider) ([]IdentityProvider, int, error)
+	GetById(id string) (*IdentityProvider, error)
+	GetBySlug(slug string) (*IdentityProvider, error)
+	Create(provider *IdentityProvider) error
+	Update(provider *IdentityProvider) error
+	DeleteById(id string) error
+}
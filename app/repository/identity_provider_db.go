@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"fmt"
+
+	"lazy-auth/app/model"
+
+	"gorm.io/gorm"
+)
+
+type identityProviderRepository struct {
+	db *gorm.DB
+}
+
+func NewIdentityProviderRepository(db *gorm.DB) IdentityProviderRepository {
+	return identityProviderRepository{db}
+}
+
+func (r identityProviderRepository) GetMany(
+	query model.QueryIdentityProvider,
+) ([]IdentityProvider, int, error) {
+	tx := r.db.Model(&IdentityProvider{})
+
+	sortBy := "created_at"
+	if query.SortBy != nil {
+		sortBy = *query.SortBy
+	}
+
+	orderBy := "DESC"
+	if query.OrderBy != nil {
+		orderBy = *query.OrderBy
+	}
+	tx = tx.Order(fmt.Sprintf("%v %v", sortBy, orderBy))
+
+	if query.Keyword != nil {
+		tx = tx.Where(
+			"name ILIKE ? OR slug ILIKE ?",
+			"%"+*query.Keyword+"%",
+			"%"+*query.Keyword+"%",
+		)
+	}
+
+	if query.DisabledFlag != nil {
+		tx = tx.Where("disabled_flag = ?", *query.DisabledFlag)
+	}
+
+	limit := 100
+	if query.Limit != nil {
+		limit = *query.Limit
+	}
+	tx = tx.Limit(limit)
+
+	offset := 0
+	if query.Offset != nil {
+		offset = *query.Offset
+	}
+	tx = tx.Offset(offset)
+
+	var providers []IdentityProvider
+	tx.Find(&providers)
+
+	var total int64
+	tx.Limit(-1).Offset(-1).Count(&total)
+
+	if tx.Error != nil {
+		return nil, int(total), tx.Error
+	}
+	return providers, int(total), nil
+}
+
+func (r identityProviderRepository) GetById(id string) (*IdentityProvider, error) {
+	var provider IdentityProvider
+	tx := r.db.Where("id = ?", id).Take(&provider)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &provider, nil
+}
+
+func (r identityProviderRepository) GetBySlug(slug string) (*IdentityProvider, error) {
+	var provider IdentityProvider
+	tx := r.db.Where("slug = ?", slug).Take(&provider)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &provider, nil
+}
+
+func (r identityProviderRepository) Create(provider *IdentityProvider) error {
+	tx := r.db.Create(&provider)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r identityProviderRepository) Update(provider *IdentityProvider) error {
+	tx := r.db.Save(&provider)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r identityProviderRepository) DeleteById(id string) error {
+	tx := r.db.Where("id = ?", id).Delete(&IdentityProvider{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
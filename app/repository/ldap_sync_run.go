@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"time"
+
+	"lazy-auth/app/model"
+
+	"gorm.io/gorm"
+)
+
+// LdapSyncRun records one directory sync and the changes it found.
+type LdapSyncRun struct {
+	gorm.Model
+	ID          string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	DryRun      bool
+	Trigger     string
+	Status      string
+	Error       string
+	Created     int
+	Updated     int
+	Deactivated int
+	Reactivated int
+	Skipped     int
+	Unchanged   int
+	Changes     []model.LdapSyncChange `gorm:"serializer:json"`
+	StartedAt   time.Time
+	FinishedAt  *time.Time
+}
+
+type LdapSyncRunRepository interface {
+	GetMany(query model.QueryLdapSyncRun) ([]LdapSyncRun, int, error)
+	GetById(id string) (*LdapSyncRun, error)
+	GetLatest() (*LdapSyncRun, error)
+	Create(run *LdapSyncRun) error
+	Update(run *LdapSyncRun) error
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"fmt"
+
+	"lazy-auth/app/model"
+
+	"gorm.io/gorm"
+)
+
+type ldapSyncRunRepository struct {
+	db *gorm.DB
+}
+
+func NewLdapSyncRunRepository(db *gorm.DB) LdapSyncRunRepository {
+	return ldapSyncRunRepository{db}
+}
+
+func (r ldapSyncRunRepository) GetMany(query model.QueryLdapSyncRun) ([]LdapSyncRun, int, error) {
+	// The change lists are only returned for a single run.
+	tx := r.db.Model(&LdapSyncRun{}).Omit("changes")
+
+	sortBy := "created_at"
+	if query.SortBy != nil {
+		sortBy = *query.SortBy
+	}
+
+	orderBy := "DESC"
+	if query.OrderBy != nil {
+		orderBy = *query.OrderBy
+	}
+	tx = tx.Order(fmt.Sprintf("%v %v", sortBy, orderBy))
+
+	if query.DryRun != nil {
+		tx = tx.Where("dry_run = ?", *query.DryRun)
+	}
+
+	if query.Status != nil {
+		tx = tx.Where("status = ?", *query.Status)
+	}
+
+	limit := 100
+	if query.Limit != nil {
+		limit = *query.Limit
+	}
+	tx = tx.Limit(limit)
+
+	offset := 0
+	if query.Offset != nil {
+		offset = *query.Offset
+	}
+	tx = tx.Offset(offset)
+
+	var runs []LdapSyncRun
+	tx.Find(&runs)
+
+	var total int64
+	tx.Limit(-1).Offset(-1).Count(&total)
+
+	if tx.Error != nil {
+		return nil, int(total), tx.Error
+	}
+	return runs, int(total), nil
+}
+
+func (r ldapSyncRunRepository) GetById(id string) (*LdapSyncRun, error) {
+	var run LdapSyncRun
+	tx := r.db.Where("id = ?", id).Take(&run)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &run, nil
+}
+
+func (r ldapSyncRunRepository) GetLatest() (*LdapSyncRun, error) {
+	var run LdapSyncRun
+	tx := r.db.Omit("changes").Order("created_at DESC").Take(&run)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &run, nil
+}
+
+func (r ldapSyncRunRepository) Create(run *LdapSyncRun) error {
+	tx := r.db.Create(&run)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r ldapSyncRunRepository) Update(run *LdapSyncRun) error {
+	tx := r.db.Save(&run)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
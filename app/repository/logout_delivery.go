@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LogoutDelivery is a pending OIDC back-channel logout notification.
+type LogoutDelivery struct {
+	gorm.Model
+	ID            string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	ClientID      string
+	URI           string
+	LogoutToken   string
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index:idx_logout_delivery_next_attempt_at"`
+	DeliveredAt   *time.Time
+	LastError     string
+}
+
+type LogoutDeliveryRepository interface {
+	Create(delivery *LogoutDelivery) error
+	ClaimDue(maxAttempts int, limit int, leaseUntil time.Time) ([]LogoutDelivery, error)
+	Update(delivery *LogoutDelivery) error
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type logoutDeliveryRepository struct {
+	db *gorm.DB
+}
+
+func NewLogoutDeliveryRepository(db *gorm.DB) LogoutDeliveryRepository {
+	return logoutDeliveryRepository{db}
+}
+
+func (r logoutDeliveryRepository) Create(delivery *LogoutDelivery) error {
+	tx := r.db.Create(&delivery)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+// ClaimDue locks due deliveries, skipping rows another instance has locked,
+// and pushes their next attempt to leaseUntil before returning them. Other
+// instances only pick them up again when the claiming instance did not
+// finish before the lease ran out.
+func (r logoutDeliveryRepository) ClaimDue(
+	maxAttempts int,
+	limit int,
+	leaseUntil time.Time,
+) ([]LogoutDelivery, error) {
+	var deliveries []LogoutDelivery
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("delivered_at IS NULL AND attempts < ? AND next_attempt_at <= ?", maxAttempts, time.Now()).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&deliveries).Error
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		var ids []string
+		for i := range deliveries {
+			ids = append(ids, deliveries[i].ID)
+			deliveries[i].NextAttemptAt = leaseUntil
+		}
+		return tx.Model(&LogoutDelivery{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", leaseUntil).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (r logoutDeliveryRepository) Update(delivery *LogoutDelivery) error {
+	tx := r.db.Save(&delivery)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type MagicLink struct {
+	gorm.Model
+	ID          string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	UserID      string `gorm:"index:idx_magic_link_user_id"`
+	TokenHash   string `gorm:"uniqueIndex:idx_magic_link_token_hash"`
+	BindingHash string
+	ExpiresAt   time.Time
+}
+
+type MagicLinkRepository interface {
+	Create(magicLink *MagicLink) error
+	GetByTokenHash(tokenHash string) (*MagicLink, error)
+	DeleteById(id string) error
+	DeleteByUserId(userId string) error
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type magicLinkRepository struct {
+	db *gorm.DB
+}
+
+func NewMagicLinkRepository(db *gorm.DB) MagicLinkRepository {
+	return magicLinkRepository{db}
+}
+
+func (r magicLinkRepository) Create(magicLink *MagicLink) error {
+	tx := r.db.Create(&magicLink)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r magicLinkRepository) GetByTokenHash(tokenHash string) (*MagicLink, error) {
+	var magicLink MagicLink
+	tx := r.db.Where("token_hash = ? AND expires_at > ?", tokenHash, time.Now()).Take(&magicLink)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &magicLink, nil
+}
+
+// DeleteById returns gorm.ErrRecordNotFound when the link was already
+// deleted, so concurrent consumers cannot both use it.
+func (r magicLinkRepository) DeleteById(id string) error {
+	tx := r.db.Unscoped().Where("id = ?", id).Delete(&MagicLink{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r magicLinkRepository) DeleteByUserId(userId string) error {
+	tx := r.db.Unscoped().Where("user_id = ?", userId).Delete(&MagicLink{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"lazy-auth/app/model"
+
+	"gorm.io/gorm"
+)
+
+type OAuthClient struct {
+	gorm.Model
+	ID                    string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	ClientID              string `gorm:"uniqueIndex:idx_oauth_client_client_id"`
+	ClientSecretHash      string
+	Name                  string
+	ClientType            string
+	RedirectURIs          []string `gorm:"serializer:json"`
+	GrantTypes            []string `gorm:"serializer:json"`
+	Scopes                []string `gorm:"serializer:json"`
+	LogoURI               string
+	TokenExpiresIn        string
+	RefreshTokenExpiresIn string
+
+	BackchannelLogoutURI   string
+	FrontchannelLogoutURI  string
+	PostLogoutRedirectURIs []string `gorm:"serializer:json"`
+
+	// TokenExchangeAudiences lists the audiences this client may request when
+	// exchanging a user's token (RFC 8693).
+	TokenExchangeAudiences []string `gorm:"serializer:json"`
+}
+
+type OAuthClientRepository interface {
+	GetMany(query model.QueryOAuthClient) ([]OAuthClient, int, error)
+	GetById(id string) (*OAuthClient, error)
+	GetByClientId(clientId string) (*OAuthClient, error)
+	Create(client *OAuthClient) error
+	Update(client *OAuthClient) error
+	DeleteById(id string) error
+}
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"fmt"
+
+	"lazy-auth/app/model"
+
+	"gorm.io/gorm"
+)
+
+type oauthClientRepository struct {
+	db *gorm.DB
+}
+
+func NewOAuthClientRepository(db *gorm.DB) OAuthClientRepository {
+	return oauthClientRepository{db}
+}
+
+func (r oauthClientRepository) GetMany(query model.QueryOAuthClient) ([]OAuthClient, int, error) {
+	tx := r.db.Model(&OAuthClient{})
+
+	sortBy := "created_at"
+	if query.SortBy != nil {
+		sortBy = *query.SortBy
+	}
+
+	orderBy := "DESC"
+	if query.OrderBy != nil {
+		orderBy = *query.OrderBy
+	}
+	tx = tx.Order(fmt.Sprintf("%v %v", sortBy, orderBy))
+
+	if query.Keyword != nil {
+		tx = tx.Where(
+			"name ILIKE ? OR client_id ILIKE ?",
+			"%"+*query.Keyword+"%",
+			"%"+*query.Keyword+"%",
+		)
+	}
+
+	if query.ClientType != nil {
+		tx = tx.Where("client_type = ?", *query.ClientType)
+	}
+
+	limit := 100
+	if query.Limit != nil {
+		limit = *query.Limit
+	}
+	tx = tx.Limit(limit)
+
+	offset := 0
+	if query.Offset != nil {
+		offset = *query.Offset
+	}
+	tx = tx.Offset(offset)
+
+	var clients []OAuthClient
+	tx.Find(&clients)
+
+	var total int64
+	tx.Limit(-1).Offset(-1).Count(&total)
+
+	if tx.Error != nil {
+		return nil, int(total), tx.Error
+	}
+	return clients, int(total), nil
+}
+
+func (r oauthClientRepository) GetById(id string) (*OAuthClient, error) {
+	var client OAuthClient
+	tx := r.db.Where("id = ?", id).Take(&client)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &client, nil
+}
+
+func (r oauthClientRepository) GetByClientId(clientId string) (*OAuthClient, error) {
+	var client OAuthClient
+	tx := r.db.Where("client_id = ?", clientId).Take(&client)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &client, nil
+}
+
+func (r oauthClientRepository) Create(client *OAuthClient) error {
+	tx := r.db.Create(&client)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r oauthClientRepository) Update(client *OAuthClient) error {
+	tx := r.db.Save(&client)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r oauthClientRepository) DeleteById(id string) error {
+	tx := r.db.Where("id = ?", id).Delete(&OAuthClient{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
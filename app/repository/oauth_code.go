@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type OAuthCode struct {
+	gorm.Model
+	ID                  string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	CodeHash            string `gorm:"uniqueIndex:idx_oauth_code_code_hash"`
+	ClientID            string
+	UserID              string
+	RedirectURI         string
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	SessionID           string
+	AuthTime            time.Time
+	ExpiresAt           time.Time
+}
+
+type OAuthCodeRepository interface {
+	Create(code *OAuthCode) error
+	GetByCodeHash(codeHash string) (*OAuthCode, error)
+	DeleteById(id string) error
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type oauthCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewOAuthCodeRepository(db *gorm.DB) OAuthCodeRepository {
+	return oauthCodeRepository{db}
+}
+
+func (r oauthCodeRepository) Create(code *OAuthCode) error {
+	tx := r.db.Create(&code)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r oauthCodeRepository) GetByCodeHash(codeHash string) (*OAuthCode, error) {
+	var code OAuthCode
+	tx := r.db.Where("code_hash = ? AND expires_at > ?", codeHash, time.Now()).Take(&code)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &code, nil
+}
+
+// DeleteById returns gorm.ErrRecordNotFound when the code was already
+// deleted, so concurrent requests cannot both redeem it.
+func (r oauthCodeRepository) DeleteById(id string) error {
+	tx := r.db.Unscoped().Where("id = ?", id).Delete(&OAuthCode{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
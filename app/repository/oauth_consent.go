@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+type OAuthConsent struct {
+	gorm.Model
+	ID       string   `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	UserID   string   `gorm:"uniqueIndex:idx_oauth_consent_user_client"`
+	ClientID string   `gorm:"uniqueIndex:idx_oauth_consent_user_client"`
+	Scopes   []string `gorm:"serializer:json"`
+}
+
+type OAuthConsentRepository interface {
+	GetByUserAndClient(userId string, clientId string) (*OAuthConsent, error)
+	Save(consent *OAuthConsent) error
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+type oauthConsentRepository struct {
+	db *gorm.DB
+}
+
+func NewOAuthConsentRepository(db *gorm.DB) OAuthConsentRepository {
+	return oauthConsentRepository{db}
+}
+
+func (r oauthConsentRepository) GetByUserAndClient(
+	userId string,
+	clientId string,
+) (*OAuthConsent, error) {
+	var consent OAuthConsent
+	tx := r.db.Where("user_id = ? AND client_id = ?", userId, clientId).Take(&consent)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &consent, nil
+}
+
+func (r oauthConsentRepository) Save(consent *OAuthConsent) error {
+	tx := r.db.Save(&consent)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type OAuthDeviceCode struct {
+	gorm.Model
+	ID             string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	DeviceCodeHash string `gorm:"uniqueIndex:idx_oauth_device_code_device_code_hash"`
+	UserCode       string `gorm:"uniqueIndex:idx_oauth_device_code_user_code"`
+	ClientID       string
+	Scope          string
+	Status         string
+	UserID         string
+	SessionID      string
+	AuthTime       time.Time
+	Interval       int
+	LastPolledAt   time.Time
+	ExpiresAt      time.Time
+}
+
+type OAuthDeviceCodeRepository interface {
+	Create(deviceCode *OAuthDeviceCode) error
+	GetByDeviceCodeHash(deviceCodeHash string) (*OAuthDeviceCode, error)
+	GetByUserCode(userCode string) (*OAuthDeviceCode, error)
+	Update(deviceCode *OAuthDeviceCode) error
+	DeleteById(id string) error
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type oauthDeviceCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewOAuthDeviceCodeRepository(db *gorm.DB) OAuthDeviceCodeRepository {
+	return oauthDeviceCodeRepository{db}
+}
+
+func (r oauthDeviceCodeRepository) Create(deviceCode *OAuthDeviceCode) error {
+	tx := r.db.Create(&deviceCode)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r oauthDeviceCodeRepository) GetByDeviceCodeHash(
+	deviceCodeHash string,
+) (*OAuthDeviceCode, error) {
+	var deviceCode OAuthDeviceCode
+	tx := r.db.Where("device_code_hash = ?", deviceCodeHash).Take(&deviceCode)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &deviceCode, nil
+}
+
+func (r oauthDeviceCodeRepository) GetByUserCode(userCode string) (*OAuthDeviceCode, error) {
+	var deviceCode OAuthDeviceCode
+	tx := r.db.Where("user_code = ? AND expires_at > ?", userCode, time.Now()).Take(&deviceCode)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &deviceCode, nil
+}
+
+func (r oauthDeviceCodeRepository) Update(deviceCode *OAuthDeviceCode) error {
+	tx := r.db.Save(&deviceCode)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+// DeleteById returns gorm.ErrRecordNotFound when the device code was already
+// deleted, so overlapping polls cannot both redeem it.
+func (r oauthDeviceCodeRepository) DeleteById(id string) error {
+	tx := r.db.Unscoped().Where("id = ?", id).Delete(&OAuthDeviceCode{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
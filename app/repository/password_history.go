@@ -0,0 +1,16 @@
+package repository
+
+import "gorm.io/gorm"
+
+type PasswordHistory struct {
+	gorm.Model
+	ID           string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	UserID       string `gorm:"index:idx_password_history_user_id"`
+	PasswordHash string
+}
+
+type PasswordHistoryRepository interface {
+	Create(passwordHistory *PasswordHistory) error
+	GetLatest(userId string, limit int) ([]PasswordHistory, error)
+	DeleteAllButLatest(userId string, keep int) error
+}
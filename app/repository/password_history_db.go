@@ -0,0 +1,43 @@
+package repository
+
+import "gorm.io/gorm"
+
+type passwordHistoryRepository struct {
+	db *gorm.DB
+}
+
+func NewPasswordHistoryRepository(db *gorm.DB) PasswordHistoryRepository {
+	return passwordHistoryRepository{db}
+}
+
+func (r passwordHistoryRepository) Create(passwordHistory *PasswordHistory) error {
+	tx := r.db.Create(&passwordHistory)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r passwordHistoryRepository) GetLatest(userId string, limit int) ([]PasswordHistory, error) {
+	var passwordHistories []PasswordHistory
+	tx := r.db.Where("user_id = ?", userId).Order("created_at DESC").Limit(limit).Find(&passwordHistories)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return passwordHistories, nil
+}
+
+func (r passwordHistoryRepository) DeleteAllButLatest(userId string, keep int) error {
+	latest := r.db.Model(&PasswordHistory{}).
+		Select("id").
+		Where("user_id = ?", userId).
+		Order("created_at DESC").
+		Limit(keep)
+	tx := r.db.Unscoped().
+		Where("user_id = ? AND id NOT IN (?)", userId, latest).
+		Delete(&PasswordHistory{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RevokedToken keeps the id of revoked stateless access tokens until they
+// would have expired anyway.
+type RevokedToken struct {
+	gorm.Model
+	ID        string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	JTI       string `gorm:"uniqueIndex:idx_revoked_token_jti"`
+	ExpiresAt time.Time
+}
+
+type RevokedTokenRepository interface {
+	Create(revokedToken *RevokedToken) error
+	GetByJti(jti string) (*RevokedToken, error)
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type revokedTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewRevokedTokenRepository(db *gorm.DB) RevokedTokenRepository {
+	return revokedTokenRepository{db}
+}
+
+func (r revokedTokenRepository) Create(revokedToken *RevokedToken) error {
+	tx := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&revokedToken)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r revokedTokenRepository) GetByJti(jti string) (*RevokedToken, error) {
+	var revokedToken RevokedToken
+	tx := r.db.Where("jti = ?", jti).Take(&revokedToken)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &revokedToken, nil
+}
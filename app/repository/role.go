@@ -12,6 +12,9 @@ type Role struct {
 	Name        string `gorm:"uniqueIndex:idx_name"`
 	Description string
 	Users       []User
+
+	// ScimTenantID is the SCIM tenant that created the role as a group.
+	ScimTenantID string `gorm:"index:idx_role_scim_tenant_id"`
 }
 
 type RoleRepository interface {
@@ -19,6 +22,7 @@ type RoleRepository interface {
 	GetAll(query model.QueryRole) ([]Role, int, error)
 	GetById(id string) (*Role, error)
 	GetByName(name string) (*Role, error)
+	GetManyByScim(tenantId string, names []string, search model.ScimSearch) ([]Role, int, error)
 	Update(role Role) (*Role, error)
 	DeleteById(id string) error
 }
@@ -86,6 +86,32 @@ func (r roleRepository) GetByName(name string) (*Role, error) {
 	return &role, nil
 }
 
+// GetManyByScim only searches the roles created by the tenant and the roles
+// it may use by name.
+func (r roleRepository) GetManyByScim(
+	tenantId string,
+	names []string,
+	search model.ScimSearch,
+) ([]Role, int, error) {
+	tx := r.db.Model(&Role{}).Where("scim_tenant_id = ? OR name IN ?", tenantId, names)
+	if search.Where != "" {
+		tx = tx.Where(search.Where, search.Args...)
+	}
+
+	tx = tx.Order("created_at ASC").Limit(search.Limit).Offset(search.Offset)
+
+	var roles []Role
+	tx.Find(&roles)
+
+	var total int64
+	tx.Limit(-1).Offset(-1).Count(&total)
+
+	if tx.Error != nil {
+		return nil, int(total), tx.Error
+	}
+	return roles, int(total), nil
+}
+
 func (r roleRepository) Update(role Role) (*Role, error) {
 	tx := r.db.Save(&role)
 	if tx.Error != nil {
@@ -95,7 +121,7 @@ func (r roleRepository) Update(role Role) (*Role, error) {
 }
 
 func (r roleRepository) DeleteById(id string) error {
-	tx := r.db.Delete(&Role{}, id)
+	tx := r.db.Where("id = ?", id).Delete(&Role{})
 	if tx.Error != nil {
 		return tx.Error
 	}
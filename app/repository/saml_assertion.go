@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SamlAssertion records a consumed assertion ID until it expires so the same
+// assertion cannot be replayed.
+type SamlAssertion struct {
+	gorm.Model
+	ID          string    `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	AssertionID string    `gorm:"uniqueIndex:idx_saml_assertion_assertion_id"`
+	ExpiresAt   time.Time `gorm:"index:idx_saml_assertion_expires_at"`
+}
+
+type SamlAssertionRepository interface {
+	Create(assertion *SamlAssertion) error
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+type samlAssertionRepository struct {
+	db *gorm.DB
+}
+
+func NewSamlAssertionRepository(db *gorm.DB) SamlAssertionRepository {
+	return samlAssertionRepository{db}
+}
+
+// Create fails with gorm.ErrDuplicatedKey when the assertion was already used.
+func (r samlAssertionRepository) Create(assertion *SamlAssertion) error {
+	tx := r.db.Create(&assertion)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
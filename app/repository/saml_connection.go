@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"lazy-auth/app/model"
+
+	"gorm.io/gorm"
+)
+
+// SamlConnection is an enterprise SAML identity provider lazy-auth acts as
+// service provider for.
+type SamlConnection struct {
+	gorm.Model
+	ID               string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	Slug             string `gorm:"uniqueIndex:idx_saml_connection_slug"`
+	Name             string
+	IdPEntityID      string
+	IdPMetadataXML   string
+	AcsURL           string
+	NameIDFormat     string
+	AttributeMapping map[string]string `gorm:"serializer:json"`
+	AllowSignUp      bool
+	LinkByEmail      bool
+	EmailDomains     []string `gorm:"serializer:json"`
+	DisabledFlag     bool     `gorm:"default:false"`
+}
+
+type SamlConnectionRepository interface {
+	GetMany(query model.QuerySamlConnection) ([]SamlConnection, int, error)
+	GetById(id string) (*SamlConnection, error)
+	GetBySlug(slug string) (*SamlConnection, error)
+	Create(connection *SamlConnection) error
+	Update(connection *SamlConnection) error
+	DeleteById(id string) error
+}
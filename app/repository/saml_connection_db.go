@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"fmt"
+
+	"lazy-auth/app/model"
+
+	"gorm.io/gorm"
+)
+
+type samlConnectionRepository struct {
+	db *gorm.DB
+}
+
+func NewSamlConnectionRepository(db *gorm.DB) SamlConnectionRepository {
+	return samlConnectionRepository{db}
+}
+
+func (r samlConnectionRepository) GetMany(
+	query model.QuerySamlConnection,
+) ([]SamlConnection, int, error) {
+	tx := r.db.Model(&SamlConnection{})
+
+	sortBy := "created_at"
+	if query.SortBy != nil {
+		sortBy = *query.SortBy
+	}
+
+	orderBy := "DESC"
+	if query.OrderBy != nil {
+		orderBy = *query.OrderBy
+	}
+	tx = tx.Order(fmt.Sprintf("%v %v", sortBy, orderBy))
+
+	if query.Keyword != nil {
+		tx = tx.Where(
+			"name ILIKE ? OR slug ILIKE ?",
+			"%"+*query.Keyword+"%",
+			"%"+*query.Keyword+"%",
+		)
+	}
+
+	if query.DisabledFlag != nil {
+		tx = tx.Where("disabled_flag = ?", *query.DisabledFlag)
+	}
+
+	limit := 100
+	if query.Limit != nil {
+		limit = *query.Limit
+	}
+	tx = tx.Limit(limit)
+
+	offset := 0
+	if query.Offset != nil {
+		offset = *query.Offset
+	}
+	tx = tx.Offset(offset)
+
+	var connections []SamlConnection
+	tx.Find(&connections)
+
+	var total int64
+	tx.Limit(-1).Offset(-1).Count(&total)
+
+	if tx.Error != nil {
+		return nil, int(total), tx.Error
+	}
+	return connections, int(total), nil
+}
+
+func (r samlConnectionRepository) GetById(id string) (*SamlConnection, error) {
+	var connection SamlConnection
+	tx := r.db.Where("id = ?", id).Take(&connection)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &connection, nil
+}
+
+func (r samlConnectionRepository) GetBySlug(slug string) (*SamlConnection, error) {
+	var connection SamlConnection
+	tx := r.db.Where("slug = ?", slug).Take(&connection)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &connection, nil
+}
+
+func (r samlConnectionRepository) Create(connection *SamlConnection) error {
+	tx := r.db.Create(&connection)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r samlConnectionRepository) Update(connection *SamlConnection) error {
+	tx := r.db.Save(&connection)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r samlConnectionRepository) DeleteById(id string) error {
+	tx := r.db.Where("id = ?", id).Delete(&SamlConnection{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
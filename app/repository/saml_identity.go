@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SamlIdentity links a user to the NameID asserted by a SAML connection.
+type SamlIdentity struct {
+	gorm.Model
+	ID           string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	UserID       string `gorm:"index:idx_saml_identity_user_id"`
+	User         User
+	ConnectionID string `gorm:"uniqueIndex:idx_saml_identity_connection_name_id"`
+	Connection   SamlConnection
+	NameID       string `gorm:"uniqueIndex:idx_saml_identity_connection_name_id"`
+	Email        string
+	LastLoginAt  time.Time
+}
+
+type SamlIdentityRepository interface {
+	GetByConnectionAndNameId(connectionId string, nameId string) (*SamlIdentity, error)
+	CountByUserId(userId string) (int, error)
+	Create(identity *SamlIdentity) error
+	Update(identity *SamlIdentity) error
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+type samlIdentityRepository struct {
+	db *gorm.DB
+}
+
+func NewSamlIdentityRepository(db *gorm.DB) SamlIdentityRepository {
+	return samlIdentityRepository{db}
+}
+
+func (r samlIdentityRepository) GetByConnectionAndNameId(
+	connectionId string,
+	nameId string,
+) (*SamlIdentity, error) {
+	var identity SamlIdentity
+	tx := r.db.Where("connection_id = ? AND name_id = ?", connectionId, nameId).Take(&identity)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &identity, nil
+}
+
+func (r samlIdentityRepository) CountByUserId(userId string) (int, error) {
+	var total int64
+	tx := r.db.Model(&SamlIdentity{}).Where("user_id = ?", userId).Count(&total)
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+	return int(total), nil
+}
+
+func (r samlIdentityRepository) Create(identity *SamlIdentity) error {
+	tx := r.db.Create(&identity)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r samlIdentityRepository) Update(identity *SamlIdentity) error {
+	tx := r.db.Save(&identity)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SamlRequest is an outstanding AuthnRequest, its ID doubles as RelayState.
+type SamlRequest struct {
+	gorm.Model
+	ID           string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	RequestID    string `gorm:"uniqueIndex:idx_saml_request_request_id"`
+	ConnectionID string
+	ExpiresAt    time.Time
+}
+
+type SamlRequestRepository interface {
+	GetByRequestId(requestId string) (*SamlRequest, error)
+	Create(request *SamlRequest) error
+	DeleteById(id string) error
+}
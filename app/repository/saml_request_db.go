@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+type samlRequestRepository struct {
+	db *gorm.DB
+}
+
+func NewSamlRequestRepository(db *gorm.DB) SamlRequestRepository {
+	return samlRequestRepository{db}
+}
+
+func (r samlRequestRepository) GetByRequestId(requestId string) (*SamlRequest, error) {
+	var request SamlRequest
+	tx := r.db.Where("request_id = ?", requestId).Take(&request)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &request, nil
+}
+
+func (r samlRequestRepository) Create(request *SamlRequest) error {
+	tx := r.db.Create(&request)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r samlRequestRepository) DeleteById(id string) error {
+	tx := r.db.Unscoped().Where("id = ?", id).Delete(&SamlRequest{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"lazy-auth/app/model"
+
+	"gorm.io/gorm"
+)
+
+// SamlServiceProvider is an application lazy-auth issues SAML assertions to
+// as identity provider.
+type SamlServiceProvider struct {
+	gorm.Model
+	ID               string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	EntityID         string `gorm:"uniqueIndex:idx_saml_service_provider_entity_id"`
+	Name             string
+	MetadataXML      string
+	NameIDFormat     string
+	NameIDField      string
+	AttributeMapping map[string]string `gorm:"serializer:json"`
+	DisabledFlag     bool              `gorm:"default:false"`
+}
+
+type SamlServiceProviderRepository interface {
+	GetMany(query model.QuerySamlServiceProvider) ([]SamlServiceProvider, int, error)
+	GetById(id string) (*SamlServiceProvider, error)
+	GetByEntityId(entityID string) (*SamlServiceProvider, error)
+	Create(serviceProvider *SamlServiceProvider) error
+	Update(serviceProvider *SamlServiceProvider) error
+	DeleteById(id string) error
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"fmt"
+
+	"lazy-auth/app/model"
+
+	"gorm.io/gorm"
+)
+
+type samlServiceProviderRepository struct {
+	db *gorm.DB
+}
+
+func NewSamlServiceProviderRepository(db *gorm.DB) SamlServiceProviderRepository {
+	return samlServiceProviderRepository{db}
+}
+
+func (r samlServiceProviderRepository) GetMany(
+	query model.QuerySamlServiceProvider,
+) ([]SamlServiceProvider, int, error) {
+	tx := r.db.Model(&SamlServiceProvider{})
+
+	sortBy := "created_at"
+	if query.SortBy != nil {
+		sortBy = *query.SortBy
+	}
+
+	orderBy := "DESC"
+	if query.OrderBy != nil {
+		orderBy = *query.OrderBy
+	}
+	tx = tx.Order(fmt.Sprintf("%v %v", sortBy, orderBy))
+
+	if query.Keyword != nil {
+		tx = tx.Where(
+			"name ILIKE ? OR entity_id ILIKE ?",
+			"%"+*query.Keyword+"%",
+			"%"+*query.Keyword+"%",
+		)
+	}
+
+	if query.DisabledFlag != nil {
+		tx = tx.Where("disabled_flag = ?", *query.DisabledFlag)
+	}
+
+	limit := 100
+	if query.Limit != nil {
+		limit = *query.Limit
+	}
+	tx = tx.Limit(limit)
+
+	offset := 0
+	if query.Offset != nil {
+		offset = *query.Offset
+	}
+	tx = tx.Offset(offset)
+
+	var serviceProviders []SamlServiceProvider
+	tx.Find(&serviceProviders)
+
+	var total int64
+	tx.Limit(-1).Offset(-1).Count(&total)
+
+	if tx.Error != nil {
+		return nil, int(total), tx.Error
+	}
+	return serviceProviders, int(total), nil
+}
+
+func (r samlServiceProviderRepository) GetById(id string) (*SamlServiceProvider, error) {
+	var serviceProvider SamlServiceProvider
+	tx := r.db.Where("id = ?", id).Take(&serviceProvider)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &serviceProvider, nil
+}
+
+func (r samlServiceProviderRepository) GetByEntityId(entityID string) (*SamlServiceProvider, error) {
+	var serviceProvider SamlServiceProvider
+	tx := r.db.Where("entity_id = ?", entityID).Take(&serviceProvider)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &serviceProvider, nil
+}
+
+func (r samlServiceProviderRepository) Create(serviceProvider *SamlServiceProvider) error {
+	tx := r.db.Create(&serviceProvider)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r samlServiceProviderRepository) Update(serviceProvider *SamlServiceProvider) error {
+	tx := r.db.Save(&serviceProvider)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r samlServiceProviderRepository) DeleteById(id string) error {
+	tx := r.db.Where("id = ?", id).Delete(&SamlServiceProvider{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"time"
+
+	"lazy-auth/app/model"
+
+	"gorm.io/gorm"
+)
+
+type ScimTenant struct {
+	gorm.Model
+	ID           string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	Name         string `gorm:"uniqueIndex:idx_scim_tenant_name"`
+	Description  string
+	TokenHash    string `gorm:"uniqueIndex:idx_scim_tenant_token_hash"`
+	DisabledFlag bool   `gorm:"default:false"`
+	LastAccessAt time.Time
+
+	// AllowedRoles are existing roles, by name, the tenant may provision
+	// members into besides the groups it created itself.
+	AllowedRoles []string `gorm:"serializer:json"`
+}
+
+type ScimTenantRepository interface {
+	GetMany(query model.QueryScimTenant) ([]ScimTenant, int, error)
+	GetById(id string) (*ScimTenant, error)
+	GetByTokenHash(tokenHash string) (*ScimTenant, error)
+	Create(scimTenant *ScimTenant) error
+	Update(scimTenant *ScimTenant) error
+	DeleteById(id string) error
+}
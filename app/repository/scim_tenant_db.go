@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"fmt"
+
+	"lazy-auth/app/model"
+
+	"gorm.io/gorm"
+)
+
+type scimTenantRepository struct {
+	db *gorm.DB
+}
+
+func NewScimTenantRepository(db *gorm.DB) ScimTenantRepository {
+	return scimTenantRepository{db}
+}
+
+func (r scimTenantRepository) GetMany(query model.QueryScimTenant) ([]ScimTenant, int, error) {
+	tx := r.db.Model(&ScimTenant{})
+
+	sortBy := "created_at"
+	if query.SortBy != nil {
+		sortBy = *query.SortBy
+	}
+
+	orderBy := "DESC"
+	if query.OrderBy != nil {
+		orderBy = *query.OrderBy
+	}
+	tx = tx.Order(fmt.Sprintf("%v %v", sortBy, orderBy))
+
+	if query.Keyword != nil {
+		tx = tx.Where(
+			"name ILIKE ? OR description ILIKE ?",
+			"%"+*query.Keyword+"%",
+			"%"+*query.Keyword+"%",
+		)
+	}
+
+	limit := 100
+	if query.Limit != nil {
+		limit = *query.Limit
+	}
+	tx = tx.Limit(limit)
+
+	offset := 0
+	if query.Offset != nil {
+		offset = *query.Offset
+	}
+	tx = tx.Offset(offset)
+
+	var scimTenants []ScimTenant
+	tx.Find(&scimTenants)
+
+	var total int64
+	tx.Limit(-1).Offset(-1).Count(&total)
+
+	if tx.Error != nil {
+		return nil, int(total), tx.Error
+	}
+	return scimTenants, int(total), nil
+}
+
+func (r scimTenantRepository) GetById(id string) (*ScimTenant, error) {
+	var scimTenant ScimTenant
+	tx := r.db.Where("id = ?", id).Take(&scimTenant)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &scimTenant, nil
+}
+
+func (r scimTenantRepository) GetByTokenHash(tokenHash string) (*ScimTenant, error) {
+	var scimTenant ScimTenant
+	tx := r.db.Where("token_hash = ?", tokenHash).Take(&scimTenant)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &scimTenant, nil
+}
+
+func (r scimTenantRepository) Create(scimTenant *ScimTenant) error {
+	tx := r.db.Create(&scimTenant)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r scimTenantRepository) Update(scimTenant *ScimTenant) error {
+	tx := r.db.Save(&scimTenant)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r scimTenantRepository) DeleteById(id string) error {
+	tx := r.db.Where("id = ?", id).Delete(&ScimTenant{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"time"
+
+	"lazy-auth/app/model"
+
+	"gorm.io/gorm"
+)
+
+type ServiceAccount struct {
+	gorm.Model
+	ID               string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	RoleID           string
+	Role             Role
+	Name             string `gorm:"uniqueIndex:idx_service_account_name"`
+	Description      string
+	ClientID         string `gorm:"uniqueIndex:idx_service_account_client_id"`
+	ClientSecretHash string
+	PublicKey        string
+	DisabledFlag     bool `gorm:"default:false"`
+	LastAccessAt     time.Time
+}
+
+type ServiceAccountRepository interface {
+	GetMany(query model.QueryServiceAccount) ([]ServiceAccount, int, error)
+	GetById(id string) (*ServiceAccount, error)
+	GetByClientId(clientId string) (*ServiceAccount, error)
+	Create(serviceAccount *ServiceAccount) error
+	Update(serviceAccount *ServiceAccount) error
+	DeleteById(id string) error
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"fmt"
+
+	"lazy-auth/app/model"
+
+	"gorm.io/gorm"
+)
+
+type serviceAccountRepository struct {
+	db *gorm.DB
+}
+
+func NewServiceAccountRepository(db *gorm.DB) ServiceAccountRepository {
+	return serviceAccountRepository{db}
+}
+
+func (r serviceAccountRepository) GetMany(
+	query model.QueryServiceAccount,
+) ([]ServiceAccount, int, error) {
+	tx := r.db.Model(&ServiceAccount{}).Preload("Role")
+
+	sortBy := "created_at"
+	if query.SortBy != nil {
+		sortBy = *query.SortBy
+	}
+
+	orderBy := "DESC"
+	if query.OrderBy != nil {
+		orderBy = *query.OrderBy
+	}
+	tx = tx.Order(fmt.Sprintf("%v %v", sortBy, orderBy))
+
+	if query.Keyword != nil {
+		tx = tx.Where(
+			"name ILIKE ? OR description ILIKE ?",
+			"%"+*query.Keyword+"%",
+			"%"+*query.Keyword+"%",
+		)
+	}
+
+	limit := 100
+	if query.Limit != nil {
+		limit = *query.Limit
+	}
+	tx = tx.Limit(limit)
+
+	offset := 0
+	if query.Offset != nil {
+		offset = *query.Offset
+	}
+	tx = tx.Offset(offset)
+
+	var serviceAccounts []ServiceAccount
+	tx.Find(&serviceAccounts)
+
+	var total int64
+	tx.Limit(-1).Offset(-1).Count(&total)
+
+	if tx.Error != nil {
+		return nil, int(total), tx.Error
+	}
+	return serviceAccounts, int(total), nil
+}
+
+func (r serviceAccountRepository) GetById(id string) (*ServiceAccount, error) {
+	var serviceAccount ServiceAccount
+	tx := r.db.Preload("Role").Where("id = ?", id).Take(&serviceAccount)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &serviceAccount, nil
+}
+
+func (r serviceAccountRepository) GetByClientId(clientId string) (*ServiceAccount, error) {
+	var serviceAccount ServiceAccount
+	tx := r.db.Preload("Role").Where("client_id = ?", clientId).Take(&serviceAccount)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &serviceAccount, nil
+}
+
+func (r serviceAccountRepository) Create(serviceAccount *ServiceAccount) error {
+	tx := r.db.Create(&serviceAccount)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r serviceAccountRepository) Update(serviceAccount *ServiceAccount) error {
+	tx := r.db.Save(&serviceAccount)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r serviceAccountRepository) DeleteById(id string) error {
+	tx := r.db.Where("id = ?", id).Delete(&ServiceAccount{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
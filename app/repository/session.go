@@ -13,13 +13,22 @@ type Session struct {
 	User         User
 	RefreshToken string
 	ExpiresAt    time.Time
+	ClientID     string
+	Scope        string
+	AuthTime     time.Time
+
+	// ParentID is the login session an OAuth session was authorized from.
+	ParentID string
 }
 
 type SessionRepository interface {
 	Create(session *Session) error
 	GetById(id string) (*Session, error)
 	GetByRefreshToken(refreshToken string) (*Session, error)
+	GetByUserId(id string) ([]Session, error)
+	GetByParentIds(ids []string) ([]Session, error)
 	Update(session *Session) error
 	DeleteById(id string) error
+	DeleteByIds(ids []string) error
 	DeleteByUserId(id string) error
 }
@@ -40,6 +40,24 @@ func (r sessionRepository) GetByRefreshToken(refreshToken string) (*Session, err
 	return &session, nil
 }
 
+func (r sessionRepository) GetByUserId(id string) ([]Session, error) {
+	var sessions []Session
+	tx := r.db.Where("user_id = ?", id).Find(&sessions)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return sessions, nil
+}
+
+func (r sessionRepository) GetByParentIds(ids []string) ([]Session, error) {
+	var sessions []Session
+	tx := r.db.Where("parent_id IN ?", ids).Find(&sessions)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return sessions, nil
+}
+
 func (r sessionRepository) Update(session *Session) error {
 	tx := r.db.Save(&session)
 	if tx.Error != nil {
@@ -49,7 +67,15 @@ func (r sessionRepository) Update(session *Session) error {
 }
 
 func (r sessionRepository) DeleteById(id string) error {
-	tx := r.db.Delete(&Session{}, id)
+	tx := r.db.Where("id = ?", id).Delete(&Session{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r sessionRepository) DeleteByIds(ids []string) error {
+	tx := r.db.Where("id IN ?", ids).Delete(&Session{})
 	if tx.Error != nil {
 		return tx.Error
 	}
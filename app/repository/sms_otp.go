@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SmsOtp struct {
+	gorm.Model
+	ID          string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	UserID      string `gorm:"index:idx_sms_otp_user_id"`
+	Purpose     string
+	PhoneNumber string
+	CodeHash    string
+	Attempts    int
+	UsedFlag    bool `gorm:"default:false"`
+	ExpiresAt   time.Time
+}
+
+type SmsOtpRepository interface {
+	Create(smsOtp *SmsOtp) error
+	GetLatest(userId string, purpose string) (*SmsOtp, error)
+	CountSince(userId string, since time.Time) (int, error)
+	IncrementAttempts(id string, maxAttempts int) error
+	MarkUsed(id string) error
+	DeleteByUserIdBefore(userId string, before time.Time) error
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type smsOtpRepository struct {
+	db *gorm.DB
+}
+
+func NewSmsOtpRepository(db *gorm.DB) SmsOtpRepository {
+	return smsOtpRepository{db}
+}
+
+func (r smsOtpRepository) Create(smsOtp *SmsOtp) error {
+	tx := r.db.Create(&smsOtp)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+// GetLatest returns the newest usable code, sending a new code replaces the
+// older ones.
+func (r smsOtpRepository) GetLatest(userId string, purpose string) (*SmsOtp, error) {
+	var smsOtp SmsOtp
+	tx := r.db.Where("user_id = ? AND purpose = ?", userId, purpose).
+		Order("created_at DESC").
+		Take(&smsOtp)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if smsOtp.UsedFlag || smsOtp.ExpiresAt.Before(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &smsOtp, nil
+}
+
+func (r smsOtpRepository) CountSince(userId string, since time.Time) (int, error) {
+	var total int64
+	tx := r.db.Model(&SmsOtp{}).Where("user_id = ? AND created_at > ?", userId, since).Count(&total)
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+	return int(total), nil
+}
+
+// IncrementAttempts uses up one attempt and returns gorm.ErrRecordNotFound
+// once there are none left, so parallel guesses cannot exceed the limit.
+func (r smsOtpRepository) IncrementAttempts(id string, maxAttempts int) error {
+	tx := r.db.Model(&SmsOtp{}).
+		Where("id = ? AND attempts < ?", id, maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// MarkUsed returns gorm.ErrRecordNotFound when the code was already used, so
+// concurrent requests cannot both redeem it.
+func (r smsOtpRepository) MarkUsed(id string) error {
+	tx := r.db.Model(&SmsOtp{}).Where("id = ? AND used_flag = ?", id, false).Update("used_flag", true)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r smsOtpRepository) DeleteByUserIdBefore(userId string, before time.Time) error {
+	tx := r.db.Unscoped().Where("user_id = ? AND created_at < ?", userId, before).Delete(&SmsOtp{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
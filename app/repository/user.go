@@ -13,8 +13,8 @@ type User struct {
 	ID               string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
 	RoleID           string
 	Role             Role
-	Username         string `gorm:"uniqueIndex:idx_username"`
-	Email            string `gorm:"uniqueIndex:idx_email"`
+	Username         string
+	Email            string
 	PasswordHash     string
 	DisplayName      string
 	FirstName        string
@@ -24,6 +24,26 @@ type User struct {
 	TicketExpiresAt  time.Time
 	LastAccessAt     time.Time
 	ChangePasswordAt time.Time
+	LdapDN           string `gorm:"index:idx_ldap_dn"`
+	DisabledFlag     bool   `gorm:"default:false"`
+	ScimTenantID     string `gorm:"index:idx_scim_tenant_id"`
+	ScimExternalID   string
+	EmailMfaFlag     bool   `gorm:"default:false"`
+	PhoneNumber      string `gorm:"uniqueIndex:idx_phone_number,where:phone_number <> ''"`
+	PhoneVerifyFlag  bool   `gorm:"default:false"`
+
+	// UsernameKey and EmailKey are the canonical forms usernames and emails
+	// are unique in and looked up by, see database/identifier.go. A username
+	// or email shared with an older account is flagged for an admin and
+	// cannot be used to sign in until one of them is changed.
+	UsernameKey          string `gorm:"uniqueIndex:idx_users_username_key,where:username_key <> '' AND NOT username_conflict_flag"`
+	EmailKey             string `gorm:"uniqueIndex:idx_users_email_key,where:email_key <> '' AND NOT email_conflict_flag"`
+	UsernameConflictFlag bool   `gorm:"default:false"`
+	EmailConflictFlag    bool   `gorm:"default:false"`
+
+	// LdapSyncDisabledFlag is set when the LDAP sync deactivated the user,
+	// the sync only reactivates those users.
+	LdapSyncDisabledFlag bool `gorm:"default:false"`
 }
 
 type UserRepository interface {
@@ -31,7 +51,13 @@ type UserRepository interface {
 	GetById(id string) (*User, error)
 	GetByUsername(username string) (*User, error)
 	GetByEmail(email string) (*User, error)
+	GetByPhoneNumber(phoneNumber string) (*User, error)
 	GetByTicket(ticket string) (*User, error)
+	GetLdapUsers() ([]User, error)
+	GetManyByScimTenant(tenantId string, search model.ScimSearch) ([]User, int, error)
+	GetByScimTenantAndIds(tenantId string, ids []string) ([]User, error)
+	GetByScimTenantAndRoleId(tenantId string, roleId string) ([]User, error)
+	CountByRoleId(roleId string) (int, error)
 	Create(user *User) error
 	Update(user *User) error
 	DaleteById(id string) error
@@ -5,16 +5,19 @@ import (
 	"time"
 
 	"lazy-auth/app/model"
+	"lazy-auth/common"
+	"lazy-auth/config"
 
 	"gorm.io/gorm"
 )
 
 type userRepository struct {
-	db *gorm.DB
+	db        *gorm.DB
+	configEnv config.ConfigEnv
 }
 
-func NewUserRepository(db *gorm.DB) UserRepository {
-	return userRepository{db}
+func NewUserRepository(db *gorm.DB, configEnv config.ConfigEnv) UserRepository {
+	return userRepository{db, configEnv}
 }
 
 func (r userRepository) GetMany(query model.QueryUser) ([]User, int, error) {
@@ -73,14 +76,80 @@ func (r userRepository) GetById(id string) (*User, error) {
 
 func (r userRepository) GetByUsername(username string) (*User, error) {
 	var user User
-	tx := r.db.Where("username = ?", username).Take(&user)
+	tx := r.db.
+		Where("username_key = ? AND NOT username_conflict_flag", common.CanonicalUsername(username)).
+		Take(&user)
 	if tx.Error != nil {
 		return nil, tx.Error
 	}
 	return &user, nil
 }
 
+func (r userRepository) GetLdapUsers() ([]User, error) {
+	var users []User
+	tx := r.db.Where("ldap_dn <> ''").Find(&users)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return users, nil
+}
+
+// GetManyByScimTenant pages through the users provisioned by a SCIM tenant,
+// search.Where is a clause built from a SCIM filter.
+func (r userRepository) GetManyByScimTenant(
+	tenantId string,
+	search model.ScimSearch,
+) ([]User, int, error) {
+	tx := r.db.Model(&User{}).Preload("Role").Where("scim_tenant_id = ?", tenantId)
+	if search.Where != "" {
+		tx = tx.Where(search.Where, search.Args...)
+	}
+
+	tx = tx.Order("created_at ASC").Limit(search.Limit).Offset(search.Offset)
+
+	var users []User
+	tx.Find(&users)
+
+	var total int64
+	tx.Limit(-1).Offset(-1).Count(&total)
+
+	if tx.Error != nil {
+		return nil, int(total), tx.Error
+	}
+	return users, int(total), nil
+}
+
+func (r userRepository) GetByScimTenantAndIds(tenantId string, ids []string) ([]User, error) {
+	var users []User
+	tx := r.db.Where("scim_tenant_id = ? AND id IN ?", tenantId, ids).Find(&users)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return users, nil
+}
+
+func (r userRepository) GetByScimTenantAndRoleId(tenantId string, roleId string) ([]User, error) {
+	var users []User
+	tx := r.db.Where("scim_tenant_id = ? AND role_id = ?", tenantId, roleId).
+		Order("created_at ASC").
+		Find(&users)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return users, nil
+}
+
+func (r userRepository) CountByRoleId(roleId string) (int, error) {
+	var total int64
+	tx := r.db.Model(&User{}).Where("role_id = ?", roleId).Count(&total)
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+	return int(total), nil
+}
+
 func (r userRepository) Create(user *User) error {
+	r.setKeys(user)
 	tx := r.db.Create(&user)
 	if tx.Error != nil {
 		return tx.Error
@@ -89,6 +158,11 @@ func (r userRepository) Create(user *User) error {
 }
 
 func (r userRepository) Update(user *User) error {
+	r.setKeys(user)
+	// Whoever reactivates a user takes them out of the sync's hands.
+	if !user.DisabledFlag {
+		user.LdapSyncDisabledFlag = false
+	}
 	tx := r.db.Save(&user)
 	if tx.Error != nil {
 		return tx.Error
@@ -97,7 +171,7 @@ func (r userRepository) Update(user *User) error {
 }
 
 func (r userRepository) DaleteById(id string) error {
-	tx := r.db.Delete(&User{}, id)
+	tx := r.db.Where("id = ?", id).Delete(&User{})
 	if tx.Error != nil {
 		return tx.Error
 	}
@@ -106,7 +180,21 @@ func (r userRepository) DaleteById(id string) error {
 
 func (r userRepository) GetByEmail(email string) (*User, error) {
 	var user User
-	tx := r.db.Where("email = ?", email).Take(&user)
+	tx := r.db.
+		Where(
+			"email_key = ? AND NOT email_conflict_flag",
+			common.CanonicalEmail(email, r.configEnv.EmailFoldGmail),
+		).
+		Take(&user)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &user, nil
+}
+
+func (r userRepository) GetByPhoneNumber(phoneNumber string) (*User, error) {
+	var user User
+	tx := r.db.Where("phone_number = ?", phoneNumber).Take(&user)
 	if tx.Error != nil {
 		return nil, tx.Error
 	}
@@ -121,3 +209,17 @@ func (r userRepository) GetByTicket(ticket string) (*User, error) {
 	}
 	return &user, nil
 }
+
+// setKeys updates the lookup keys when the username or email changed, the
+// values themselves are kept as the user entered them. A changed username or
+// email clears its conflict, the new one has to be unique.
+func (r userRepository) setKeys(user *User) {
+	if usernameKey := common.CanonicalUsername(user.Username); usernameKey != user.UsernameKey {
+		user.UsernameKey = usernameKey
+		user.UsernameConflictFlag = false
+	}
+	if emailKey := common.CanonicalEmail(user.Email, r.configEnv.EmailFoldGmail); emailKey != user.EmailKey {
+		user.EmailKey = emailKey
+		user.EmailConflictFlag = false
+	}
+}
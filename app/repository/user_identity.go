@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserIdentity links a user to the subject of an external identity provider.
+type UserIdentity struct {
+	gorm.Model
+	ID          string `gorm:"primarykey;type:uuid;default:uuid_generate_v4()"`
+	UserID      string `gorm:"index:idx_user_identity_user_id"`
+	User        User
+	ProviderID  string `gorm:"uniqueIndex:idx_user_identity_provider_subject"`
+	Provider    IdentityProvider
+	Subject     string `gorm:"uniqueIndex:idx_user_identity_provider_subject"`
+	Email       string
+	LastLoginAt time.Time
+}
+
+type UserIdentityRepository interface {
+	GetById(id string) (*UserIdentity, error)
+	GetByUserId(userId string) ([]UserIdentity, error)
+	GetByProviderAndSubject(providerId string, subject string) (*UserIdentity, error)
+	Create(identity *UserIdentity) error
+	Update(identity *UserIdentity) error
+	DeleteById(id string) error
+}
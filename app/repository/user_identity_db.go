@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+type userIdentityRepository struct {
+	db *gorm.DB
+}
+
+func NewUserIdentityRepository(db *gorm.DB) UserIdentityRepository {
+	return userIdentityRepository{db}
+}
+
+func (r userIdentityRepository) GetById(id string) (*UserIdentity, error) {
+	var identity UserIdentity
+	tx := r.db.Where("id = ?", id).Take(&identity)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &identity, nil
+}
+
+func (r userIdentityRepository) GetByUserId(userId string) ([]UserIdentity, error) {
+	var identities []UserIdentity
+	tx := r.db.Preload("Provider").Where("user_id = ?", userId).Find(&identities)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return identities, nil
+}
+
+func (r userIdentityRepository) GetByProviderAndSubject(
+	providerId string,
+	subject string,
+) (*UserIdentity, error) {
+	var identity UserIdentity
+	tx := r.db.Where("provider_id = ? AND subject = ?", providerId, subject).Take(&identity)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return &identity, nil
+}
+
+func (r userIdentityRepository) Create(identity *UserIdentity) error {
+	tx := r.db.Create(&identity)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r userIdentityRepository) Update(identity *UserIdentity) error {
+	tx := r.db.Save(&identity)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r userIdentityRepository) DeleteById(id string) error {
+	tx := r.db.Unscoped().Where("id = ?", id).Delete(&UserIdentity{})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
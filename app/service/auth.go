@@ -7,7 +7,7 @@ type AuthService interface {
 	CreateRole(body model.CreateRoleRequest) (*model.RoleResponse, error)
 	Login(body model.LoginRequest) (*model.TokenResponse, error)
 	RefreshToken(refreshToken string) (*model.TokenResponse, error)
-	Logout(body model.LogoutRequest) error
+	Logout(body model.LogoutRequest) (*model.LogoutResponse, error)
 	ChangePassword(id string, body model.ChangePasswordRequest) error
 	ForgotPassword(body model.ForgotPasswordRequest) error
 	ResetPassword(body model.ResetPasswordRequest) error
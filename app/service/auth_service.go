@@ -3,6 +3,7 @@ package service
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"lazy-auth/app/errs"
@@ -17,23 +18,38 @@ import (
 )
 
 type authService struct {
-	userRepository    repository.UserRepository
-	roleRepository    repository.RoleRepository
-	sessionRepository repository.SessionRepository
-	configEnv         config.ConfigEnv
+	userRepository        repository.UserRepository
+	roleRepository        repository.RoleRepository
+	sessionRepository     repository.SessionRepository
+	logoutService         LogoutService
+	ldapService           LdapService
+	emailOtpService       EmailOtpService
+	passwordPolicyService PasswordPolicyService
+	passwordHasher        *common.PasswordHasher
+	configEnv             config.ConfigEnv
 }
 
 func NewAuthService(
 	userRepository repository.UserRepository,
 	roleRepository repository.RoleRepository,
 	sessionRepository repository.SessionRepository,
+	logoutService LogoutService,
+	ldapService LdapService,
+	emailOtpService EmailOtpService,
+	passwordPolicyService PasswordPolicyService,
+	passwordHasher *common.PasswordHasher,
 	configEnv config.ConfigEnv,
 ) AuthService {
 	return authService{
-		userRepository:    userRepository,
-		roleRepository:    roleRepository,
-		sessionRepository: sessionRepository,
-		configEnv:         configEnv,
+		userRepository:        userRepository,
+		roleRepository:        roleRepository,
+		sessionRepository:     sessionRepository,
+		logoutService:         logoutService,
+		ldapService:           ldapService,
+		emailOtpService:       emailOtpService,
+		passwordPolicyService: passwordPolicyService,
+		passwordHasher:        passwordHasher,
+		configEnv:             configEnv,
 	}
 }
 
@@ -81,45 +97,160 @@ func (s authService) GetRoles(query model.QueryRole) (*model.RolePageResponse, e
 }
 
 func (s authService) Login(body model.LoginRequest) (*model.TokenResponse, error) {
-	user, err := s.userRepository.GetByUsername(body.Username)
+	user, err := s.getLoginUser(body.Username)
+	if s.ldapService.Enabled() && (err != nil || user.LdapDN != "") {
+		// Local accounts take precedence, everyone else is looked up in the
+		// directory.
+		username := body.Username
+		if err == nil {
+			username = user.Username
+		}
+		user, err = s.ldapService.Authenticate(username, body.Password)
+		if err != nil {
+			return nil, err
+		}
+		return completeLogin(s.emailOtpService, s.sessionRepository, s.configEnv, user)
+	}
 	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			zlog.Error(err)
+			return nil, errs.NewUnexpectedError()
+		}
+		s.passwordHasher.VerifyDummy(body.Password)
 		return nil, errs.NewUnauthorizedError("username or password is incorrect")
 	}
 
-	ok := common.CheckPasswordHash(body.Password, user.PasswordHash)
+	if user.PasswordHash == "" {
+		s.passwordHasher.VerifyDummy(body.Password)
+		return nil, errs.NewUnauthorizedError("username or password is incorrect")
+	}
+
+	ok, needsRehash := s.passwordHasher.Verify(body.Password, user.PasswordHash)
 	if !ok {
 		return nil, errs.NewUnauthorizedError("username or password is incorrect")
 	}
 
+	// The password is only known now, so this is when a hash made with an
+	// older algorithm or parameters can be upgraded.
+	if needsRehash {
+		passwordHash, err := s.passwordHasher.Hash(body.Password)
+		if err != nil {
+			zlog.Error(err)
+		} else {
+			user.PasswordHash = passwordHash
+		}
+	}
+
 	user.LastAccessAt = time.Now()
 	err = s.userRepository.Update(user)
 	if err != nil {
 		return nil, errs.NewUnexpectedError()
 	}
 
+	if s.passwordPolicyService.IsPasswordExpired(user) {
+		return s.startPasswordChange(user)
+	}
+
+	return completeLogin(s.emailOtpService, s.sessionRepository, s.configEnv, user)
+}
+
+// startPasswordChange answers a login with an expired password. The token it
+// returns is only accepted by the change password endpoint, the user logs in
+// again with the new password afterwards. The second factor still comes
+// first, the password alone is not enough to change it.
+func (s authService) startPasswordChange(user *repository.User) (*model.TokenResponse, error) {
+	if user.EmailMfaFlag {
+		return s.emailOtpService.StartMfa(user, true)
+	}
+	return createPasswordChangeToken(s.configEnv, user)
+}
+
+// getLoginUser looks the identifier up as GO_AUTH_LOGIN_IDENTIFIER allows,
+// with both a matching username wins over a matching email. Both are matched
+// in their canonical form.
+func (s authService) getLoginUser(identifier string) (*repository.User, error) {
+	if s.configEnv.LoginIdentifier != "email" {
+		user, err := s.userRepository.GetByUsername(identifier)
+		if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) || s.configEnv.LoginIdentifier == "username" {
+			return user, err
+		}
+	}
+
+	if !strings.Contains(identifier, "@") {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return s.userRepository.GetByEmail(identifier)
+}
+
+// completeLogin asks for the second factor when the user turned it on,
+// otherwise the first factor was enough. Every login method goes through it
+// except the email code and magic link logins, they already prove access to
+// the mailbox the second factor would use.
+func completeLogin(
+	emailOtpService EmailOtpService,
+	sessionRepository repository.SessionRepository,
+	configEnv config.ConfigEnv,
+	user *repository.User,
+) (*model.TokenResponse, error) {
+	if user.EmailMfaFlag {
+		return emailOtpService.StartMfa(user, false)
+	}
+	return createLoginSession(sessionRepository, configEnv, user)
+}
+
+// createPasswordChangeToken issues the restricted token for a user whose
+// password has expired, once every factor of the login succeeded.
+func createPasswordChangeToken(configEnv config.ConfigEnv, user *repository.User) (*model.TokenResponse, error) {
+	if user.DisabledFlag {
+		return nil, errs.NewForbiddenError("user is deactivated")
+	}
+
+	tokenExpiresAt := common.AddTimeByDuration(configEnv.PasswordChangeExpiresIn)
+	token := common.GeneratePasswordChangeToken(user.ID, configEnv.JwtTokenSecret, tokenExpiresAt)
+
+	return &model.TokenResponse{
+		TokenType:       "Bearer",
+		AccessToken:     token,
+		TokenExpiresAt:  tokenExpiresAt,
+		PasswordExpired: true,
+	}, nil
+}
+
+// createLoginSession starts a login session for a user who has been
+// authenticated by any login method. Deactivated users cannot sign in.
+func createLoginSession(
+	sessionRepository repository.SessionRepository,
+	configEnv config.ConfigEnv,
+	user *repository.User,
+) (*model.TokenResponse, error) {
+	if user.DisabledFlag {
+		return nil, errs.NewForbiddenError("user is deactivated")
+	}
+
 	refreshToken := uuid.NewString()
-	refreshTokenExpiresAt := common.AddTimeByDuration(s.configEnv.JwtRefreshTokenExpiresIn)
+	refreshTokenExpiresAt := common.AddTimeByDuration(configEnv.JwtRefreshTokenExpiresIn)
 	session := repository.Session{
 		UserID:       user.ID,
 		RefreshToken: refreshToken,
 		ExpiresAt:    refreshTokenExpiresAt,
 	}
-	err = s.sessionRepository.Create(&session)
+	err := sessionRepository.Create(&session)
 	if err != nil {
-		return nil, errs.NewUnauthorizedError("username or password is incorrect")
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
 	}
 
-	tokenExpiresAt := common.AddTimeByDuration(s.configEnv.JwtTokenExpiresIn)
+	tokenExpiresAt := common.AddTimeByDuration(configEnv.JwtTokenExpiresIn)
 	token := common.GenerateToken(
 		user.ID,
 		session.ID,
-		s.configEnv.JwtTokenSecret,
+		configEnv.JwtTokenSecret,
 		tokenExpiresAt,
 	)
 
 	refreshTokenAES, err := common.Encrypt(
 		session.RefreshToken,
-		s.configEnv.JwtRefreshTokenSecret,
+		configEnv.JwtRefreshTokenSecret,
 	)
 	if err != nil {
 		zlog.Error(err)
@@ -151,6 +282,11 @@ func (s authService) RefreshToken(
 		return nil, errs.NewUnauthorizedError("refresh token is invalid")
 	}
 
+	// OAuth sessions are refreshed through the token endpoint of their client.
+	if session.ClientID != "" {
+		return nil, errs.NewUnauthorizedError("refresh token is invalid")
+	}
+
 	session.RefreshToken = uuid.NewString()
 	session.ExpiresAt = common.AddTimeByDuration(s.configEnv.JwtRefreshTokenExpiresIn)
 	s.sessionRepository.Update(session)
@@ -181,35 +317,35 @@ func (s authService) RefreshToken(
 	}, nil
 }
 
-func (s authService) Logout(logoutReq model.LogoutRequest) error {
+func (s authService) Logout(logoutReq model.LogoutRequest) (*model.LogoutResponse, error) {
 	refreshToken, err := common.Decrypt(
 		logoutReq.RefreshToken,
 		s.configEnv.JwtRefreshTokenSecret,
 	)
 	if err != nil {
-		return errs.NewUnauthorizedError("refresh token is invalid")
+		return nil, errs.NewUnauthorizedError("refresh token is invalid")
 	}
 
 	session, err := s.sessionRepository.GetByRefreshToken(refreshToken)
 	if err != nil {
-		return errs.NewUnauthorizedError("refresh token is invalid")
+		return nil, errs.NewUnauthorizedError("refresh token is invalid")
 	}
 
+	sessions := []repository.Session{*session}
 	if logoutReq.IsAll {
-		err = s.sessionRepository.DeleteByUserId(session.UserID)
+		sessions, err = s.sessionRepository.GetByUserId(session.UserID)
 		if err != nil {
 			zlog.Error(err)
-			return errs.NewUnexpectedError()
+			return nil, errs.NewUnexpectedError()
 		}
-		return nil
 	}
 
-	err = s.sessionRepository.DeleteById(session.ID)
+	frontchannelURIs, err := s.logoutService.EndSessions(sessions)
 	if err != nil {
-		zlog.Error(err)
-		return errs.NewUnexpectedError()
+		return nil, err
 	}
-	return nil
+
+	return &model.LogoutResponse{FrontchannelLogoutURIs: frontchannelURIs}, nil
 }
 
 func (s authService) ChangePassword(
@@ -225,12 +361,27 @@ func (s authService) ChangePassword(
 		return errs.NewUnexpectedError()
 	}
 
-	ok := common.CheckPasswordHash(changePassReq.OldPassword, user.PasswordHash)
+	// Password change tokens are not tied to a session, the user may have
+	// been deactivated since one was issued.
+	if user.DisabledFlag {
+		return errs.NewForbiddenError("user is deactivated")
+	}
+
+	ok, _ := s.passwordHasher.Verify(changePassReq.OldPassword, user.PasswordHash)
 	if !ok {
 		return errs.NewUnauthorizedError("old password is incorrect")
 	}
 
-	user.PasswordHash, _ = common.HashPassword(changePassReq.NewPassword)
+	err = s.passwordPolicyService.CheckPassword(changePassReq.NewPassword, user)
+	if err != nil {
+		return err
+	}
+
+	user.PasswordHash, err = s.passwordHasher.Hash(changePassReq.NewPassword)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
 	user.ChangePasswordAt = time.Now()
 	err = s.userRepository.Update(user)
 	if err != nil {
@@ -238,6 +389,11 @@ func (s authService) ChangePassword(
 		return errs.NewUnexpectedError()
 	}
 
+	err = s.passwordPolicyService.RememberPassword(user)
+	if err != nil {
+		zlog.Error(err)
+	}
+
 	return nil
 }
 
@@ -274,7 +430,16 @@ func (s authService) ResetPassword(resetReq model.ResetPasswordRequest) error {
 		return errs.NewUnexpectedError()
 	}
 
-	user.PasswordHash, _ = common.HashPassword(resetReq.Password)
+	err = s.passwordPolicyService.CheckPassword(resetReq.Password, user)
+	if err != nil {
+		return err
+	}
+
+	user.PasswordHash, err = s.passwordHasher.Hash(resetReq.Password)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
 	user.Ticket = ""
 	user.TicketExpiresAt = time.Time{}
 	user.ChangePasswordAt = time.Now()
@@ -284,5 +449,10 @@ func (s authService) ResetPassword(resetReq model.ResetPasswordRequest) error {
 		return errs.NewUnexpectedError()
 	}
 
+	err = s.passwordPolicyService.RememberPassword(user)
+	if err != nil {
+		zlog.Error(err)
+	}
+
 	return nil
 }
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/common"
+	"lazy-auth/config"
+)
+
+const testPassword = "Correct-Horse-1"
+
+var mailedCodePattern = regexp.MustCompile(`\b\d{6}\b`)
+
+type authTestEnv struct {
+	service         AuthService
+	emailOtpService EmailOtpService
+	repos           *testRepositories
+	mailer          *fakeMailer
+}
+
+// newAuthTestEnv gives "jdoe" the password testPassword, changed a day ago.
+// Passwords expire after 90 days and the last 3 cannot be reused.
+func newAuthTestEnv(t *testing.T, configure ...func(*config.ConfigEnv)) *authTestEnv {
+	t.Helper()
+
+	configEnv := newTestConfigEnv(append([]func(*config.ConfigEnv){func(configEnv *config.ConfigEnv) {
+		configEnv.PasswordMinLength = 8
+		configEnv.PasswordMaxLength = 64
+		configEnv.PasswordHistory = 3
+		configEnv.PasswordMaxAgeDays = 90
+		configEnv.PasswordChangeExpiresIn = "5m"
+	}}, configure...)...)
+	passwordHasher := common.NewPasswordHasher(common.PasswordHashParams{
+		Algorithm:  common.PasswordHashBcrypt,
+		BcryptCost: 4,
+	})
+
+	repos := newTestRepositories()
+	passwordHash, err := passwordHasher.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := repos.users.users["user-1"]
+	user.PasswordHash = passwordHash
+	user.ChangePasswordAt = time.Now().Add(-24 * time.Hour)
+	repos.users.users["user-1"] = user
+
+	mailer := newFakeMailer()
+	emailOtpService := NewEmailOtpService(repos.emailOtps, repos.users, repos.sessions, mailer, configEnv)
+	passwordPolicyService := NewPasswordPolicyService(
+		repos.passwordHistories,
+		NewBreachedPasswordChecker(configEnv),
+		passwordHasher,
+		configEnv,
+	)
+
+	return &authTestEnv{
+		service: NewAuthService(
+			repos.users,
+			repos.roles,
+			repos.sessions,
+			nil,
+			NewLdapService(repos.users, repos.roles, configEnv),
+			emailOtpService,
+			passwordPolicyService,
+			passwordHasher,
+			configEnv,
+		),
+		emailOtpService: emailOtpService,
+		repos:           repos,
+		mailer:          mailer,
+	}
+}
+
+func (env *authTestEnv) updateUser(change func(*repository.User)) {
+	user := env.repos.users.users["user-1"]
+	change(&user)
+	env.repos.users.users["user-1"] = user
+}
+
+func (env *authTestEnv) expirePassword() {
+	env.updateUser(func(user *repository.User) {
+		user.ChangePasswordAt = time.Now().Add(-91 * 24 * time.Hour)
+	})
+}
+
+// mailedCode waits for the next email and returns the code in it.
+func (env *authTestEnv) mailedCode(t *testing.T) string {
+	t.Helper()
+
+	mail := env.mailer.next(t)
+	code := mailedCodePattern.FindString(mail.body)
+	if code == "" {
+		t.Fatalf("no code in %q", mail.body)
+	}
+	return code
+}
+
+func assertPasswordChangeToken(t *testing.T, tokenResp *model.TokenResponse) {
+	t.Helper()
+
+	if !tokenResp.PasswordExpired || tokenResp.RefreshToken != "" {
+		t.Fatalf("token response = %+v, want a password change token", tokenResp)
+	}
+	claims, ok := common.ValidateToken(tokenResp.AccessToken, testJwtTokenSecret)
+	if !ok || claims.SubjectType != common.SubjectTypePasswordChange || claims.Subject != "user-1" {
+		t.Fatalf("access token claims = %+v", claims)
+	}
+}
+
+func assertPolicyViolation(t *testing.T, err error, code string) {
+	t.Helper()
+
+	var appErr errs.AppError
+	if !errors.As(err, &appErr) || appErr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("error = %v, want a password policy error", err)
+	}
+	for _, violation := range appErr.Details.([]model.PasswordPolicyViolation) {
+		if violation.Code == code {
+			return
+		}
+	}
+	t.Fatalf("violations = %+v, want %s", appErr.Details, code)
+}
+
+func TestLogin(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	tokenResp, err := env.service.Login(model.LoginRequest{Username: "jdoe", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenResp.PasswordExpired || tokenResp.RefreshToken == "" {
+		t.Errorf("token response = %+v, want a session", tokenResp)
+	}
+
+	_, err = env.service.Login(model.LoginRequest{Username: "jdoe", Password: "wrong-password"})
+	assertAppError(t, err, http.StatusUnauthorized, "username or password is incorrect")
+}
+
+func TestLoginWithExpiredPassword(t *testing.T) {
+	env := newAuthTestEnv(t)
+	env.expirePassword()
+
+	tokenResp, err := env.service.Login(model.LoginRequest{Username: "jdoe", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPasswordChangeToken(t, tokenResp)
+	if len(env.repos.sessions.sessions) != 0 {
+		t.Errorf("%d sessions were created, want none", len(env.repos.sessions.sessions))
+	}
+
+	err = env.service.ChangePassword("user-1", model.ChangePasswordRequest{
+		OldPassword: testPassword,
+		NewPassword: "Battery-Staple-2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenResp, err = env.service.Login(model.LoginRequest{Username: "jdoe", Password: "Battery-Staple-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenResp.PasswordExpired || tokenResp.RefreshToken == "" {
+		t.Errorf("token response = %+v, want a session", tokenResp)
+	}
+}
+
+func TestLoginWithExpiredPasswordAsksForMfaFirst(t *testing.T) {
+	env := newAuthTestEnv(t)
+	env.expirePassword()
+	env.updateUser(func(user *repository.User) { user.EmailMfaFlag = true })
+
+	tokenResp, err := env.service.Login(model.LoginRequest{Username: "jdoe", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tokenResp.MfaRequired || tokenResp.AccessToken != "" || tokenResp.PasswordExpired {
+		t.Fatalf("token response = %+v, want only an MFA token", tokenResp)
+	}
+	code := env.mailedCode(t)
+
+	_, err = env.emailOtpService.VerifyMfa(model.VerifyMfaRequest{MfaToken: tokenResp.MfaToken, Code: "000000"})
+	assertAppError(t, err, http.StatusUnauthorized, "code is invalid")
+
+	tokenResp, err = env.emailOtpService.VerifyMfa(model.VerifyMfaRequest{MfaToken: tokenResp.MfaToken, Code: code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPasswordChangeToken(t, tokenResp)
+	if len(env.repos.sessions.sessions) != 0 {
+		t.Errorf("%d sessions were created, want none", len(env.repos.sessions.sessions))
+	}
+}
+
+func TestLoginWithMfa(t *testing.T) {
+	env := newAuthTestEnv(t)
+	env.updateUser(func(user *repository.User) { user.EmailMfaFlag = true })
+
+	tokenResp, err := env.service.Login(model.LoginRequest{Username: "jdoe", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenResp, err = env.emailOtpService.VerifyMfa(model.VerifyMfaRequest{
+		MfaToken: tokenResp.MfaToken,
+		Code:     env.mailedCode(t),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenResp.PasswordExpired || tokenResp.RefreshToken == "" {
+		t.Errorf("token response = %+v, want a session", tokenResp)
+	}
+}
+
+func TestChangePasswordRejectsDeactivatedUser(t *testing.T) {
+	env := newAuthTestEnv(t)
+	env.expirePassword()
+
+	tokenResp, err := env.service.Login(model.LoginRequest{Username: "jdoe", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPasswordChangeToken(t, tokenResp)
+
+	// The restricted token outlives the deactivation.
+	env.updateUser(func(user *repository.User) { user.DisabledFlag = true })
+	err = env.service.ChangePassword("user-1", model.ChangePasswordRequest{
+		OldPassword: testPassword,
+		NewPassword: "Battery-Staple-2",
+	})
+	assertAppError(t, err, http.StatusForbidden, "user is deactivated")
+
+	_, err = env.service.Login(model.LoginRequest{Username: "jdoe", Password: testPassword})
+	assertAppError(t, err, http.StatusForbidden, "user is deactivated")
+}
+
+func TestChangePasswordHistory(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	change := func(oldPassword string, newPassword string) error {
+		return env.service.ChangePassword("user-1", model.ChangePasswordRequest{
+			OldPassword: oldPassword,
+			NewPassword: newPassword,
+		})
+	}
+
+	err := change(testPassword, testPassword)
+	assertPolicyViolation(t, err, "reused")
+
+	passwords := []string{testPassword, "Battery-Staple-1", "Battery-Staple-2", "Battery-Staple-3", "Battery-Staple-4"}
+	for i := 1; i < len(passwords); i++ {
+		err = change(passwords[i-1], passwords[i])
+		if err != nil {
+			t.Fatalf("change to %s: %v", passwords[i], err)
+		}
+	}
+	if len(env.repos.passwordHistories.passwordHistories) != 3 {
+		t.Errorf("%d passwords are remembered, want 3", len(env.repos.passwordHistories.passwordHistories))
+	}
+
+	// The last 3 passwords include the current one.
+	err = change(passwords[4], passwords[2])
+	assertPolicyViolation(t, err, "reused")
+	err = change(passwords[4], passwords[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = change("wrong-password", "Battery-Staple-5")
+	assertAppError(t, err, http.StatusUnauthorized, "old password is incorrect")
+}
@@ -0,0 +1,6 @@
+package service
+
+type BreachedPasswordChecker interface {
+	Enabled() bool
+	IsBreached(password string) (bool, error)
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"lazy-auth/common"
+	"lazy-auth/config"
+)
+
+// NewBreachedPasswordChecker returns the checker picked by
+// GO_AUTH_BREACHED_PASSWORD_MODE. "file" reads a directory of Pwned
+// Passwords range files, "bloom" a filter built by cmd/breached-bloom and
+// "http" asks a range API with only the first 5 characters of the hash.
+func NewBreachedPasswordChecker(configEnv config.ConfigEnv) BreachedPasswordChecker {
+	switch configEnv.BreachedPasswordMode {
+	case "file":
+		return fileBreachedPasswordChecker{
+			dir:      configEnv.BreachedPasswordFile,
+			minCount: configEnv.BreachedPasswordMinCount,
+		}
+	case "bloom":
+		filter, err := common.LoadBloomFilter(configEnv.BreachedPasswordFile)
+		if err != nil {
+			panic(err)
+		}
+		return bloomBreachedPasswordChecker{filter: filter}
+	case "http":
+		return httpBreachedPasswordChecker{
+			url:        strings.TrimSuffix(configEnv.BreachedPasswordURL, "/"),
+			minCount:   configEnv.BreachedPasswordMinCount,
+			httpClient: &http.Client{Timeout: externalRequestTimeout},
+		}
+	}
+	return offBreachedPasswordChecker{}
+}
+
+type offBreachedPasswordChecker struct{}
+
+func (c offBreachedPasswordChecker) Enabled() bool {
+	return false
+}
+
+func (c offBreachedPasswordChecker) IsBreached(password string) (bool, error) {
+	return false, nil
+}
+
+type fileBreachedPasswordChecker struct {
+	dir      string
+	minCount int
+}
+
+func (c fileBreachedPasswordChecker) Enabled() bool {
+	return true
+}
+
+func (c fileBreachedPasswordChecker) IsBreached(password string) (bool, error) {
+	hash := common.PwnedPasswordHash(password)
+	f, err := os.Open(filepath.Join(c.dir, hash[:5]+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	count, err := common.FindPwnedSuffix(f, hash[5:])
+	if err != nil {
+		return false, err
+	}
+	return count >= c.minCount, nil
+}
+
+type bloomBreachedPasswordChecker struct {
+	filter *common.BloomFilter
+}
+
+func (c bloomBreachedPasswordChecker) Enabled() bool {
+	return true
+}
+
+func (c bloomBreachedPasswordChecker) IsBreached(password string) (bool, error) {
+	return c.filter.Contains(common.PwnedPasswordHash(password))
+}
+
+type httpBreachedPasswordChecker struct {
+	url        string
+	minCount   int
+	httpClient *http.Client
+}
+
+func (c httpBreachedPasswordChecker) Enabled() bool {
+	return true
+}
+
+func (c httpBreachedPasswordChecker) IsBreached(password string) (bool, error) {
+	hash := common.PwnedPasswordHash(password)
+
+	req, err := http.NewRequest(http.MethodGet, c.url+"/"+hash[:5], nil)
+	if err != nil {
+		return false, err
+	}
+	// Padding hides the real number of suffixes from anyone watching.
+	req.Header.Set("Add-Padding", "true")
+	req.Header.Set("User-Agent", "lazy-auth")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("breached password range API responded %s", resp.Status)
+	}
+
+	count, err := common.FindPwnedSuffix(resp.Body, hash[5:])
+	if err != nil {
+		return false, err
+	}
+	return count >= c.minCount, nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lazy-auth/common"
+	"lazy-auth/config"
+)
+
+// testBreachedPasswords is the dataset the checkers are built from, with how
+// often each password was seen.
+var testBreachedPasswords = map[string]int{
+	"password":   100,
+	"rarely-hit": 1,
+}
+
+func newBreachedPasswordChecker(mode string, source string, minCount int) BreachedPasswordChecker {
+	return NewBreachedPasswordChecker(newTestConfigEnv(func(configEnv *config.ConfigEnv) {
+		configEnv.BreachedPasswordMode = mode
+		configEnv.BreachedPasswordFile = source
+		configEnv.BreachedPasswordURL = source
+		configEnv.BreachedPasswordMinCount = minCount
+	}))
+}
+
+// testRangeFiles returns testBreachedPasswords as range file contents by
+// prefix, padded like the range API pads them.
+func testRangeFiles() map[string]string {
+	rangeFiles := map[string]string{}
+	for password, count := range testBreachedPasswords {
+		hash := common.PwnedPasswordHash(password)
+		rangeFiles[hash[:5]] += fmt.Sprintf("%s:%d\r\n", hash[5:], count)
+	}
+	for prefix := range rangeFiles {
+		rangeFiles[prefix] += "0018A45C4D1DEF81644B54AB7F969B88D65:0\r\n"
+	}
+	return rangeFiles
+}
+
+func assertBreached(t *testing.T, checker BreachedPasswordChecker, password string, want bool) {
+	t.Helper()
+
+	breached, err := checker.IsBreached(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if breached != want {
+		t.Errorf("IsBreached(%q) = %v, want %v", password, breached, want)
+	}
+}
+
+func TestFileBreachedPasswordChecker(t *testing.T) {
+	dir := t.TempDir()
+	for prefix, content := range testRangeFiles() {
+		err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(content), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checker := newBreachedPasswordChecker("file", dir, 1)
+	assertBreached(t, checker, "password", true)
+	assertBreached(t, checker, "rarely-hit", true)
+	// No range file for its prefix.
+	assertBreached(t, checker, "Correct-Horse-1", false)
+
+	checker = newBreachedPasswordChecker("file", dir, 2)
+	assertBreached(t, checker, "password", true)
+	assertBreached(t, checker, "rarely-hit", false)
+}
+
+func TestBloomBreachedPasswordChecker(t *testing.T) {
+	filter := common.NewBloomFilter(uint64(len(testBreachedPasswords)), 0.0001)
+	for password := range testBreachedPasswords {
+		err := filter.Add(common.PwnedPasswordHash(password))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "breached.bloom")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = filter.WriteTo(f)
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checker := newBreachedPasswordChecker("bloom", path, 1)
+	assertBreached(t, checker, "password", true)
+	assertBreached(t, checker, "rarely-hit", true)
+	assertBreached(t, checker, "Correct-Horse-1", false)
+}
+
+func TestHttpBreachedPasswordChecker(t *testing.T) {
+	rangeFiles := testRangeFiles()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the prefix of the hash leaves the server.
+		prefix, found := strings.CutPrefix(r.URL.Path, "/range/")
+		if !found || len(prefix) != 5 {
+			t.Errorf("requested %s, want /range/<5 characters>", r.URL.Path)
+		}
+		if r.Header.Get("Add-Padding") != "true" {
+			t.Error("range request is not padded")
+		}
+		w.Write([]byte(rangeFiles[prefix]))
+	}))
+	defer server.Close()
+
+	checker := newBreachedPasswordChecker("http", server.URL+"/range/", 1)
+	assertBreached(t, checker, "password", true)
+	assertBreached(t, checker, "rarely-hit", true)
+	assertBreached(t, checker, "Correct-Horse-1", false)
+
+	checker = newBreachedPasswordChecker("http", server.URL+"/range", 2)
+	assertBreached(t, checker, "password", true)
+	assertBreached(t, checker, "rarely-hit", false)
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	_, err := newBreachedPasswordChecker("http", unavailable.URL, 1).IsBreached("password")
+	if err == nil {
+		t.Error("a failed range request was not reported")
+	}
+}
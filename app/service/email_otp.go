@@ -0,0 +1,15 @@
+package service
+
+import (
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+)
+
+type EmailOtpService interface {
+	RequestLoginCode(body model.EmailOtpRequest) error
+	VerifyLoginCode(body model.VerifyEmailOtpRequest) (*model.TokenResponse, error)
+	StartMfa(user *repository.User, passwordExpired bool) (*model.TokenResponse, error)
+	VerifyMfa(body model.VerifyMfaRequest) (*model.TokenResponse, error)
+	SendSetupCode(userId string) error
+	UpdateEmailMfa(userId string, body model.UpdateEmailMfaRequest) error
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"gorm.io/gorm"
+)
+
+const (
+	emailOtpPurposeLogin = "login"
+	emailOtpPurposeMfa   = "mfa"
+	emailOtpPurposeSetup = "setup"
+	// emailOtpPurposeMfaPasswordChange is a second factor after a password
+	// that has expired, it is answered with a password change token.
+	emailOtpPurposeMfaPasswordChange = "mfa_password_change"
+)
+
+var errOtpRateLimited = errors.New("too many codes requested")
+
+type emailOtpService struct {
+	emailOtpRepository repository.EmailOtpRepository
+	userRepository     repository.UserRepository
+	sessionRepository  repository.SessionRepository
+	mailer             Mailer
+	configEnv          config.ConfigEnv
+}
+
+func NewEmailOtpService(
+	emailOtpRepository repository.EmailOtpRepository,
+	userRepository repository.UserRepository,
+	sessionRepository repository.SessionRepository,
+	mailer Mailer,
+	configEnv config.ConfigEnv,
+) EmailOtpService {
+	return emailOtpService{
+		emailOtpRepository: emailOtpRepository,
+		userRepository:     userRepository,
+		sessionRepository:  sessionRepository,
+		mailer:             mailer,
+		configEnv:          configEnv,
+	}
+}
+
+// RequestLoginCode answers the same way for unknown, deactivated and rate
+// limited addresses, so it cannot be used to find accounts.
+func (s emailOtpService) RequestLoginCode(emailOtpReq model.EmailOtpRequest) error {
+	user, err := s.userRepository.GetByEmail(emailOtpReq.Email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	if user.DisabledFlag {
+		return nil
+	}
+
+	err = s.sendCode(user, emailOtpPurposeLogin, "")
+	if err != nil {
+		if errors.Is(err, errOtpRateLimited) {
+			return nil
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
+
+func (s emailOtpService) VerifyLoginCode(
+	verifyReq model.VerifyEmailOtpRequest,
+) (*model.TokenResponse, error) {
+	user, err := s.userRepository.GetByEmail(verifyReq.Email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewUnauthorizedError("code is invalid")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	emailOtp, err := s.emailOtpRepository.GetLatest(user.ID, emailOtpPurposeLogin)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewUnauthorizedError("code is invalid")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	err = s.redeem(emailOtp, verifyReq.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	// The code was delivered to the address, so it is verified now.
+	user.VerifyFlag = true
+	user.LastAccessAt = time.Now()
+	err = s.userRepository.Update(user)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return createLoginSession(s.sessionRepository, s.configEnv, user)
+}
+
+// StartMfa is called after the first factor succeeded. Instead of tokens it
+// returns an MFA token that is exchanged together with the emailed code.
+// When passwordExpired is set the exchange only gets a password change token.
+func (s emailOtpService) StartMfa(user *repository.User, passwordExpired bool) (*model.TokenResponse, error) {
+	if user.DisabledFlag {
+		return nil, errs.NewForbiddenError("user is deactivated")
+	}
+
+	purpose := emailOtpPurposeMfa
+	if passwordExpired {
+		purpose = emailOtpPurposeMfaPasswordChange
+	}
+
+	mfaToken, err := common.GenerateSecret(32)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	err = s.sendCode(user, purpose, common.HashToken(mfaToken))
+	if err != nil {
+		if errors.Is(err, errOtpRateLimited) {
+			return nil, errs.NewTooManyRequestsError("too many codes requested, try again later")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return &model.TokenResponse{MfaRequired: true, MfaToken: mfaToken}, nil
+}
+
+func (s emailOtpService) VerifyMfa(verifyReq model.VerifyMfaRequest) (*model.TokenResponse, error) {
+	emailOtp, err := s.emailOtpRepository.GetByMfaTokenHash(common.HashToken(verifyReq.MfaToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewUnauthorizedError("mfa token is invalid")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	err = s.redeem(emailOtp, verifyReq.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepository.GetById(emailOtp.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewUnauthorizedError("mfa token is invalid")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	if emailOtp.Purpose == emailOtpPurposeMfaPasswordChange {
+		return createPasswordChangeToken(s.configEnv, user)
+	}
+	return createLoginSession(s.sessionRepository, s.configEnv, user)
+}
+
+func (s emailOtpService) SendSetupCode(userId string) error {
+	user, err := s.userRepository.GetById(userId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewNotFoundError("user not found")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	if user.Email == "" {
+		return errs.NewUnprocessableEntity("user has no email")
+	}
+
+	err = s.sendCode(user, emailOtpPurposeSetup, "")
+	if err != nil {
+		if errors.Is(err, errOtpRateLimited) {
+			return errs.NewTooManyRequestsError("too many codes requested, try again later")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
+
+// UpdateEmailMfa turns the email second factor on or off, both need a setup
+// code so a stolen session alone cannot change it.
+func (s emailOtpService) UpdateEmailMfa(userId string, updateReq model.UpdateEmailMfaRequest) error {
+	user, err := s.userRepository.GetById(userId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewNotFoundError("user not found")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	emailOtp, err := s.emailOtpRepository.GetLatest(user.ID, emailOtpPurposeSetup)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewUnauthorizedError("code is invalid")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	err = s.redeem(emailOtp, updateReq.Code)
+	if err != nil {
+		return err
+	}
+
+	user.EmailMfaFlag = *updateReq.Enabled
+	user.VerifyFlag = true
+	err = s.userRepository.Update(user)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
+
+// sendCode stores a new code for the user and emails it, at most
+// EmailOtpMaxPerHour codes are sent per user across all purposes.
+func (s emailOtpService) sendCode(
+	user *repository.User,
+	purpose string,
+	mfaTokenHash string,
+) error {
+	since := time.Now().Add(-time.Hour)
+	err := s.emailOtpRepository.DeleteByUserIdBefore(user.ID, since)
+	if err != nil {
+		return err
+	}
+
+	total, err := s.emailOtpRepository.CountSince(user.ID, since)
+	if err != nil {
+		return err
+	}
+	if total >= s.configEnv.EmailOtpMaxPerHour {
+		return errOtpRateLimited
+	}
+
+	code, err := common.GenerateNumericCode(6)
+	if err != nil {
+		return err
+	}
+
+	emailOtp := repository.EmailOtp{
+		UserID:       user.ID,
+		Purpose:      purpose,
+		CodeHash:     common.HashCode(user.ID+":"+code, s.configEnv.SecretEncryptionKey),
+		MfaTokenHash: mfaTokenHash,
+		ExpiresAt:    common.AddTimeByDuration(s.configEnv.EmailOtpExpiresIn),
+	}
+	err = s.emailOtpRepository.Create(&emailOtp)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf(
+		"Your code is %s, it expires in %s.\n\nIf you did not ask for a code you can ignore this email.",
+		code,
+		s.configEnv.EmailOtpExpiresIn,
+	)
+
+	// Sending in the background keeps the response time the same for
+	// unknown emails.
+	go func() {
+		err := s.mailer.Send(user.Email, "Your verification code", body)
+		if err != nil {
+			zlog.Error(err)
+		}
+	}()
+
+	return nil
+}
+
+// redeem checks a code and burns it. Every check uses up an attempt, the
+// code stops working after EmailOtpMaxAttempts.
+func (s emailOtpService) redeem(emailOtp *repository.EmailOtp, code string) error {
+	err := s.emailOtpRepository.IncrementAttempts(emailOtp.ID, s.configEnv.EmailOtpMaxAttempts)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewUnauthorizedError("code is invalid")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	codeHash := common.HashCode(emailOtp.UserID+":"+code, s.configEnv.SecretEncryptionKey)
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(emailOtp.CodeHash)) != 1 {
+		return errs.NewUnauthorizedError("code is invalid")
+	}
+
+	err = s.emailOtpRepository.MarkUsed(emailOtp.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewUnauthorizedError("code is invalid")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
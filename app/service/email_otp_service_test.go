@@ -0,0 +1,139 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+)
+
+type emailOtpTestEnv struct {
+	service EmailOtpService
+	repos   *testRepositories
+	mailer  *fakeMailer
+}
+
+// newEmailOtpTestEnv allows 5 attempts per code and 5 codes per hour.
+func newEmailOtpTestEnv() *emailOtpTestEnv {
+	repos := newTestRepositories()
+	mailer := newFakeMailer()
+
+	return &emailOtpTestEnv{
+		service: NewEmailOtpService(repos.emailOtps, repos.users, repos.sessions, mailer, newTestConfigEnv()),
+		repos:   repos,
+		mailer:  mailer,
+	}
+}
+
+// requestCode asks for a login code for jdoe and returns the emailed code.
+func (env *emailOtpTestEnv) requestCode(t *testing.T) string {
+	t.Helper()
+
+	err := env.service.RequestLoginCode(model.EmailOtpRequest{Email: "jdoe@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mail := env.mailer.next(t)
+	code := mailedCodePattern.FindString(mail.body)
+	if code == "" {
+		t.Fatalf("no code in %q", mail.body)
+	}
+	return code
+}
+
+func (env *emailOtpTestEnv) verify(code string) (*model.TokenResponse, error) {
+	return env.service.VerifyLoginCode(model.VerifyEmailOtpRequest{Email: "jdoe@example.com", Code: code})
+}
+
+// wrongCode returns a code that differs from code.
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestEmailVerifyLoginCode(t *testing.T) {
+	env := newEmailOtpTestEnv()
+	code := env.requestCode(t)
+
+	tokenResp, err := env.verify(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenResp.RefreshToken == "" {
+		t.Errorf("token response = %+v, want a session", tokenResp)
+	}
+
+	// A code works once.
+	_, err = env.verify(code)
+	assertAppError(t, err, http.StatusUnauthorized, "code is invalid")
+}
+
+func TestEmailVerifyLoginCodeAttemptLimit(t *testing.T) {
+	env := newEmailOtpTestEnv()
+	code := env.requestCode(t)
+
+	for i := 0; i < 5; i++ {
+		_, err := env.verify(wrongCode(code))
+		assertAppError(t, err, http.StatusUnauthorized, "code is invalid")
+	}
+
+	// The attempts are used up, the right code no longer works either.
+	_, err := env.verify(code)
+	assertAppError(t, err, http.StatusUnauthorized, "code is invalid")
+	if len(env.repos.sessions.sessions) != 0 {
+		t.Errorf("%d sessions were created, want none", len(env.repos.sessions.sessions))
+	}
+
+	// A new code gets a fresh set of attempts.
+	_, err = env.verify(env.requestCode(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmailRequestLoginCodeHourlyLimit(t *testing.T) {
+	env := newEmailOtpTestEnv()
+	for i := 0; i < 5; i++ {
+		env.requestCode(t)
+	}
+
+	// Over the limit the answer is the same, only no code is sent.
+	err := env.service.RequestLoginCode(model.EmailOtpRequest{Email: "jdoe@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.mailer.assertNoMail(t)
+
+	// The limit counts every purpose.
+	user := env.repos.users.users["user-1"]
+	_, err = env.service.StartMfa(&user, false)
+	assertAppError(t, err, http.StatusTooManyRequests, "too many codes requested, try again later")
+}
+
+func TestEmailRequestLoginCodeAnswersTheSame(t *testing.T) {
+	env := newEmailOtpTestEnv()
+	env.repos.users.users["user-2"] = repository.User{
+		ID:           "user-2",
+		RoleID:       "role-1",
+		Username:     "disabled",
+		Email:        "disabled@example.com",
+		DisabledFlag: true,
+	}
+
+	for _, email := range []string{"unknown@example.com", "disabled@example.com"} {
+		err := env.service.RequestLoginCode(model.EmailOtpRequest{Email: email})
+		if err != nil {
+			t.Fatalf("%s: %v", email, err)
+		}
+	}
+	env.mailer.assertNoMail(t)
+	if len(env.repos.emailOtps.emailOtps) != 0 {
+		t.Errorf("%d codes are stored, want none", len(env.repos.emailOtps.emailOtps))
+	}
+
+	_, err := env.service.VerifyLoginCode(model.VerifyEmailOtpRequest{Email: "unknown@example.com", Code: "000000"})
+	assertAppError(t, err, http.StatusUnauthorized, "code is invalid")
+}
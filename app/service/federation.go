@@ -0,0 +1,22 @@
+package service
+
+import "lazy-auth/app/model"
+
+type FederationService interface {
+	GetLoginProviders() ([]model.LoginProviderResponse, error)
+	Authorize(slug string) (*model.ExternalAuthorizeResponse, string, error)
+	Callback(
+		slug string,
+		body model.ExternalCallbackRequest,
+		binding string,
+	) (*model.TokenResponse, error)
+	GetIdentities(userId string) ([]model.UserIdentityResponse, error)
+	LinkAuthorize(userId string, slug string) (*model.ExternalAuthorizeResponse, string, error)
+	LinkCallback(
+		userId string,
+		slug string,
+		body model.ExternalCallbackRequest,
+		binding string,
+	) (*model.UserIdentityResponse, error)
+	UnlinkIdentity(userId string, id string) error
+}
@@ -0,0 +1,849 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	zconstant "lazy-auth/app/constant"
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	externalStateExpiresIn   = 10 * time.Minute
+	externalMetadataCacheTTL = time.Hour
+	externalRequestTimeout   = 10 * time.Second
+)
+
+// externalClaimFields are the user fields a provider's claim mapping may set.
+var externalClaimFields = []string{
+	"subject", "email", "email_verified", "username", "display_name", "first_name", "last_name",
+}
+
+var defaultClaimMapping = map[string]string{
+	"subject":        "sub",
+	"email":          "email",
+	"email_verified": "email_verified",
+	"username":       "preferred_username",
+	"display_name":   "name",
+	"first_name":     "given_name",
+	"last_name":      "family_name",
+}
+
+// externalAuthState travels through the provider inside the encrypted state
+// parameter, so no server side storage is needed between the two legs. UserID
+// is set when a signed in user links the identity to their account.
+// BindingHash ties the state to the browser that started the flow, which
+// holds the binding in a cookie, so a state cannot be used for login CSRF.
+type externalAuthState struct {
+	Provider     string `json:"p"`
+	UserID       string `json:"u,omitempty"`
+	Nonce        string `json:"n"`
+	CodeVerifier string `json:"v"`
+	BindingHash  string `json:"b"`
+	ExpiresAt    int64  `json:"e"`
+}
+
+type externalTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+}
+
+// externalProfile is a provider's user after claim mapping.
+type externalProfile struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	DisplayName   string
+	FirstName     string
+	LastName      string
+}
+
+type providerMetadata struct {
+	authorizationEndpoint string
+	tokenEndpoint         string
+	userinfoEndpoint      string
+	jwksURI               string
+	keys                  []model.JsonWebKey
+	providerUpdatedAt     time.Time
+	fetchedAt             time.Time
+}
+
+type federationService struct {
+	identityProviderRepository repository.IdentityProviderRepository
+	userIdentityRepository     repository.UserIdentityRepository
+	samlIdentityRepository     repository.SamlIdentityRepository
+	userRepository             repository.UserRepository
+	roleRepository             repository.RoleRepository
+	sessionRepository          repository.SessionRepository
+	emailOtpService            EmailOtpService
+	passwordPolicyService      PasswordPolicyService
+	configEnv                  config.ConfigEnv
+	httpClient                 *http.Client
+
+	metadataMutex *sync.Mutex
+	metadata      map[string]*providerMetadata
+}
+
+func NewFederationService(
+	identityProviderRepository repository.IdentityProviderRepository,
+	userIdentityRepository repository.UserIdentityRepository,
+	samlIdentityRepository repository.SamlIdentityRepository,
+	userRepository repository.UserRepository,
+	roleRepository repository.RoleRepository,
+	sessionRepository repository.SessionRepository,
+	emailOtpService EmailOtpService,
+	passwordPolicyService PasswordPolicyService,
+	configEnv config.ConfigEnv,
+) FederationService {
+	return federationService{
+		identityProviderRepository: identityProviderRepository,
+		userIdentityRepository:     userIdentityRepository,
+		samlIdentityRepository:     samlIdentityRepository,
+		userRepository:             userRepository,
+		roleRepository:             roleRepository,
+		sessionRepository:          sessionRepository,
+		emailOtpService:            emailOtpService,
+		passwordPolicyService:      passwordPolicyService,
+		configEnv:                  configEnv,
+		httpClient:                 &http.Client{Timeout: externalRequestTimeout},
+		metadataMutex:              &sync.Mutex{},
+		metadata:                   map[string]*providerMetadata{},
+	}
+}
+
+func (s federationService) GetLoginProviders() ([]model.LoginProviderResponse, error) {
+	disabled := false
+	providers, _, err := s.identityProviderRepository.GetMany(model.QueryIdentityProvider{
+		DisabledFlag: &disabled,
+	})
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return common.Map(providers, func(provider repository.IdentityProvider) model.LoginProviderResponse {
+		return model.LoginProviderResponse{Slug: provider.Slug, Name: provider.Name}
+	}), nil
+}
+
+// Authorize returns the provider's authorization URL and the browser binding
+// the caller must keep in a cookie until the callback.
+func (s federationService) Authorize(slug string) (*model.ExternalAuthorizeResponse, string, error) {
+	return s.authorize(slug, "")
+}
+
+func (s federationService) LinkAuthorize(
+	userId string,
+	slug string,
+) (*model.ExternalAuthorizeResponse, string, error) {
+	return s.authorize(slug, userId)
+}
+
+func (s federationService) authorize(
+	slug string,
+	userId string,
+) (*model.ExternalAuthorizeResponse, string, error) {
+	provider, err := s.getEnabledProvider(slug)
+	if err != nil {
+		return nil, "", err
+	}
+
+	metadata, err := s.getMetadata(provider, false)
+	if err != nil {
+		zlog.Error(err)
+		return nil, "", errs.NewUnexpectedError()
+	}
+
+	nonce, err := common.GenerateSecret(16)
+	if err != nil {
+		zlog.Error(err)
+		return nil, "", errs.NewUnexpectedError()
+	}
+	codeVerifier, err := common.GenerateSecret(32)
+	if err != nil {
+		zlog.Error(err)
+		return nil, "", errs.NewUnexpectedError()
+	}
+	binding, err := common.GenerateSecret(32)
+	if err != nil {
+		zlog.Error(err)
+		return nil, "", errs.NewUnexpectedError()
+	}
+
+	stateJSON, _ := json.Marshal(externalAuthState{
+		Provider:     provider.Slug,
+		UserID:       userId,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		BindingHash:  common.HashToken(binding),
+		ExpiresAt:    time.Now().Add(externalStateExpiresIn).Unix(),
+	})
+	state, err := common.Encrypt(string(stateJSON), s.configEnv.SecretEncryptionKey)
+	if err != nil {
+		zlog.Error(err)
+		return nil, "", errs.NewUnexpectedError()
+	}
+
+	scopes := provider.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{zconstant.ScopeOpenID, zconstant.ScopeProfile, zconstant.ScopeEmail}
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.ClientID},
+		"redirect_uri":          {provider.RedirectURI},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	return &model.ExternalAuthorizeResponse{
+		RedirectTo: buildRedirectURI(metadata.authorizationEndpoint, params),
+		State:      state,
+	}, binding, nil
+}
+
+func (s federationService) Callback(
+	slug string,
+	callbackReq model.ExternalCallbackRequest,
+	binding string,
+) (*model.TokenResponse, error) {
+	state, ok := s.decodeState(slug, callbackReq.State, binding)
+	if !ok || state.UserID != "" {
+		return nil, errs.NewUnauthorizedError("state is invalid")
+	}
+
+	provider, err := s.getEnabledProvider(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := s.fetchProfile(provider, callbackReq.Code, state)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnauthorizedError("identity provider sign in failed")
+	}
+
+	user, err := s.resolveUser(provider, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	user.LastAccessAt = time.Now()
+	err = s.userRepository.Update(user)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return completeLogin(s.emailOtpService, s.sessionRepository, s.configEnv, user)
+}
+
+func (s federationService) GetIdentities(userId string) ([]model.UserIdentityResponse, error) {
+	identities, err := s.userIdentityRepository.GetByUserId(userId)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return common.Map(identities, buildUserIdentityResponse), nil
+}
+
+func (s federationService) LinkCallback(
+	userId string,
+	slug string,
+	callbackReq model.ExternalCallbackRequest,
+	binding string,
+) (*model.UserIdentityResponse, error) {
+	// The state must have been issued to this user, otherwise an attacker
+	// could get their own identity linked to the victim's account.
+	state, ok := s.decodeState(slug, callbackReq.State, binding)
+	if !ok || state.UserID != userId {
+		return nil, errs.NewUnauthorizedError("state is invalid")
+	}
+
+	provider, err := s.getEnabledProvider(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := s.fetchProfile(provider, callbackReq.Code, state)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnauthorizedError("identity provider sign in failed")
+	}
+
+	identity, err := s.userIdentityRepository.GetByProviderAndSubject(provider.ID, profile.Subject)
+	if err == nil {
+		if identity.UserID != userId {
+			return nil, errs.NewUnprocessableEntity("identity is already linked to another account")
+		}
+		identity.Provider = *provider
+		identityResponse := buildUserIdentityResponse(*identity)
+		return &identityResponse, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	identities, err := s.userIdentityRepository.GetByUserId(userId)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	for _, linked := range identities {
+		if linked.ProviderID == provider.ID {
+			return nil, errs.NewUnprocessableEntity("another identity of this provider is already linked")
+		}
+	}
+
+	identity, err = s.linkIdentity(userId, provider, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	identityResponse := buildUserIdentityResponse(*identity)
+	return &identityResponse, nil
+}
+
+func (s federationService) UnlinkIdentity(userId string, id string) error {
+	identity, err := s.userIdentityRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewNotFoundError("identity not found")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	if identity.UserID != userId {
+		return errs.NewNotFoundError("identity not found")
+	}
+
+	user, err := s.userRepository.GetById(userId)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	otherMethods, err := s.countLoginMethods(user, identity.ID)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	if otherMethods == 0 {
+		return errs.NewUnprocessableEntity("cannot unlink the last login method, set a password first")
+	}
+
+	err = s.userIdentityRepository.DeleteById(identity.ID)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
+
+// countLoginMethods counts the ways the user can still sign in without the
+// identity excluded: a local password that has not expired, the directory,
+// a verified email (magic links and email codes), a verified phone, SAML
+// identities and the other linked identities.
+func (s federationService) countLoginMethods(user *repository.User, excludedIdentityId string) (int, error) {
+	methods := 0
+	if user.LdapDN != "" {
+		if s.configEnv.LdapURL != "" {
+			methods++
+		}
+	} else if user.PasswordHash != "" && !s.passwordPolicyService.IsPasswordExpired(user) {
+		methods++
+	}
+	if user.Email != "" && user.VerifyFlag {
+		methods++
+	}
+	if user.PhoneNumber != "" && user.PhoneVerifyFlag {
+		methods++
+	}
+
+	samlIdentities, err := s.samlIdentityRepository.CountByUserId(user.ID)
+	if err != nil {
+		return 0, err
+	}
+	methods += samlIdentities
+
+	identities, err := s.userIdentityRepository.GetByUserId(user.ID)
+	if err != nil {
+		return 0, err
+	}
+	for _, identity := range identities {
+		if identity.ID != excludedIdentityId {
+			methods++
+		}
+	}
+
+	return methods, nil
+}
+
+func buildUserIdentityResponse(identity repository.UserIdentity) model.UserIdentityResponse {
+	return model.UserIdentityResponse{
+		ID:           identity.ID,
+		Provider:     identity.Provider.Slug,
+		ProviderName: identity.Provider.Name,
+		Email:        identity.Email,
+		CreatedAt:    identity.CreatedAt,
+		LastLoginAt:  identity.LastLoginAt,
+	}
+}
+
+func (s federationService) decodeState(
+	slug string,
+	encrypted string,
+	binding string,
+) (*externalAuthState, bool) {
+	stateJSON, err := common.Decrypt(encrypted, s.configEnv.SecretEncryptionKey)
+	if err != nil {
+		return nil, false
+	}
+
+	var state externalAuthState
+	err = json.Unmarshal([]byte(stateJSON), &state)
+	if err != nil || state.Provider != slug || time.Now().Unix() > state.ExpiresAt {
+		return nil, false
+	}
+	if binding == "" || common.HashToken(binding) != state.BindingHash {
+		return nil, false
+	}
+	return &state, true
+}
+
+func (s federationService) linkIdentity(
+	userId string,
+	provider *repository.IdentityProvider,
+	profile *externalProfile,
+) (*repository.UserIdentity, error) {
+	identity := repository.UserIdentity{
+		UserID:      userId,
+		ProviderID:  provider.ID,
+		Provider:    *provider,
+		Subject:     profile.Subject,
+		Email:       profile.Email,
+		LastLoginAt: time.Now(),
+	}
+	err := s.userIdentityRepository.Create(&identity)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errs.NewUnprocessableEntity("identity is already linked to another account")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	return &identity, nil
+}
+
+func (s federationService) getEnabledProvider(slug string) (*repository.IdentityProvider, error) {
+	provider, err := s.identityProviderRepository.GetBySlug(slug)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("identity provider not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	if provider.DisabledFlag {
+		return nil, errs.NewNotFoundError("identity provider not found")
+	}
+	return provider, nil
+}
+
+// resolveUser finds the user linked to the external identity. Unknown
+// identities are linked to the account with the same email when both sides
+// have verified it and the provider is trusted to do so, otherwise a user is
+// created just in time when the provider allows sign up.
+func (s federationService) resolveUser(
+	provider *repository.IdentityProvider,
+	profile *externalProfile,
+) (*repository.User, error) {
+	identity, err := s.userIdentityRepository.GetByProviderAndSubject(provider.ID, profile.Subject)
+	if err == nil {
+		identity.Email = profile.Email
+		identity.LastLoginAt = time.Now()
+		err = s.userIdentityRepository.Update(identity)
+		if err != nil {
+			zlog.Error(err)
+			return nil, errs.NewUnexpectedError()
+		}
+
+		user, err := s.userRepository.GetById(identity.UserID)
+		if err != nil {
+			zlog.Error(err)
+			return nil, errs.NewUnexpectedError()
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	if profile.Email != "" {
+		user, err := s.userRepository.GetByEmail(profile.Email)
+		if err == nil {
+			// An unverified address on either side would let whoever
+			// registered it first take over the other account.
+			if !provider.LinkByVerifiedEmail || !profile.EmailVerified || !user.VerifyFlag {
+				return nil, errs.NewUnprocessableEntity(
+					"an account with this email already exists, sign in and link this provider from your account",
+				)
+			}
+
+			_, err = s.linkIdentity(user.ID, provider, profile)
+			if err != nil {
+				return nil, err
+			}
+			return user, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			zlog.Error(err)
+			return nil, errs.NewUnexpectedError()
+		}
+	}
+
+	if !provider.AllowSignUp {
+		return nil, errs.NewUnauthorizedError("no account is linked to this identity")
+	}
+	if profile.Email == "" {
+		return nil, errs.NewUnauthorizedError("identity provider did not return an email")
+	}
+
+	user, err := createExternalUser(s.userRepository, s.roleRepository, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.linkIdentity(user.ID, provider, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// createExternalUser provisions a user asserted by an external identity
+// source, without a password.
+func createExternalUser(
+	userRepository repository.UserRepository,
+	roleRepository repository.RoleRepository,
+	profile *externalProfile,
+) (*repository.User, error) {
+	role, err := roleRepository.GetByName("user")
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	username := profile.Username
+	if username == "" {
+		username, _, _ = strings.Cut(profile.Email, "@")
+	}
+	if _, err := userRepository.GetByUsername(username); err == nil {
+		username = username + "_" + uuid.NewString()[:8]
+	}
+
+	user := repository.User{
+		RoleID:      role.ID,
+		Email:       profile.Email,
+		Username:    username,
+		DisplayName: profile.DisplayName,
+		FirstName:   profile.FirstName,
+		LastName:    profile.LastName,
+		VerifyFlag:  profile.EmailVerified,
+	}
+	err = userRepository.Create(&user)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errs.NewUnprocessableEntity("Username or email duplicated")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	return &user, nil
+}
+
+// fetchProfile redeems the authorization code and maps the provider's claims,
+// taken from the ID token and, when available, the userinfo endpoint.
+func (s federationService) fetchProfile(
+	provider *repository.IdentityProvider,
+	code string,
+	state *externalAuthState,
+) (*externalProfile, error) {
+	metadata, err := s.getMetadata(provider, false)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {provider.RedirectURI},
+		"client_id":     {provider.ClientID},
+		"code_verifier": {state.CodeVerifier},
+	}
+	if provider.ClientSecretEncrypted != "" {
+		clientSecret, err := common.Decrypt(provider.ClientSecretEncrypted, s.configEnv.SecretEncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		form.Set("client_secret", clientSecret)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, metadata.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var tokenResponse externalTokenResponse
+	err = s.doJSON(req, &tokenResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	// ID tokens of providers without an issuer cannot be validated, those
+	// providers are read through their userinfo endpoint only.
+	claims := map[string]any{}
+	if tokenResponse.IDToken != "" && provider.Issuer != "" {
+		idClaims, err := s.validateIDToken(provider, tokenResponse.IDToken, state.Nonce)
+		if err != nil {
+			return nil, err
+		}
+		claims = idClaims
+	} else if metadata.userinfoEndpoint == "" {
+		return nil, errors.New("provider returned no id token and has no userinfo endpoint")
+	}
+
+	if metadata.userinfoEndpoint != "" && tokenResponse.AccessToken != "" {
+		req, err := http.NewRequest(http.MethodGet, metadata.userinfoEndpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+tokenResponse.AccessToken)
+
+		var userinfo map[string]any
+		err = s.doJSON(req, &userinfo)
+		if err != nil {
+			return nil, err
+		}
+		if sub, ok := claims["sub"]; ok && fmt.Sprint(sub) != fmt.Sprint(userinfo["sub"]) {
+			return nil, errors.New("userinfo subject does not match id token")
+		}
+		for key, value := range userinfo {
+			claims[key] = value
+		}
+	}
+
+	mapping := map[string]string{}
+	for field, claim := range defaultClaimMapping {
+		mapping[field] = claim
+	}
+	for field, claim := range provider.ClaimMapping {
+		mapping[field] = claim
+	}
+
+	profile := externalProfile{
+		Subject:     claimString(claims, mapping["subject"]),
+		Email:       claimString(claims, mapping["email"]),
+		Username:    claimString(claims, mapping["username"]),
+		DisplayName: claimString(claims, mapping["display_name"]),
+		FirstName:   claimString(claims, mapping["first_name"]),
+		LastName:    claimString(claims, mapping["last_name"]),
+	}
+	profile.EmailVerified, _ = strconv.ParseBool(claimString(claims, mapping["email_verified"]))
+	if profile.Subject == "" {
+		return nil, errors.New("provider returned no subject")
+	}
+
+	return &profile, nil
+}
+
+func (s federationService) validateIDToken(
+	provider *repository.IdentityProvider,
+	idToken string,
+	nonce string,
+) (map[string]any, error) {
+	metadata, err := s.getMetadata(provider, false)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := common.ValidateExternalToken(idToken, metadata.keys)
+	if !ok {
+		// The provider may have rotated its keys since they were cached.
+		metadata, err = s.getMetadata(provider, true)
+		if err != nil {
+			return nil, err
+		}
+		claims, ok = common.ValidateExternalToken(idToken, metadata.keys)
+		if !ok {
+			return nil, errors.New("id token signature is invalid")
+		}
+	}
+
+	// Without an issuer there is nothing to check the token against.
+	if provider.Issuer == "" || !claims.VerifyIssuer(provider.Issuer, true) {
+		return nil, errors.New("id token issuer is invalid")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("id token has no expiry")
+	}
+	if !slices.Contains(getAudience(claims), provider.ClientID) {
+		return nil, errors.New("id token audience is invalid")
+	}
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, errors.New("id token nonce is invalid")
+	}
+
+	return claims, nil
+}
+
+// getMetadata returns the provider endpoints and signing keys, discovered
+// from the issuer and cached per provider until it expires or the provider
+// is changed. Explicitly configured endpoints win.
+func (s federationService) getMetadata(
+	provider *repository.IdentityProvider,
+	force bool,
+) (*providerMetadata, error) {
+	s.metadataMutex.Lock()
+	cached, ok := s.metadata[provider.ID]
+	s.metadataMutex.Unlock()
+	if ok && !force &&
+		cached.providerUpdatedAt.Equal(provider.UpdatedAt) &&
+		time.Since(cached.fetchedAt) < externalMetadataCacheTTL {
+		return cached, nil
+	}
+
+	metadata := providerMetadata{
+		authorizationEndpoint: provider.AuthorizationEndpoint,
+		tokenEndpoint:         provider.TokenEndpoint,
+		userinfoEndpoint:      provider.UserinfoEndpoint,
+		jwksURI:               provider.JwksURI,
+		providerUpdatedAt:     provider.UpdatedAt,
+		fetchedAt:             time.Now(),
+	}
+
+	if provider.Issuer != "" {
+		req, err := http.NewRequest(
+			http.MethodGet,
+			strings.TrimSuffix(provider.Issuer, "/")+"/.well-known/openid-configuration",
+			nil,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		var discovery model.OpenIDConfigurationResponse
+		err = s.doJSON(req, &discovery)
+		if err != nil {
+			return nil, err
+		}
+		if discovery.Issuer != provider.Issuer {
+			return nil, fmt.Errorf("discovered issuer %q does not match %q", discovery.Issuer, provider.Issuer)
+		}
+
+		metadata.authorizationEndpoint = common.TernaryIf(
+			metadata.authorizationEndpoint != "",
+			metadata.authorizationEndpoint,
+			discovery.AuthorizationEndpoint,
+		)
+		metadata.tokenEndpoint = common.TernaryIf(
+			metadata.tokenEndpoint != "",
+			metadata.tokenEndpoint,
+			discovery.TokenEndpoint,
+		)
+		metadata.userinfoEndpoint = common.TernaryIf(
+			metadata.userinfoEndpoint != "",
+			metadata.userinfoEndpoint,
+			discovery.UserinfoEndpoint,
+		)
+		metadata.jwksURI = common.TernaryIf(metadata.jwksURI != "", metadata.jwksURI, discovery.JwksURI)
+	}
+
+	if metadata.jwksURI != "" {
+		req, err := http.NewRequest(http.MethodGet, metadata.jwksURI, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var jwks model.JwksResponse
+		err = s.doJSON(req, &jwks)
+		if err != nil {
+			return nil, err
+		}
+		metadata.keys = jwks.Keys
+	}
+
+	// Drop expired entries too, e.g. of deleted providers.
+	s.metadataMutex.Lock()
+	for id, entry := range s.metadata {
+		if time.Since(entry.fetchedAt) >= externalMetadataCacheTTL {
+			delete(s.metadata, id)
+		}
+	}
+	s.metadata[provider.ID] = &metadata
+	s.metadataMutex.Unlock()
+
+	return &metadata, nil
+}
+
+func (s federationService) doJSON(req *http.Request, out any) error {
+	req.Header.Set("Accept", "application/json")
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned status %d", req.Method, req.URL.Host, res.StatusCode)
+	}
+
+	decoder := json.NewDecoder(res.Body)
+	decoder.UseNumber()
+	return decoder.Decode(out)
+}
+
+// claimString reads a claim as a string, providers disagree on whether ids
+// and flags are strings, numbers or booleans.
+func claimString(claims map[string]any, name string) string {
+	switch value := claims[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
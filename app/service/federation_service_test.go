@@ -0,0 +1,456 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/common"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	testProviderClientID = "lazy-auth"
+	testProviderSubject  = "idp-subject"
+)
+
+func newTestRSAKey(keyId string) *common.SigningKey {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return &common.SigningKey{KeyID: keyId, PrivateKey: privateKey}
+}
+
+// Keys of the stand-in identity provider, "other" is never published.
+var testProviderKeys = sync.OnceValue(func() map[string]*common.SigningKey {
+	return map[string]*common.SigningKey{
+		"first":  newTestRSAKey("first"),
+		"second": newTestRSAKey("second"),
+		"other":  newTestRSAKey("other"),
+	}
+})
+
+type testAuthorization struct {
+	codeChallenge string
+	nonce         string
+}
+
+// testIdentityProvider is a minimal OpenID provider: discovery, JWKS, a token
+// endpoint that checks PKCE and a userinfo endpoint.
+type testIdentityProvider struct {
+	server *httptest.Server
+
+	mu             sync.Mutex
+	authorizations map[string]testAuthorization
+	publishedKey   *common.SigningKey
+	signingKey     *common.SigningKey
+	idToken        func(claims jwt.MapClaims) string
+	userinfo       map[string]any
+}
+
+func newTestIdentityProvider(t *testing.T) *testIdentityProvider {
+	keys := testProviderKeys()
+	idp := &testIdentityProvider{
+		authorizations: map[string]testAuthorization{},
+		publishedKey:   keys["first"],
+		signingKey:     keys["first"],
+		userinfo:       map[string]any{"sub": testProviderSubject},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, model.OpenIDConfigurationResponse{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			UserinfoEndpoint:      idp.server.URL + "/userinfo",
+			JwksURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		writeTestJSON(w, model.JwksResponse{Keys: []model.JsonWebKey{idp.publishedKey.JsonWebKey()}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer idp-access-token" || idp.userinfo == nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeTestJSON(w, idp.userinfo)
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func writeTestJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// approve plays the user signing in at the provider: it reads the
+// authorization request and returns the code the browser is redirected with.
+func (idp *testIdentityProvider) approve(t *testing.T, redirectTo string) string {
+	t.Helper()
+
+	authorizeURL, err := url.Parse(redirectTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authorizeURL.Query()
+	if authorizeURL.Path != "/authorize" ||
+		query.Get("client_id") != testProviderClientID ||
+		query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization request = %s", redirectTo)
+	}
+
+	code, err := common.GenerateSecret(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.mu.Lock()
+	idp.authorizations[code] = testAuthorization{
+		codeChallenge: query.Get("code_challenge"),
+		nonce:         query.Get("nonce"),
+	}
+	idp.mu.Unlock()
+	return code
+}
+
+func (idp *testIdentityProvider) token(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	authorization, ok := idp.authorizations[r.PostFormValue("code")]
+	delete(idp.authorizations, r.PostFormValue("code"))
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok ||
+		r.PostFormValue("client_id") != testProviderClientID ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != authorization.codeChallenge {
+		w.WriteHeader(http.StatusBadRequest)
+		writeTestJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            testProviderClientID,
+		"sub":            testProviderSubject,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"nonce":          authorization.nonce,
+		"email":          "jdoe@example.com",
+		"email_verified": true,
+	}
+	idToken := ""
+	if idp.idToken != nil {
+		idToken = idp.idToken(claims)
+	} else {
+		idToken, _ = idp.signingKey.Sign(claims)
+	}
+	writeTestJSON(w, externalTokenResponse{AccessToken: "idp-access-token", IDToken: idToken})
+}
+
+type federationTestEnv struct {
+	idp     *testIdentityProvider
+	service FederationService
+	repos   *testRepositories
+	mailer  *fakeMailer
+}
+
+func newFederationTestEnv(t *testing.T) *federationTestEnv {
+	idp := newTestIdentityProvider(t)
+
+	repos := newTestRepositories()
+	repos.identityProviders.providers["acme"] = repository.IdentityProvider{
+		ID:          "provider-1",
+		Slug:        "acme",
+		Name:        "Acme",
+		Issuer:      idp.server.URL,
+		ClientID:    testProviderClientID,
+		RedirectURI: testIssuer + "/login/acme/callback",
+	}
+	// legacy has no issuer, its users are read from userinfo only.
+	repos.identityProviders.providers["legacy"] = repository.IdentityProvider{
+		ID:                    "provider-2",
+		Slug:                  "legacy",
+		Name:                  "Legacy",
+		ClientID:              testProviderClientID,
+		AuthorizationEndpoint: idp.server.URL + "/authorize",
+		TokenEndpoint:         idp.server.URL + "/token",
+		UserinfoEndpoint:      idp.server.URL + "/userinfo",
+		RedirectURI:           testIssuer + "/login/legacy/callback",
+	}
+	repos.userIdentities.identities["identity-1"] = repository.UserIdentity{
+		ID:         "identity-1",
+		UserID:     "user-1",
+		ProviderID: "provider-1",
+		Subject:    testProviderSubject,
+	}
+	repos.userIdentities.identities["identity-2"] = repository.UserIdentity{
+		ID:         "identity-2",
+		UserID:     "user-1",
+		ProviderID: "provider-2",
+		Subject:    testProviderSubject,
+	}
+
+	configEnv := newTestConfigEnv()
+	mailer := newFakeMailer()
+	return &federationTestEnv{
+		idp: idp,
+		service: NewFederationService(
+			repos.identityProviders,
+			repos.userIdentities,
+			nil,
+			repos.users,
+			repos.roles,
+			repos.sessions,
+			NewEmailOtpService(repos.emailOtps, repos.users, repos.sessions, mailer, configEnv),
+			nil,
+			configEnv,
+		),
+		repos:  repos,
+		mailer: mailer,
+	}
+}
+
+// signIn runs the whole flow for slug: authorize, approve at the provider and
+// call back with the browser binding.
+func (env *federationTestEnv) signIn(t *testing.T, slug string) (*model.TokenResponse, error) {
+	t.Helper()
+
+	authorizeResp, binding, err := env.service.Authorize(slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := env.idp.approve(t, authorizeResp.RedirectTo)
+	return env.service.Callback(slug, model.ExternalCallbackRequest{Code: code, State: authorizeResp.State}, binding)
+}
+
+func TestFederationCallback(t *testing.T) {
+	env := newFederationTestEnv(t)
+
+	tokenResp, err := env.signIn(t, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, ok := common.ValidateToken(tokenResp.AccessToken, testJwtTokenSecret)
+	if !ok || claims.Subject != "user-1" {
+		t.Errorf("access token claims = %+v", claims)
+	}
+	if identity := env.repos.userIdentities.identities["identity-1"]; identity.Email != "jdoe@example.com" {
+		t.Errorf("identity email = %q, want the email of the ID token", identity.Email)
+	}
+}
+
+func TestFederationCallbackAsksForMfa(t *testing.T) {
+	env := newFederationTestEnv(t)
+	user := env.repos.users.users["user-1"]
+	user.EmailMfaFlag = true
+	env.repos.users.users["user-1"] = user
+
+	tokenResp, err := env.signIn(t, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tokenResp.MfaRequired || tokenResp.AccessToken != "" || len(env.repos.sessions.sessions) != 0 {
+		t.Errorf("token response = %+v, want only an MFA token", tokenResp)
+	}
+	if mail := env.mailer.next(t); mail.to != user.Email {
+		t.Errorf("code was sent to %s, want %s", mail.to, user.Email)
+	}
+}
+
+func TestFederationCallbackRejectsIDToken(t *testing.T) {
+	keys := testProviderKeys()
+	tests := []struct {
+		name    string
+		idToken func(claims jwt.MapClaims) string
+	}{
+		{"no expiry", func(claims jwt.MapClaims) string {
+			delete(claims, "exp")
+			token, _ := keys["first"].Sign(claims)
+			return token
+		}},
+		{"expired", func(claims jwt.MapClaims) string {
+			claims["exp"] = time.Now().Add(-time.Minute).Unix()
+			token, _ := keys["first"].Sign(claims)
+			return token
+		}},
+		{"other issuer", func(claims jwt.MapClaims) string {
+			claims["iss"] = "https://evil.example.com"
+			token, _ := keys["first"].Sign(claims)
+			return token
+		}},
+		{"no issuer", func(claims jwt.MapClaims) string {
+			delete(claims, "iss")
+			token, _ := keys["first"].Sign(claims)
+			return token
+		}},
+		{"other audience", func(claims jwt.MapClaims) string {
+			claims["aud"] = []string{"another-client"}
+			token, _ := keys["first"].Sign(claims)
+			return token
+		}},
+		{"other nonce", func(claims jwt.MapClaims) string {
+			claims["nonce"] = "replayed"
+			token, _ := keys["first"].Sign(claims)
+			return token
+		}},
+		{"unpublished key", func(claims jwt.MapClaims) string {
+			token, _ := keys["other"].Sign(claims)
+			return token
+		}},
+		{"symmetric signature", func(claims jwt.MapClaims) string {
+			// Signed with the public modulus, as in the RS256 to HS256 confusion.
+			secret := keys["first"].PrivateKey.PublicKey.N.Bytes()
+			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+			return token
+		}},
+		{"unsigned", func(claims jwt.MapClaims) string {
+			token, _ := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return token
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := newFederationTestEnv(t)
+			env.idp.idToken = test.idToken
+
+			_, err := env.signIn(t, "acme")
+			assertAppError(t, err, http.StatusUnauthorized, "identity provider sign in failed")
+		})
+	}
+}
+
+func TestFederationCallbackBindsState(t *testing.T) {
+	env := newFederationTestEnv(t)
+
+	authorizeResp, binding, err := env.service.Authorize("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherResp, otherBinding, err := env.service.Authorize("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	linkResp, linkBinding, err := env.service.LinkAuthorize("user-1", "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		slug    string
+		state   string
+		binding string
+	}{
+		{"no binding", "acme", authorizeResp.State, ""},
+		{"binding of another sign in", "acme", authorizeResp.State, otherBinding},
+		{"state of another sign in", "acme", otherResp.State, binding},
+		{"other provider", "legacy", authorizeResp.State, binding},
+		{"tampered state", "acme", authorizeResp.State[:len(authorizeResp.State)-2] + "00", binding},
+		{"garbage state", "acme", "00", binding},
+		{"link state", "acme", linkResp.State, linkBinding},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code := env.idp.approve(t, authorizeResp.RedirectTo)
+			_, err := env.service.Callback(
+				test.slug,
+				model.ExternalCallbackRequest{Code: code, State: test.state},
+				test.binding,
+			)
+			assertAppError(t, err, http.StatusUnauthorized, "state is invalid")
+		})
+	}
+
+	// The same browser still completes its own sign in.
+	code := env.idp.approve(t, authorizeResp.RedirectTo)
+	_, err = env.service.Callback("acme", model.ExternalCallbackRequest{Code: code, State: authorizeResp.State}, binding)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFederationCallbackRefetchesRotatedKeys(t *testing.T) {
+	env := newFederationTestEnv(t)
+
+	_, err := env.signIn(t, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The provider rotates its key while the old JWKS is cached.
+	env.idp.mu.Lock()
+	env.idp.publishedKey = testProviderKeys()["second"]
+	env.idp.signingKey = testProviderKeys()["second"]
+	env.idp.mu.Unlock()
+
+	_, err = env.signIn(t, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFederationCallbackUserinfo(t *testing.T) {
+	env := newFederationTestEnv(t)
+
+	// A userinfo response about someone else than the ID token is refused.
+	env.idp.userinfo = map[string]any{"sub": "someone-else", "email": "other@example.com"}
+	_, err := env.signIn(t, "acme")
+	assertAppError(t, err, http.StatusUnauthorized, "identity provider sign in failed")
+
+	env.idp.userinfo = map[string]any{"sub": testProviderSubject, "name": "John Doe"}
+	_, err = env.signIn(t, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFederationCallbackWithoutIssuer(t *testing.T) {
+	env := newFederationTestEnv(t)
+
+	// Without an issuer the ID token cannot be checked, even one signed with
+	// an unknown key and for another audience is ignored in favour of
+	// userinfo.
+	env.idp.idToken = func(claims jwt.MapClaims) string {
+		claims["sub"] = "forged"
+		claims["aud"] = "another-client"
+		token, _ := testProviderKeys()["other"].Sign(claims)
+		return token
+	}
+	env.idp.userinfo = map[string]any{"sub": testProviderSubject, "email": "jdoe@example.com"}
+
+	tokenResp, err := env.signIn(t, "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, ok := common.ValidateToken(tokenResp.AccessToken, testJwtTokenSecret)
+	if !ok || claims.Subject != "user-1" {
+		t.Errorf("access token claims = %+v", claims)
+	}
+
+	// When userinfo fails there is nothing trustworthy to sign in with.
+	env.idp.userinfo = nil
+	_, err = env.signIn(t, "legacy")
+	assertAppError(t, err, http.StatusUnauthorized, "identity provider sign in failed")
+}
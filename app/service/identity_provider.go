@@ -0,0 +1,14 @@
+package service
+
+import "lazy-auth/app/model"
+
+type IdentityProviderService interface {
+	CreateProvider(body model.CreateIdentityProviderRequest) (*model.IdentityProviderResponse, error)
+	GetProviders(query model.QueryIdentityProvider) (*model.IdentityProviderPageResponse, error)
+	GetProviderById(id string) (*model.IdentityProviderResponse, error)
+	UpdateProviderById(
+		id string,
+		body model.UpdateIdentityProviderRequest,
+	) (*model.IdentityProviderResponse, error)
+	DeleteProviderById(id string) error
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"gorm.io/gorm"
+)
+
+type identityProviderService struct {
+	identityProviderRepository repository.IdentityProviderRepository
+	configEnv                  config.ConfigEnv
+}
+
+func NewIdentityProviderService(
+	identityProviderRepository repository.IdentityProviderRepository,
+	configEnv config.ConfigEnv,
+) IdentityProviderService {
+	return identityProviderService{
+		identityProviderRepository: identityProviderRepository,
+		configEnv:                  configEnv,
+	}
+}
+
+func buildIdentityProviderResponse(provider repository.IdentityProvider) model.IdentityProviderResponse {
+	return model.IdentityProviderResponse{
+		ID:                    provider.ID,
+		Slug:                  provider.Slug,
+		Name:                  provider.Name,
+		Issuer:                provider.Issuer,
+		ClientID:              provider.ClientID,
+		Scopes:                provider.Scopes,
+		ClaimMapping:          provider.ClaimMapping,
+		AuthorizationEndpoint: provider.AuthorizationEndpoint,
+		TokenEndpoint:         provider.TokenEndpoint,
+		UserinfoEndpoint:      provider.UserinfoEndpoint,
+		JwksURI:               provider.JwksURI,
+		RedirectURI:           provider.RedirectURI,
+		AllowSignUp:           provider.AllowSignUp,
+		LinkByVerifiedEmail:   provider.LinkByVerifiedEmail,
+		DisabledFlag:          provider.DisabledFlag,
+		CreatedAt:             provider.CreatedAt,
+	}
+}
+
+func (s identityProviderService) CreateProvider(
+	providerReq model.CreateIdentityProviderRequest,
+) (*model.IdentityProviderResponse, error) {
+	provider := repository.IdentityProvider{
+		Slug:                  providerReq.Slug,
+		Name:                  providerReq.Name,
+		Issuer:                providerReq.Issuer,
+		ClientID:              providerReq.ClientID,
+		Scopes:                providerReq.Scopes,
+		ClaimMapping:          providerReq.ClaimMapping,
+		AuthorizationEndpoint: providerReq.AuthorizationEndpoint,
+		TokenEndpoint:         providerReq.TokenEndpoint,
+		UserinfoEndpoint:      providerReq.UserinfoEndpoint,
+		JwksURI:               providerReq.JwksURI,
+		RedirectURI:           providerReq.RedirectURI,
+		AllowSignUp:           providerReq.AllowSignUp,
+		LinkByVerifiedEmail:   providerReq.LinkByVerifiedEmail,
+	}
+
+	err := s.setClientSecret(&provider, providerReq.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateIdentityProvider(&provider); err != nil {
+		return nil, errs.NewValidationError(err.Error())
+	}
+
+	err = s.identityProviderRepository.Create(&provider)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errs.NewUnprocessableEntity("identity provider slug duplicated")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	providerResponse := buildIdentityProviderResponse(provider)
+	return &providerResponse, nil
+}
+
+func (s identityProviderService) GetProviders(
+	query model.QueryIdentityProvider,
+) (*model.IdentityProviderPageResponse, error) {
+	providers, total, err := s.identityProviderRepository.GetMany(query)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	providersResponse := common.Map(providers, buildIdentityProviderResponse)
+	meta := common.BuildMetaPagination(&total, query.Limit, query.Offset)
+
+	return &model.IdentityProviderPageResponse{Meta: meta, Data: providersResponse}, nil
+}
+
+func (s identityProviderService) GetProviderById(id string) (*model.IdentityProviderResponse, error) {
+	provider, err := s.identityProviderRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("identity provider not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	providerResponse := buildIdentityProviderResponse(*provider)
+	return &providerResponse, nil
+}
+
+func (s identityProviderService) UpdateProviderById(
+	id string,
+	providerReq model.UpdateIdentityProviderRequest,
+) (*model.IdentityProviderResponse, error) {
+	provider, err := s.identityProviderRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("identity provider not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	if providerReq.Name != nil {
+		provider.Name = *providerReq.Name
+	}
+
+	if providerReq.Issuer != nil {
+		provider.Issuer = *providerReq.Issuer
+	}
+
+	if providerReq.ClientID != nil {
+		provider.ClientID = *providerReq.ClientID
+	}
+
+	if providerReq.ClientSecret != nil {
+		err = s.setClientSecret(provider, *providerReq.ClientSecret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if providerReq.Scopes != nil {
+		provider.Scopes = *providerReq.Scopes
+	}
+
+	if providerReq.ClaimMapping != nil {
+		provider.ClaimMapping = *providerReq.ClaimMapping
+	}
+
+	if providerReq.AuthorizationEndpoint != nil {
+		provider.AuthorizationEndpoint = *providerReq.AuthorizationEndpoint
+	}
+
+	if providerReq.TokenEndpoint != nil {
+		provider.TokenEndpoint = *providerReq.TokenEndpoint
+	}
+
+	if providerReq.UserinfoEndpoint != nil {
+		provider.UserinfoEndpoint = *providerReq.UserinfoEndpoint
+	}
+
+	if providerReq.JwksURI != nil {
+		provider.JwksURI = *providerReq.JwksURI
+	}
+
+	if providerReq.RedirectURI != nil {
+		provider.RedirectURI = *providerReq.RedirectURI
+	}
+
+	if providerReq.AllowSignUp != nil {
+		provider.AllowSignUp = *providerReq.AllowSignUp
+	}
+
+	if providerReq.LinkByVerifiedEmail != nil {
+		provider.LinkByVerifiedEmail = *providerReq.LinkByVerifiedEmail
+	}
+
+	if providerReq.DisabledFlag != nil {
+		provider.DisabledFlag = *providerReq.DisabledFlag
+	}
+
+	if err := validateIdentityProvider(provider); err != nil {
+		return nil, errs.NewValidationError(err.Error())
+	}
+
+	err = s.identityProviderRepository.Update(provider)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	providerResponse := buildIdentityProviderResponse(*provider)
+	return &providerResponse, nil
+}
+
+func (s identityProviderService) DeleteProviderById(id string) error {
+	_, err := s.identityProviderRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewNotFoundError("identity provider not found")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	err = s.identityProviderRepository.DeleteById(id)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
+
+// setClientSecret stores the provider's client secret encrypted at rest, an
+// empty secret is kept empty for providers using PKCE only.
+func (s identityProviderService) setClientSecret(
+	provider *repository.IdentityProvider,
+	clientSecret string,
+) error {
+	if clientSecret == "" {
+		provider.ClientSecretEncrypted = ""
+		return nil
+	}
+
+	encrypted, err := common.Encrypt(clientSecret, s.configEnv.SecretEncryptionKey)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	provider.ClientSecretEncrypted = encrypted
+	return nil
+}
+
+func validateIdentityProvider(provider *repository.IdentityProvider) error {
+	if provider.Issuer == "" &&
+		(provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.UserinfoEndpoint == "") {
+		return errors.New("issuer or authorization, token and userinfo endpoints are required")
+	}
+	// ID tokens are only accepted with an issuer to check them against.
+	if provider.Issuer == "" && provider.JwksURI != "" {
+		return errors.New("issuer is required to validate id tokens")
+	}
+
+	for _, endpoint := range []string{
+		provider.Issuer,
+		provider.AuthorizationEndpoint,
+		provider.TokenEndpoint,
+		provider.UserinfoEndpoint,
+		provider.JwksURI,
+		provider.RedirectURI,
+	} {
+		if endpoint == "" {
+			continue
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil || !isWebURI(u) {
+			return errors.New("endpoint " + endpoint + " is invalid")
+		}
+	}
+
+	for field := range provider.ClaimMapping {
+		if !slices.Contains(externalClaimFields, field) {
+			return errors.New("claim mapping field " + field + " is not supported")
+		}
+	}
+
+	return nil
+}
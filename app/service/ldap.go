@@ -0,0 +1,8 @@
+package service
+
+import "lazy-auth/app/repository"
+
+type LdapService interface {
+	Enabled() bool
+	Authenticate(username string, password string) (*repository.User, error)
+}
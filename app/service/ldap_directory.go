@@ -0,0 +1,305 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"lazy-auth/app/repository"
+	"lazy-auth/config"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+// ldapEntry is a directory user reduced to the fields lazy-auth keeps.
+type ldapEntry struct {
+	DN          string
+	Username    string
+	Email       string
+	DisplayName string
+	FirstName   string
+	LastName    string
+	Groups      []string
+}
+
+type ldapGroupRole struct {
+	GroupDN string
+	Role    string
+}
+
+// ldapDirectory holds the connection settings and entry mapping shared by
+// login and directory sync.
+type ldapDirectory struct {
+	roleRepository repository.RoleRepository
+	configEnv      config.ConfigEnv
+	tlsConfig      *tls.Config
+	groupRoles     []ldapGroupRole
+}
+
+func newLdapDirectory(
+	roleRepository repository.RoleRepository,
+	configEnv config.ConfigEnv,
+) ldapDirectory {
+	return ldapDirectory{
+		roleRepository: roleRepository,
+		configEnv:      configEnv,
+		tlsConfig:      buildLdapTLSConfig(configEnv),
+		groupRoles:     parseLdapGroupRoleMapping(configEnv.LdapGroupRoleMapping),
+	}
+}
+
+func (d ldapDirectory) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(
+		d.configEnv.LdapURL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: externalRequestTimeout}),
+		ldap.DialWithTLSConfig(d.tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(externalRequestTimeout)
+
+	if d.configEnv.LdapStartTLS {
+		err = conn.StartTLS(d.tlsConfig)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (d ldapDirectory) bindServiceAccount(conn *ldap.Conn) error {
+	if d.configEnv.LdapBindDN == "" {
+		return nil
+	}
+	return conn.Bind(d.configEnv.LdapBindDN, d.configEnv.LdapBindPassword)
+}
+
+var errLdapUserNotFound = errors.New("ldap user not found")
+
+func (d ldapDirectory) searchUser(conn *ldap.Conn, username string) (*ldapEntry, error) {
+	filter := fmt.Sprintf(d.configEnv.LdapUserFilter, ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.configEnv.LdapBaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		int(externalRequestTimeout.Seconds()),
+		false,
+		filter,
+		d.userAttributes(),
+		nil,
+	))
+	if err != nil {
+		// Hitting the size limit means more than one match.
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) ||
+			ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, errLdapUserNotFound
+		}
+		return nil, err
+	}
+	// More than one match is ambiguous and treated like no match.
+	if len(result.Entries) != 1 {
+		return nil, errLdapUserNotFound
+	}
+
+	entry := d.mapEntry(result.Entries[0])
+	if d.configEnv.LdapGroupFilter != "" {
+		groups, err := d.searchGroups(conn, entry.DN)
+		if err != nil {
+			return nil, err
+		}
+		entry.Groups = append(entry.Groups, groups...)
+	}
+	return entry, nil
+}
+
+// searchUsers lists every user entry the sync filter matches.
+func (d ldapDirectory) searchUsers(conn *ldap.Conn) ([]ldapEntry, error) {
+	filter := d.configEnv.LdapSyncFilter
+	if filter == "" {
+		filter = strings.ReplaceAll(d.configEnv.LdapUserFilter, "%s", "*")
+	}
+
+	result, err := conn.SearchWithPaging(ldap.NewSearchRequest(
+		d.configEnv.LdapBaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		0,
+		false,
+		filter,
+		d.userAttributes(),
+		nil,
+	), 500)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ldapEntry, 0, len(result.Entries))
+	for _, result := range result.Entries {
+		entry := d.mapEntry(result)
+		if d.configEnv.LdapGroupFilter != "" {
+			groups, err := d.searchGroups(conn, entry.DN)
+			if err != nil {
+				return nil, err
+			}
+			entry.Groups = append(entry.Groups, groups...)
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+func (d ldapDirectory) searchGroups(conn *ldap.Conn, userDN string) ([]string, error) {
+	filter := fmt.Sprintf(d.configEnv.LdapGroupFilter, ldap.EscapeFilter(userDN))
+	result, err := conn.SearchWithPaging(ldap.NewSearchRequest(
+		d.configEnv.LdapGroupBaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		0,
+		int(externalRequestTimeout.Seconds()),
+		false,
+		filter,
+		[]string{"dn"},
+		nil,
+	), 500)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]string, 0, len(result.Entries))
+	for _, group := range result.Entries {
+		groups = append(groups, group.DN)
+	}
+	return groups, nil
+}
+
+func (d ldapDirectory) userAttributes() []string {
+	return []string{
+		d.configEnv.LdapUsernameAttribute,
+		d.configEnv.LdapEmailAttribute,
+		d.configEnv.LdapDisplayNameAttribute,
+		d.configEnv.LdapFirstNameAttribute,
+		d.configEnv.LdapLastNameAttribute,
+		d.configEnv.LdapGroupAttribute,
+	}
+}
+
+func (d ldapDirectory) mapEntry(entry *ldap.Entry) *ldapEntry {
+	return &ldapEntry{
+		DN:          entry.DN,
+		Username:    entry.GetEqualFoldAttributeValue(d.configEnv.LdapUsernameAttribute),
+		Email:       strings.TrimSpace(entry.GetEqualFoldAttributeValue(d.configEnv.LdapEmailAttribute)),
+		DisplayName: entry.GetEqualFoldAttributeValue(d.configEnv.LdapDisplayNameAttribute),
+		FirstName:   entry.GetEqualFoldAttributeValue(d.configEnv.LdapFirstNameAttribute),
+		LastName:    entry.GetEqualFoldAttributeValue(d.configEnv.LdapLastNameAttribute),
+		Groups:      entry.GetEqualFoldAttributeValues(d.configEnv.LdapGroupAttribute),
+	}
+}
+
+// resolveRole returns the role of the first configured group the entry is a
+// member of, or the default role.
+func (d ldapDirectory) resolveRole(entry *ldapEntry) (*repository.Role, error) {
+	roleName := d.configEnv.LdapDefaultRole
+	for _, groupRole := range d.groupRoles {
+		if containsDN(entry.Groups, groupRole.GroupDN) {
+			roleName = groupRole.Role
+			break
+		}
+	}
+
+	role, err := d.roleRepository.GetByName(roleName)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("ldap role %s does not exist", roleName)
+		}
+		return nil, err
+	}
+	return role, nil
+}
+
+// applyLdapEntry copies the directory fields onto the user and returns the
+// names of the fields that changed.
+func applyLdapEntry(user *repository.User, entry *ldapEntry, role *repository.Role) []string {
+	var fields []string
+	set := func(field string, target *string, value string) {
+		if *target != value {
+			*target = value
+			fields = append(fields, field)
+		}
+	}
+
+	set("username", &user.Username, entry.Username)
+	set("email", &user.Email, entry.Email)
+	set("display_name", &user.DisplayName, entry.DisplayName)
+	set("first_name", &user.FirstName, entry.FirstName)
+	set("last_name", &user.LastName, entry.LastName)
+	set("role", &user.RoleID, role.ID)
+	set("dn", &user.LdapDN, entry.DN)
+
+	return fields
+}
+
+func buildLdapTLSConfig(configEnv config.ConfigEnv) *tls.Config {
+	if configEnv.LdapURL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(configEnv.LdapURL)
+	if err != nil {
+		panic(err)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: configEnv.LdapTLSSkipVerify,
+	}
+	if configEnv.LdapTLSCAFile != "" {
+		pem, err := os.ReadFile(configEnv.LdapTLSCAFile)
+		if err != nil {
+			panic(err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			panic(errors.New("GO_AUTH_LDAP_TLS_CA_FILE has no certificates"))
+		}
+	}
+	return tlsConfig
+}
+
+// parseLdapGroupRoleMapping reads "role=groupDN" pairs separated by ";", in
+// order of precedence.
+func parseLdapGroupRoleMapping(mapping string) []ldapGroupRole {
+	var groupRoles []ldapGroupRole
+	for _, pair := range strings.Split(mapping, ";") {
+		role, groupDN, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || role == "" || groupDN == "" {
+			continue
+		}
+		groupRoles = append(groupRoles, ldapGroupRole{GroupDN: groupDN, Role: role})
+	}
+	return groupRoles
+}
+
+// containsDN compares distinguished names ignoring case and spacing.
+func containsDN(dns []string, dn string) bool {
+	want, err := ldap.ParseDN(dn)
+	if err != nil {
+		return false
+	}
+	for _, value := range dns {
+		got, err := ldap.ParseDN(value)
+		if err == nil && got.EqualFold(want) {
+			return true
+		}
+	}
+	return false
+}
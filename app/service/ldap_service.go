@@ -0,0 +1,137 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/config"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+type ldapService struct {
+	userRepository repository.UserRepository
+	directory      ldapDirectory
+	configEnv      config.ConfigEnv
+}
+
+func NewLdapService(
+	userRepository repository.UserRepository,
+	roleRepository repository.RoleRepository,
+	configEnv config.ConfigEnv,
+) LdapService {
+	return ldapService{
+		userRepository: userRepository,
+		directory:      newLdapDirectory(roleRepository, configEnv),
+		configEnv:      configEnv,
+	}
+}
+
+func (s ldapService) Enabled() bool {
+	return s.configEnv.LdapURL != ""
+}
+
+// Authenticate verifies the password against the directory and creates or
+// updates the local user from the directory entry.
+func (s ldapService) Authenticate(username string, password string) (*repository.User, error) {
+	// An empty password is an unauthenticated bind, which most servers accept.
+	if username == "" || password == "" {
+		return nil, errs.NewUnauthorizedError("username or password is incorrect")
+	}
+
+	conn, err := s.directory.dial()
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	defer conn.Close()
+
+	var entry *ldapEntry
+	if s.configEnv.LdapUserDNTemplate != "" {
+		// Bind as the user, then read the entry with the user's own rights.
+		err = conn.Bind(fmt.Sprintf(s.configEnv.LdapUserDNTemplate, ldap.EscapeDN(username)), password)
+		if err != nil {
+			return nil, s.handleBindError(err)
+		}
+		entry, err = s.directory.searchUser(conn, username)
+	} else {
+		// Search with the service account, then bind as the entry found.
+		err = s.directory.bindServiceAccount(conn)
+		if err != nil {
+			zlog.Error(err)
+			return nil, errs.NewUnexpectedError()
+		}
+		entry, err = s.directory.searchUser(conn, username)
+		if err == nil {
+			err = conn.Bind(entry.DN, password)
+			if err != nil {
+				return nil, s.handleBindError(err)
+			}
+		}
+	}
+	if err != nil {
+		if errors.Is(err, errLdapUserNotFound) {
+			return nil, errs.NewUnauthorizedError("username or password is incorrect")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return s.upsertUser(entry)
+}
+
+func (s ldapService) handleBindError(err error) error {
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return errs.NewUnauthorizedError("username or password is incorrect")
+	}
+	zlog.Error(err)
+	return errs.NewUnexpectedError()
+}
+
+func (s ldapService) upsertUser(entry *ldapEntry) (*repository.User, error) {
+	if entry.Username == "" || entry.Email == "" {
+		return nil, errs.NewUnprocessableEntity("directory entry has no username or email")
+	}
+
+	role, err := s.directory.resolveRole(entry)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	user, err := s.userRepository.GetByUsername(entry.Username)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	if user != nil && user.LdapDN == "" {
+		// Local accounts are never taken over by a directory entry.
+		return nil, errs.NewUnprocessableEntity("a local account with this username already exists")
+	}
+	if user == nil {
+		user = &repository.User{Username: entry.Username}
+	}
+
+	applyLdapEntry(user, entry, role)
+	user.VerifyFlag = true
+	user.LastAccessAt = time.Now()
+
+	if user.ID == "" {
+		err = s.userRepository.Create(user)
+	} else {
+		err = s.userRepository.Update(user)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errs.NewUnprocessableEntity("an account with this email already exists")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	return user, nil
+}
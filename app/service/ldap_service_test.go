@@ -0,0 +1,485 @@
+package service
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"lazy-auth/app/repository"
+	"lazy-auth/config"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+type testLdapEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// testLdapServer is a stand-in directory that answers simple binds and
+// searches, enough for the requests ldapDirectory sends. Searches need a
+// bound connection, like most servers configured without anonymous access.
+type testLdapServer struct {
+	listener net.Listener
+
+	mu          sync.Mutex
+	entries     []testLdapEntry
+	connections int
+}
+
+func newTestLdapServer(t *testing.T, entries []testLdapEntry) *testLdapServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &testLdapServer{listener: listener, entries: entries}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.connections++
+			server.mu.Unlock()
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *testLdapServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *testLdapServer) setAttribute(dn string, attribute string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.dn, dn) {
+			entry.attributes[attribute] = values
+		}
+	}
+}
+
+func (s *testLdapServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	var boundDN string
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		switch request.Tag {
+		case ldap.ApplicationBindRequest:
+			name := request.Children[1].Value.(string)
+			password := request.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if entry := s.find(name); entry != nil && entry.password != "" && entry.password == password {
+				boundDN = entry.dn
+				code = ldap.LDAPResultSuccess
+			}
+			s.respond(conn, messageID, ldap.ApplicationBindResponse, code)
+
+		case ldap.ApplicationSearchRequest:
+			if boundDN == "" {
+				s.respond(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights)
+				continue
+			}
+			s.search(conn, messageID, request)
+
+		default:
+			return
+		}
+	}
+}
+
+func (s *testLdapServer) find(dn string) *testLdapEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.dn, dn) {
+			return &entry
+		}
+	}
+	return nil
+}
+
+func (s *testLdapServer) search(conn net.Conn, messageID int64, request *ber.Packet) {
+	baseDN := strings.ToLower(request.Children[0].Value.(string))
+	sizeLimit := request.Children[3].Value.(int64)
+	filter := request.Children[6]
+	var attributes []string
+	for _, attribute := range request.Children[7].Children {
+		attributes = append(attributes, attribute.Value.(string))
+	}
+
+	s.mu.Lock()
+	var matches []testLdapEntry
+	baseExists := false
+	for _, entry := range s.entries {
+		dn := strings.ToLower(entry.dn)
+		if dn == baseDN || strings.HasSuffix(dn, ","+baseDN) {
+			baseExists = true
+			if testLdapMatch(filter, entry) {
+				matches = append(matches, entry)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if !baseExists {
+		s.respond(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultNoSuchObject)
+		return
+	}
+	for i, entry := range matches {
+		if sizeLimit > 0 && int64(i) == sizeLimit {
+			s.respond(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSizeLimitExceeded)
+			return
+		}
+
+		result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+		result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, ""))
+		list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		for name, values := range entry.attributes {
+			if !testLdapRequested(attributes, name) {
+				continue
+			}
+			attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+			attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+			for _, value := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+			}
+			attribute.AppendChild(set)
+			list.AppendChild(attribute)
+		}
+		result.AppendChild(list)
+		s.write(conn, messageID, result)
+	}
+	s.respond(conn, messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)
+}
+
+func (s *testLdapServer) respond(conn net.Conn, messageID int64, application uint8, code uint16) {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ber.Tag(application), nil, "")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	s.write(conn, messageID, result)
+}
+
+func (s *testLdapServer) write(conn net.Conn, messageID int64, op *ber.Packet) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, ""))
+	packet.AppendChild(op)
+	conn.Write(packet.Bytes())
+}
+
+func testLdapRequested(attributes []string, name string) bool {
+	if len(attributes) == 0 {
+		return true
+	}
+	for _, attribute := range attributes {
+		if strings.EqualFold(attribute, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// testLdapMatch evaluates and, or, not, equality and presence filters,
+// comparing attribute names and values case-insensitively. Anything else
+// matches nothing.
+func testLdapMatch(filter *ber.Packet, entry testLdapEntry) bool {
+	values := func(name string) []string {
+		for attribute, values := range entry.attributes {
+			if strings.EqualFold(attribute, name) {
+				return values
+			}
+		}
+		return nil
+	}
+
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !testLdapMatch(child, entry) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if testLdapMatch(child, entry) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !testLdapMatch(filter.Children[0], entry)
+	case ldap.FilterEqualityMatch:
+		want := filter.Children[1].Data.String()
+		for _, value := range values(filter.Children[0].Data.String()) {
+			if strings.EqualFold(value, want) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(values(filter.Data.String())) > 0
+	}
+	return false
+}
+
+const (
+	testLdapBindDN   = "cn=reader,dc=example,dc=com"
+	testLdapPeopleDN = "ou=people,dc=example,dc=com"
+	testLdapGroupsDN = "ou=groups,dc=example,dc=com"
+)
+
+func testLdapPerson(uid string, attributes map[string][]string) testLdapEntry {
+	attributes["objectClass"] = []string{"top", "person", "inetOrgPerson"}
+	if _, ok := attributes["uid"]; !ok {
+		attributes["uid"] = []string{uid}
+	}
+	return testLdapEntry{
+		dn:         "uid=" + uid + "," + testLdapPeopleDN,
+		password:   uid + "-secret",
+		attributes: attributes,
+	}
+}
+
+type ldapTestEnv struct {
+	server    *testLdapServer
+	service   ldapService
+	users     *fakeUserRepository
+	repos     *testRepositories
+	configEnv config.ConfigEnv
+}
+
+func newLdapTestEnv(t *testing.T, configure ...func(*config.ConfigEnv)) *ldapTestEnv {
+	t.Helper()
+
+	server := newTestLdapServer(t, []testLdapEntry{
+		{dn: testLdapBindDN, password: "reader-secret", attributes: map[string][]string{"cn": {"reader"}}},
+		testLdapPerson("bob", map[string][]string{
+			"mail":        {"bob@example.com"},
+			"cn":          {"Bob Builder"},
+			"givenName":   {"Bob"},
+			"sn":          {"Builder"},
+			"memberOf":    {"CN=Admins, OU=Groups, DC=example, DC=com"},
+			"description": {"not requested"},
+		}),
+		testLdapPerson("carol", map[string][]string{"mail": {"carol@example.com"}}),
+		testLdapPerson("nomail", map[string][]string{}),
+		testLdapPerson("jdoe", map[string][]string{"mail": {"jdoe@corp.example.com"}}),
+		testLdapPerson("twin1", map[string][]string{"uid": {"twin"}, "mail": {"twin1@example.com"}}),
+		testLdapPerson("twin2", map[string][]string{"uid": {"twin"}, "mail": {"twin2@example.com"}}),
+		testLdapPerson("triplet1", map[string][]string{"uid": {"triplet"}, "mail": {"triplet1@example.com"}}),
+		testLdapPerson("triplet2", map[string][]string{"uid": {"triplet"}, "mail": {"triplet2@example.com"}}),
+		testLdapPerson("triplet3", map[string][]string{"uid": {"triplet"}, "mail": {"triplet3@example.com"}}),
+		{dn: `uid=smith\, john,` + testLdapPeopleDN, password: "smith-secret", attributes: map[string][]string{
+			"objectClass": {"person"},
+			"uid":         {"smith, john"},
+			"mail":        {"john.smith@example.com"},
+		}},
+		{dn: "cn=staff," + testLdapGroupsDN, attributes: map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"member":      {"uid=carol," + testLdapPeopleDN},
+		}},
+		{dn: "cn=admins," + testLdapGroupsDN, attributes: map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"member":      {"uid=bob," + testLdapPeopleDN},
+		}},
+	})
+
+	ldapConfig := func(configEnv *config.ConfigEnv) {
+		configEnv.LdapURL = server.url()
+		configEnv.LdapBindDN = testLdapBindDN
+		configEnv.LdapBindPassword = "reader-secret"
+		configEnv.LdapBaseDN = testLdapPeopleDN
+		configEnv.LdapUserFilter = "(&(objectClass=person)(uid=%s))"
+		configEnv.LdapUsernameAttribute = "uid"
+		configEnv.LdapEmailAttribute = "mail"
+		configEnv.LdapDisplayNameAttribute = "cn"
+		configEnv.LdapFirstNameAttribute = "givenName"
+		configEnv.LdapLastNameAttribute = "sn"
+		configEnv.LdapGroupAttribute = "memberOf"
+		configEnv.LdapGroupBaseDN = testLdapGroupsDN
+		configEnv.LdapGroupRoleMapping = "admin=cn=admins," + testLdapGroupsDN + ";staff=cn=staff," + testLdapGroupsDN
+		configEnv.LdapDefaultRole = "user"
+	}
+
+	// The seeded user-1 "jdoe" is a local account, the directory has an
+	// entry with the same uid.
+	repos := newTestRepositories()
+	repos.roles.roles["role-2"] = repository.Role{ID: "role-2", Name: "admin"}
+	repos.roles.roles["role-3"] = repository.Role{ID: "role-3", Name: "staff"}
+
+	env := ldapTestEnv{
+		server:    server,
+		users:     repos.users,
+		repos:     repos,
+		configEnv: newTestConfigEnv(append([]func(*config.ConfigEnv){ldapConfig}, configure...)...),
+	}
+	env.service = NewLdapService(repos.users, repos.roles, env.configEnv).(ldapService)
+	return &env
+}
+
+func TestLdapAuthenticate(t *testing.T) {
+	env := newLdapTestEnv(t)
+
+	user, err := env.service.Authenticate("bob", "bob-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ldapEntry{
+		DN:          "uid=bob," + testLdapPeopleDN,
+		Username:    "bob",
+		Email:       "bob@example.com",
+		DisplayName: "Bob Builder",
+		FirstName:   "Bob",
+		LastName:    "Builder",
+	}
+	got := ldapEntry{
+		DN:          user.LdapDN,
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("user = %+v, want %+v", got, want)
+	}
+	if user.RoleID != "role-2" || !user.VerifyFlag || user.LastAccessAt.IsZero() {
+		t.Errorf("role = %s, verified %v, last access %v", user.RoleID, user.VerifyFlag, user.LastAccessAt)
+	}
+	userID := user.ID
+
+	// Changes in the directory are copied on the next sign in.
+	env.server.setAttribute("uid=bob,"+testLdapPeopleDN, "mail", "bob@new.example.com")
+	env.server.setAttribute("uid=bob,"+testLdapPeopleDN, "memberOf")
+	user, err = env.service.Authenticate("bob", "bob-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != userID || user.Email != "bob@new.example.com" || user.RoleID != "role-1" {
+		t.Errorf("user = %s %s role %s", user.ID, user.Email, user.RoleID)
+	}
+	if len(env.users.users) != 2 {
+		t.Errorf("%d users, want 2", len(env.users.users))
+	}
+}
+
+func TestLdapAuthenticateRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		username  string
+		password  string
+		wantCode  int
+		wantError string
+	}{
+		{"wrong password", "bob", "carol-secret", 401, "username or password is incorrect"},
+		{"unknown user", "mallory", "mallory-secret", 401, "username or password is incorrect"},
+		{"wildcard username", "*", "bob-secret", 401, "username or password is incorrect"},
+		{"filter injection", "bob)(uid=*", "bob-secret", 401, "username or password is incorrect"},
+		{"ambiguous username", "twin", "twin1-secret", 401, "username or password is incorrect"},
+		{"ambiguous beyond the size limit", "triplet", "triplet1-secret", 401, "username or password is incorrect"},
+		{"entry without email", "nomail", "nomail-secret", 422, "directory entry has no username or email"},
+		{"local account", "jdoe", "jdoe-secret", 422, "a local account with this username already exists"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := newLdapTestEnv(t)
+
+			_, err := env.service.Authenticate(test.username, test.password)
+			assertAppError(t, err, test.wantCode, test.wantError)
+			if len(env.users.users) != 1 {
+				t.Error("a user was created")
+			}
+		})
+	}
+}
+
+func TestLdapAuthenticateEmptyPassword(t *testing.T) {
+	env := newLdapTestEnv(t)
+
+	// An empty password would be an unauthenticated bind, it must not
+	// reach the directory at all.
+	_, err := env.service.Authenticate("bob", "")
+	assertAppError(t, err, 401, "username or password is incorrect")
+	env.server.mu.Lock()
+	defer env.server.mu.Unlock()
+	if env.server.connections != 0 {
+		t.Errorf("%d connections were made", env.server.connections)
+	}
+}
+
+func TestLdapAuthenticateUserDNTemplate(t *testing.T) {
+	env := newLdapTestEnv(t, func(configEnv *config.ConfigEnv) {
+		configEnv.LdapBindDN = ""
+		configEnv.LdapBindPassword = ""
+		configEnv.LdapUserDNTemplate = "uid=%s," + testLdapPeopleDN
+	})
+
+	user, err := env.service.Authenticate("bob", "bob-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.LdapDN != "uid=bob,"+testLdapPeopleDN || user.RoleID != "role-2" {
+		t.Errorf("user = %s role %s", user.LdapDN, user.RoleID)
+	}
+
+	_, err = env.service.Authenticate("bob", "wrong")
+	assertAppError(t, err, 401, "username or password is incorrect")
+
+	// The username is escaped, special characters stay part of the RDN
+	// value and cannot point the bind at another entry.
+	user, err = env.service.Authenticate("smith, john", "smith-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "john.smith@example.com" {
+		t.Errorf("email = %s", user.Email)
+	}
+
+	_, err = env.service.Authenticate("carol,"+testLdapPeopleDN, "carol-secret")
+	assertAppError(t, err, 401, "username or password is incorrect")
+}
+
+func TestLdapAuthenticateGroupFilter(t *testing.T) {
+	env := newLdapTestEnv(t, func(configEnv *config.ConfigEnv) {
+		configEnv.LdapGroupAttribute = "isMemberOf"
+		configEnv.LdapGroupFilter = "(&(objectClass=groupOfNames)(member=%s))"
+	})
+
+	user, err := env.service.Authenticate("carol", "carol-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.RoleID != "role-3" {
+		t.Errorf("role = %s, want role-3", user.RoleID)
+	}
+
+	user, err = env.service.Authenticate("bob", "bob-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.RoleID != "role-2" {
+		t.Errorf("role = %s, want role-2", user.RoleID)
+	}
+}
@@ -0,0 +1,11 @@
+package service
+
+import "lazy-auth/app/model"
+
+type LdapSyncService interface {
+	Sync(body model.LdapSyncRequest) (*model.LdapSyncRunResponse, error)
+	GetStatus() (*model.LdapSyncStatusResponse, error)
+	GetRuns(query model.QueryLdapSyncRun) (*model.LdapSyncRunPageResponse, error)
+	GetRunById(id string) (*model.LdapSyncRunResponse, error)
+	StartScheduler()
+}
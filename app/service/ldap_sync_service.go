@@ -0,0 +1,445 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ldapSyncTriggerManual   = "manual"
+	ldapSyncTriggerSchedule = "schedule"
+
+	ldapSyncStatusRunning   = "running"
+	ldapSyncStatusSucceeded = "succeeded"
+	ldapSyncStatusFailed    = "failed"
+
+	ldapSyncActionCreate     = "create"
+	ldapSyncActionUpdate     = "update"
+	ldapSyncActionDeactivate = "deactivate"
+	ldapSyncActionReactivate = "reactivate"
+	ldapSyncActionSkip       = "skip"
+)
+
+// ldapSyncState is shared by the scheduler and manual runs, only one sync
+// runs at a time.
+type ldapSyncState struct {
+	mu        sync.Mutex
+	running   bool
+	nextRunAt *time.Time
+}
+
+func (st *ldapSyncState) tryStart() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.running {
+		return false
+	}
+	st.running = true
+	return true
+}
+
+func (st *ldapSyncState) finish() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.running = false
+}
+
+func (st *ldapSyncState) setNextRunAt(nextRunAt time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.nextRunAt = &nextRunAt
+}
+
+func (st *ldapSyncState) snapshot() (bool, *time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.running, st.nextRunAt
+}
+
+type ldapSyncService struct {
+	ldapSyncRunRepository repository.LdapSyncRunRepository
+	userRepository        repository.UserRepository
+	sessionRepository     repository.SessionRepository
+	logoutService         LogoutService
+	directory             ldapDirectory
+	configEnv             config.ConfigEnv
+	state                 *ldapSyncState
+}
+
+func NewLdapSyncService(
+	ldapSyncRunRepository repository.LdapSyncRunRepository,
+	userRepository repository.UserRepository,
+	roleRepository repository.RoleRepository,
+	sessionRepository repository.SessionRepository,
+	logoutService LogoutService,
+	configEnv config.ConfigEnv,
+) LdapSyncService {
+	return ldapSyncService{
+		ldapSyncRunRepository: ldapSyncRunRepository,
+		userRepository:        userRepository,
+		sessionRepository:     sessionRepository,
+		logoutService:         logoutService,
+		directory:             newLdapDirectory(roleRepository, configEnv),
+		configEnv:             configEnv,
+		state:                 &ldapSyncState{},
+	}
+}
+
+func buildLdapSyncRunResponse(run repository.LdapSyncRun) model.LdapSyncRunResponse {
+	return model.LdapSyncRunResponse{
+		ID:          run.ID,
+		DryRun:      run.DryRun,
+		Trigger:     run.Trigger,
+		Status:      run.Status,
+		Error:       run.Error,
+		Created:     run.Created,
+		Updated:     run.Updated,
+		Deactivated: run.Deactivated,
+		Reactivated: run.Reactivated,
+		Skipped:     run.Skipped,
+		Unchanged:   run.Unchanged,
+		Changes:     run.Changes,
+		StartedAt:   run.StartedAt,
+		FinishedAt:  run.FinishedAt,
+	}
+}
+
+// Sync starts a run in the background, its result is read from the run
+// history.
+func (s ldapSyncService) Sync(syncReq model.LdapSyncRequest) (*model.LdapSyncRunResponse, error) {
+	if s.configEnv.LdapURL == "" {
+		return nil, errs.NewUnprocessableEntity("ldap is not configured")
+	}
+
+	run, err := s.start(ldapSyncTriggerManual, syncReq.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	go s.execute(run)
+
+	runResponse := buildLdapSyncRunResponse(*run)
+	return &runResponse, nil
+}
+
+func (s ldapSyncService) GetStatus() (*model.LdapSyncStatusResponse, error) {
+	running, nextRunAt := s.state.snapshot()
+	statusResponse := model.LdapSyncStatusResponse{
+		Enabled:   s.configEnv.LdapURL != "",
+		Running:   running,
+		NextRunAt: nextRunAt,
+	}
+
+	run, err := s.ldapSyncRunRepository.GetLatest()
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	if run != nil {
+		runResponse := buildLdapSyncRunResponse(*run)
+		statusResponse.LastRun = &runResponse
+	}
+
+	return &statusResponse, nil
+}
+
+func (s ldapSyncService) GetRuns(query model.QueryLdapSyncRun) (*model.LdapSyncRunPageResponse, error) {
+	runs, total, err := s.ldapSyncRunRepository.GetMany(query)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	runsResponse := common.Map(runs, buildLdapSyncRunResponse)
+	meta := common.BuildMetaPagination(&total, query.Limit, query.Offset)
+
+	return &model.LdapSyncRunPageResponse{Meta: meta, Data: runsResponse}, nil
+}
+
+func (s ldapSyncService) GetRunById(id string) (*model.LdapSyncRunResponse, error) {
+	run, err := s.ldapSyncRunRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("ldap sync run not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	runResponse := buildLdapSyncRunResponse(*run)
+	return &runResponse, nil
+}
+
+// StartScheduler runs a full sync every day at GO_AUTH_LDAP_SYNC_TIME, in the
+// server's local time.
+func (s ldapSyncService) StartScheduler() {
+	if s.configEnv.LdapURL == "" || s.configEnv.LdapSyncTime == "" {
+		return
+	}
+
+	at, err := time.Parse("15:04", s.configEnv.LdapSyncTime)
+	if err != nil {
+		panic(fmt.Errorf("GO_AUTH_LDAP_SYNC_TIME must be HH:MM: %w", err))
+	}
+
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			s.state.setNextRunAt(next)
+			time.Sleep(time.Until(next))
+
+			run, err := s.start(ldapSyncTriggerSchedule, false)
+			if err != nil {
+				zlog.Error(fmt.Errorf("scheduled ldap sync skipped: %w", err))
+				continue
+			}
+			s.execute(run)
+		}
+	}()
+}
+
+func (s ldapSyncService) start(trigger string, dryRun bool) (*repository.LdapSyncRun, error) {
+	if !s.state.tryStart() {
+		return nil, errs.NewUnprocessableEntity("a directory sync is already running")
+	}
+
+	run := repository.LdapSyncRun{
+		DryRun:    dryRun,
+		Trigger:   trigger,
+		Status:    ldapSyncStatusRunning,
+		StartedAt: time.Now(),
+	}
+	err := s.ldapSyncRunRepository.Create(&run)
+	if err != nil {
+		s.state.finish()
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	return &run, nil
+}
+
+func (s ldapSyncService) execute(run *repository.LdapSyncRun) {
+	defer s.state.finish()
+
+	changes, unchanged, err := s.sync(run.DryRun)
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Changes = changes
+	run.Unchanged = unchanged
+	run.Status = ldapSyncStatusSucceeded
+	if err != nil {
+		zlog.Error(err)
+		run.Status = ldapSyncStatusFailed
+		run.Error = err.Error()
+	}
+	for _, change := range changes {
+		switch change.Action {
+		case ldapSyncActionCreate:
+			run.Created++
+		case ldapSyncActionUpdate:
+			run.Updated++
+		case ldapSyncActionDeactivate:
+			run.Deactivated++
+		case ldapSyncActionReactivate:
+			run.Reactivated++
+		case ldapSyncActionSkip:
+			run.Skipped++
+		}
+	}
+
+	err = s.ldapSyncRunRepository.Update(run)
+	if err != nil {
+		zlog.Error(err)
+	}
+}
+
+// sync compares the directory with the local directory users and, unless
+// dryRun is set, applies the differences. Changes made before a failure are
+// kept and reported.
+func (s ldapSyncService) sync(dryRun bool) ([]model.LdapSyncChange, int, error) {
+	changes := []model.LdapSyncChange{}
+	unchanged := 0
+
+	conn, err := s.directory.dial()
+	if err != nil {
+		return changes, unchanged, err
+	}
+	defer conn.Close()
+
+	err = s.directory.bindServiceAccount(conn)
+	if err != nil {
+		return changes, unchanged, err
+	}
+
+	entries, err := s.directory.searchUsers(conn)
+	if err != nil {
+		return changes, unchanged, err
+	}
+	// An empty result is far more likely a filter or permission problem than
+	// an empty directory, deactivating everyone would lock all users out.
+	if len(entries) == 0 {
+		return changes, unchanged, errors.New("directory returned no users, nothing was changed")
+	}
+
+	users, err := s.userRepository.GetLdapUsers()
+	if err != nil {
+		return changes, unchanged, err
+	}
+	usersByDN := map[string]*repository.User{}
+	usersByUsername := map[string]*repository.User{}
+	for i := range users {
+		usersByDN[strings.ToLower(users[i].LdapDN)] = &users[i]
+		usersByUsername[users[i].Username] = &users[i]
+	}
+
+	seen := map[string]bool{}
+	for i := range entries {
+		entry := &entries[i]
+		change := model.LdapSyncChange{DN: entry.DN, Username: entry.Username, Email: entry.Email}
+
+		if entry.Username == "" || entry.Email == "" {
+			change.Action = ldapSyncActionSkip
+			change.Reason = "entry has no username or email"
+			changes = append(changes, change)
+			continue
+		}
+
+		role, err := s.directory.resolveRole(entry)
+		if err != nil {
+			return changes, unchanged, err
+		}
+		change.Role = role.Name
+
+		// Entries are matched by DN, or by username after a rename.
+		user, ok := usersByDN[strings.ToLower(entry.DN)]
+		if !ok {
+			user, ok = usersByUsername[entry.Username]
+		}
+		if ok && seen[user.ID] {
+			change.Action = ldapSyncActionSkip
+			change.Reason = "another entry already matched this user"
+			changes = append(changes, change)
+			continue
+		}
+
+		if !ok {
+			change.Action, change.Reason, err = s.createUser(entry, role, dryRun)
+			if err != nil {
+				return changes, unchanged, err
+			}
+			changes = append(changes, change)
+			continue
+		}
+		seen[user.ID] = true
+
+		change.Fields = applyLdapEntry(user, entry, role)
+		switch {
+		// Users deactivated by an admin stay deactivated.
+		case user.DisabledFlag && user.LdapSyncDisabledFlag:
+			user.DisabledFlag = false
+			user.LdapSyncDisabledFlag = false
+			change.Action = ldapSyncActionReactivate
+		case len(change.Fields) > 0:
+			change.Action = ldapSyncActionUpdate
+		default:
+			unchanged++
+			continue
+		}
+
+		if !dryRun {
+			err = s.userRepository.Update(user)
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				change.Action = ldapSyncActionSkip
+				change.Reason = "username or email duplicated"
+			} else if err != nil {
+				return changes, unchanged, err
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	for i := range users {
+		user := &users[i]
+		if seen[user.ID] || user.DisabledFlag {
+			continue
+		}
+
+		changes = append(changes, model.LdapSyncChange{
+			Action:   ldapSyncActionDeactivate,
+			DN:       user.LdapDN,
+			Username: user.Username,
+			Email:    user.Email,
+		})
+		if dryRun {
+			continue
+		}
+
+		user.DisabledFlag = true
+		user.LdapSyncDisabledFlag = true
+		err = s.userRepository.Update(user)
+		if err != nil {
+			return changes, unchanged, err
+		}
+		err = endUserSessions(s.sessionRepository, s.logoutService, user.ID)
+		if err != nil {
+			return changes, unchanged, err
+		}
+	}
+
+	return changes, unchanged, nil
+}
+
+// createUser returns the action taken for an entry without a local user and
+// the reason when it was skipped.
+func (s ldapSyncService) createUser(
+	entry *ldapEntry,
+	role *repository.Role,
+	dryRun bool,
+) (string, string, error) {
+	_, err := s.userRepository.GetByUsername(entry.Username)
+	if err == nil {
+		return ldapSyncActionSkip, "a local account with this username already exists", nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", "", err
+	}
+
+	_, err = s.userRepository.GetByEmail(entry.Email)
+	if err == nil {
+		return ldapSyncActionSkip, "email belongs to another account", nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", "", err
+	}
+
+	if dryRun {
+		return ldapSyncActionCreate, "", nil
+	}
+
+	user := repository.User{Username: entry.Username, VerifyFlag: true}
+	applyLdapEntry(&user, entry, role)
+	err = s.userRepository.Create(&user)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ldapSyncActionSkip, "username or email duplicated", nil
+		}
+		return "", "", err
+	}
+	return ldapSyncActionCreate, "", nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"testing"
+
+	"lazy-auth/app/repository"
+)
+
+func TestLdapSyncReactivatesOnlyUsersItDeactivated(t *testing.T) {
+	env := newLdapTestEnv(t)
+	env.users.users["user-bob"] = repository.User{
+		ID:                   "user-bob",
+		RoleID:               "role-2",
+		Username:             "bob",
+		Email:                "bob@example.com",
+		LdapDN:               "uid=bob," + testLdapPeopleDN,
+		DisabledFlag:         true,
+		LdapSyncDisabledFlag: true,
+	}
+	env.users.users["user-carol"] = repository.User{
+		ID:           "user-carol",
+		RoleID:       "role-3",
+		Username:     "carol",
+		Email:        "carol@example.com",
+		LdapDN:       "uid=carol," + testLdapPeopleDN,
+		DisabledFlag: true,
+	}
+	env.users.users["user-gone"] = repository.User{
+		ID:       "user-gone",
+		RoleID:   "role-1",
+		Username: "gone",
+		Email:    "gone@example.com",
+		LdapDN:   "uid=gone," + testLdapPeopleDN,
+	}
+
+	service := NewLdapSyncService(
+		nil,
+		env.repos.users,
+		env.repos.roles,
+		env.repos.sessions,
+		nil,
+		env.configEnv,
+	).(ldapSyncService)
+	changes, _, err := service.sync(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions := map[string]string{}
+	for _, change := range changes {
+		actions[change.Username] = change.Action
+	}
+	if actions["bob"] != ldapSyncActionReactivate || actions["gone"] != ldapSyncActionDeactivate {
+		t.Errorf("actions = %v, want bob reactivated and gone deactivated", actions)
+	}
+	if actions["carol"] == ldapSyncActionReactivate {
+		t.Error("carol was reactivated")
+	}
+
+	if bob := env.users.users["user-bob"]; bob.DisabledFlag || bob.LdapSyncDisabledFlag {
+		t.Errorf("bob disabled %v, by sync %v", bob.DisabledFlag, bob.LdapSyncDisabledFlag)
+	}
+	// carol was deactivated by an admin.
+	if carol := env.users.users["user-carol"]; !carol.DisabledFlag {
+		t.Error("carol was reactivated")
+	}
+	if gone := env.users.users["user-gone"]; !gone.DisabledFlag || !gone.LdapSyncDisabledFlag {
+		t.Errorf("gone disabled %v, by sync %v", gone.DisabledFlag, gone.LdapSyncDisabledFlag)
+	}
+
+	// Once deactivated by the sync, gone comes back with its entry.
+	env.server.mu.Lock()
+	env.server.entries = append(env.server.entries, testLdapPerson("gone", map[string][]string{"mail": {"gone@example.com"}}))
+	env.server.mu.Unlock()
+	_, _, err = service.sync(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gone := env.users.users["user-gone"]; gone.DisabledFlag || gone.LdapSyncDisabledFlag {
+		t.Errorf("gone disabled %v, by sync %v", gone.DisabledFlag, gone.LdapSyncDisabledFlag)
+	}
+}
@@ -0,0 +1,12 @@
+package service
+
+import (
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+)
+
+type LogoutService interface {
+	EndSessions(sessions []repository.Session) ([]string, error)
+	EndSession(body model.EndSessionRequest) (*model.EndSessionResponse, error)
+	StartDeliveryWorker()
+}
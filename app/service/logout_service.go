@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	logoutEventBackchannel = "http://schemas.openid.net/event/backchannel-logout"
+
+	logoutDeliveryMaxAttempts  = 6
+	logoutDeliveryBatchSize    = 50
+	logoutDeliveryPollInterval = 10 * time.Second
+	logoutDeliveryTimeout      = 10 * time.Second
+	logoutDeliveryLease        = logoutDeliveryBatchSize*logoutDeliveryTimeout + time.Minute
+	logoutTokenExpiresIn       = 5 * time.Minute
+)
+
+type logoutService struct {
+	oauthClientRepository    repository.OAuthClientRepository
+	sessionRepository        repository.SessionRepository
+	logoutDeliveryRepository repository.LogoutDeliveryRepository
+	signingKey               *common.SigningKey
+	configEnv                config.ConfigEnv
+	httpClient               *http.Client
+	wake                     chan struct{}
+}
+
+func NewLogoutService(
+	oauthClientRepository repository.OAuthClientRepository,
+	sessionRepository repository.SessionRepository,
+	logoutDeliveryRepository repository.LogoutDeliveryRepository,
+	signingKey *common.SigningKey,
+	configEnv config.ConfigEnv,
+) LogoutService {
+	return logoutService{
+		oauthClientRepository:    oauthClientRepository,
+		sessionRepository:        sessionRepository,
+		logoutDeliveryRepository: logoutDeliveryRepository,
+		signingKey:               signingKey,
+		configEnv:                configEnv,
+		httpClient:               &http.Client{Timeout: logoutDeliveryTimeout},
+		wake:                     make(chan struct{}, 1),
+	}
+}
+
+// logoutTarget identifies one relying party session to notify.
+type logoutTarget struct {
+	clientID string
+	userID   string
+	sid      string
+}
+
+// EndSessions deletes the given sessions together with every OAuth session
+// authorized from them, queues back-channel logout tokens for the affected
+// clients and returns the front-channel logout URIs the browser should load.
+func (s logoutService) EndSessions(sessions []repository.Session) ([]string, error) {
+	if len(sessions) == 0 {
+		return []string{}, nil
+	}
+
+	var loginSessionIds []string
+	for _, session := range sessions {
+		if session.ClientID == "" {
+			loginSessionIds = append(loginSessionIds, session.ID)
+		}
+	}
+	if len(loginSessionIds) > 0 {
+		children, err := s.sessionRepository.GetByParentIds(loginSessionIds)
+		if err != nil {
+			zlog.Error(err)
+			return nil, errs.NewUnexpectedError()
+		}
+		sessions = append(sessions, children...)
+	}
+
+	var sessionIds []string
+	var targets []logoutTarget
+	for _, session := range sessions {
+		if slices.Contains(sessionIds, session.ID) {
+			continue
+		}
+		sessionIds = append(sessionIds, session.ID)
+
+		if session.ClientID == "" {
+			continue
+		}
+		target := logoutTarget{
+			clientID: session.ClientID,
+			userID:   session.UserID,
+			sid:      session.ParentID,
+		}
+		if !slices.Contains(targets, target) {
+			targets = append(targets, target)
+		}
+	}
+
+	err := s.sessionRepository.DeleteByIds(sessionIds)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	frontchannelURIs := []string{}
+	for _, target := range targets {
+		client, err := s.oauthClientRepository.GetByClientId(target.clientID)
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				zlog.Error(err)
+			}
+			continue
+		}
+
+		if client.FrontchannelLogoutURI != "" {
+			params := url.Values{"iss": {s.configEnv.Issuer}}
+			if target.sid != "" {
+				params.Set("sid", target.sid)
+			}
+			frontchannelURI := buildRedirectURI(client.FrontchannelLogoutURI, params)
+			if !slices.Contains(frontchannelURIs, frontchannelURI) {
+				frontchannelURIs = append(frontchannelURIs, frontchannelURI)
+			}
+		}
+
+		if client.BackchannelLogoutURI != "" {
+			err = s.queueBackchannelLogout(client, target)
+			if err != nil {
+				zlog.Error(err)
+			}
+		}
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	return frontchannelURIs, nil
+}
+
+func (s logoutService) queueBackchannelLogout(
+	client *repository.OAuthClient,
+	target logoutTarget,
+) error {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":    s.configEnv.Issuer,
+		"aud":    client.ClientID,
+		"iat":    now.Unix(),
+		"exp":    now.Add(logoutTokenExpiresIn).Unix(),
+		"jti":    uuid.NewString(),
+		"sub":    target.userID,
+		"events": map[string]any{logoutEventBackchannel: map[string]any{}},
+	}
+	if target.sid != "" {
+		claims["sid"] = target.sid
+	}
+
+	logoutToken, err := s.signingKey.Sign(claims)
+	if err != nil {
+		return err
+	}
+
+	return s.logoutDeliveryRepository.Create(&repository.LogoutDelivery{
+		ClientID:      client.ClientID,
+		URI:           client.BackchannelLogoutURI,
+		LogoutToken:   logoutToken,
+		NextAttemptAt: now,
+	})
+}
+
+// EndSession implements RP-initiated logout. The browser is redirected here
+// by the relying party, so the login session is identified by the sid of the
+// id_token_hint rather than a bearer token. The login session is ended and,
+// when requested, the browser is sent back to one of the relying party's
+// registered post logout redirect URIs.
+func (s logoutService) EndSession(
+	endSessionReq model.EndSessionRequest,
+) (*model.EndSessionResponse, error) {
+	if endSessionReq.IDTokenHint == "" {
+		return nil, errs.NewValidationError("id token hint is required")
+	}
+
+	// Expired ID tokens are still good hints, only the signature and issuer
+	// are checked. Logout tokens are signed with the same key but are never
+	// handed to the browser.
+	claims, ok := s.signingKey.Verify(endSessionReq.IDTokenHint)
+	if !ok || !claims.VerifyIssuer(s.configEnv.Issuer, true) || claims["events"] != nil {
+		return nil, errs.NewValidationError("id token hint is invalid")
+	}
+
+	clientId := endSessionReq.ClientID
+	audience := getAudience(claims)
+	if clientId == "" && len(audience) > 0 {
+		clientId = audience[0]
+	}
+	if !slices.Contains(audience, clientId) {
+		return nil, errs.NewValidationError("client id does not match id token hint")
+	}
+
+	sub, _ := claims["sub"].(string)
+	sid, _ := claims["sid"].(string)
+	if sid == "" {
+		return nil, errs.NewValidationError("id token hint has no session")
+	}
+
+	var sessions []repository.Session
+	session, err := s.sessionRepository.GetById(sid)
+	switch {
+	case err == nil:
+		if session.UserID != sub || session.ClientID != "" {
+			return nil, errs.NewValidationError("id token hint is invalid")
+		}
+		sessions = append(sessions, *session)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// Already logged out, still honour the redirect.
+	default:
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	var redirectTo string
+	if endSessionReq.PostLogoutRedirectURI != "" {
+		client, err := s.oauthClientRepository.GetByClientId(clientId)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, errs.NewValidationError("client is invalid")
+			}
+			zlog.Error(err)
+			return nil, errs.NewUnexpectedError()
+		}
+		if !slices.Contains(client.PostLogoutRedirectURIs, endSessionReq.PostLogoutRedirectURI) {
+			return nil, errs.NewValidationError("post logout redirect uri is not registered")
+		}
+
+		params := url.Values{}
+		if endSessionReq.State != "" {
+			params.Set("state", endSessionReq.State)
+		}
+		redirectTo = buildRedirectURI(endSessionReq.PostLogoutRedirectURI, params)
+	}
+
+	frontchannelURIs, err := s.EndSessions(sessions)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.EndSessionResponse{
+		RedirectTo:             redirectTo,
+		FrontchannelLogoutURIs: frontchannelURIs,
+	}, nil
+}
+
+// StartDeliveryWorker sends queued back-channel logout tokens in the
+// background, retrying failed deliveries with exponential backoff.
+func (s logoutService) StartDeliveryWorker() {
+	go func() {
+		ticker := time.NewTicker(logoutDeliveryPollInterval)
+		defer ticker.Stop()
+
+		for {
+			s.deliverDue()
+			select {
+			case <-ticker.C:
+			case <-s.wake:
+			}
+		}
+	}()
+}
+
+func (s logoutService) deliverDue() {
+	// Claimed deliveries are held for long enough to send the whole batch,
+	// so other instances do not deliver them at the same time.
+	deliveries, err := s.logoutDeliveryRepository.ClaimDue(
+		logoutDeliveryMaxAttempts,
+		logoutDeliveryBatchSize,
+		time.Now().Add(logoutDeliveryLease),
+	)
+	if err != nil {
+		zlog.Error(err)
+		return
+	}
+
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		delivery.Attempts++
+
+		err := s.deliver(delivery)
+		if err == nil {
+			deliveredAt := time.Now()
+			delivery.DeliveredAt = &deliveredAt
+			delivery.LastError = ""
+		} else {
+			delivery.LastError = err.Error()
+			delivery.NextAttemptAt = time.Now().Add(
+				time.Duration(1<<delivery.Attempts) * logoutDeliveryPollInterval,
+			)
+			if delivery.Attempts >= logoutDeliveryMaxAttempts {
+				zlog.Error(fmt.Errorf(
+					"back-channel logout to client %s failed: %s",
+					delivery.ClientID,
+					delivery.LastError,
+				))
+			}
+		}
+
+		err = s.logoutDeliveryRepository.Update(delivery)
+		if err != nil {
+			zlog.Error(err)
+		}
+	}
+}
+
+func (s logoutService) deliver(delivery *repository.LogoutDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), logoutDeliveryTimeout)
+	defer cancel()
+
+	form := url.Values{"logout_token": {delivery.LogoutToken}}
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		delivery.URI,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Cache-Control", "no-store")
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// endUserSessions logs a user out everywhere, e.g. after deactivation.
+func endUserSessions(
+	sessionRepository repository.SessionRepository,
+	logoutService LogoutService,
+	userID string,
+) error {
+	sessions, err := sessionRepository.GetByUserId(userID)
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	_, err = logoutService.EndSessions(sessions)
+	return err
+}
+
+func getAudience(claims jwt.MapClaims) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		var audience []string
+		for _, v := range aud {
+			if s, ok := v.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+		return audience
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package service
+
+import "lazy-auth/app/model"
+
+type MagicLinkService interface {
+	RequestMagicLink(body model.MagicLinkRequest) (string, error)
+	ConsumeMagicLink(body model.ConsumeMagicLinkRequest, binding string) (*model.TokenResponse, error)
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"gorm.io/gorm"
+)
+
+type magicLinkService struct {
+	magicLinkRepository repository.MagicLinkRepository
+	userRepository      repository.UserRepository
+	sessionRepository   repository.SessionRepository
+	mailer              Mailer
+	configEnv           config.ConfigEnv
+}
+
+func NewMagicLinkService(
+	magicLinkRepository repository.MagicLinkRepository,
+	userRepository repository.UserRepository,
+	sessionRepository repository.SessionRepository,
+	mailer Mailer,
+	configEnv config.ConfigEnv,
+) MagicLinkService {
+	return magicLinkService{
+		magicLinkRepository: magicLinkRepository,
+		userRepository:      userRepository,
+		sessionRepository:   sessionRepository,
+		mailer:              mailer,
+		configEnv:           configEnv,
+	}
+}
+
+// RequestMagicLink emails a sign-in link and returns the browser binding,
+// which is empty unless same-browser links are enabled. The result is the
+// same whether or not the email belongs to an account.
+func (s magicLinkService) RequestMagicLink(magicLinkReq model.MagicLinkRequest) (string, error) {
+	binding := ""
+	if s.configEnv.MagicLinkSameBrowser {
+		var err error
+		binding, err = common.GenerateSecret(32)
+		if err != nil {
+			zlog.Error(err)
+			return "", errs.NewUnexpectedError()
+		}
+	}
+
+	user, err := s.userRepository.GetByEmail(magicLinkReq.Email)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return binding, nil
+		}
+		zlog.Error(err)
+		return "", errs.NewUnexpectedError()
+	}
+
+	if user.DisabledFlag {
+		return binding, nil
+	}
+
+	// Only the latest link works, requesting again invalidates older ones.
+	err = s.magicLinkRepository.DeleteByUserId(user.ID)
+	if err != nil {
+		zlog.Error(err)
+		return "", errs.NewUnexpectedError()
+	}
+
+	token, err := common.GenerateSecret(32)
+	if err != nil {
+		zlog.Error(err)
+		return "", errs.NewUnexpectedError()
+	}
+
+	magicLink := repository.MagicLink{
+		UserID:    user.ID,
+		TokenHash: common.HashToken(token),
+		ExpiresAt: common.AddTimeByDuration(s.configEnv.MagicLinkExpiresIn),
+	}
+	if binding != "" {
+		magicLink.BindingHash = common.HashToken(binding)
+	}
+
+	err = s.magicLinkRepository.Create(&magicLink)
+	if err != nil {
+		zlog.Error(err)
+		return "", errs.NewUnexpectedError()
+	}
+
+	link := fmt.Sprintf("%s?token=%s", s.configEnv.MagicLinkURL, url.QueryEscape(token))
+	body := fmt.Sprintf(
+		"Use the link below to sign in, it expires in %s and works once.\n\n%s\n\nIf you did not ask to sign in you can ignore this email.",
+		s.configEnv.MagicLinkExpiresIn,
+		link,
+	)
+
+	// Sending in the background keeps the response time the same for
+	// unknown emails.
+	go func() {
+		err := s.mailer.Send(user.Email, "Your sign-in link", body)
+		if err != nil {
+			zlog.Error(err)
+		}
+	}()
+
+	return binding, nil
+}
+
+func (s magicLinkService) ConsumeMagicLink(
+	consumeReq model.ConsumeMagicLinkRequest,
+	binding string,
+) (*model.TokenResponse, error) {
+	magicLink, err := s.magicLinkRepository.GetByTokenHash(common.HashToken(consumeReq.Token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewUnauthorizedError("magic link is invalid")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	// A forwarded link is left alone, the owner can still use it.
+	if magicLink.BindingHash != "" && common.HashToken(binding) != magicLink.BindingHash {
+		return nil, errs.NewUnauthorizedError("magic link must be opened in the browser that requested it")
+	}
+
+	err = s.magicLinkRepository.DeleteById(magicLink.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewUnauthorizedError("magic link is invalid")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	user, err := s.userRepository.GetById(magicLink.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewUnauthorizedError("magic link is invalid")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	// Opening the link proves the user owns the email.
+	user.VerifyFlag = true
+	user.LastAccessAt = time.Now()
+	err = s.userRepository.Update(user)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return createLoginSession(s.sessionRepository, s.configEnv, user)
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/config"
+)
+
+var mailedLinkPattern = regexp.MustCompile(`\?token=(\S+)`)
+
+type magicLinkTestEnv struct {
+	service MagicLinkService
+	repos   *testRepositories
+	mailer  *fakeMailer
+}
+
+func newMagicLinkTestEnv(t *testing.T, configure ...func(*config.ConfigEnv)) *magicLinkTestEnv {
+	t.Helper()
+
+	configEnv := newTestConfigEnv(append([]func(*config.ConfigEnv){func(configEnv *config.ConfigEnv) {
+		configEnv.MagicLinkURL = testIssuer + "/magic-link"
+		configEnv.MagicLinkExpiresIn = "15m"
+	}}, configure...)...)
+	repos := newTestRepositories()
+	mailer := newFakeMailer()
+
+	return &magicLinkTestEnv{
+		service: NewMagicLinkService(repos.magicLinks, repos.users, repos.sessions, mailer, configEnv),
+		repos:   repos,
+		mailer:  mailer,
+	}
+}
+
+// mailedToken waits for the next email and returns the token in its link.
+func (env *magicLinkTestEnv) mailedToken(t *testing.T) string {
+	t.Helper()
+
+	mail := env.mailer.next(t)
+	match := mailedLinkPattern.FindStringSubmatch(mail.body)
+	if match == nil {
+		t.Fatalf("no link in %q", mail.body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestConsumeMagicLink(t *testing.T) {
+	env := newMagicLinkTestEnv(t)
+
+	binding, err := env.service.RequestMagicLink(model.MagicLinkRequest{Email: "jdoe@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binding != "" {
+		t.Errorf("binding = %q, want none", binding)
+	}
+	token := env.mailedToken(t)
+
+	tokenResp, err := env.service.ConsumeMagicLink(model.ConsumeMagicLinkRequest{Token: token}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenResp.RefreshToken == "" {
+		t.Errorf("token response = %+v, want a session", tokenResp)
+	}
+
+	// A link works once.
+	_, err = env.service.ConsumeMagicLink(model.ConsumeMagicLinkRequest{Token: token}, "")
+	assertAppError(t, err, http.StatusUnauthorized, "magic link is invalid")
+}
+
+func TestRequestMagicLinkReplacesOlderLinks(t *testing.T) {
+	env := newMagicLinkTestEnv(t)
+
+	for i := 0; i < 2; i++ {
+		_, err := env.service.RequestMagicLink(model.MagicLinkRequest{Email: "jdoe@example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	older := env.mailedToken(t)
+	newer := env.mailedToken(t)
+	if len(env.repos.magicLinks.magicLinks) != 1 {
+		t.Fatalf("%d links are stored, want 1", len(env.repos.magicLinks.magicLinks))
+	}
+
+	// The emails are sent in the background, either may arrive first.
+	_, olderErr := env.service.ConsumeMagicLink(model.ConsumeMagicLinkRequest{Token: older}, "")
+	_, newerErr := env.service.ConsumeMagicLink(model.ConsumeMagicLinkRequest{Token: newer}, "")
+	if (olderErr == nil) == (newerErr == nil) {
+		t.Errorf("consume errors = %v and %v, want exactly one link to work", olderErr, newerErr)
+	}
+}
+
+func TestRequestMagicLinkAnswersTheSame(t *testing.T) {
+	env := newMagicLinkTestEnv(t, func(configEnv *config.ConfigEnv) {
+		configEnv.MagicLinkSameBrowser = true
+	})
+	env.repos.users.users["user-2"] = repository.User{
+		ID:           "user-2",
+		RoleID:       "role-1",
+		Username:     "disabled",
+		Email:        "disabled@example.com",
+		DisabledFlag: true,
+	}
+
+	for _, email := range []string{"unknown@example.com", "disabled@example.com"} {
+		binding, err := env.service.RequestMagicLink(model.MagicLinkRequest{Email: email})
+		if err != nil {
+			t.Fatalf("%s: %v", email, err)
+		}
+		if binding == "" {
+			t.Errorf("%s: no binding, an account would get one", email)
+		}
+	}
+	env.mailer.assertNoMail(t)
+	if len(env.repos.magicLinks.magicLinks) != 0 {
+		t.Errorf("%d links are stored, want none", len(env.repos.magicLinks.magicLinks))
+	}
+}
+
+func TestConsumeMagicLinkInAnotherBrowser(t *testing.T) {
+	env := newMagicLinkTestEnv(t, func(configEnv *config.ConfigEnv) {
+		configEnv.MagicLinkSameBrowser = true
+	})
+
+	binding, err := env.service.RequestMagicLink(model.MagicLinkRequest{Email: "jdoe@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binding == "" {
+		t.Fatal("no binding was returned")
+	}
+	token := env.mailedToken(t)
+
+	for _, otherBinding := range []string{"", "other-browser"} {
+		_, err = env.service.ConsumeMagicLink(model.ConsumeMagicLinkRequest{Token: token}, otherBinding)
+		assertAppError(t, err, http.StatusUnauthorized, "magic link must be opened in the browser that requested it")
+	}
+
+	// The refused attempts leave the link to its owner.
+	tokenResp, err := env.service.ConsumeMagicLink(model.ConsumeMagicLinkRequest{Token: token}, binding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenResp.RefreshToken == "" {
+		t.Errorf("token response = %+v, want a session", tokenResp)
+	}
+}
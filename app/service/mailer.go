@@ -0,0 +1,6 @@
+package service
+
+// Mailer delivers transactional email such as sign-in links and codes.
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"lazy-auth/app/zlog"
+	"lazy-auth/config"
+
+	"go.uber.org/zap"
+)
+
+// NewMailer returns the mailer picked by GO_AUTH_MAILER, "log" writes
+// messages to the log for development and "smtp" sends them.
+func NewMailer(configEnv config.ConfigEnv) Mailer {
+	if configEnv.Mailer == "smtp" {
+		return smtpMailer{configEnv: configEnv}
+	}
+	return logMailer{}
+}
+
+type logMailer struct{}
+
+func (m logMailer) Send(to string, subject string, body string) error {
+	zlog.Info("mail", zap.String("to", to), zap.String("subject", subject), zap.String("body", body))
+	return nil
+}
+
+type smtpMailer struct {
+	configEnv config.ConfigEnv
+}
+
+// Send uses STARTTLS when the server offers it, credentials are only sent
+// over TLS or to localhost.
+func (m smtpMailer) Send(to string, subject string, body string) error {
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+
+	var auth smtp.Auth
+	if m.configEnv.SmtpUsername != "" {
+		auth = smtp.PlainAuth("", m.configEnv.SmtpUsername, m.configEnv.SmtpPassword, m.configEnv.SmtpHost)
+	}
+
+	message := strings.Join([]string{
+		"From: " + m.configEnv.MailFrom,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(
+		net.JoinHostPort(m.configEnv.SmtpHost, m.configEnv.SmtpPort),
+		auth,
+		m.configEnv.MailFrom,
+		[]string{to},
+		[]byte(message),
+	)
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+)
+
+type OAuthService interface {
+	Authorize(
+		session *repository.Session,
+		body model.AuthorizeRequest,
+	) (*model.AuthorizeResponse, error)
+	Decide(
+		session *repository.Session,
+		body model.AuthorizeDecisionRequest,
+	) (*model.AuthorizeResponse, error)
+	Token(body model.OAuthTokenRequest) (*model.OAuthTokenResponse, error)
+	AuthorizeDevice(body model.DeviceAuthorizationRequest) (*model.DeviceAuthorizationResponse, error)
+	GetDeviceVerification(
+		session *repository.Session,
+		userCode string,
+	) (*model.DeviceVerificationResponse, error)
+	VerifyDevice(
+		session *repository.Session,
+		body model.DeviceVerificationRequest,
+	) (*model.DeviceVerificationResponse, error)
+	Introspect(body model.TokenIntrospectionRequest) (*model.TokenIntrospectionResponse, error)
+	Revoke(body model.TokenRevocationRequest) error
+	GetUserInfo(userId string, scope string) (map[string]any, error)
+	GetOpenIDConfiguration() *model.OpenIDConfigurationResponse
+	GetJwks() *model.JwksResponse
+}
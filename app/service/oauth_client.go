@@ -0,0 +1,16 @@
+package service
+
+import "lazy-auth/app/model"
+
+type OAuthClientService interface {
+	CreateClient(body model.CreateOAuthClientRequest) (*model.OAuthClientSecretResponse, error)
+	GetClients(query model.QueryOAuthClient) (*model.OAuthClientPageResponse, error)
+	GetClientById(id string) (*model.OAuthClientResponse, error)
+	UpdateClientById(id string, body model.UpdateOAuthClientRequest) (*model.OAuthClientResponse, error)
+	RotateSecret(id string) (*model.OAuthClientSecretResponse, error)
+	DeleteClientById(id string) error
+	RegisterClient(
+		initialAccessToken string,
+		body model.ClientRegistrationRequest,
+	) (*model.ClientRegistrationResponse, error)
+}
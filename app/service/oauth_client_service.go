@@ -0,0 +1,482 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	zconstant "lazy-auth/app/constant"
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type oauthClientService struct {
+	oauthClientRepository repository.OAuthClientRepository
+	configEnv             config.ConfigEnv
+}
+
+func NewOAuthClientService(
+	oauthClientRepository repository.OAuthClientRepository,
+	configEnv config.ConfigEnv,
+) OAuthClientService {
+	return oauthClientService{
+		oauthClientRepository: oauthClientRepository,
+		configEnv:             configEnv,
+	}
+}
+
+func buildOAuthClientResponse(client repository.OAuthClient) model.OAuthClientResponse {
+	return model.OAuthClientResponse{
+		ID:                     client.ID,
+		ClientID:               client.ClientID,
+		Name:                   client.Name,
+		ClientType:             client.ClientType,
+		RedirectURIs:           client.RedirectURIs,
+		GrantTypes:             client.GrantTypes,
+		Scopes:                 client.Scopes,
+		LogoURI:                client.LogoURI,
+		TokenExpiresIn:         client.TokenExpiresIn,
+		RefreshTokenExpiresIn:  client.RefreshTokenExpiresIn,
+		TokenExchangeAudiences: client.TokenExchangeAudiences,
+		BackchannelLogoutURI:   client.BackchannelLogoutURI,
+		FrontchannelLogoutURI:  client.FrontchannelLogoutURI,
+		PostLogoutRedirectURIs: client.PostLogoutRedirectURIs,
+		CreatedAt:              client.CreatedAt,
+	}
+}
+
+func (s oauthClientService) CreateClient(
+	clientReq model.CreateOAuthClientRequest,
+) (*model.OAuthClientSecretResponse, error) {
+	client := repository.OAuthClient{
+		ClientID:               uuid.NewString(),
+		Name:                   clientReq.Name,
+		ClientType:             clientReq.ClientType,
+		RedirectURIs:           clientReq.RedirectURIs,
+		GrantTypes:             clientReq.GrantTypes,
+		Scopes:                 clientReq.Scopes,
+		LogoURI:                clientReq.LogoURI,
+		TokenExpiresIn:         clientReq.TokenExpiresIn,
+		RefreshTokenExpiresIn:  clientReq.RefreshTokenExpiresIn,
+		TokenExchangeAudiences: clientReq.TokenExchangeAudiences,
+		BackchannelLogoutURI:   clientReq.BackchannelLogoutURI,
+		FrontchannelLogoutURI:  clientReq.FrontchannelLogoutURI,
+		PostLogoutRedirectURIs: clientReq.PostLogoutRedirectURIs,
+	}
+
+	if err := validateRedirectURIs(client.RedirectURIs); err != nil {
+		return nil, errs.NewValidationError(err.Error())
+	}
+	if err := validateClientMetadata(&client); err != nil {
+		return nil, errs.NewValidationError(err.Error())
+	}
+
+	clientSecret, err := s.createClient(&client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.OAuthClientSecretResponse{
+		OAuthClientResponse: buildOAuthClientResponse(client),
+		ClientSecret:        clientSecret,
+	}, nil
+}
+
+func (s oauthClientService) GetClients(
+	query model.QueryOAuthClient,
+) (*model.OAuthClientPageResponse, error) {
+	clients, total, err := s.oauthClientRepository.GetMany(query)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	clientsResponse := common.Map(clients, buildOAuthClientResponse)
+	meta := common.BuildMetaPagination(&total, query.Limit, query.Offset)
+
+	return &model.OAuthClientPageResponse{Meta: meta, Data: clientsResponse}, nil
+}
+
+func (s oauthClientService) GetClientById(id string) (*model.OAuthClientResponse, error) {
+	client, err := s.oauthClientRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("client not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	clientResponse := buildOAuthClientResponse(*client)
+	return &clientResponse, nil
+}
+
+func (s oauthClientService) UpdateClientById(
+	id string,
+	clientReq model.UpdateOAuthClientRequest,
+) (*model.OAuthClientResponse, error) {
+	client, err := s.oauthClientRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("client not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	if clientReq.Name != nil {
+		client.Name = *clientReq.Name
+	}
+
+	if clientReq.RedirectURIs != nil {
+		client.RedirectURIs = *clientReq.RedirectURIs
+	}
+
+	if clientReq.GrantTypes != nil {
+		client.GrantTypes = *clientReq.GrantTypes
+	}
+
+	if clientReq.Scopes != nil {
+		client.Scopes = *clientReq.Scopes
+	}
+
+	if clientReq.LogoURI != nil {
+		client.LogoURI = *clientReq.LogoURI
+	}
+
+	if clientReq.TokenExpiresIn != nil {
+		client.TokenExpiresIn = *clientReq.TokenExpiresIn
+	}
+
+	if clientReq.RefreshTokenExpiresIn != nil {
+		client.RefreshTokenExpiresIn = *clientReq.RefreshTokenExpiresIn
+	}
+
+	if clientReq.TokenExchangeAudiences != nil {
+		client.TokenExchangeAudiences = *clientReq.TokenExchangeAudiences
+	}
+
+	if clientReq.BackchannelLogoutURI != nil {
+		client.BackchannelLogoutURI = *clientReq.BackchannelLogoutURI
+	}
+
+	if clientReq.FrontchannelLogoutURI != nil {
+		client.FrontchannelLogoutURI = *clientReq.FrontchannelLogoutURI
+	}
+
+	if clientReq.PostLogoutRedirectURIs != nil {
+		client.PostLogoutRedirectURIs = *clientReq.PostLogoutRedirectURIs
+	}
+
+	if err := validateRedirectURIs(client.RedirectURIs); err != nil {
+		return nil, errs.NewValidationError(err.Error())
+	}
+	if err := validateClientMetadata(client); err != nil {
+		return nil, errs.NewValidationError(err.Error())
+	}
+
+	err = s.oauthClientRepository.Update(client)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	clientResponse := buildOAuthClientResponse(*client)
+	return &clientResponse, nil
+}
+
+func (s oauthClientService) RotateSecret(id string) (*model.OAuthClientSecretResponse, error) {
+	client, err := s.oauthClientRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("client not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	if client.ClientType != zconstant.OAuthClientConfidential {
+		return nil, errs.NewUnprocessableEntity("public clients have no secret")
+	}
+
+	clientSecret, err := common.GenerateSecret(32)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	client.ClientSecretHash, _ = common.HashSecret(clientSecret)
+
+	err = s.oauthClientRepository.Update(client)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return &model.OAuthClientSecretResponse{
+		OAuthClientResponse: buildOAuthClientResponse(*client),
+		ClientSecret:        clientSecret,
+	}, nil
+}
+
+func (s oauthClientService) DeleteClientById(id string) error {
+	_, err := s.oauthClientRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewNotFoundError("client not found")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	err = s.oauthClientRepository.DeleteById(id)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
+
+// RegisterClient implements RFC 7591 dynamic registration. It is disabled
+// unless an initial access token is configured, and dynamically registered
+// clients are limited to the standard grants and scopes.
+func (s oauthClientService) RegisterClient(
+	initialAccessToken string,
+	registrationReq model.ClientRegistrationRequest,
+) (*model.ClientRegistrationResponse, error) {
+	expected := s.configEnv.OAuthInitialAccessToken
+	if expected == "" {
+		return nil, errs.NewNotFoundError("dynamic client registration is disabled")
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(initialAccessToken)) != 1 {
+		return nil, errs.OAuthError{
+			Code:        http.StatusUnauthorized,
+			ErrorCode:   "invalid_token",
+			Description: "initial access token is invalid",
+		}
+	}
+
+	clientType := zconstant.OAuthClientConfidential
+	switch registrationReq.TokenEndpointAuthMethod {
+	case "", "client_secret_basic", "client_secret_post":
+		if registrationReq.TokenEndpointAuthMethod == "" {
+			registrationReq.TokenEndpointAuthMethod = "client_secret_basic"
+		}
+	case "none":
+		clientType = zconstant.OAuthClientPublic
+	default:
+		return nil, errs.NewOAuthError("invalid_client_metadata", "token endpoint auth method is not supported")
+	}
+
+	if len(registrationReq.GrantTypes) == 0 {
+		registrationReq.GrantTypes = []string{zconstant.GrantTypeAuthorizationCode}
+	}
+	for _, grantType := range registrationReq.GrantTypes {
+		if grantType == zconstant.GrantTypeTokenExchange {
+			return nil, errs.NewOAuthError("invalid_client_metadata", "token exchange cannot be registered dynamically")
+		}
+	}
+
+	if len(registrationReq.ResponseTypes) == 0 {
+		registrationReq.ResponseTypes = []string{"code"}
+	}
+	if !isSubset(registrationReq.ResponseTypes, []string{"code"}) {
+		return nil, errs.NewOAuthError("invalid_client_metadata", "only the code response type is supported")
+	}
+
+	supportedScopes := []string{zconstant.ScopeOpenID, zconstant.ScopeProfile, zconstant.ScopeEmail}
+	scopes := strings.Fields(registrationReq.Scope)
+	if len(scopes) == 0 {
+		scopes = supportedScopes
+	}
+	if !isSubset(scopes, supportedScopes) {
+		return nil, errs.NewOAuthError("invalid_client_metadata", "requested scope is not supported")
+	}
+
+	client := repository.OAuthClient{
+		ClientID:     uuid.NewString(),
+		Name:         registrationReq.ClientName,
+		ClientType:   clientType,
+		RedirectURIs: registrationReq.RedirectURIs,
+		GrantTypes:   registrationReq.GrantTypes,
+		Scopes:       scopes,
+		LogoURI:      registrationReq.LogoURI,
+
+		BackchannelLogoutURI:   registrationReq.BackchannelLogoutURI,
+		FrontchannelLogoutURI:  registrationReq.FrontchannelLogoutURI,
+		PostLogoutRedirectURIs: registrationReq.PostLogoutRedirectURIs,
+	}
+
+	if err := validateRedirectURIs(client.RedirectURIs); err != nil {
+		return nil, errs.NewOAuthError("invalid_redirect_uri", err.Error())
+	}
+	if err := validateClientMetadata(&client); err != nil {
+		return nil, errs.NewOAuthError("invalid_client_metadata", err.Error())
+	}
+
+	clientSecret, err := s.createClient(&client)
+	if err != nil {
+		return nil, errs.NewOAuthServerError()
+	}
+
+	registrationResponse := model.ClientRegistrationResponse{
+		ClientID:                client.ClientID,
+		ClientSecret:            clientSecret,
+		ClientIDIssuedAt:        client.CreatedAt.Unix(),
+		RedirectURIs:            client.RedirectURIs,
+		TokenEndpointAuthMethod: registrationReq.TokenEndpointAuthMethod,
+		GrantTypes:              client.GrantTypes,
+		ResponseTypes:           registrationReq.ResponseTypes,
+		ClientName:              client.Name,
+		LogoURI:                 client.LogoURI,
+		Scope:                   strings.Join(client.Scopes, " "),
+		BackchannelLogoutURI:    client.BackchannelLogoutURI,
+		FrontchannelLogoutURI:   client.FrontchannelLogoutURI,
+		PostLogoutRedirectURIs:  client.PostLogoutRedirectURIs,
+	}
+	if clientSecret != "" {
+		neverExpires := int64(0)
+		registrationResponse.ClientSecretExpiresAt = &neverExpires
+	}
+
+	return &registrationResponse, nil
+}
+
+// createClient stores client and returns its plain secret, which is empty for
+// public clients.
+func (s oauthClientService) createClient(client *repository.OAuthClient) (string, error) {
+	var clientSecret string
+	if client.ClientType == zconstant.OAuthClientConfidential {
+		secret, err := common.GenerateSecret(32)
+		if err != nil {
+			zlog.Error(err)
+			return "", errs.NewUnexpectedError()
+		}
+		clientSecret = secret
+		client.ClientSecretHash, _ = common.HashSecret(clientSecret)
+	}
+
+	err := s.oauthClientRepository.Create(client)
+	if err != nil {
+		zlog.Error(err)
+		return "", errs.NewUnexpectedError()
+	}
+
+	return clientSecret, nil
+}
+
+func validateClientMetadata(client *repository.OAuthClient) error {
+	if strings.TrimSpace(client.Name) == "" {
+		return errors.New("client name is required")
+	}
+
+	supportedGrantTypes := []string{
+		zconstant.GrantTypeAuthorizationCode,
+		zconstant.GrantTypeRefreshToken,
+		zconstant.GrantTypeClientCredentials,
+		zconstant.GrantTypeDeviceCode,
+		zconstant.GrantTypeTokenExchange,
+	}
+	if len(client.GrantTypes) == 0 || !isSubset(client.GrantTypes, supportedGrantTypes) {
+		return errors.New("grant types are not supported")
+	}
+
+	isConfidential := client.ClientType == zconstant.OAuthClientConfidential
+	for _, grantType := range client.GrantTypes {
+		switch grantType {
+		case zconstant.GrantTypeAuthorizationCode:
+			if len(client.RedirectURIs) == 0 {
+				return errors.New("authorization code grant requires a redirect uri")
+			}
+		case zconstant.GrantTypeRefreshToken:
+			if !slices.Contains(client.GrantTypes, zconstant.GrantTypeAuthorizationCode) &&
+				!slices.Contains(client.GrantTypes, zconstant.GrantTypeDeviceCode) {
+				return errors.New("refresh token grant requires authorization code or device code grant")
+			}
+		case zconstant.GrantTypeClientCredentials, zconstant.GrantTypeTokenExchange:
+			if !isConfidential {
+				return fmt.Errorf("%s grant requires a confidential client", grantType)
+			}
+		}
+	}
+
+	for _, duration := range []string{client.TokenExpiresIn, client.RefreshTokenExpiresIn} {
+		if duration == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(duration); err != nil || d <= 0 {
+			return fmt.Errorf("token lifetime %q is invalid", duration)
+		}
+	}
+
+	if client.LogoURI != "" {
+		u, err := url.Parse(client.LogoURI)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errors.New("logo uri is invalid")
+		}
+	}
+
+	// Logout notifications carry session identifiers, keep them off plain
+	// http except for local development.
+	for _, logoutURI := range []string{client.BackchannelLogoutURI, client.FrontchannelLogoutURI} {
+		if logoutURI == "" {
+			continue
+		}
+		u, err := url.Parse(logoutURI)
+		if err != nil || !u.IsAbs() || u.Fragment != "" || !isWebURI(u) {
+			return fmt.Errorf("logout uri %q is invalid", logoutURI)
+		}
+	}
+
+	if err := validateRedirectURIs(client.PostLogoutRedirectURIs); err != nil {
+		return errors.New("post logout " + err.Error())
+	}
+
+	return nil
+}
+
+func isWebURI(u *url.URL) bool {
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		ip := net.ParseIP(u.Hostname())
+		return u.Hostname() == "localhost" || (ip != nil && ip.IsLoopback())
+	}
+	return false
+}
+
+// validateRedirectURIs accepts https, http on loopback and private-use
+// schemes for native apps (RFC 8252).
+func validateRedirectURIs(redirectURIs []string) error {
+	for _, redirectURI := range redirectURIs {
+		u, err := url.Parse(redirectURI)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return fmt.Errorf("redirect uri %q is invalid", redirectURI)
+		}
+
+		switch u.Scheme {
+		case "https":
+		case "http":
+			ip := net.ParseIP(u.Hostname())
+			if u.Hostname() != "localhost" && (ip == nil || !ip.IsLoopback()) {
+				return fmt.Errorf("redirect uri %q must use https", redirectURI)
+			}
+		case "javascript", "data", "file":
+			return fmt.Errorf("redirect uri %q is invalid", redirectURI)
+		}
+	}
+	return nil
+}
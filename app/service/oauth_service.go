@@ -0,0 +1,1218 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	zconstant "lazy-auth/app/constant"
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type oauthService struct {
+	oauthClientRepository  repository.OAuthClientRepository
+	oauthCodeRepository    repository.OAuthCodeRepository
+	oauthConsentRepository repository.OAuthConsentRepository
+	oauthDeviceRepository  repository.OAuthDeviceCodeRepository
+	sessionRepository      repository.SessionRepository
+	userRepository         repository.UserRepository
+	revokedTokenRepository repository.RevokedTokenRepository
+	signingKey             *common.SigningKey
+	configEnv              config.ConfigEnv
+}
+
+func NewOAuthService(
+	oauthClientRepository repository.OAuthClientRepository,
+	oauthCodeRepository repository.OAuthCodeRepository,
+	oauthConsentRepository repository.OAuthConsentRepository,
+	oauthDeviceRepository repository.OAuthDeviceCodeRepository,
+	sessionRepository repository.SessionRepository,
+	userRepository repository.UserRepository,
+	revokedTokenRepository repository.RevokedTokenRepository,
+	signingKey *common.SigningKey,
+	configEnv config.ConfigEnv,
+) OAuthService {
+	return oauthService{
+		oauthClientRepository:  oauthClientRepository,
+		oauthCodeRepository:    oauthCodeRepository,
+		oauthConsentRepository: oauthConsentRepository,
+		oauthDeviceRepository:  oauthDeviceRepository,
+		sessionRepository:      sessionRepository,
+		userRepository:         userRepository,
+		revokedTokenRepository: revokedTokenRepository,
+		signingKey:             signingKey,
+		configEnv:              configEnv,
+	}
+}
+
+// authorizeRequest is an authorization request that passed validation.
+type authorizeRequest struct {
+	client      *repository.OAuthClient
+	redirectURI string
+	scopes      []string
+}
+
+func (s oauthService) Authorize(
+	session *repository.Session,
+	authorizeReq model.AuthorizeRequest,
+) (*model.AuthorizeResponse, error) {
+	if session.ClientID != "" {
+		return nil, errs.NewForbiddenError("token cannot be used to authorize clients")
+	}
+
+	request, redirectErr, err := s.validateAuthorizeRequest(authorizeReq)
+	if err != nil {
+		return nil, err
+	}
+	if redirectErr != nil {
+		return redirectErr, nil
+	}
+
+	consent, err := s.oauthConsentRepository.GetByUserAndClient(
+		session.UserID,
+		request.client.ClientID,
+	)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	consented := consent != nil && isSubset(request.scopes, consent.Scopes)
+	if consented && authorizeReq.Prompt != "consent" {
+		return s.issueCode(session, authorizeReq, request)
+	}
+
+	if authorizeReq.Prompt == "none" {
+		return s.buildErrorRedirect(
+			request,
+			authorizeReq.State,
+			"consent_required",
+			"user consent is required",
+		), nil
+	}
+
+	return &model.AuthorizeResponse{
+		ConsentRequired: true,
+		ClientID:        request.client.ClientID,
+		ClientName:      request.client.Name,
+		Scopes:          request.scopes,
+	}, nil
+}
+
+func (s oauthService) Decide(
+	session *repository.Session,
+	decisionReq model.AuthorizeDecisionRequest,
+) (*model.AuthorizeResponse, error) {
+	if session.ClientID != "" {
+		return nil, errs.NewForbiddenError("token cannot be used to authorize clients")
+	}
+
+	request, redirectErr, err := s.validateAuthorizeRequest(decisionReq.AuthorizeRequest)
+	if err != nil {
+		return nil, err
+	}
+	if redirectErr != nil {
+		return redirectErr, nil
+	}
+
+	if !decisionReq.Approve {
+		return s.buildErrorRedirect(
+			request,
+			decisionReq.State,
+			"access_denied",
+			"user denied the request",
+		), nil
+	}
+
+	err = s.saveConsent(session.UserID, request.client.ClientID, request.scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueCode(session, decisionReq.AuthorizeRequest, request)
+}
+
+func (s oauthService) saveConsent(userId string, clientId string, scopes []string) error {
+	consent, err := s.oauthConsentRepository.GetByUserAndClient(userId, clientId)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			zlog.Error(err)
+			return errs.NewUnexpectedError()
+		}
+		consent = &repository.OAuthConsent{UserID: userId, ClientID: clientId}
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(consent.Scopes, scope) {
+			consent.Scopes = append(consent.Scopes, scope)
+		}
+	}
+
+	err = s.oauthConsentRepository.Save(consent)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
+
+func (s oauthService) AuthorizeDevice(
+	deviceReq model.DeviceAuthorizationRequest,
+) (*model.DeviceAuthorizationResponse, error) {
+	client, err := s.authenticateClient(deviceReq.ClientID, deviceReq.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(client.GrantTypes, zconstant.GrantTypeDeviceCode) {
+		return nil, errs.NewOAuthError("unauthorized_client", "grant type is not allowed for client")
+	}
+
+	scopes := strings.Fields(deviceReq.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !isSubset(scopes, client.Scopes) {
+		return nil, errs.NewOAuthError("invalid_scope", "requested scope is not allowed for client")
+	}
+
+	deviceCode, err := common.GenerateSecret(32)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewOAuthServerError()
+	}
+	userCode, err := common.GenerateUserCode()
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewOAuthServerError()
+	}
+
+	oauthDeviceCode := repository.OAuthDeviceCode{
+		DeviceCodeHash: common.HashToken(deviceCode),
+		UserCode:       userCode,
+		ClientID:       client.ClientID,
+		Scope:          strings.Join(scopes, " "),
+		Status:         zconstant.DeviceCodePending,
+		Interval:       5,
+		ExpiresAt:      common.AddTimeByDuration(s.configEnv.DeviceCodeExpiresIn),
+	}
+	err = s.oauthDeviceRepository.Create(&oauthDeviceCode)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewOAuthServerError()
+	}
+
+	displayCode := userCode[:4] + "-" + userCode[4:]
+	return &model.DeviceAuthorizationResponse{
+		DeviceCode:      deviceCode,
+		UserCode:        displayCode,
+		VerificationURI: s.configEnv.DeviceVerificationURI,
+		VerificationURIComplete: buildRedirectURI(
+			s.configEnv.DeviceVerificationURI,
+			url.Values{"user_code": {displayCode}},
+		),
+		ExpiresIn: int64(time.Until(oauthDeviceCode.ExpiresAt).Seconds()),
+		Interval:  oauthDeviceCode.Interval,
+	}, nil
+}
+
+func (s oauthService) GetDeviceVerification(
+	session *repository.Session,
+	userCode string,
+) (*model.DeviceVerificationResponse, error) {
+	if session.ClientID != "" {
+		return nil, errs.NewForbiddenError("token cannot be used to authorize clients")
+	}
+
+	deviceCode, client, err := s.getPendingDeviceCode(userCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.DeviceVerificationResponse{
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		Scopes:     strings.Fields(deviceCode.Scope),
+		Status:     deviceCode.Status,
+	}, nil
+}
+
+func (s oauthService) VerifyDevice(
+	session *repository.Session,
+	verificationReq model.DeviceVerificationRequest,
+) (*model.DeviceVerificationResponse, error) {
+	if session.ClientID != "" {
+		return nil, errs.NewForbiddenError("token cannot be used to authorize clients")
+	}
+
+	deviceCode, client, err := s.getPendingDeviceCode(verificationReq.UserCode)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceCode.Status = zconstant.DeviceCodeDenied
+	if verificationReq.Approve {
+		err = s.saveConsent(session.UserID, client.ClientID, strings.Fields(deviceCode.Scope))
+		if err != nil {
+			return nil, err
+		}
+		deviceCode.Status = zconstant.DeviceCodeApproved
+		deviceCode.UserID = session.UserID
+		deviceCode.SessionID = session.ID
+		deviceCode.AuthTime = session.CreatedAt
+	}
+
+	err = s.oauthDeviceRepository.Update(deviceCode)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return &model.DeviceVerificationResponse{
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		Scopes:     strings.Fields(deviceCode.Scope),
+		Status:     deviceCode.Status,
+	}, nil
+}
+
+func (s oauthService) getPendingDeviceCode(
+	userCode string,
+) (*repository.OAuthDeviceCode, *repository.OAuthClient, error) {
+	userCode = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(userCode))
+
+	deviceCode, err := s.oauthDeviceRepository.GetByUserCode(userCode)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errs.NewNotFoundError("user code is invalid or expired")
+		}
+		zlog.Error(err)
+		return nil, nil, errs.NewUnexpectedError()
+	}
+
+	if deviceCode.Status != zconstant.DeviceCodePending {
+		return nil, nil, errs.NewUnprocessableEntity("user code has already been used")
+	}
+
+	client, err := s.oauthClientRepository.GetByClientId(deviceCode.ClientID)
+	if err != nil {
+		zlog.Error(err)
+		return nil, nil, errs.NewUnexpectedError()
+	}
+
+	return deviceCode, client, nil
+}
+
+func (s oauthService) Token(tokenReq model.OAuthTokenRequest) (*model.OAuthTokenResponse, error) {
+	client, err := s.authenticateClient(tokenReq.ClientID, tokenReq.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(client.GrantTypes, tokenReq.GrantType) {
+		return nil, errs.NewOAuthError("unauthorized_client", "grant type is not allowed for client")
+	}
+
+	switch tokenReq.GrantType {
+	case zconstant.GrantTypeAuthorizationCode:
+		return s.exchangeCode(client, tokenReq)
+	case zconstant.GrantTypeRefreshToken:
+		return s.refreshToken(client, tokenReq)
+	case zconstant.GrantTypeClientCredentials:
+		return s.clientCredentials(client, tokenReq)
+	case zconstant.GrantTypeDeviceCode:
+		return s.exchangeDeviceCode(client, tokenReq)
+	case zconstant.GrantTypeTokenExchange:
+		return s.exchangeToken(client, tokenReq)
+	}
+
+	return nil, errs.NewOAuthError("unsupported_grant_type", "grant type is not supported")
+}
+
+// validateAuthorizeRequest returns an error when the client or redirect URI is
+// invalid, those must never be redirected to. Other problems are reported back
+// to the client through the redirect response.
+func (s oauthService) validateAuthorizeRequest(
+	authorizeReq model.AuthorizeRequest,
+) (*authorizeRequest, *model.AuthorizeResponse, error) {
+	client, err := s.oauthClientRepository.GetByClientId(authorizeReq.ClientID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errs.NewValidationError("client is invalid")
+		}
+		zlog.Error(err)
+		return nil, nil, errs.NewUnexpectedError()
+	}
+
+	redirectURI := authorizeReq.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		return nil, nil, errs.NewValidationError("redirect uri is not registered for client")
+	}
+
+	request := &authorizeRequest{client: client, redirectURI: redirectURI}
+
+	if authorizeReq.ResponseType != "code" {
+		return nil, s.buildErrorRedirect(
+			request,
+			authorizeReq.State,
+			"unsupported_response_type",
+			"only the code response type is supported",
+		), nil
+	}
+
+	if !slices.Contains(client.GrantTypes, zconstant.GrantTypeAuthorizationCode) {
+		return nil, s.buildErrorRedirect(
+			request,
+			authorizeReq.State,
+			"unauthorized_client",
+			"client is not allowed to use the authorization code grant",
+		), nil
+	}
+
+	request.scopes = strings.Fields(authorizeReq.Scope)
+	if len(request.scopes) == 0 {
+		request.scopes = client.Scopes
+	}
+	if !isSubset(request.scopes, client.Scopes) {
+		return nil, s.buildErrorRedirect(
+			request,
+			authorizeReq.State,
+			"invalid_scope",
+			"requested scope is not allowed for client",
+		), nil
+	}
+
+	if authorizeReq.CodeChallenge == "" && client.ClientType == zconstant.OAuthClientPublic {
+		return nil, s.buildErrorRedirect(
+			request,
+			authorizeReq.State,
+			"invalid_request",
+			"code challenge is required for public clients",
+		), nil
+	}
+	if authorizeReq.CodeChallenge != "" && authorizeReq.CodeChallengeMethod != "S256" {
+		return nil, s.buildErrorRedirect(
+			request,
+			authorizeReq.State,
+			"invalid_request",
+			"code challenge method must be S256",
+		), nil
+	}
+
+	return request, nil, nil
+}
+
+func (s oauthService) issueCode(
+	session *repository.Session,
+	authorizeReq model.AuthorizeRequest,
+	request *authorizeRequest,
+) (*model.AuthorizeResponse, error) {
+	code, err := common.GenerateSecret(32)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	oauthCode := repository.OAuthCode{
+		CodeHash:            common.HashToken(code),
+		ClientID:            request.client.ClientID,
+		UserID:              session.UserID,
+		RedirectURI:         authorizeReq.RedirectURI,
+		Scope:               strings.Join(request.scopes, " "),
+		CodeChallenge:       authorizeReq.CodeChallenge,
+		CodeChallengeMethod: authorizeReq.CodeChallengeMethod,
+		Nonce:               authorizeReq.Nonce,
+		SessionID:           session.ID,
+		AuthTime:            session.CreatedAt,
+		ExpiresAt:           common.AddTimeByDuration(s.configEnv.OAuthCodeExpiresIn),
+	}
+	err = s.oauthCodeRepository.Create(&oauthCode)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	params := url.Values{"code": {code}}
+	if authorizeReq.State != "" {
+		params.Set("state", authorizeReq.State)
+	}
+
+	return &model.AuthorizeResponse{
+		ClientID:   request.client.ClientID,
+		ClientName: request.client.Name,
+		Scopes:     request.scopes,
+		RedirectTo: buildRedirectURI(request.redirectURI, params),
+	}, nil
+}
+
+func (s oauthService) buildErrorRedirect(
+	request *authorizeRequest,
+	state string,
+	errorCode string,
+	description string,
+) *model.AuthorizeResponse {
+	params := url.Values{"error": {errorCode}, "error_description": {description}}
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	return &model.AuthorizeResponse{
+		ClientID:   request.client.ClientID,
+		ClientName: request.client.Name,
+		RedirectTo: buildRedirectURI(request.redirectURI, params),
+	}
+}
+
+func (s oauthService) authenticateClient(
+	clientId string,
+	clientSecret string,
+) (*repository.OAuthClient, error) {
+	if clientId == "" {
+		return nil, errs.NewOAuthClientError("client authentication failed")
+	}
+
+	client, err := s.oauthClientRepository.GetByClientId(clientId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewOAuthClientError("client authentication failed")
+		}
+		zlog.Error(err)
+		return nil, errs.NewOAuthServerError()
+	}
+
+	if client.ClientType == zconstant.OAuthClientConfidential {
+		ok := common.CheckSecretHash(clientSecret, client.ClientSecretHash)
+		if !ok {
+			return nil, errs.NewOAuthClientError("client authentication failed")
+		}
+	}
+
+	return client, nil
+}
+
+func (s oauthService) exchangeCode(
+	client *repository.OAuthClient,
+	tokenReq model.OAuthTokenRequest,
+) (*model.OAuthTokenResponse, error) {
+	code, err := s.oauthCodeRepository.GetByCodeHash(common.HashToken(tokenReq.Code))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewOAuthError("invalid_grant", "authorization code is invalid")
+		}
+		zlog.Error(err)
+		return nil, errs.NewOAuthServerError()
+	}
+
+	// Codes are single use, burn it before doing anything else.
+	err = s.oauthCodeRepository.DeleteById(code.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewOAuthError("invalid_grant", "authorization code is invalid")
+		}
+		zlog.Error(err)
+		return nil, errs.NewOAuthServerError()
+	}
+
+	if code.ClientID != client.ClientID || code.RedirectURI != tokenReq.RedirectURI {
+		return nil, errs.NewOAuthError("invalid_grant", "authorization code is invalid")
+	}
+
+	if code.CodeChallenge != "" {
+		ok := common.VerifyCodeChallenge(
+			tokenReq.CodeVerifier,
+			code.CodeChallenge,
+			code.CodeChallengeMethod,
+		)
+		if !ok {
+			return nil, errs.NewOAuthError("invalid_grant", "code verifier is invalid")
+		}
+	}
+
+	session := repository.Session{
+		UserID:       code.UserID,
+		RefreshToken: uuid.NewString(),
+		ExpiresAt:    s.getRefreshTokenExpiresAt(client),
+		ClientID:     client.ClientID,
+		Scope:        code.Scope,
+		AuthTime:     code.AuthTime,
+		ParentID:     code.SessionID,
+	}
+	err = s.sessionRepository.Create(&session)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewOAuthServerError()
+	}
+
+	return s.buildTokenResponse(client, &session, session.Scope, code.Nonce)
+}
+
+func (s oauthService) refreshToken(
+	client *repository.OAuthClient,
+	tokenReq model.OAuthTokenRequest,
+) (*model.OAuthTokenResponse, error) {
+	refreshToken, err := common.Decrypt(
+		tokenReq.RefreshToken,
+		s.configEnv.JwtRefreshTokenSecret,
+	)
+	if err != nil {
+		return nil, errs.NewOAuthError("invalid_grant", "refresh token is invalid")
+	}
+
+	session, err := s.sessionRepository.GetByRefreshToken(refreshToken)
+	if err != nil {
+		return nil, errs.NewOAuthError("invalid_grant", "refresh token is invalid")
+	}
+
+	if session.ClientID != client.ClientID || session.ExpiresAt.Before(time.Now()) {
+		return nil, errs.NewOAuthError("invalid_grant", "refresh token is invalid")
+	}
+
+	scope := session.Scope
+	if tokenReq.Scope != "" {
+		if !isSubset(strings.Fields(tokenReq.Scope), strings.Fields(session.Scope)) {
+			return nil, errs.NewOAuthError("invalid_scope", "requested scope exceeds the original grant")
+		}
+		scope = tokenReq.Scope
+	}
+
+	session.RefreshToken = uuid.NewString()
+	session.ExpiresAt = s.getRefreshTokenExpiresAt(client)
+	err = s.sessionRepository.Update(session)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewOAuthServerError()
+	}
+
+	return s.buildTokenResponse(client, session, scope, "")
+}
+
+// exchangeDeviceCode answers device polling with the RFC 8628 section 3.5
+// error codes until the user has approved or denied the request.
+func (s oauthService) exchangeDeviceCode(
+	client *repository.OAuthClient,
+	tokenReq model.OAuthTokenRequest,
+) (*model.OAuthTokenResponse, error) {
+	deviceCode, err := s.oauthDeviceRepository.GetByDeviceCodeHash(
+		common.HashToken(tokenReq.DeviceCode),
+	)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewOAuthError("invalid_grant", "device code is invalid")
+		}
+		zlog.Error(err)
+		return nil, errs.NewOAuthServerError()
+	}
+
+	if deviceCode.ClientID != client.ClientID {
+		return nil, errs.NewOAuthError("invalid_grant", "device code is invalid")
+	}
+
+	if deviceCode.ExpiresAt.Before(time.Now()) {
+		err = s.oauthDeviceRepository.DeleteById(deviceCode.ID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			zlog.Error(err)
+			return nil, errs.NewOAuthServerError()
+		}
+		return nil, errs.NewOAuthError("expired_token", "device code has expired")
+	}
+
+	switch deviceCode.Status {
+	case zconstant.DeviceCodeDenied:
+		err = s.oauthDeviceRepository.DeleteById(deviceCode.ID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			zlog.Error(err)
+			return nil, errs.NewOAuthServerError()
+		}
+		return nil, errs.NewOAuthError("access_denied", "user denied the request")
+
+	case zconstant.DeviceCodePending:
+		interval := time.Duration(deviceCode.Interval) * time.Second
+		tooFast := time.Since(deviceCode.LastPolledAt) < interval
+		if tooFast {
+			deviceCode.Interval += 5
+		}
+		deviceCode.LastPolledAt = time.Now()
+		err = s.oauthDeviceRepository.Update(deviceCode)
+		if err != nil {
+			zlog.Error(err)
+			return nil, errs.NewOAuthServerError()
+		}
+
+		if tooFast {
+			return nil, errs.NewOAuthError("slow_down", "polling too frequently")
+		}
+		return nil, errs.NewOAuthError("authorization_pending", "user has not yet approved the request")
+	}
+
+	// Overlapping polls race for the approval, only the one that deletes the
+	// device code gets tokens.
+	err = s.oauthDeviceRepository.DeleteById(deviceCode.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewOAuthError("invalid_grant", "device code is invalid")
+		}
+		zlog.Error(err)
+		return nil, errs.NewOAuthServerError()
+	}
+
+	session := repository.Session{
+		UserID:       deviceCode.UserID,
+		RefreshToken: uuid.NewString(),
+		ExpiresAt:    s.getRefreshTokenExpiresAt(client),
+		ClientID:     client.ClientID,
+		Scope:        deviceCode.Scope,
+		AuthTime:     deviceCode.AuthTime,
+		ParentID:     deviceCode.SessionID,
+	}
+	err = s.sessionRepository.Create(&session)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewOAuthServerError()
+	}
+
+	return s.buildTokenResponse(client, &session, session.Scope, "")
+}
+
+// exchangeToken swaps a user's access token for a down-scoped token limited
+// to one audience, recording the calling client as the actor. The new token
+// stays bound to the user's session so logout and revocation still apply.
+func (s oauthService) exchangeToken(
+	client *repository.OAuthClient,
+	tokenReq model.OAuthTokenRequest,
+) (*model.OAuthTokenResponse, error) {
+	if client.ClientType != zconstant.OAuthClientConfidential {
+		return nil, errs.NewOAuthError("unauthorized_client", "only confidential clients may use this grant")
+	}
+
+	if tokenReq.SubjectTokenType != zconstant.TokenTypeAccessToken {
+		return nil, errs.NewOAuthError("invalid_request", "subject token type is not supported")
+	}
+	if tokenReq.ActorToken != "" {
+		return nil, errs.NewOAuthError("invalid_request", "actor token is not supported")
+	}
+	requestedType := tokenReq.RequestedTokenType
+	if requestedType != "" && requestedType != zconstant.TokenTypeAccessToken {
+		return nil, errs.NewOAuthError("invalid_request", "requested token type is not supported")
+	}
+
+	if tokenReq.Audience == "" || !slices.Contains(client.TokenExchangeAudiences, tokenReq.Audience) {
+		return nil, errs.NewOAuthError("invalid_target", "audience is not allowed for client")
+	}
+
+	subject, ok := common.ValidateToken(tokenReq.SubjectToken, s.configEnv.JwtTokenSecret)
+	if !ok || subject.SubjectType != common.SubjectTypeUser {
+		return nil, errs.NewOAuthError("invalid_grant", "subject token is invalid")
+	}
+
+	if subject.Act != nil {
+		_, err := s.revokedTokenRepository.GetByJti(subject.Id)
+		if err == nil {
+			return nil, errs.NewOAuthError("invalid_grant", "subject token is invalid")
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			zlog.Error(err)
+			return nil, errs.NewOAuthServerError()
+		}
+	}
+
+	session, err := s.sessionRepository.GetById(getTokenSessionId(subject))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewOAuthError("invalid_grant", "subject token is invalid")
+		}
+		zlog.Error(err)
+		return nil, errs.NewOAuthServerError()
+	}
+
+	// Tokens from the password login carry no scope, the client's own scopes
+	// are the ceiling for those.
+	allowedScopes := client.Scopes
+	if subject.Scope != "" {
+		allowedScopes = strings.Fields(subject.Scope)
+	}
+	scopes := strings.Fields(tokenReq.Scope)
+	if len(scopes) == 0 {
+		scopes = allowedScopes
+	}
+	if !isSubset(scopes, allowedScopes) || !isSubset(scopes, client.Scopes) {
+		return nil, errs.NewOAuthError("invalid_scope", "requested scope exceeds the subject token")
+	}
+	scope := strings.Join(scopes, " ")
+
+	tokenExpiresAt := s.getTokenExpiresAt(client)
+	if subjectExpiresAt := time.Unix(subject.ExpiresAt, 0); subjectExpiresAt.Before(tokenExpiresAt) {
+		tokenExpiresAt = subjectExpiresAt
+	}
+
+	token := common.SignToken(&common.TokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  tokenReq.Audience,
+			ExpiresAt: tokenExpiresAt.Unix(),
+			Id:        uuid.NewString(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    s.configEnv.Issuer,
+			Subject:   subject.Subject,
+		},
+		ClientID:  client.ClientID,
+		Scope:     scope,
+		SessionID: session.ID,
+		Act:       &model.ActorClaim{Subject: client.ClientID, Act: subject.Act},
+	}, s.configEnv.JwtTokenSecret)
+
+	return &model.OAuthTokenResponse{
+		AccessToken:     token,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(time.Until(tokenExpiresAt).Seconds()),
+		Scope:           scope,
+		IssuedTokenType: zconstant.TokenTypeAccessToken,
+	}, nil
+}
+
+// clientCredentials issues a session-less token whose subject is the client
+// itself. It is signed with the same secret as user access tokens.
+func (s oauthService) clientCredentials(
+	client *repository.OAuthClient,
+	tokenReq model.OAuthTokenRequest,
+) (*model.OAuthTokenResponse, error) {
+	if client.ClientType != zconstant.OAuthClientConfidential {
+		return nil, errs.NewOAuthError("unauthorized_client", "only confidential clients may use this grant")
+	}
+
+	scopes := strings.Fields(tokenReq.Scope)
+	if len(scopes) == 0 {
+		scopes = slices.DeleteFunc(slices.Clone(client.Scopes), func(scope string) bool {
+			return scope == zconstant.ScopeOpenID
+		})
+	}
+	if slices.Contains(scopes, zconstant.ScopeOpenID) || !isSubset(scopes, client.Scopes) {
+		return nil, errs.NewOAuthError("invalid_scope", "requested scope is not allowed for client")
+	}
+	scope := strings.Join(scopes, " ")
+
+	tokenExpiresAt := s.getTokenExpiresAt(client)
+	token := common.SignToken(&common.TokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: tokenExpiresAt.Unix(),
+			Id:        uuid.NewString(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    s.configEnv.Issuer,
+			Subject:   client.ClientID,
+		},
+		SubjectType: common.SubjectTypeClient,
+		ClientID:    client.ClientID,
+		Scope:       scope,
+	}, s.configEnv.JwtTokenSecret)
+
+	return &model.OAuthTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(time.Until(tokenExpiresAt).Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// getTokenExpiresAt applies the client's own access token lifetime when set.
+func (s oauthService) getTokenExpiresAt(client *repository.OAuthClient) time.Time {
+	if client.TokenExpiresIn != "" {
+		if _, err := time.ParseDuration(client.TokenExpiresIn); err == nil {
+			return common.AddTimeByDuration(client.TokenExpiresIn)
+		}
+		zlog.Error("invalid token lifetime for client " + client.ClientID)
+	}
+	return common.AddTimeByDuration(s.configEnv.JwtTokenExpiresIn)
+}
+
+func (s oauthService) getRefreshTokenExpiresAt(client *repository.OAuthClient) time.Time {
+	if client.RefreshTokenExpiresIn != "" {
+		if _, err := time.ParseDuration(client.RefreshTokenExpiresIn); err == nil {
+			return common.AddTimeByDuration(client.RefreshTokenExpiresIn)
+		}
+		zlog.Error("invalid refresh token lifetime for client " + client.ClientID)
+	}
+	return common.AddTimeByDuration(s.configEnv.JwtRefreshTokenExpiresIn)
+}
+
+func (s oauthService) buildTokenResponse(
+	client *repository.OAuthClient,
+	session *repository.Session,
+	scope string,
+	nonce string,
+) (*model.OAuthTokenResponse, error) {
+	tokenExpiresAt := s.getTokenExpiresAt(client)
+	token := common.SignToken(&common.TokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  client.ClientID,
+			ExpiresAt: tokenExpiresAt.Unix(),
+			Id:        session.ID,
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    s.configEnv.Issuer,
+			Subject:   session.UserID,
+		},
+		ClientID: client.ClientID,
+		Scope:    scope,
+	}, s.configEnv.JwtTokenSecret)
+
+	tokenResponse := model.OAuthTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(time.Until(tokenExpiresAt).Seconds()),
+		Scope:       scope,
+	}
+
+	if slices.Contains(client.GrantTypes, zconstant.GrantTypeRefreshToken) {
+		refreshTokenAES, err := common.Encrypt(
+			session.RefreshToken,
+			s.configEnv.JwtRefreshTokenSecret,
+		)
+		if err != nil {
+			zlog.Error(err)
+			return nil, errs.NewOAuthServerError()
+		}
+		tokenResponse.RefreshToken = refreshTokenAES
+	}
+
+	if slices.Contains(strings.Fields(scope), zconstant.ScopeOpenID) {
+		idToken, err := s.buildIDToken(client, session, scope, nonce, token, tokenExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		tokenResponse.IDToken = idToken
+	}
+
+	return &tokenResponse, nil
+}
+
+func (s oauthService) buildIDToken(
+	client *repository.OAuthClient,
+	session *repository.Session,
+	scope string,
+	nonce string,
+	accessToken string,
+	expiresAt time.Time,
+) (string, error) {
+	user, err := s.userRepository.GetById(session.UserID)
+	if err != nil {
+		zlog.Error(err)
+		return "", errs.NewOAuthServerError()
+	}
+
+	claims := buildUserClaims(user, strings.Fields(scope))
+	claims["iss"] = s.configEnv.Issuer
+	claims["aud"] = client.ClientID
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = expiresAt.Unix()
+	claims["auth_time"] = session.AuthTime.Unix()
+	claims["at_hash"] = common.TokenHash(accessToken)
+	if session.ParentID != "" {
+		claims["sid"] = session.ParentID
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	idToken, err := s.signingKey.Sign(claims)
+	if err != nil {
+		zlog.Error(err)
+		return "", errs.NewOAuthServerError()
+	}
+	return idToken, nil
+}
+
+func (s oauthService) Introspect(
+	introspectReq model.TokenIntrospectionRequest,
+) (*model.TokenIntrospectionResponse, error) {
+	client, err := s.authenticateClient(introspectReq.ClientID, introspectReq.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if client.ClientType != zconstant.OAuthClientConfidential {
+		return nil, errs.NewOAuthClientError("client authentication failed")
+	}
+
+	introspectors := []func(string) (*model.TokenIntrospectionResponse, error){
+		s.introspectAccessToken,
+		s.introspectRefreshToken,
+	}
+	if introspectReq.TokenTypeHint == "refresh_token" {
+		slices.Reverse(introspectors)
+	}
+
+	for _, introspect := range introspectors {
+		introspection, err := introspect(introspectReq.Token)
+		if err != nil {
+			return nil, err
+		}
+		if introspection != nil {
+			return introspection, nil
+		}
+	}
+
+	return &model.TokenIntrospectionResponse{Active: false}, nil
+}
+
+// introspectAccessToken returns nil when token is not an active access token.
+func (s oauthService) introspectAccessToken(
+	token string,
+) (*model.TokenIntrospectionResponse, error) {
+	claims, ok := common.ValidateToken(token, s.configEnv.JwtTokenSecret)
+	if !ok || claims.SubjectType == common.SubjectTypePasswordChange {
+		return nil, nil
+	}
+
+	introspection := model.TokenIntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		TokenType: "access_token",
+		Exp:       claims.ExpiresAt,
+		Iat:       claims.IssuedAt,
+		Sub:       claims.Subject,
+		Aud:       claims.Audience,
+		Iss:       claims.Issuer,
+		Jti:       claims.Id,
+		Act:       claims.Act,
+	}
+
+	if claims.SubjectType != common.SubjectTypeUser || claims.Act != nil {
+		_, err := s.revokedTokenRepository.GetByJti(claims.Id)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			zlog.Error(err)
+			return nil, errs.NewOAuthServerError()
+		}
+	}
+
+	if claims.SubjectType != common.SubjectTypeUser {
+		return &introspection, nil
+	}
+
+	// User tokens live as long as the session they were issued for.
+	session, err := s.sessionRepository.GetById(getTokenSessionId(claims))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		zlog.Error(err)
+		return nil, errs.NewOAuthServerError()
+	}
+
+	introspection.SessionID = session.ID
+	introspection.SessionExpiresAt = session.ExpiresAt.Unix()
+	if user, err := s.userRepository.GetById(session.UserID); err == nil {
+		introspection.Username = user.Username
+	}
+
+	return &introspection, nil
+}
+
+// introspectRefreshToken returns nil when token is not an active refresh token.
+func (s oauthService) introspectRefreshToken(
+	token string,
+) (*model.TokenIntrospectionResponse, error) {
+	session := s.getSessionByRefreshToken(token)
+	if session == nil || session.ExpiresAt.Before(time.Now()) {
+		return nil, nil
+	}
+
+	introspection := model.TokenIntrospectionResponse{
+		Active:           true,
+		Scope:            session.Scope,
+		ClientID:         session.ClientID,
+		TokenType:        "refresh_token",
+		Exp:              session.ExpiresAt.Unix(),
+		Iat:              session.UpdatedAt.Unix(),
+		Sub:              session.UserID,
+		Iss:              s.configEnv.Issuer,
+		SessionID:        session.ID,
+		SessionExpiresAt: session.ExpiresAt.Unix(),
+	}
+	if user, err := s.userRepository.GetById(session.UserID); err == nil {
+		introspection.Username = user.Username
+	}
+
+	return &introspection, nil
+}
+
+// Revoke never reports whether the token was known, as RFC 7009 requires.
+func (s oauthService) Revoke(revokeReq model.TokenRevocationRequest) error {
+	client, err := s.authenticateClient(revokeReq.ClientID, revokeReq.ClientSecret)
+	if err != nil {
+		return err
+	}
+
+	if session := s.getSessionByRefreshToken(revokeReq.Token); session != nil {
+		if session.ClientID != client.ClientID {
+			return nil
+		}
+		err = s.sessionRepository.DeleteById(session.ID)
+		if err != nil {
+			zlog.Error(err)
+			return errs.NewOAuthServerError()
+		}
+		return nil
+	}
+
+	claims, ok := common.ValidateToken(revokeReq.Token, s.configEnv.JwtTokenSecret)
+	if !ok || claims.ClientID != client.ClientID {
+		return nil
+	}
+
+	// Revoking a delegated token must not end the user's session.
+	if claims.SubjectType == common.SubjectTypeUser && claims.Act == nil {
+		err = s.sessionRepository.DeleteById(claims.Id)
+	} else {
+		err = s.revokedTokenRepository.Create(&repository.RevokedToken{
+			JTI:       claims.Id,
+			ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+		})
+	}
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewOAuthServerError()
+	}
+
+	return nil
+}
+
+func (s oauthService) getSessionByRefreshToken(token string) *repository.Session {
+	refreshToken, err := common.Decrypt(token, s.configEnv.JwtRefreshTokenSecret)
+	if err != nil {
+		return nil
+	}
+
+	session, err := s.sessionRepository.GetByRefreshToken(refreshToken)
+	if err != nil {
+		return nil
+	}
+	return session
+}
+
+func (s oauthService) GetUserInfo(userId string, scope string) (map[string]any, error) {
+	scopes := strings.Fields(scope)
+	if !slices.Contains(scopes, zconstant.ScopeOpenID) {
+		return nil, errs.NewForbiddenError("insufficient scope")
+	}
+
+	user, err := s.userRepository.GetById(userId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewUnauthorizedError("invalid token")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return buildUserClaims(user, scopes), nil
+}
+
+func (s oauthService) GetOpenIDConfiguration() *model.OpenIDConfigurationResponse {
+	return &model.OpenIDConfigurationResponse{
+		Issuer:                      s.configEnv.Issuer,
+		AuthorizationEndpoint:       s.configEnv.Issuer + "/oauth/authorize",
+		TokenEndpoint:               s.configEnv.Issuer + "/oauth/token",
+		UserinfoEndpoint:            s.configEnv.Issuer + "/oauth/userinfo",
+		JwksURI:                     s.configEnv.Issuer + "/oauth/jwks",
+		IntrospectionEndpoint:       s.configEnv.Issuer + "/oauth/introspect",
+		RevocationEndpoint:          s.configEnv.Issuer + "/oauth/revoke",
+		DeviceAuthorizationEndpoint: s.configEnv.Issuer + "/oauth/device_authorization",
+		EndSessionEndpoint:          s.configEnv.Issuer + "/oauth/end_session",
+		RegistrationEndpoint: common.TernaryIf(
+			s.configEnv.OAuthInitialAccessToken != "",
+			s.configEnv.Issuer+"/oauth/register",
+			"",
+		),
+		ScopesSupported:        []string{zconstant.ScopeOpenID, zconstant.ScopeProfile, zconstant.ScopeEmail},
+		ResponseTypesSupported: []string{"code"},
+		GrantTypesSupported: []string{
+			zconstant.GrantTypeAuthorizationCode,
+			zconstant.GrantTypeRefreshToken,
+			zconstant.GrantTypeClientCredentials,
+			zconstant.GrantTypeDeviceCode,
+			zconstant.GrantTypeTokenExchange,
+		},
+		SubjectTypesSupported:              []string{"public"},
+		IDTokenSigningAlgValuesSupported:   []string{"RS256"},
+		TokenEndpointAuthMethodsSupported:  []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:      []string{"S256"},
+		BackchannelLogoutSupported:         true,
+		BackchannelLogoutSessionSupported:  true,
+		FrontchannelLogoutSupported:        true,
+		FrontchannelLogoutSessionSupported: true,
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "sid",
+			"name", "given_name", "family_name", "preferred_username", "updated_at",
+			"email", "email_verified",
+		},
+	}
+}
+
+func (s oauthService) GetJwks() *model.JwksResponse {
+	return &model.JwksResponse{Keys: []model.JsonWebKey{s.signingKey.JsonWebKey()}}
+}
+
+// buildUserClaims maps a user onto the standard OIDC claims allowed by scopes.
+func buildUserClaims(user *repository.User, scopes []string) jwt.MapClaims {
+	claims := jwt.MapClaims{"sub": user.ID}
+
+	if slices.Contains(scopes, zconstant.ScopeProfile) {
+		claims["name"] = user.DisplayName
+		claims["given_name"] = user.FirstName
+		claims["family_name"] = user.LastName
+		claims["preferred_username"] = user.Username
+		claims["updated_at"] = user.UpdatedAt.Unix()
+	}
+
+	if slices.Contains(scopes, zconstant.ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.VerifyFlag
+	}
+
+	return claims
+}
+
+func getTokenSessionId(claims *common.TokenClaims) string {
+	if claims.SessionID != "" {
+		return claims.SessionID
+	}
+	return claims.Id
+}
+
+func isSubset(values []string, allowed []string) bool {
+	for _, value := range values {
+		if !slices.Contains(allowed, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func buildRedirectURI(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,692 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	zconstant "lazy-auth/app/constant"
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/common"
+	"lazy-auth/config"
+)
+
+const (
+	testRedirectURI  = "https://app.example.com/callback"
+	testAudience     = "https://api.example.com"
+	testClientSecret = "web-secret"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// testSigningKey is generated once, RSA key generation is slow.
+var testSigningKey = sync.OnceValue(func() *common.SigningKey {
+	return common.LoadSigningKey("")
+})
+
+type oauthTestEnv struct {
+	service      OAuthService
+	repos        *testRepositories
+	loginSession *repository.Session
+}
+
+// newOAuthTestEnv sets up three clients: "web" is confidential and may use
+// every grant but the device code, "spa" is public with PKCE and "tv" is a
+// public device client. configure changes the configuration before the
+// service is built.
+func newOAuthTestEnv(t *testing.T, configure ...func(*config.ConfigEnv)) *oauthTestEnv {
+	t.Helper()
+
+	secretHash, err := common.HashSecret(testClientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos := newTestRepositories()
+	repos.oauthClients.clients["web"] = repository.OAuthClient{
+		ClientID:         "web",
+		ClientSecretHash: secretHash,
+		Name:             "Web",
+		ClientType:       zconstant.OAuthClientConfidential,
+		RedirectURIs:     []string{testRedirectURI},
+		GrantTypes: []string{
+			zconstant.GrantTypeAuthorizationCode,
+			zconstant.GrantTypeRefreshToken,
+			zconstant.GrantTypeClientCredentials,
+			zconstant.GrantTypeTokenExchange,
+		},
+		Scopes:                 []string{"openid", "profile", "email", "api"},
+		TokenExchangeAudiences: []string{testAudience},
+	}
+	repos.oauthClients.clients["spa"] = repository.OAuthClient{
+		ClientID:     "spa",
+		Name:         "SPA",
+		ClientType:   zconstant.OAuthClientPublic,
+		RedirectURIs: []string{testRedirectURI},
+		GrantTypes:   []string{zconstant.GrantTypeAuthorizationCode},
+		Scopes:       []string{"openid", "profile"},
+	}
+	repos.oauthClients.clients["tv"] = repository.OAuthClient{
+		ClientID:   "tv",
+		Name:       "TV",
+		ClientType: zconstant.OAuthClientPublic,
+		GrantTypes: []string{zconstant.GrantTypeDeviceCode, zconstant.GrantTypeRefreshToken},
+		Scopes:     []string{"openid", "profile"},
+	}
+
+	env := oauthTestEnv{repos: repos}
+	env.loginSession = &repository.Session{
+		UserID:       "user-1",
+		RefreshToken: "login-refresh-token",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}
+	env.loginSession.CreatedAt = time.Now().Add(-time.Minute)
+	err = repos.sessions.Create(env.loginSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.service = NewOAuthService(
+		repos.oauthClients,
+		repos.oauthCodes,
+		repos.oauthConsents,
+		repos.oauthDeviceCodes,
+		repos.sessions,
+		repos.users,
+		repos.revokedTokens,
+		testSigningKey(),
+		newTestConfigEnv(configure...),
+	)
+	return &env
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorize approves an authorization request as the logged in user and
+// returns the query of the redirect back to the client.
+func (env *oauthTestEnv) authorize(t *testing.T, authorizeReq model.AuthorizeRequest) url.Values {
+	t.Helper()
+
+	authorizeReq.ResponseType = "code"
+	authorizeResp, err := env.service.Decide(
+		env.loginSession,
+		model.AuthorizeDecisionRequest{AuthorizeRequest: authorizeReq, Approve: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirectTo, err := url.Parse(authorizeResp.RedirectTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return redirectTo.Query()
+}
+
+// spaCode returns a fresh code issued to the public client with PKCE.
+func (env *oauthTestEnv) spaCode(t *testing.T) string {
+	t.Helper()
+
+	query := env.authorize(t, model.AuthorizeRequest{
+		ClientID:            "spa",
+		RedirectURI:         testRedirectURI,
+		Scope:               "openid profile",
+		CodeChallenge:       codeChallenge(testCodeVerifier),
+		CodeChallengeMethod: "S256",
+		Nonce:               "n-0S6_WzA2Mj",
+	})
+	if query.Get("code") == "" {
+		t.Fatalf("no code in redirect: %v", query)
+	}
+	return query.Get("code")
+}
+
+func spaTokenRequest(code string) model.OAuthTokenRequest {
+	return model.OAuthTokenRequest{
+		GrantType:    zconstant.GrantTypeAuthorizationCode,
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: testCodeVerifier,
+		ClientID:     "spa",
+	}
+}
+
+// lineUp returns a function that blocks until n goroutines have called it.
+func lineUp(n int) func() {
+	var arrived sync.WaitGroup
+	arrived.Add(n)
+	return func() {
+		arrived.Done()
+		arrived.Wait()
+	}
+}
+
+func assertOAuthError(t *testing.T, err error, errorCode string) {
+	t.Helper()
+
+	var oauthErr errs.OAuthError
+	if !errors.As(err, &oauthErr) {
+		t.Fatalf("error = %v, want OAuth error %s", err, errorCode)
+	}
+	if oauthErr.ErrorCode != errorCode {
+		t.Fatalf("error = %s (%s), want %s", oauthErr.ErrorCode, oauthErr.Description, errorCode)
+	}
+}
+
+func TestTokenAuthorizationCodeWithPkce(t *testing.T) {
+	env := newOAuthTestEnv(t)
+
+	tokenResp, err := env.service.Token(spaTokenRequest(env.spaCode(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, ok := common.ValidateToken(tokenResp.AccessToken, testJwtTokenSecret)
+	if !ok {
+		t.Fatal("access token is invalid")
+	}
+	if claims.Subject != "user-1" || claims.ClientID != "spa" || claims.Scope != "openid profile" {
+		t.Errorf("access token claims = %+v", claims)
+	}
+	if tokenResp.RefreshToken != "" {
+		t.Error("refresh token issued to a client without the refresh_token grant")
+	}
+
+	idClaims, ok := testSigningKey().Verify(tokenResp.IDToken)
+	if !ok {
+		t.Fatal("ID token is invalid")
+	}
+	for name, want := range map[string]any{
+		"iss":                testIssuer,
+		"aud":                "spa",
+		"sub":                "user-1",
+		"nonce":              "n-0S6_WzA2Mj",
+		"sid":                env.loginSession.ID,
+		"preferred_username": "jdoe",
+		"at_hash":            common.TokenHash(tokenResp.AccessToken),
+	} {
+		if idClaims[name] != want {
+			t.Errorf("ID token %s = %v, want %v", name, idClaims[name], want)
+		}
+	}
+	if _, ok := idClaims["email"]; ok {
+		t.Error("ID token has the email claim without the email scope")
+	}
+
+	session, err := env.repos.sessions.GetById(claims.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.ClientID != "spa" || session.ParentID != env.loginSession.ID {
+		t.Errorf("OAuth session = %+v", session)
+	}
+}
+
+func TestTokenAuthorizationCodeRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*model.OAuthTokenRequest)
+		want   string
+	}{
+		{"wrong verifier", func(r *model.OAuthTokenRequest) { r.CodeVerifier = strings.Repeat("x", 43) }, "invalid_grant"},
+		{"missing verifier", func(r *model.OAuthTokenRequest) { r.CodeVerifier = "" }, "invalid_grant"},
+		{"other redirect uri", func(r *model.OAuthTokenRequest) { r.RedirectURI = "https://evil.example.com" }, "invalid_grant"},
+		{"unknown code", func(r *model.OAuthTokenRequest) { r.Code = "unknown" }, "invalid_grant"},
+		{
+			"other client",
+			func(r *model.OAuthTokenRequest) { r.ClientID, r.ClientSecret = "web", testClientSecret },
+			"invalid_grant",
+		},
+		{"unknown client", func(r *model.OAuthTokenRequest) { r.ClientID = "unknown" }, "invalid_client"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := newOAuthTestEnv(t)
+			code := env.spaCode(t)
+
+			tokenReq := spaTokenRequest(code)
+			test.change(&tokenReq)
+			_, err := env.service.Token(tokenReq)
+			assertOAuthError(t, err, test.want)
+
+			// A rejected redemption still burns the code, it cannot be
+			// retried with the right values.
+			if test.want == "invalid_grant" && tokenReq.Code == code {
+				_, err = env.service.Token(spaTokenRequest(code))
+				assertOAuthError(t, err, "invalid_grant")
+			}
+		})
+	}
+}
+
+func TestTokenAuthorizationCodeExpired(t *testing.T) {
+	env := newOAuthTestEnv(t, func(configEnv *config.ConfigEnv) { configEnv.OAuthCodeExpiresIn = "-1m" })
+
+	_, err := env.service.Token(spaTokenRequest(env.spaCode(t)))
+	assertOAuthError(t, err, "invalid_grant")
+}
+
+func TestTokenAuthorizationCodeSingleUse(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	code := env.spaCode(t)
+
+	// Every request reads the code before any of them deletes it, the
+	// interleaving that lets a code be redeemed twice.
+	const attempts = 20
+	env.repos.oauthCodes.afterGet = lineUp(attempts)
+	var wg sync.WaitGroup
+	results := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := env.service.Token(spaTokenRequest(code))
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assertOAuthError(t, err, "invalid_grant")
+	}
+	if succeeded != 1 {
+		t.Errorf("%d redemptions succeeded, want 1", succeeded)
+	}
+}
+
+func TestAuthorizeRequiresPkceForPublicClients(t *testing.T) {
+	env := newOAuthTestEnv(t)
+
+	query := env.authorize(t, model.AuthorizeRequest{ClientID: "spa", RedirectURI: testRedirectURI, State: "xyz"})
+	if query.Get("error") != "invalid_request" || query.Get("state") != "xyz" || query.Get("code") != "" {
+		t.Errorf("redirect = %v, want invalid_request", query)
+	}
+
+	query = env.authorize(t, model.AuthorizeRequest{
+		ClientID:            "spa",
+		RedirectURI:         testRedirectURI,
+		CodeChallenge:       "plain-challenge",
+		CodeChallengeMethod: "plain",
+	})
+	if query.Get("error") != "invalid_request" {
+		t.Errorf("plain challenge redirect = %v, want invalid_request", query)
+	}
+}
+
+func TestTokenClientAuthentication(t *testing.T) {
+	env := newOAuthTestEnv(t)
+
+	_, err := env.service.Token(model.OAuthTokenRequest{
+		GrantType:    zconstant.GrantTypeClientCredentials,
+		ClientID:     "web",
+		ClientSecret: "wrong",
+	})
+	assertOAuthError(t, err, "invalid_client")
+
+	_, err = env.service.Token(model.OAuthTokenRequest{GrantType: zconstant.GrantTypeClientCredentials})
+	assertOAuthError(t, err, "invalid_client")
+
+	_, err = env.service.Token(model.OAuthTokenRequest{
+		GrantType: zconstant.GrantTypeClientCredentials,
+		ClientID:  "spa",
+	})
+	assertOAuthError(t, err, "unauthorized_client")
+
+	_, err = env.service.Token(model.OAuthTokenRequest{
+		GrantType:    "password",
+		ClientID:     "web",
+		ClientSecret: testClientSecret,
+	})
+	assertOAuthError(t, err, "unauthorized_client")
+}
+
+func TestTokenRefreshTokenRotation(t *testing.T) {
+	env := newOAuthTestEnv(t)
+
+	query := env.authorize(t, model.AuthorizeRequest{
+		ClientID:    "web",
+		RedirectURI: testRedirectURI,
+		Scope:       "openid email api",
+	})
+	tokenResp, err := env.service.Token(model.OAuthTokenRequest{
+		GrantType:    zconstant.GrantTypeAuthorizationCode,
+		Code:         query.Get("code"),
+		RedirectURI:  testRedirectURI,
+		ClientID:     "web",
+		ClientSecret: testClientSecret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenResp.RefreshToken == "" {
+		t.Fatal("no refresh token")
+	}
+
+	refreshReq := model.OAuthTokenRequest{
+		GrantType:    zconstant.GrantTypeRefreshToken,
+		RefreshToken: tokenResp.RefreshToken,
+		Scope:        "openid profile",
+		ClientID:     "web",
+		ClientSecret: testClientSecret,
+	}
+	_, err = env.service.Token(refreshReq)
+	assertOAuthError(t, err, "invalid_scope")
+
+	refreshReq.Scope = "api"
+	refreshed, err := env.service.Token(refreshReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.Scope != "api" || refreshed.IDToken != "" || refreshed.RefreshToken == tokenResp.RefreshToken {
+		t.Errorf("refreshed = %+v", refreshed)
+	}
+
+	// The refresh token was rotated, the old one is dead.
+	_, err = env.service.Token(refreshReq)
+	assertOAuthError(t, err, "invalid_grant")
+
+	refreshReq.RefreshToken = "not-encrypted"
+	_, err = env.service.Token(refreshReq)
+	assertOAuthError(t, err, "invalid_grant")
+}
+
+func TestTokenClientCredentials(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	tokenReq := model.OAuthTokenRequest{
+		GrantType:    zconstant.GrantTypeClientCredentials,
+		ClientID:     "web",
+		ClientSecret: testClientSecret,
+	}
+
+	tokenResp, err := env.service.Token(tokenReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenResp.Scope != "profile email api" || tokenResp.IDToken != "" || tokenResp.RefreshToken != "" {
+		t.Errorf("token response = %+v", tokenResp)
+	}
+	claims, ok := common.ValidateToken(tokenResp.AccessToken, testJwtTokenSecret)
+	if !ok || claims.SubjectType != common.SubjectTypeClient || claims.Subject != "web" {
+		t.Errorf("access token claims = %+v", claims)
+	}
+
+	tokenReq.Scope = "openid"
+	_, err = env.service.Token(tokenReq)
+	assertOAuthError(t, err, "invalid_scope")
+
+	tokenReq.Scope = "admin"
+	_, err = env.service.Token(tokenReq)
+	assertOAuthError(t, err, "invalid_scope")
+}
+
+func TestTokenDeviceCode(t *testing.T) {
+	env := newOAuthTestEnv(t)
+
+	deviceResp, err := env.service.AuthorizeDevice(model.DeviceAuthorizationRequest{ClientID: "tv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pollReq := model.OAuthTokenRequest{
+		GrantType:  zconstant.GrantTypeDeviceCode,
+		DeviceCode: deviceResp.DeviceCode,
+		ClientID:   "tv",
+	}
+
+	_, err = env.service.Token(pollReq)
+	assertOAuthError(t, err, "authorization_pending")
+	_, err = env.service.Token(pollReq)
+	assertOAuthError(t, err, "slow_down")
+
+	_, err = env.service.Token(model.OAuthTokenRequest{
+		GrantType:  zconstant.GrantTypeDeviceCode,
+		DeviceCode: deviceResp.DeviceCode,
+		ClientID:   "spa",
+	})
+	assertOAuthError(t, err, "unauthorized_client")
+
+	verification, err := env.service.VerifyDevice(
+		env.loginSession,
+		model.DeviceVerificationRequest{UserCode: strings.ToLower(deviceResp.UserCode), Approve: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.Status != zconstant.DeviceCodeApproved {
+		t.Fatalf("status = %s", verification.Status)
+	}
+
+	tokenResp, err := env.service.Token(pollReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, ok := common.ValidateToken(tokenResp.AccessToken, testJwtTokenSecret)
+	if !ok || claims.Subject != "user-1" || claims.ClientID != "tv" {
+		t.Errorf("access token claims = %+v", claims)
+	}
+	if tokenResp.RefreshToken == "" || tokenResp.IDToken == "" {
+		t.Error("refresh or ID token missing")
+	}
+
+	_, err = env.service.Token(pollReq)
+	assertOAuthError(t, err, "invalid_grant")
+}
+
+func TestTokenDeviceCodeDenied(t *testing.T) {
+	env := newOAuthTestEnv(t)
+
+	deviceResp, err := env.service.AuthorizeDevice(model.DeviceAuthorizationRequest{ClientID: "tv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.service.VerifyDevice(env.loginSession, model.DeviceVerificationRequest{UserCode: deviceResp.UserCode})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pollReq := model.OAuthTokenRequest{
+		GrantType:  zconstant.GrantTypeDeviceCode,
+		DeviceCode: deviceResp.DeviceCode,
+		ClientID:   "tv",
+	}
+	_, err = env.service.Token(pollReq)
+	assertOAuthError(t, err, "access_denied")
+	_, err = env.service.Token(pollReq)
+	assertOAuthError(t, err, "invalid_grant")
+}
+
+func TestTokenDeviceCodeExpired(t *testing.T) {
+	env := newOAuthTestEnv(t, func(configEnv *config.ConfigEnv) { configEnv.DeviceCodeExpiresIn = "-1m" })
+
+	deviceResp, err := env.service.AuthorizeDevice(model.DeviceAuthorizationRequest{ClientID: "tv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pollReq := model.OAuthTokenRequest{
+		GrantType:  zconstant.GrantTypeDeviceCode,
+		DeviceCode: deviceResp.DeviceCode,
+		ClientID:   "tv",
+	}
+	_, err = env.service.Token(pollReq)
+	assertOAuthError(t, err, "expired_token")
+	if len(env.repos.oauthDeviceCodes.deviceCodes) != 0 {
+		t.Error("expired device code was not deleted")
+	}
+}
+
+func TestTokenDeviceCodeSingleUse(t *testing.T) {
+	env := newOAuthTestEnv(t)
+
+	deviceResp, err := env.service.AuthorizeDevice(model.DeviceAuthorizationRequest{ClientID: "tv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.service.VerifyDevice(
+		env.loginSession,
+		model.DeviceVerificationRequest{UserCode: deviceResp.UserCode, Approve: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const attempts = 20
+	env.repos.oauthDeviceCodes.afterGet = lineUp(attempts)
+	var wg sync.WaitGroup
+	results := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := env.service.Token(model.OAuthTokenRequest{
+				GrantType:  zconstant.GrantTypeDeviceCode,
+				DeviceCode: deviceResp.DeviceCode,
+				ClientID:   "tv",
+			})
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assertOAuthError(t, err, "invalid_grant")
+	}
+	if succeeded != 1 {
+		t.Errorf("%d redemptions succeeded, want 1", succeeded)
+	}
+}
+
+func (env *oauthTestEnv) exchangeRequest(subjectToken string) model.OAuthTokenRequest {
+	return model.OAuthTokenRequest{
+		GrantType:        zconstant.GrantTypeTokenExchange,
+		SubjectToken:     subjectToken,
+		SubjectTokenType: zconstant.TokenTypeAccessToken,
+		Audience:         testAudience,
+		Scope:            "api",
+		ClientID:         "web",
+		ClientSecret:     testClientSecret,
+	}
+}
+
+func TestTokenExchange(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	subjectToken := common.GenerateToken(
+		"user-1",
+		env.loginSession.ID,
+		testJwtTokenSecret,
+		time.Now().Add(5*time.Minute),
+	)
+
+	tokenResp, err := env.service.Token(env.exchangeRequest(subjectToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenResp.IssuedTokenType != zconstant.TokenTypeAccessToken || tokenResp.Scope != "api" {
+		t.Errorf("token response = %+v", tokenResp)
+	}
+	// The exchanged token never outlives the subject token.
+	if tokenResp.ExpiresIn > int64((5 * time.Minute).Seconds()) {
+		t.Errorf("expires in %d seconds, longer than the subject token", tokenResp.ExpiresIn)
+	}
+
+	claims, ok := common.ValidateToken(tokenResp.AccessToken, testJwtTokenSecret)
+	if !ok {
+		t.Fatal("exchanged token is invalid")
+	}
+	if claims.Subject != "user-1" ||
+		claims.Audience != testAudience ||
+		claims.SessionID != env.loginSession.ID ||
+		claims.Act == nil ||
+		claims.Act.Subject != "web" {
+		t.Errorf("exchanged token claims = %+v", claims)
+	}
+
+	// Exchanging the exchanged token nests the actor.
+	nested, err := env.service.Token(env.exchangeRequest(tokenResp.AccessToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nestedClaims, _ := common.ValidateToken(nested.AccessToken, testJwtTokenSecret)
+	if nestedClaims.Act == nil || nestedClaims.Act.Act == nil || nestedClaims.Act.Act.Subject != "web" {
+		t.Errorf("nested actor = %+v", nestedClaims.Act)
+	}
+
+	// A revoked delegated token cannot be exchanged.
+	err = env.repos.revokedTokens.Create(&repository.RevokedToken{JTI: claims.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.service.Token(env.exchangeRequest(tokenResp.AccessToken))
+	assertOAuthError(t, err, "invalid_grant")
+
+	// Nor can any token of a session that ended.
+	err = env.repos.sessions.DeleteById(env.loginSession.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.service.Token(env.exchangeRequest(subjectToken))
+	assertOAuthError(t, err, "invalid_grant")
+}
+
+func TestTokenExchangeRejected(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	expiresAt := time.Now().Add(5 * time.Minute)
+	subjectToken := common.GenerateToken("user-1", env.loginSession.ID, testJwtTokenSecret, expiresAt)
+
+	tests := []struct {
+		name   string
+		change func(*model.OAuthTokenRequest)
+		want   string
+	}{
+		{"audience not allowed", func(r *model.OAuthTokenRequest) { r.Audience = "https://other.example.com" }, "invalid_target"},
+		{"no audience", func(r *model.OAuthTokenRequest) { r.Audience = "" }, "invalid_target"},
+		{"scope not allowed", func(r *model.OAuthTokenRequest) { r.Scope = "api admin" }, "invalid_scope"},
+		{"unsupported subject type", func(r *model.OAuthTokenRequest) { r.SubjectTokenType = "id_token" }, "invalid_request"},
+		{"actor token", func(r *model.OAuthTokenRequest) { r.ActorToken = subjectToken }, "invalid_request"},
+		{"forged subject", func(r *model.OAuthTokenRequest) { r.SubjectToken = subjectToken + "x" }, "invalid_grant"},
+		{
+			"signed with another secret",
+			func(r *model.OAuthTokenRequest) {
+				r.SubjectToken = common.GenerateToken("user-1", "", testJwtRefreshToken, expiresAt)
+			},
+			"invalid_grant",
+		},
+		{
+			"password change token",
+			func(r *model.OAuthTokenRequest) {
+				r.SubjectToken = common.GeneratePasswordChangeToken("user-1", testJwtTokenSecret, expiresAt)
+			},
+			"invalid_grant",
+		},
+		{"wrong client secret", func(r *model.OAuthTokenRequest) { r.ClientSecret = "wrong" }, "invalid_client"},
+		{"public client", func(r *model.OAuthTokenRequest) { r.ClientID, r.ClientSecret = "spa", "" }, "unauthorized_client"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokenReq := env.exchangeRequest(subjectToken)
+			test.change(&tokenReq)
+			_, err := env.service.Token(tokenReq)
+			assertOAuthError(t, err, test.want)
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package service
+
+import (
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+)
+
+type PasswordPolicyService interface {
+	GetPasswordPolicy() model.PasswordPolicy
+	CheckPassword(password string, user *repository.User) error
+	RememberPassword(user *repository.User) error
+	IsPasswordExpired(user *repository.User) bool
+}
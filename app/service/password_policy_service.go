@@ -0,0 +1,167 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+)
+
+type passwordPolicyService struct {
+	passwordHistoryRepository repository.PasswordHistoryRepository
+	breachedPasswordChecker   BreachedPasswordChecker
+	passwordHasher            *common.PasswordHasher
+	policy                    model.PasswordPolicy
+}
+
+func NewPasswordPolicyService(
+	passwordHistoryRepository repository.PasswordHistoryRepository,
+	breachedPasswordChecker BreachedPasswordChecker,
+	passwordHasher *common.PasswordHasher,
+	configEnv config.ConfigEnv,
+) PasswordPolicyService {
+	forbiddenWords := []string{}
+	for _, word := range strings.Split(configEnv.PasswordForbiddenWords, ",") {
+		word = strings.TrimSpace(word)
+		if word != "" {
+			forbiddenWords = append(forbiddenWords, word)
+		}
+	}
+
+	return passwordPolicyService{
+		passwordHistoryRepository: passwordHistoryRepository,
+		breachedPasswordChecker:   breachedPasswordChecker,
+		passwordHasher:            passwordHasher,
+		policy: model.PasswordPolicy{
+			MinLength:        configEnv.PasswordMinLength,
+			MaxLength:        configEnv.PasswordMaxLength,
+			MaxBytes:         passwordHasher.MaxPasswordBytes(),
+			RequireLowercase: configEnv.PasswordRequireLowercase,
+			RequireUppercase: configEnv.PasswordRequireUppercase,
+			RequireDigit:     configEnv.PasswordRequireDigit,
+			RequireSymbol:    configEnv.PasswordRequireSymbol,
+			MaxRepeated:      configEnv.PasswordMaxRepeated,
+			MinEntropy:       configEnv.PasswordMinEntropy,
+			ForbiddenWords:   forbiddenWords,
+			ForbidUserInfo:   configEnv.PasswordForbidUserInfo,
+			RejectBreached:   breachedPasswordChecker.Enabled(),
+			History:          configEnv.PasswordHistory,
+			MaxAgeDays:       configEnv.PasswordMaxAgeDays,
+		},
+	}
+}
+
+func (s passwordPolicyService) GetPasswordPolicy() model.PasswordPolicy {
+	return s.policy
+}
+
+// CheckPassword returns a 422 listing every violation, user is the account
+// the password is for and may be new.
+func (s passwordPolicyService) CheckPassword(password string, user *repository.User) error {
+	userInputs := []string{}
+	if user != nil {
+		localPart, _, _ := strings.Cut(user.Email, "@")
+		userInputs = append(
+			userInputs,
+			user.Username,
+			localPart,
+			user.DisplayName,
+			user.FirstName,
+			user.LastName,
+		)
+	}
+
+	violations := common.CheckPasswordPolicy(s.policy, password, userInputs)
+
+	// An unreachable breach list must not stop everyone from setting a
+	// password, the other rules still apply.
+	breached, err := s.breachedPasswordChecker.IsBreached(password)
+	if err != nil {
+		zlog.Error(err)
+	}
+	if breached {
+		violations = append(violations, model.PasswordPolicyViolation{
+			Code:    "breached",
+			Message: "appears in a known data breach, choose another password",
+		})
+	}
+
+	if user != nil && user.ID != "" {
+		reused, err := s.isReused(password, user)
+		if err != nil {
+			zlog.Error(err)
+			return errs.NewUnexpectedError()
+		}
+		if reused {
+			violations = append(violations, model.PasswordPolicyViolation{
+				Code:    "reused",
+				Message: fmt.Sprintf("must differ from your last %d passwords", s.policy.History),
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return errs.NewPasswordPolicyError(violations)
+	}
+	return nil
+}
+
+// isReused compares against the current password and the ones before it,
+// History passwords in total.
+func (s passwordPolicyService) isReused(password string, user *repository.User) (bool, error) {
+	if s.policy.History <= 0 {
+		return false, nil
+	}
+
+	if ok, _ := s.passwordHasher.Verify(password, user.PasswordHash); ok {
+		return true, nil
+	}
+
+	passwordHistories, err := s.passwordHistoryRepository.GetLatest(user.ID, s.policy.History)
+	if err != nil {
+		return false, err
+	}
+	for _, passwordHistory := range passwordHistories {
+		if ok, _ := s.passwordHasher.Verify(password, passwordHistory.PasswordHash); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RememberPassword records the user's new password hash once it is saved.
+func (s passwordPolicyService) RememberPassword(user *repository.User) error {
+	if s.policy.History <= 0 || user.PasswordHash == "" {
+		return nil
+	}
+
+	err := s.passwordHistoryRepository.Create(&repository.PasswordHistory{
+		UserID:       user.ID,
+		PasswordHash: user.PasswordHash,
+	})
+	if err != nil {
+		return err
+	}
+	return s.passwordHistoryRepository.DeleteAllButLatest(user.ID, s.policy.History)
+}
+
+// IsPasswordExpired is false for accounts without a local password, their
+// password is managed elsewhere.
+func (s passwordPolicyService) IsPasswordExpired(user *repository.User) bool {
+	if s.policy.MaxAgeDays <= 0 || user.PasswordHash == "" || user.LdapDN != "" {
+		return false
+	}
+
+	// Users created before ChangePasswordAt was set on creation have none.
+	changedAt := user.ChangePasswordAt
+	if changedAt.IsZero() {
+		changedAt = user.CreatedAt
+	}
+	return time.Since(changedAt) > time.Duration(s.policy.MaxAgeDays)*24*time.Hour
+}
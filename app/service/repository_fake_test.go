@@ -0,0 +1,924 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/repository"
+	"lazy-auth/config"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	testIssuer          = "https://auth.example.com"
+	testJwtTokenSecret  = "0123456789abcdef0123456789abcdef"
+	testJwtRefreshToken = "fedcba9876543210fedcba9876543210"
+)
+
+// newTestConfigEnv returns the configuration the services under test are
+// built with, configure changes it first.
+func newTestConfigEnv(configure ...func(*config.ConfigEnv)) config.ConfigEnv {
+	configEnv := config.ConfigEnv{
+		JwtTokenSecret:           testJwtTokenSecret,
+		JwtRefreshTokenSecret:    testJwtRefreshToken,
+		JwtTokenExpiresIn:        "15m",
+		JwtRefreshTokenExpiresIn: "24h",
+		Issuer:                   testIssuer,
+		SecretEncryptionKey:      testJwtRefreshToken,
+		OAuthCodeExpiresIn:       "1m",
+		DeviceCodeExpiresIn:      "10m",
+		DeviceVerificationURI:    testIssuer + "/device",
+		EmailOtpExpiresIn:        "10m",
+		EmailOtpMaxAttempts:      5,
+		EmailOtpMaxPerHour:       5,
+	}
+	for _, change := range configure {
+		change(&configEnv)
+	}
+	return configEnv
+}
+
+// testRepositories holds one fake of each repository. Every fake starts
+// empty except for the "user" role and the verified user "user-1", tests
+// seed the other rows they need.
+type testRepositories struct {
+	roles             *fakeRoleRepository
+	users             *fakeUserRepository
+	sessions          *fakeSessionRepository
+	revokedTokens     *fakeRevokedTokenRepository
+	serviceAccounts   *fakeServiceAccountRepository
+	clientAssertions  *fakeClientAssertionRepository
+	oauthClients      *fakeOAuthClientRepository
+	oauthCodes        *fakeOAuthCodeRepository
+	oauthConsents     *fakeOAuthConsentRepository
+	oauthDeviceCodes  *fakeOAuthDeviceCodeRepository
+	identityProviders *fakeIdentityProviderRepository
+	userIdentities    *fakeUserIdentityRepository
+	samlConnections   *fakeSamlConnectionRepository
+	samlRequests      *fakeSamlRequestRepository
+	samlAssertions    *fakeSamlAssertionRepository
+	samlIdentities    *fakeSamlIdentityRepository
+	magicLinks        *fakeMagicLinkRepository
+	emailOtps         *fakeEmailOtpRepository
+	smsOtps           *fakeSmsOtpRepository
+	passwordHistories *fakePasswordHistoryRepository
+}
+
+func newTestRepositories() *testRepositories {
+	return &testRepositories{
+		roles: &fakeRoleRepository{roles: map[string]repository.Role{
+			"role-1": {ID: "role-1", Name: "user"},
+		}},
+		users: &fakeUserRepository{users: map[string]repository.User{
+			"user-1": {
+				ID:         "user-1",
+				RoleID:     "role-1",
+				Username:   "jdoe",
+				Email:      "jdoe@example.com",
+				VerifyFlag: true,
+			},
+		}},
+		sessions:          &fakeSessionRepository{sessions: map[string]repository.Session{}},
+		revokedTokens:     &fakeRevokedTokenRepository{tokens: map[string]repository.RevokedToken{}},
+		serviceAccounts:   &fakeServiceAccountRepository{serviceAccounts: map[string]repository.ServiceAccount{}},
+		clientAssertions:  &fakeClientAssertionRepository{assertions: map[string]repository.ClientAssertion{}},
+		oauthClients:      &fakeOAuthClientRepository{clients: map[string]repository.OAuthClient{}},
+		oauthCodes:        &fakeOAuthCodeRepository{codes: map[string]repository.OAuthCode{}},
+		oauthConsents:     &fakeOAuthConsentRepository{consents: map[string]repository.OAuthConsent{}},
+		oauthDeviceCodes:  &fakeOAuthDeviceCodeRepository{deviceCodes: map[string]repository.OAuthDeviceCode{}},
+		identityProviders: &fakeIdentityProviderRepository{providers: map[string]repository.IdentityProvider{}},
+		userIdentities:    &fakeUserIdentityRepository{identities: map[string]repository.UserIdentity{}},
+		samlConnections:   &fakeSamlConnectionRepository{connections: map[string]repository.SamlConnection{}},
+		samlRequests:      &fakeSamlRequestRepository{requests: map[string]repository.SamlRequest{}},
+		samlAssertions:    &fakeSamlAssertionRepository{assertions: map[string]repository.SamlAssertion{}},
+		samlIdentities:    &fakeSamlIdentityRepository{identities: map[string]repository.SamlIdentity{}},
+		magicLinks:        &fakeMagicLinkRepository{magicLinks: map[string]repository.MagicLink{}},
+		emailOtps:         &fakeEmailOtpRepository{emailOtps: map[string]repository.EmailOtp{}},
+		smsOtps:           &fakeSmsOtpRepository{smsOtps: map[string]repository.SmsOtp{}},
+		passwordHistories: &fakePasswordHistoryRepository{},
+	}
+}
+
+func assertAppError(t *testing.T, err error, code int, message string) {
+	t.Helper()
+
+	var appErr errs.AppError
+	if !errors.As(err, &appErr) {
+		t.Fatalf("error = %v, want %d %s", err, code, message)
+	}
+	if appErr.Code != code || appErr.Message != message {
+		t.Fatalf("error = %d %s, want %d %s", appErr.Code, appErr.Message, code, message)
+	}
+}
+
+// The fakes below keep rows in memory and behave like the gorm repositories
+// where the services depend on it: lookups return copies, missing rows are
+// gorm.ErrRecordNotFound, expired rows are filtered by the same lookups and
+// DeleteById fails when nothing was deleted. Each
+// embeds its interface so methods a test does not need panic when called.
+
+type fakeRoleRepository struct {
+	repository.RoleRepository
+	roles map[string]repository.Role
+}
+
+func (r *fakeRoleRepository) GetByName(name string) (*repository.Role, error) {
+	for _, role := range r.roles {
+		if role.Name == name {
+			return &role, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+type fakeUserRepository struct {
+	repository.UserRepository
+	mu    sync.Mutex
+	users map[string]repository.User
+}
+
+func (r *fakeUserRepository) GetById(id string) (*repository.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+func (r *fakeUserRepository) GetByUsername(username string) (*repository.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepository) GetByEmail(email string) (*repository.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepository) GetByPhoneNumber(phoneNumber string) (*repository.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if user.PhoneNumber == phoneNumber {
+			return &user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepository) GetLdapUsers() ([]repository.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	users := []repository.User{}
+	for _, user := range r.users {
+		if user.LdapDN != "" {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (r *fakeUserRepository) Create(user *repository.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.users {
+		if existing.Username == user.Username || existing.Email == user.Email {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	user.ID = uuid.NewString()
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *fakeUserRepository) Update(user *repository.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[user.ID] = *user
+	return nil
+}
+
+type fakeSessionRepository struct {
+	repository.SessionRepository
+	mu       sync.Mutex
+	sessions map[string]repository.Session
+}
+
+func (r *fakeSessionRepository) Create(session *repository.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session.ID = uuid.NewString()
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *fakeSessionRepository) GetById(id string) (*repository.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[id]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &session, nil
+}
+
+func (r *fakeSessionRepository) GetByRefreshToken(refreshToken string) (*repository.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, session := range r.sessions {
+		if session.RefreshToken == refreshToken {
+			return &session, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeSessionRepository) GetByUserId(userId string) ([]repository.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sessions := []repository.Session{}
+	for _, session := range r.sessions {
+		if session.UserID == userId {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *fakeSessionRepository) Update(session *repository.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *fakeSessionRepository) DeleteById(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.sessions, id)
+	return nil
+}
+
+type fakeRevokedTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]repository.RevokedToken
+}
+
+func (r *fakeRevokedTokenRepository) Create(revokedToken *repository.RevokedToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tokens[revokedToken.JTI]; ok {
+		return gorm.ErrDuplicatedKey
+	}
+	r.tokens[revokedToken.JTI] = *revokedToken
+	return nil
+}
+
+func (r *fakeRevokedTokenRepository) GetByJti(jti string) (*repository.RevokedToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	revokedToken, ok := r.tokens[jti]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &revokedToken, nil
+}
+
+type fakeServiceAccountRepository struct {
+	repository.ServiceAccountRepository
+	mu              sync.Mutex
+	serviceAccounts map[string]repository.ServiceAccount
+}
+
+func (r *fakeServiceAccountRepository) GetByClientId(clientId string) (*repository.ServiceAccount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, serviceAccount := range r.serviceAccounts {
+		if serviceAccount.ClientID == clientId {
+			return &serviceAccount, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeServiceAccountRepository) Update(serviceAccount *repository.ServiceAccount) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.serviceAccounts[serviceAccount.ID] = *serviceAccount
+	return nil
+}
+
+type fakeClientAssertionRepository struct {
+	mu         sync.Mutex
+	assertions map[string]repository.ClientAssertion
+}
+
+func (r *fakeClientAssertionRepository) Create(assertion *repository.ClientAssertion) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := assertion.ClientID + ":" + assertion.JTI
+	if _, ok := r.assertions[key]; ok {
+		return gorm.ErrDuplicatedKey
+	}
+	r.assertions[key] = *assertion
+	return nil
+}
+
+type fakeOAuthClientRepository struct {
+	repository.OAuthClientRepository
+	clients map[string]repository.OAuthClient
+}
+
+func (r *fakeOAuthClientRepository) GetByClientId(clientId string) (*repository.OAuthClient, error) {
+	client, ok := r.clients[clientId]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &client, nil
+}
+
+type fakeOAuthCodeRepository struct {
+	mu    sync.Mutex
+	codes map[string]repository.OAuthCode
+
+	// afterGet runs after a code was found, tests block in it to line up
+	// concurrent redemptions.
+	afterGet func()
+}
+
+func (r *fakeOAuthCodeRepository) Create(code *repository.OAuthCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code.ID = uuid.NewString()
+	r.codes[code.ID] = *code
+	return nil
+}
+
+func (r *fakeOAuthCodeRepository) GetByCodeHash(codeHash string) (*repository.OAuthCode, error) {
+	r.mu.Lock()
+	var found *repository.OAuthCode
+	for _, code := range r.codes {
+		if code.CodeHash == codeHash && code.ExpiresAt.After(time.Now()) {
+			found = &code
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	if found == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if r.afterGet != nil {
+		r.afterGet()
+	}
+	return found, nil
+}
+
+func (r *fakeOAuthCodeRepository) DeleteById(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.codes[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.codes, id)
+	return nil
+}
+
+type fakeOAuthConsentRepository struct {
+	mu       sync.Mutex
+	consents map[string]repository.OAuthConsent
+}
+
+func (r *fakeOAuthConsentRepository) GetByUserAndClient(
+	userId string,
+	clientId string,
+) (*repository.OAuthConsent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	consent, ok := r.consents[userId+":"+clientId]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &consent, nil
+}
+
+func (r *fakeOAuthConsentRepository) Save(consent *repository.OAuthConsent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.consents[consent.UserID+":"+consent.ClientID] = *consent
+	return nil
+}
+
+type fakeOAuthDeviceCodeRepository struct {
+	mu          sync.Mutex
+	deviceCodes map[string]repository.OAuthDeviceCode
+
+	// afterGet runs after a device code was found by its hash, like
+	// fakeOAuthCodeRepository.afterGet.
+	afterGet func()
+}
+
+func (r *fakeOAuthDeviceCodeRepository) Create(deviceCode *repository.OAuthDeviceCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	deviceCode.ID = uuid.NewString()
+	r.deviceCodes[deviceCode.ID] = *deviceCode
+	return nil
+}
+
+func (r *fakeOAuthDeviceCodeRepository) GetByDeviceCodeHash(
+	deviceCodeHash string,
+) (*repository.OAuthDeviceCode, error) {
+	r.mu.Lock()
+	var found *repository.OAuthDeviceCode
+	for _, deviceCode := range r.deviceCodes {
+		if deviceCode.DeviceCodeHash == deviceCodeHash {
+			found = &deviceCode
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	if found == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if r.afterGet != nil {
+		r.afterGet()
+	}
+	return found, nil
+}
+
+func (r *fakeOAuthDeviceCodeRepository) GetByUserCode(userCode string) (*repository.OAuthDeviceCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, deviceCode := range r.deviceCodes {
+		if deviceCode.UserCode == userCode && deviceCode.ExpiresAt.After(time.Now()) {
+			return &deviceCode, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeOAuthDeviceCodeRepository) Update(deviceCode *repository.OAuthDeviceCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.deviceCodes[deviceCode.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	r.deviceCodes[deviceCode.ID] = *deviceCode
+	return nil
+}
+
+func (r *fakeOAuthDeviceCodeRepository) DeleteById(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.deviceCodes[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.deviceCodes, id)
+	return nil
+}
+
+type fakeIdentityProviderRepository struct {
+	repository.IdentityProviderRepository
+	providers map[string]repository.IdentityProvider
+}
+
+func (r *fakeIdentityProviderRepository) GetBySlug(slug string) (*repository.IdentityProvider, error) {
+	provider, ok := r.providers[slug]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &provider, nil
+}
+
+type fakeUserIdentityRepository struct {
+	repository.UserIdentityRepository
+	identities map[string]repository.UserIdentity
+}
+
+func (r *fakeUserIdentityRepository) GetByProviderAndSubject(
+	providerId string,
+	subject string,
+) (*repository.UserIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.ProviderID == providerId && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserIdentityRepository) Update(identity *repository.UserIdentity) error {
+	r.identities[identity.ID] = *identity
+	return nil
+}
+
+type fakeSamlIdentityRepository struct {
+	repository.SamlIdentityRepository
+	identities map[string]repository.SamlIdentity
+}
+
+func (r *fakeSamlIdentityRepository) GetByConnectionAndNameId(
+	connectionId string,
+	nameId string,
+) (*repository.SamlIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.ConnectionID == connectionId && identity.NameID == nameId {
+			return &identity, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeSamlIdentityRepository) Create(identity *repository.SamlIdentity) error {
+	for _, existing := range r.identities {
+		if existing.ConnectionID == identity.ConnectionID && existing.NameID == identity.NameID {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	identity.ID = uuid.NewString()
+	r.identities[identity.ID] = *identity
+	return nil
+}
+
+func (r *fakeSamlIdentityRepository) Update(identity *repository.SamlIdentity) error {
+	r.identities[identity.ID] = *identity
+	return nil
+}
+
+type fakeSamlConnectionRepository struct {
+	repository.SamlConnectionRepository
+	connections map[string]repository.SamlConnection
+}
+
+func (r *fakeSamlConnectionRepository) GetBySlug(slug string) (*repository.SamlConnection, error) {
+	for _, connection := range r.connections {
+		if connection.Slug == slug {
+			return &connection, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+type fakeSamlRequestRepository struct {
+	requests map[string]repository.SamlRequest
+}
+
+func (r *fakeSamlRequestRepository) GetByRequestId(requestId string) (*repository.SamlRequest, error) {
+	for _, request := range r.requests {
+		if request.RequestID == requestId {
+			return &request, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeSamlRequestRepository) Create(request *repository.SamlRequest) error {
+	request.ID = uuid.NewString()
+	r.requests[request.ID] = *request
+	return nil
+}
+
+func (r *fakeSamlRequestRepository) DeleteById(id string) error {
+	if _, ok := r.requests[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.requests, id)
+	return nil
+}
+
+type fakeSamlAssertionRepository struct {
+	assertions map[string]repository.SamlAssertion
+}
+
+func (r *fakeSamlAssertionRepository) Create(assertion *repository.SamlAssertion) error {
+	if _, ok := r.assertions[assertion.AssertionID]; ok {
+		return gorm.ErrDuplicatedKey
+	}
+	r.assertions[assertion.AssertionID] = *assertion
+	return nil
+}
+
+type fakeMagicLinkRepository struct {
+	mu         sync.Mutex
+	magicLinks map[string]repository.MagicLink
+}
+
+func (r *fakeMagicLinkRepository) Create(magicLink *repository.MagicLink) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	magicLink.ID = uuid.NewString()
+	r.magicLinks[magicLink.ID] = *magicLink
+	return nil
+}
+
+func (r *fakeMagicLinkRepository) GetByTokenHash(tokenHash string) (*repository.MagicLink, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, magicLink := range r.magicLinks {
+		if magicLink.TokenHash == tokenHash && magicLink.ExpiresAt.After(time.Now()) {
+			return &magicLink, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeMagicLinkRepository) DeleteById(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.magicLinks[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(r.magicLinks, id)
+	return nil
+}
+
+func (r *fakeMagicLinkRepository) DeleteByUserId(userId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, magicLink := range r.magicLinks {
+		if magicLink.UserID == userId {
+			delete(r.magicLinks, id)
+		}
+	}
+	return nil
+}
+
+type fakeEmailOtpRepository struct {
+	mu        sync.Mutex
+	emailOtps map[string]repository.EmailOtp
+}
+
+func (r *fakeEmailOtpRepository) Create(emailOtp *repository.EmailOtp) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	emailOtp.ID = uuid.NewString()
+	emailOtp.CreatedAt = time.Now()
+	r.emailOtps[emailOtp.ID] = *emailOtp
+	return nil
+}
+
+func (r *fakeEmailOtpRepository) GetLatest(userId string, purpose string) (*repository.EmailOtp, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var latest *repository.EmailOtp
+	for _, emailOtp := range r.emailOtps {
+		if emailOtp.UserID == userId && emailOtp.Purpose == purpose &&
+			(latest == nil || emailOtp.CreatedAt.After(latest.CreatedAt)) {
+			emailOtp := emailOtp
+			latest = &emailOtp
+		}
+	}
+	if latest == nil || latest.UsedFlag || latest.ExpiresAt.Before(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return latest, nil
+}
+
+func (r *fakeEmailOtpRepository) GetByMfaTokenHash(mfaTokenHash string) (*repository.EmailOtp, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, emailOtp := range r.emailOtps {
+		if emailOtp.MfaTokenHash == mfaTokenHash && !emailOtp.UsedFlag && emailOtp.ExpiresAt.After(time.Now()) {
+			return &emailOtp, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeEmailOtpRepository) CountSince(userId string, since time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total := 0
+	for _, emailOtp := range r.emailOtps {
+		if emailOtp.UserID == userId && emailOtp.CreatedAt.After(since) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+func (r *fakeEmailOtpRepository) IncrementAttempts(id string, maxAttempts int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	emailOtp, ok := r.emailOtps[id]
+	if !ok || emailOtp.Attempts >= maxAttempts {
+		return gorm.ErrRecordNotFound
+	}
+	emailOtp.Attempts++
+	r.emailOtps[id] = emailOtp
+	return nil
+}
+
+func (r *fakeEmailOtpRepository) MarkUsed(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	emailOtp, ok := r.emailOtps[id]
+	if !ok || emailOtp.UsedFlag {
+		return gorm.ErrRecordNotFound
+	}
+	emailOtp.UsedFlag = true
+	r.emailOtps[id] = emailOtp
+	return nil
+}
+
+func (r *fakeEmailOtpRepository) DeleteByUserIdBefore(userId string, before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, emailOtp := range r.emailOtps {
+		if emailOtp.UserID == userId && emailOtp.CreatedAt.Before(before) {
+			delete(r.emailOtps, id)
+		}
+	}
+	return nil
+}
+
+type fakeSmsOtpRepository struct {
+	mu      sync.Mutex
+	smsOtps map[string]repository.SmsOtp
+}
+
+func (r *fakeSmsOtpRepository) Create(smsOtp *repository.SmsOtp) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	smsOtp.ID = uuid.NewString()
+	smsOtp.CreatedAt = time.Now()
+	r.smsOtps[smsOtp.ID] = *smsOtp
+	return nil
+}
+
+func (r *fakeSmsOtpRepository) GetLatest(userId string, purpose string) (*repository.SmsOtp, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var latest *repository.SmsOtp
+	for _, smsOtp := range r.smsOtps {
+		if smsOtp.UserID == userId && smsOtp.Purpose == purpose &&
+			(latest == nil || smsOtp.CreatedAt.After(latest.CreatedAt)) {
+			smsOtp := smsOtp
+			latest = &smsOtp
+		}
+	}
+	if latest == nil || latest.UsedFlag || latest.ExpiresAt.Before(time.Now()) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return latest, nil
+}
+
+func (r *fakeSmsOtpRepository) CountSince(userId string, since time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total := 0
+	for _, smsOtp := range r.smsOtps {
+		if smsOtp.UserID == userId && smsOtp.CreatedAt.After(since) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+func (r *fakeSmsOtpRepository) IncrementAttempts(id string, maxAttempts int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	smsOtp, ok := r.smsOtps[id]
+	if !ok || smsOtp.Attempts >= maxAttempts {
+		return gorm.ErrRecordNotFound
+	}
+	smsOtp.Attempts++
+	r.smsOtps[id] = smsOtp
+	return nil
+}
+
+func (r *fakeSmsOtpRepository) MarkUsed(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	smsOtp, ok := r.smsOtps[id]
+	if !ok || smsOtp.UsedFlag {
+		return gorm.ErrRecordNotFound
+	}
+	smsOtp.UsedFlag = true
+	r.smsOtps[id] = smsOtp
+	return nil
+}
+
+func (r *fakeSmsOtpRepository) DeleteByUserIdBefore(userId string, before time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, smsOtp := range r.smsOtps {
+		if smsOtp.UserID == userId && smsOtp.CreatedAt.Before(before) {
+			delete(r.smsOtps, id)
+		}
+	}
+	return nil
+}
+
+// fakePasswordHistoryRepository keeps the rows oldest first.
+type fakePasswordHistoryRepository struct {
+	mu                sync.Mutex
+	passwordHistories []repository.PasswordHistory
+}
+
+func (r *fakePasswordHistoryRepository) Create(passwordHistory *repository.PasswordHistory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	passwordHistory.ID = uuid.NewString()
+	r.passwordHistories = append(r.passwordHistories, *passwordHistory)
+	return nil
+}
+
+func (r *fakePasswordHistoryRepository) GetLatest(userId string, limit int) ([]repository.PasswordHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	latest := []repository.PasswordHistory{}
+	for i := len(r.passwordHistories) - 1; i >= 0 && len(latest) < limit; i-- {
+		if r.passwordHistories[i].UserID == userId {
+			latest = append(latest, r.passwordHistories[i])
+		}
+	}
+	return latest, nil
+}
+
+func (r *fakePasswordHistoryRepository) DeleteAllButLatest(userId string, keep int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := []repository.PasswordHistory{}
+	for i := len(r.passwordHistories) - 1; i >= 0; i-- {
+		passwordHistory := r.passwordHistories[i]
+		if passwordHistory.UserID != userId || keep > 0 {
+			kept = append([]repository.PasswordHistory{passwordHistory}, kept...)
+			if passwordHistory.UserID == userId {
+				keep--
+			}
+		}
+	}
+	r.passwordHistories = kept
+	return nil
+}
+
+// fakeMail is an email the services sent through fakeMailer.
+type fakeMail struct {
+	to      string
+	subject string
+	body    string
+}
+
+// fakeMailer hands sent emails to the test, the services send them in the
+// background.
+type fakeMailer struct {
+	mails chan fakeMail
+}
+
+func newFakeMailer() *fakeMailer {
+	return &fakeMailer{mails: make(chan fakeMail, 100)}
+}
+
+func (m *fakeMailer) Send(to string, subject string, body string) error {
+	m.mails <- fakeMail{to: to, subject: subject, body: body}
+	return nil
+}
+
+// next waits for the next email.
+func (m *fakeMailer) next(t *testing.T) fakeMail {
+	t.Helper()
+
+	select {
+	case mail := <-m.mails:
+		return mail
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email was sent")
+		return fakeMail{}
+	}
+}
+
+// assertNoMail fails when an email is sent within a short while.
+func (m *fakeMailer) assertNoMail(t *testing.T) {
+	t.Helper()
+
+	select {
+	case mail := <-m.mails:
+		t.Fatalf("unexpected email to %s: %s", mail.to, mail.subject)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
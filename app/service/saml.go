@@ -0,0 +1,9 @@
+package service
+
+import "lazy-auth/app/model"
+
+type SamlService interface {
+	GetMetadata(slug string) ([]byte, error)
+	Login(slug string) (*model.SamlLoginResponse, error)
+	Acs(slug string, body model.SamlAcsRequest) (*model.TokenResponse, error)
+}
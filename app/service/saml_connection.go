@@ -0,0 +1,14 @@
+package service
+
+import "lazy-auth/app/model"
+
+type SamlConnectionService interface {
+	CreateConnection(body model.CreateSamlConnectionRequest) (*model.SamlConnectionResponse, error)
+	GetConnections(query model.QuerySamlConnection) (*model.SamlConnectionPageResponse, error)
+	GetConnectionById(id string) (*model.SamlConnectionResponse, error)
+	UpdateConnectionById(
+		id string,
+		body model.UpdateSamlConnectionRequest,
+	) (*model.SamlConnectionResponse, error)
+	DeleteConnectionById(id string) error
+}
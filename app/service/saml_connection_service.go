@@ -0,0 +1,344 @@
+package service
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"github.com/crewjam/saml"
+	"gorm.io/gorm"
+)
+
+// samlAttributeFields are the user fields a connection's attribute mapping
+// may set.
+var samlAttributeFields = []string{"email", "username", "display_name", "first_name", "last_name"}
+
+type samlConnectionService struct {
+	samlConnectionRepository repository.SamlConnectionRepository
+	configEnv                config.ConfigEnv
+	httpClient               *http.Client
+}
+
+func NewSamlConnectionService(
+	samlConnectionRepository repository.SamlConnectionRepository,
+	configEnv config.ConfigEnv,
+) SamlConnectionService {
+	return samlConnectionService{
+		samlConnectionRepository: samlConnectionRepository,
+		configEnv:                configEnv,
+		httpClient:               &http.Client{Timeout: externalRequestTimeout},
+	}
+}
+
+func (s samlConnectionService) buildSamlConnectionResponse(
+	connection repository.SamlConnection,
+) model.SamlConnectionResponse {
+	return model.SamlConnectionResponse{
+		ID:               connection.ID,
+		Slug:             connection.Slug,
+		Name:             connection.Name,
+		IdPEntityID:      connection.IdPEntityID,
+		AcsURL:           connection.AcsURL,
+		SpEntityID:       samlSpEntityID(s.configEnv.Issuer, connection.Slug),
+		NameIDFormat:     connection.NameIDFormat,
+		AttributeMapping: connection.AttributeMapping,
+		AllowSignUp:      connection.AllowSignUp,
+		LinkByEmail:      connection.LinkByEmail,
+		EmailDomains:     connection.EmailDomains,
+		DisabledFlag:     connection.DisabledFlag,
+		CreatedAt:        connection.CreatedAt,
+	}
+}
+
+func (s samlConnectionService) CreateConnection(
+	connectionReq model.CreateSamlConnectionRequest,
+) (*model.SamlConnectionResponse, error) {
+	connection := repository.SamlConnection{
+		Slug:             connectionReq.Slug,
+		Name:             connectionReq.Name,
+		AcsURL:           connectionReq.AcsURL,
+		NameIDFormat:     connectionReq.NameIDFormat,
+		AttributeMapping: connectionReq.AttributeMapping,
+		AllowSignUp:      connectionReq.AllowSignUp,
+		LinkByEmail:      connectionReq.LinkByEmail,
+		EmailDomains:     connectionReq.EmailDomains,
+	}
+
+	err := s.importMetadata(&connection, connectionReq.IdPMetadataXML, connectionReq.IdPMetadataURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateSamlConnection(&connection); err != nil {
+		return nil, errs.NewValidationError(err.Error())
+	}
+
+	err = s.samlConnectionRepository.Create(&connection)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errs.NewUnprocessableEntity("saml connection slug duplicated")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	connectionResponse := s.buildSamlConnectionResponse(connection)
+	return &connectionResponse, nil
+}
+
+func (s samlConnectionService) GetConnections(
+	query model.QuerySamlConnection,
+) (*model.SamlConnectionPageResponse, error) {
+	connections, total, err := s.samlConnectionRepository.GetMany(query)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	connectionsResponse := common.Map(connections, s.buildSamlConnectionResponse)
+	meta := common.BuildMetaPagination(&total, query.Limit, query.Offset)
+
+	return &model.SamlConnectionPageResponse{Meta: meta, Data: connectionsResponse}, nil
+}
+
+func (s samlConnectionService) GetConnectionById(id string) (*model.SamlConnectionResponse, error) {
+	connection, err := s.samlConnectionRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("saml connection not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	connectionResponse := s.buildSamlConnectionResponse(*connection)
+	return &connectionResponse, nil
+}
+
+func (s samlConnectionService) UpdateConnectionById(
+	id string,
+	connectionReq model.UpdateSamlConnectionRequest,
+) (*model.SamlConnectionResponse, error) {
+	connection, err := s.samlConnectionRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("saml connection not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	if connectionReq.Name != nil {
+		connection.Name = *connectionReq.Name
+	}
+
+	if connectionReq.IdPMetadataXML != nil || connectionReq.IdPMetadataURL != nil {
+		var metadataXML, metadataURL string
+		if connectionReq.IdPMetadataXML != nil {
+			metadataXML = *connectionReq.IdPMetadataXML
+		}
+		if connectionReq.IdPMetadataURL != nil {
+			metadataURL = *connectionReq.IdPMetadataURL
+		}
+		err = s.importMetadata(connection, metadataXML, metadataURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if connectionReq.AcsURL != nil {
+		connection.AcsURL = *connectionReq.AcsURL
+	}
+
+	if connectionReq.NameIDFormat != nil {
+		connection.NameIDFormat = *connectionReq.NameIDFormat
+	}
+
+	if connectionReq.AttributeMapping != nil {
+		connection.AttributeMapping = *connectionReq.AttributeMapping
+	}
+
+	if connectionReq.AllowSignUp != nil {
+		connection.AllowSignUp = *connectionReq.AllowSignUp
+	}
+
+	if connectionReq.LinkByEmail != nil {
+		connection.LinkByEmail = *connectionReq.LinkByEmail
+	}
+
+	if connectionReq.EmailDomains != nil {
+		connection.EmailDomains = *connectionReq.EmailDomains
+	}
+
+	if connectionReq.DisabledFlag != nil {
+		connection.DisabledFlag = *connectionReq.DisabledFlag
+	}
+
+	if err := validateSamlConnection(connection); err != nil {
+		return nil, errs.NewValidationError(err.Error())
+	}
+
+	err = s.samlConnectionRepository.Update(connection)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	connectionResponse := s.buildSamlConnectionResponse(*connection)
+	return &connectionResponse, nil
+}
+
+func (s samlConnectionService) DeleteConnectionById(id string) error {
+	_, err := s.samlConnectionRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewNotFoundError("saml connection not found")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	err = s.samlConnectionRepository.DeleteById(id)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
+
+// importMetadata stores the IdP metadata given inline or downloaded once from
+// metadataURL. Metadata is not refreshed automatically.
+func (s samlConnectionService) importMetadata(
+	connection *repository.SamlConnection,
+	metadataXML string,
+	metadataURL string,
+) error {
+	if metadataXML == "" && metadataURL == "" {
+		return errs.NewValidationError("idp metadata xml or url is required")
+	}
+
+	if metadataXML == "" {
+		body, err := fetchSamlMetadata(s.httpClient, metadataURL)
+		if err != nil {
+			return errs.NewValidationError("idp " + err.Error())
+		}
+		metadataXML = body
+	}
+
+	entity, err := parseIdPMetadata([]byte(metadataXML))
+	if err != nil {
+		return errs.NewValidationError(err.Error())
+	}
+
+	connection.IdPEntityID = entity.EntityID
+	connection.IdPMetadataXML = metadataXML
+	return nil
+}
+
+func fetchSamlMetadata(httpClient *http.Client, metadataURL string) (string, error) {
+	u, err := url.Parse(metadataURL)
+	if err != nil || !isWebURI(u) {
+		return "", errors.New("metadata url is invalid")
+	}
+
+	res, err := httpClient.Get(metadataURL)
+	if err != nil {
+		return "", errors.New("metadata could not be downloaded")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata url returned status %d", res.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", errors.New("metadata could not be downloaded")
+	}
+	return string(body), nil
+}
+
+func validateSamlConnection(connection *repository.SamlConnection) error {
+	// "/saml/idp" is lazy-auth's own identity provider.
+	if connection.Slug == "idp" {
+		return errors.New("slug idp is reserved")
+	}
+
+	u, err := url.Parse(connection.AcsURL)
+	if err != nil || !isWebURI(u) {
+		return errors.New("acs url is invalid")
+	}
+
+	for field := range connection.AttributeMapping {
+		if !slices.Contains(samlAttributeFields, field) {
+			return errors.New("attribute mapping field " + field + " is not supported")
+		}
+	}
+
+	// Only emails in the domains the connection owns count as verified.
+	emailDomains := []string{}
+	for _, domain := range connection.EmailDomains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain == "" || strings.ContainsAny(domain, "@ /") {
+			return errors.New("email domain " + domain + " is invalid")
+		}
+		if !slices.Contains(emailDomains, domain) {
+			emailDomains = append(emailDomains, domain)
+		}
+	}
+	connection.EmailDomains = emailDomains
+	if connection.LinkByEmail && len(connection.EmailDomains) == 0 {
+		return errors.New("link by email requires email domains")
+	}
+
+	return nil
+}
+
+// parseIdPMetadata accepts an EntityDescriptor, or an EntitiesDescriptor
+// holding exactly one identity provider.
+func parseIdPMetadata(metadataXML []byte) (*saml.EntityDescriptor, error) {
+	var entity saml.EntityDescriptor
+	err := xml.Unmarshal(metadataXML, &entity)
+	if err != nil {
+		var entities saml.EntitiesDescriptor
+		if xml.Unmarshal(metadataXML, &entities) != nil {
+			return nil, errors.New("idp metadata is not valid saml metadata")
+		}
+
+		var idps []saml.EntityDescriptor
+		for _, e := range entities.EntityDescriptors {
+			if len(e.IDPSSODescriptors) > 0 {
+				idps = append(idps, e)
+			}
+		}
+		if len(idps) != 1 {
+			return nil, errors.New("idp metadata must describe exactly one identity provider")
+		}
+		entity = idps[0]
+	}
+
+	if entity.EntityID == "" || len(entity.IDPSSODescriptors) == 0 {
+		return nil, errors.New("idp metadata does not describe an identity provider")
+	}
+	if !entity.ValidUntil.IsZero() && entity.ValidUntil.Before(time.Now()) {
+		return nil, errors.New("idp metadata has expired")
+	}
+
+	return &entity, nil
+}
+
+func samlSpEntityID(issuer string, slug string) string {
+	return issuer + "/saml/" + slug + "/metadata"
+}
@@ -0,0 +1,15 @@
+package service
+
+import (
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+)
+
+type SamlIdpService interface {
+	GetMetadata() ([]byte, error)
+	Sso(
+		session *repository.Session,
+		body model.SamlSsoRequest,
+		remoteAddr string,
+	) (*model.SamlSsoResponse, error)
+}
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+	"gorm.io/gorm"
+)
+
+type samlIdpService struct {
+	samlServiceProviderRepository repository.SamlServiceProviderRepository
+	userRepository                repository.UserRepository
+	samlCertificate               *common.SamlCertificate
+	configEnv                     config.ConfigEnv
+}
+
+func NewSamlIdpService(
+	samlServiceProviderRepository repository.SamlServiceProviderRepository,
+	userRepository repository.UserRepository,
+	samlCertificate *common.SamlCertificate,
+	configEnv config.ConfigEnv,
+) SamlIdpService {
+	return samlIdpService{
+		samlServiceProviderRepository: samlServiceProviderRepository,
+		userRepository:                userRepository,
+		samlCertificate:               samlCertificate,
+		configEnv:                     configEnv,
+	}
+}
+
+func (s samlIdpService) GetMetadata() ([]byte, error) {
+	entity := s.identityProvider().Metadata()
+	entity.IDPSSODescriptors[0].NameIDFormats = []saml.NameIDFormat{
+		saml.EmailAddressNameIDFormat,
+		saml.PersistentNameIDFormat,
+		saml.UnspecifiedNameIDFormat,
+	}
+
+	metadata, err := xml.MarshalIndent(entity, "", "  ")
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	return metadata, nil
+}
+
+func (s samlIdpService) Sso(
+	session *repository.Session,
+	ssoReq model.SamlSsoRequest,
+	remoteAddr string,
+) (*model.SamlSsoResponse, error) {
+	if session.ClientID != "" {
+		return nil, errs.NewForbiddenError("token cannot be used for saml sign in")
+	}
+
+	idp := s.identityProvider()
+	req := &saml.IdpAuthnRequest{
+		IDP:         idp,
+		HTTPRequest: &http.Request{RemoteAddr: remoteAddr},
+		RelayState:  ssoReq.RelayState,
+		Now:         saml.TimeNow(),
+	}
+
+	var serviceProvider *repository.SamlServiceProvider
+	var err error
+	switch {
+	case ssoReq.SAMLRequest != "":
+		req.RequestBuffer, err = decodeSamlRequest(ssoReq.SAMLRequest)
+		if err != nil {
+			return nil, errs.NewValidationError("saml request is invalid")
+		}
+
+		// Checks the destination, issue instant, issuer and ACS URL against
+		// the registered service provider.
+		err = req.Validate()
+		if err != nil {
+			return nil, errs.NewValidationError("saml request is invalid: " + err.Error())
+		}
+
+		serviceProvider, err = s.samlServiceProviderRepository.GetByEntityId(
+			req.ServiceProviderMetadata.EntityID,
+		)
+		if err != nil {
+			zlog.Error(err)
+			return nil, errs.NewUnexpectedError()
+		}
+	case ssoReq.ServiceProviderID != "":
+		serviceProvider, err = s.initiateRequest(req, ssoReq.ServiceProviderID)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errs.NewValidationError("saml request or service provider id is required")
+	}
+
+	if req.ACSEndpoint.Binding != saml.HTTPPostBinding {
+		return nil, errs.NewUnprocessableEntity("assertion consumer service must use the HTTP-POST binding")
+	}
+
+	user, err := s.userRepository.GetById(session.UserID)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	nameID := samlUserField(user, serviceProvider.NameIDField)
+	if nameID == "" {
+		return nil, errs.NewUnprocessableEntity("user has no " + serviceProvider.NameIDField + " for the name id")
+	}
+
+	err = saml.DefaultAssertionMaker{}.MakeAssertion(req, &saml.Session{
+		ID:           session.ID,
+		CreateTime:   session.CreatedAt,
+		Index:        session.ID,
+		NameID:       nameID,
+		NameIDFormat: string(samlNameIDFormat(serviceProvider.NameIDFormat)),
+	})
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	req.Assertion.AttributeStatements = buildSamlAttributeStatements(user, serviceProvider.AttributeMapping)
+
+	form, err := req.PostBinding()
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return &model.SamlSsoResponse{
+		AcsURL:       form.URL,
+		SAMLResponse: form.SAMLResponse,
+		RelayState:   form.RelayState,
+	}, nil
+}
+
+func (s samlIdpService) identityProvider() *saml.IdentityProvider {
+	metadataURL, _ := url.Parse(samlIdpEntityID(s.configEnv.Issuer))
+	ssoURL, _ := url.Parse(s.configEnv.SamlIdpSsoURL)
+
+	return &saml.IdentityProvider{
+		Key:                     s.samlCertificate.PrivateKey,
+		Certificate:             s.samlCertificate.Certificate,
+		MetadataURL:             *metadataURL,
+		SSOURL:                  *ssoURL,
+		ServiceProviderProvider: samlServiceProviderProvider{s.samlServiceProviderRepository},
+		SignatureMethod:         dsig.RSASHA256SignatureMethod,
+	}
+}
+
+// initiateRequest prepares an unsolicited response for IdP-initiated sign in,
+// sent to the default HTTP-POST assertion consumer service.
+func (s samlIdpService) initiateRequest(
+	req *saml.IdpAuthnRequest,
+	serviceProviderID string,
+) (*repository.SamlServiceProvider, error) {
+	serviceProvider, err := s.samlServiceProviderRepository.GetById(serviceProviderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("saml service provider not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	if serviceProvider.DisabledFlag {
+		return nil, errs.NewNotFoundError("saml service provider not found")
+	}
+
+	entity, err := parseSpMetadata([]byte(serviceProvider.MetadataXML))
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	req.ServiceProviderMetadata = entity
+	req.Request.IssueInstant = req.Now
+	for i, descriptor := range entity.SPSSODescriptors {
+		for j, endpoint := range descriptor.AssertionConsumerServices {
+			if endpoint.Binding != saml.HTTPPostBinding {
+				continue
+			}
+			if req.ACSEndpoint == nil || (endpoint.IsDefault != nil && *endpoint.IsDefault) {
+				req.SPSSODescriptor = &entity.SPSSODescriptors[i]
+				req.ACSEndpoint = &entity.SPSSODescriptors[i].AssertionConsumerServices[j]
+			}
+		}
+	}
+
+	return serviceProvider, nil
+}
+
+// samlServiceProviderProvider looks up AuthnRequest issuers in the service
+// provider registry.
+type samlServiceProviderProvider struct {
+	samlServiceProviderRepository repository.SamlServiceProviderRepository
+}
+
+func (p samlServiceProviderProvider) GetServiceProvider(
+	_ *http.Request,
+	entityID string,
+) (*saml.EntityDescriptor, error) {
+	serviceProvider, err := p.samlServiceProviderRepository.GetByEntityId(entityID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, os.ErrNotExist
+		}
+		return nil, err
+	}
+	if serviceProvider.DisabledFlag {
+		return nil, os.ErrNotExist
+	}
+
+	return parseSpMetadata([]byte(serviceProvider.MetadataXML))
+}
+
+// decodeSamlRequest accepts both the deflated HTTP-Redirect and the plain
+// HTTP-POST binding encodings.
+func decodeSamlRequest(samlRequest string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(samlRequest)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("<")) {
+		return raw, nil
+	}
+	return io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(raw)), 1<<20))
+}
+
+func buildSamlAttributeStatements(
+	user *repository.User,
+	attributeMapping map[string]string,
+) []saml.AttributeStatement {
+	names := make([]string, 0, len(attributeMapping))
+	for name := range attributeMapping {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var attributes []saml.Attribute
+	for _, name := range names {
+		value := samlUserField(user, attributeMapping[name])
+		if value == "" {
+			continue
+		}
+		attributes = append(attributes, saml.Attribute{
+			Name:       name,
+			NameFormat: "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
+			Values:     []saml.AttributeValue{{Type: "xs:string", Value: value}},
+		})
+	}
+
+	if len(attributes) == 0 {
+		return nil
+	}
+	return []saml.AttributeStatement{{Attributes: attributes}}
+}
+
+func samlUserField(user *repository.User, field string) string {
+	switch field {
+	case "id":
+		return user.ID
+	case "email":
+		return user.Email
+	case "username":
+		return user.Username
+	case "display_name":
+		return user.DisplayName
+	case "first_name":
+		return user.FirstName
+	case "last_name":
+		return user.LastName
+	case "role":
+		return user.Role.Name
+	}
+	return ""
+}
+
+func samlIdpEntityID(issuer string) string {
+	return issuer + "/saml/idp/metadata"
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+	"gorm.io/gorm"
+)
+
+const samlRequestExpiresIn = 10 * time.Minute
+
+var defaultAttributeMapping = map[string]string{
+	"email":        "email",
+	"username":     "uid",
+	"display_name": "displayName",
+	"first_name":   "givenName",
+	"last_name":    "sn",
+}
+
+type samlService struct {
+	samlConnectionRepository repository.SamlConnectionRepository
+	samlRequestRepository    repository.SamlRequestRepository
+	samlAssertionRepository  repository.SamlAssertionRepository
+	samlIdentityRepository   repository.SamlIdentityRepository
+	userRepository           repository.UserRepository
+	roleRepository           repository.RoleRepository
+	sessionRepository        repository.SessionRepository
+	emailOtpService          EmailOtpService
+	samlCertificate          *common.SamlCertificate
+	configEnv                config.ConfigEnv
+}
+
+func NewSamlService(
+	samlConnectionRepository repository.SamlConnectionRepository,
+	samlRequestRepository repository.SamlRequestRepository,
+	samlAssertionRepository repository.SamlAssertionRepository,
+	samlIdentityRepository repository.SamlIdentityRepository,
+	userRepository repository.UserRepository,
+	roleRepository repository.RoleRepository,
+	sessionRepository repository.SessionRepository,
+	emailOtpService EmailOtpService,
+	samlCertificate *common.SamlCertificate,
+	configEnv config.ConfigEnv,
+) SamlService {
+	return samlService{
+		samlConnectionRepository: samlConnectionRepository,
+		samlRequestRepository:    samlRequestRepository,
+		samlAssertionRepository:  samlAssertionRepository,
+		samlIdentityRepository:   samlIdentityRepository,
+		userRepository:           userRepository,
+		roleRepository:           roleRepository,
+		sessionRepository:        sessionRepository,
+		emailOtpService:          emailOtpService,
+		samlCertificate:          samlCertificate,
+		configEnv:                configEnv,
+	}
+}
+
+func (s samlService) GetMetadata(slug string) ([]byte, error) {
+	_, sp, err := s.getServiceProvider(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	return metadata, nil
+}
+
+func (s samlService) Login(slug string) (*model.SamlLoginResponse, error) {
+	connection, sp, err := s.getServiceProvider(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	ssoURL := sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if ssoURL == "" {
+		return nil, errs.NewUnprocessableEntity("identity provider does not support the HTTP-Redirect binding")
+	}
+
+	authnRequest, err := sp.MakeAuthenticationRequest(ssoURL, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	err = s.samlRequestRepository.Create(&repository.SamlRequest{
+		RequestID:    authnRequest.ID,
+		ConnectionID: connection.ID,
+		ExpiresAt:    time.Now().Add(samlRequestExpiresIn),
+	})
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	// The request ID is short enough to satisfy the 80 byte RelayState limit.
+	redirectURL, err := authnRequest.Redirect(authnRequest.ID, sp)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return &model.SamlLoginResponse{RedirectTo: redirectURL.String()}, nil
+}
+
+func (s samlService) Acs(slug string, acsReq model.SamlAcsRequest) (*model.TokenResponse, error) {
+	connection, sp, err := s.getServiceProvider(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := s.samlRequestRepository.GetByRequestId(acsReq.RelayState)
+	if err != nil || request.ConnectionID != connection.ID || time.Now().After(request.ExpiresAt) {
+		return nil, errs.NewUnauthorizedError("saml request is invalid or expired")
+	}
+	err = s.samlRequestRepository.DeleteById(request.ID)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	responseXML, err := base64.StdEncoding.DecodeString(acsReq.SAMLResponse)
+	if err != nil {
+		return nil, errs.NewUnauthorizedError("saml response is invalid")
+	}
+
+	// Signature, issuer, audience, recipient, InResponseTo and the validity
+	// window are all checked here.
+	assertion, err := sp.ParseXMLResponse(responseXML, []string{request.RequestID})
+	if err != nil {
+		var invalidResponse *saml.InvalidResponseError
+		if errors.As(err, &invalidResponse) {
+			err = invalidResponse.PrivateErr
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnauthorizedError("saml response is invalid")
+	}
+
+	err = s.samlAssertionRepository.Create(&repository.SamlAssertion{
+		AssertionID: assertion.ID,
+		ExpiresAt:   assertion.Conditions.NotOnOrAfter.Add(saml.MaxClockSkew),
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errs.NewUnauthorizedError("saml assertion was already used")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	nameID, profile := s.mapAssertion(connection, assertion)
+	if nameID == "" {
+		return nil, errs.NewUnauthorizedError("saml assertion has no subject")
+	}
+
+	// Identities are linked by NameID, a transient one changes with every
+	// sign in and would never find the account again.
+	if assertion.Subject.NameID.Format == string(saml.TransientNameIDFormat) {
+		return nil, errs.NewUnauthorizedError("saml assertion has a transient subject")
+	}
+
+	user, err := s.resolveUser(connection, nameID, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	user.LastAccessAt = time.Now()
+	err = s.userRepository.Update(user)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return completeLogin(s.emailOtpService, s.sessionRepository, s.configEnv, user)
+}
+
+func (s samlService) getServiceProvider(
+	slug string,
+) (*repository.SamlConnection, *saml.ServiceProvider, error) {
+	connection, err := s.samlConnectionRepository.GetBySlug(slug)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errs.NewNotFoundError("saml connection not found")
+		}
+		zlog.Error(err)
+		return nil, nil, errs.NewUnexpectedError()
+	}
+	if connection.DisabledFlag {
+		return nil, nil, errs.NewNotFoundError("saml connection not found")
+	}
+
+	idpMetadata, err := parseIdPMetadata([]byte(connection.IdPMetadataXML))
+	if err != nil {
+		zlog.Error(err)
+		return nil, nil, errs.NewUnexpectedError()
+	}
+
+	entityID := samlSpEntityID(s.configEnv.Issuer, connection.Slug)
+	metadataURL, _ := url.Parse(entityID)
+	acsURL, _ := url.Parse(connection.AcsURL)
+
+	sp := saml.ServiceProvider{
+		EntityID:          entityID,
+		Key:               s.samlCertificate.PrivateKey,
+		Certificate:       s.samlCertificate.Certificate,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idpMetadata,
+		AuthnNameIDFormat: samlNameIDFormat(connection.NameIDFormat),
+		SignatureMethod:   dsig.RSASHA256SignatureMethod,
+	}
+	return connection, &sp, nil
+}
+
+// mapAssertion returns the NameID and the user fields found in the
+// assertion's attributes, matched by name or friendly name.
+func (s samlService) mapAssertion(
+	connection *repository.SamlConnection,
+	assertion *saml.Assertion,
+) (string, *externalProfile) {
+	mapping := map[string]string{}
+	for field, attribute := range defaultAttributeMapping {
+		mapping[field] = attribute
+	}
+	for field, attribute := range connection.AttributeMapping {
+		mapping[field] = attribute
+	}
+
+	attributes := map[string]string{}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if len(attribute.Values) == 0 {
+				continue
+			}
+			attributes[attribute.Name] = attribute.Values[0].Value
+			if attribute.FriendlyName != "" {
+				attributes[attribute.FriendlyName] = attribute.Values[0].Value
+			}
+		}
+	}
+
+	var nameID, nameIDFormat string
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		nameID = assertion.Subject.NameID.Value
+		nameIDFormat = assertion.Subject.NameID.Format
+	}
+
+	profile := externalProfile{
+		Subject:     nameID,
+		Email:       attributes[mapping["email"]],
+		Username:    attributes[mapping["username"]],
+		DisplayName: attributes[mapping["display_name"]],
+		FirstName:   attributes[mapping["first_name"]],
+		LastName:    attributes[mapping["last_name"]],
+	}
+	if profile.Email == "" && nameIDFormat == string(saml.EmailAddressNameIDFormat) {
+		profile.Email = nameID
+	}
+	profile.Email = strings.TrimSpace(profile.Email)
+
+	// Any IdP can assert any address, it is only trusted within the
+	// domains the connection owns.
+	_, domain, _ := strings.Cut(profile.Email, "@")
+	profile.EmailVerified = domain != "" &&
+		slices.Contains(connection.EmailDomains, strings.ToLower(domain))
+
+	return nameID, &profile
+}
+
+func (s samlService) resolveUser(
+	connection *repository.SamlConnection,
+	nameID string,
+	profile *externalProfile,
+) (*repository.User, error) {
+	identity, err := s.samlIdentityRepository.GetByConnectionAndNameId(connection.ID, nameID)
+	if err == nil {
+		identity.Email = profile.Email
+		identity.LastLoginAt = time.Now()
+		err = s.samlIdentityRepository.Update(identity)
+		if err != nil {
+			zlog.Error(err)
+			return nil, errs.NewUnexpectedError()
+		}
+
+		user, err := s.userRepository.GetById(identity.UserID)
+		if err != nil {
+			zlog.Error(err)
+			return nil, errs.NewUnexpectedError()
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	var user *repository.User
+	if profile.Email != "" {
+		existing, err := s.userRepository.GetByEmail(profile.Email)
+		if err == nil {
+			// An unverified address on either side would let whoever
+			// registered it first take over the other account.
+			if !connection.LinkByEmail || !profile.EmailVerified || !existing.VerifyFlag {
+				return nil, errs.NewUnprocessableEntity("an account with this email already exists")
+			}
+			user = existing
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			zlog.Error(err)
+			return nil, errs.NewUnexpectedError()
+		}
+	}
+
+	if user == nil {
+		if !connection.AllowSignUp {
+			return nil, errs.NewUnauthorizedError("no account is linked to this identity")
+		}
+		if profile.Email == "" {
+			return nil, errs.NewUnauthorizedError("saml assertion has no email")
+		}
+		user, err = createExternalUser(s.userRepository, s.roleRepository, profile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.samlIdentityRepository.Create(&repository.SamlIdentity{
+		UserID:       user.ID,
+		ConnectionID: connection.ID,
+		NameID:       nameID,
+		Email:        profile.Email,
+		LastLoginAt:  time.Now(),
+	})
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return user, nil
+}
+
+func samlNameIDFormat(format string) saml.NameIDFormat {
+	switch format {
+	case "email":
+		return saml.EmailAddressNameIDFormat
+	case "persistent":
+		return saml.PersistentNameIDFormat
+	}
+	return saml.UnspecifiedNameIDFormat
+}
@@ -0,0 +1,18 @@
+package service
+
+import "lazy-auth/app/model"
+
+type SamlServiceProviderService interface {
+	CreateServiceProvider(
+		body model.CreateSamlServiceProviderRequest,
+	) (*model.SamlServiceProviderResponse, error)
+	GetServiceProviders(
+		query model.QuerySamlServiceProvider,
+	) (*model.SamlServiceProviderPageResponse, error)
+	GetServiceProviderById(id string) (*model.SamlServiceProviderResponse, error)
+	UpdateServiceProviderById(
+		id string,
+		body model.UpdateSamlServiceProviderRequest,
+	) (*model.SamlServiceProviderResponse, error)
+	DeleteServiceProviderById(id string) error
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+
+	"github.com/crewjam/saml"
+	"gorm.io/gorm"
+)
+
+// samlIdpAttributeFields are the user fields a service provider's attribute
+// mapping may release.
+var samlIdpAttributeFields = []string{
+	"id",
+	"email",
+	"username",
+	"display_name",
+	"first_name",
+	"last_name",
+	"role",
+}
+
+var defaultIdpAttributeMapping = map[string]string{
+	"email":       "email",
+	"uid":         "username",
+	"displayName": "display_name",
+	"givenName":   "first_name",
+	"sn":          "last_name",
+	"role":        "role",
+}
+
+type samlServiceProviderService struct {
+	samlServiceProviderRepository repository.SamlServiceProviderRepository
+	httpClient                    *http.Client
+}
+
+func NewSamlServiceProviderService(
+	samlServiceProviderRepository repository.SamlServiceProviderRepository,
+) SamlServiceProviderService {
+	return samlServiceProviderService{
+		samlServiceProviderRepository: samlServiceProviderRepository,
+		httpClient:                    &http.Client{Timeout: externalRequestTimeout},
+	}
+}
+
+func (s samlServiceProviderService) buildSamlServiceProviderResponse(
+	serviceProvider repository.SamlServiceProvider,
+) model.SamlServiceProviderResponse {
+	acsURLs := []string{}
+	if entity, err := parseSpMetadata([]byte(serviceProvider.MetadataXML)); err == nil {
+		for _, descriptor := range entity.SPSSODescriptors {
+			for _, endpoint := range descriptor.AssertionConsumerServices {
+				acsURLs = append(acsURLs, endpoint.Location)
+			}
+		}
+	}
+
+	return model.SamlServiceProviderResponse{
+		ID:               serviceProvider.ID,
+		Name:             serviceProvider.Name,
+		EntityID:         serviceProvider.EntityID,
+		AcsURLs:          acsURLs,
+		NameIDFormat:     serviceProvider.NameIDFormat,
+		NameIDField:      serviceProvider.NameIDField,
+		AttributeMapping: serviceProvider.AttributeMapping,
+		DisabledFlag:     serviceProvider.DisabledFlag,
+		CreatedAt:        serviceProvider.CreatedAt,
+	}
+}
+
+func (s samlServiceProviderService) CreateServiceProvider(
+	serviceProviderReq model.CreateSamlServiceProviderRequest,
+) (*model.SamlServiceProviderResponse, error) {
+	serviceProvider := repository.SamlServiceProvider{
+		Name:             serviceProviderReq.Name,
+		NameIDFormat:     serviceProviderReq.NameIDFormat,
+		NameIDField:      serviceProviderReq.NameIDField,
+		AttributeMapping: serviceProviderReq.AttributeMapping,
+	}
+	if serviceProvider.NameIDFormat == "" {
+		serviceProvider.NameIDFormat = "unspecified"
+	}
+	if serviceProvider.NameIDField == "" {
+		serviceProvider.NameIDField = "id"
+		if serviceProvider.NameIDFormat == "email" {
+			serviceProvider.NameIDField = "email"
+		}
+	}
+	if serviceProvider.AttributeMapping == nil {
+		serviceProvider.AttributeMapping = defaultIdpAttributeMapping
+	}
+
+	err := s.importMetadata(
+		&serviceProvider,
+		serviceProviderReq.MetadataXML,
+		serviceProviderReq.MetadataURL,
+		serviceProviderReq.EntityID,
+		serviceProviderReq.AcsURL,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateSamlServiceProvider(&serviceProvider); err != nil {
+		return nil, errs.NewValidationError(err.Error())
+	}
+
+	err = s.samlServiceProviderRepository.Create(&serviceProvider)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errs.NewUnprocessableEntity("saml service provider entity id duplicated")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	serviceProviderResponse := s.buildSamlServiceProviderResponse(serviceProvider)
+	return &serviceProviderResponse, nil
+}
+
+func (s samlServiceProviderService) GetServiceProviders(
+	query model.QuerySamlServiceProvider,
+) (*model.SamlServiceProviderPageResponse, error) {
+	serviceProviders, total, err := s.samlServiceProviderRepository.GetMany(query)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	serviceProvidersResponse := common.Map(serviceProviders, s.buildSamlServiceProviderResponse)
+	meta := common.BuildMetaPagination(&total, query.Limit, query.Offset)
+
+	return &model.SamlServiceProviderPageResponse{Meta: meta, Data: serviceProvidersResponse}, nil
+}
+
+func (s samlServiceProviderService) GetServiceProviderById(
+	id string,
+) (*model.SamlServiceProviderResponse, error) {
+	serviceProvider, err := s.samlServiceProviderRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("saml service provider not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	serviceProviderResponse := s.buildSamlServiceProviderResponse(*serviceProvider)
+	return &serviceProviderResponse, nil
+}
+
+func (s samlServiceProviderService) UpdateServiceProviderById(
+	id string,
+	serviceProviderReq model.UpdateSamlServiceProviderRequest,
+) (*model.SamlServiceProviderResponse, error) {
+	serviceProvider, err := s.samlServiceProviderRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("saml service provider not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	if serviceProviderReq.Name != nil {
+		serviceProvider.Name = *serviceProviderReq.Name
+	}
+
+	if serviceProviderReq.MetadataXML != nil ||
+		serviceProviderReq.MetadataURL != nil ||
+		serviceProviderReq.EntityID != nil ||
+		serviceProviderReq.AcsURL != nil {
+		var metadataXML, metadataURL, acsURL string
+		entityID := serviceProvider.EntityID
+		if serviceProviderReq.MetadataXML != nil {
+			metadataXML = *serviceProviderReq.MetadataXML
+		}
+		if serviceProviderReq.MetadataURL != nil {
+			metadataURL = *serviceProviderReq.MetadataURL
+		}
+		if serviceProviderReq.EntityID != nil {
+			entityID = *serviceProviderReq.EntityID
+		}
+		if serviceProviderReq.AcsURL != nil {
+			acsURL = *serviceProviderReq.AcsURL
+		}
+		err = s.importMetadata(serviceProvider, metadataXML, metadataURL, entityID, acsURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if serviceProviderReq.NameIDFormat != nil {
+		serviceProvider.NameIDFormat = *serviceProviderReq.NameIDFormat
+	}
+
+	if serviceProviderReq.NameIDField != nil {
+		serviceProvider.NameIDField = *serviceProviderReq.NameIDField
+	}
+
+	if serviceProviderReq.AttributeMapping != nil {
+		serviceProvider.AttributeMapping = *serviceProviderReq.AttributeMapping
+	}
+
+	if serviceProviderReq.DisabledFlag != nil {
+		serviceProvider.DisabledFlag = *serviceProviderReq.DisabledFlag
+	}
+
+	if err := validateSamlServiceProvider(serviceProvider); err != nil {
+		return nil, errs.NewValidationError(err.Error())
+	}
+
+	err = s.samlServiceProviderRepository.Update(serviceProvider)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errs.NewUnprocessableEntity("saml service provider entity id duplicated")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	serviceProviderResponse := s.buildSamlServiceProviderResponse(*serviceProvider)
+	return &serviceProviderResponse, nil
+}
+
+func (s samlServiceProviderService) DeleteServiceProviderById(id string) error {
+	_, err := s.samlServiceProviderRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewNotFoundError("saml service provider not found")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	err = s.samlServiceProviderRepository.DeleteById(id)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
+
+// importMetadata stores the SP metadata given inline or downloaded once from
+// metadataURL. Service providers without metadata are described by their
+// entity ID and a single HTTP-POST ACS URL instead.
+func (s samlServiceProviderService) importMetadata(
+	serviceProvider *repository.SamlServiceProvider,
+	metadataXML string,
+	metadataURL string,
+	entityID string,
+	acsURL string,
+) error {
+	if metadataXML == "" && metadataURL != "" {
+		body, err := fetchSamlMetadata(s.httpClient, metadataURL)
+		if err != nil {
+			return errs.NewValidationError("sp " + err.Error())
+		}
+		metadataXML = body
+	}
+
+	if metadataXML == "" {
+		if entityID == "" || acsURL == "" {
+			return errs.NewValidationError("sp metadata xml or url, or entity id and acs url are required")
+		}
+		u, err := url.Parse(acsURL)
+		if err != nil || !isWebURI(u) {
+			return errs.NewValidationError("acs url is invalid")
+		}
+
+		metadata, err := xml.Marshal(saml.EntityDescriptor{
+			EntityID: entityID,
+			SPSSODescriptors: []saml.SPSSODescriptor{{
+				SSODescriptor: saml.SSODescriptor{
+					RoleDescriptor: saml.RoleDescriptor{
+						ProtocolSupportEnumeration: "urn:oasis:names:tc:SAML:2.0:protocol",
+					},
+				},
+				AssertionConsumerServices: []saml.IndexedEndpoint{{
+					Binding:  saml.HTTPPostBinding,
+					Location: acsURL,
+					Index:    1,
+				}},
+			}},
+		})
+		if err != nil {
+			zlog.Error(err)
+			return errs.NewUnexpectedError()
+		}
+		metadataXML = string(metadata)
+	}
+
+	entity, err := parseSpMetadata([]byte(metadataXML))
+	if err != nil {
+		return errs.NewValidationError(err.Error())
+	}
+
+	serviceProvider.EntityID = entity.EntityID
+	serviceProvider.MetadataXML = metadataXML
+	return nil
+}
+
+func validateSamlServiceProvider(serviceProvider *repository.SamlServiceProvider) error {
+	if serviceProvider.NameIDFormat == "email" && serviceProvider.NameIDField != "email" {
+		return errors.New("name id field must be email for the email name id format")
+	}
+
+	for attribute, field := range serviceProvider.AttributeMapping {
+		if attribute == "" {
+			return errors.New("attribute mapping name is empty")
+		}
+		if !slices.Contains(samlIdpAttributeFields, field) {
+			return errors.New("attribute mapping field " + field + " is not supported")
+		}
+	}
+
+	return nil
+}
+
+// parseSpMetadata accepts an EntityDescriptor describing a service provider
+// with at least one HTTP-POST assertion consumer service.
+func parseSpMetadata(metadataXML []byte) (*saml.EntityDescriptor, error) {
+	var entity saml.EntityDescriptor
+	err := xml.Unmarshal(metadataXML, &entity)
+	if err != nil {
+		return nil, errors.New("sp metadata is not valid saml metadata")
+	}
+
+	if entity.EntityID == "" || len(entity.SPSSODescriptors) == 0 {
+		return nil, errors.New("sp metadata does not describe a service provider")
+	}
+	if !entity.ValidUntil.IsZero() && entity.ValidUntil.Before(time.Now()) {
+		return nil, errors.New("sp metadata has expired")
+	}
+
+	for _, descriptor := range entity.SPSSODescriptors {
+		for _, endpoint := range descriptor.AssertionConsumerServices {
+			if endpoint.Binding == saml.HTTPPostBinding {
+				return &entity, nil
+			}
+		}
+	}
+	return nil, errors.New("sp metadata has no HTTP-POST assertion consumer service")
+}
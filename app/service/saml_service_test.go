@@ -0,0 +1,536 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/common"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	testSamlIdPURL   = "https://idp.example.com"
+	testSamlAcsURL   = testIssuer + "/saml/corp/acs"
+	testSamlNameID   = "idp-user-1"
+	testSamlEmail    = "bob@example.com"
+	testSamlUsername = "bob"
+)
+
+// testSamlCertificates holds the service provider's certificate, the IdP's
+// and one the connection does not trust.
+var testSamlCertificates = sync.OnceValue(func() map[string]*common.SamlCertificate {
+	return map[string]*common.SamlCertificate{
+		"sp":    common.LoadSamlCertificate("", ""),
+		"idp":   common.LoadSamlCertificate("", ""),
+		"other": common.LoadSamlCertificate("", ""),
+	}
+})
+
+type samlTestEnv struct {
+	service samlService
+	idp     *saml.IdentityProvider
+	repos   *testRepositories
+	mailer  *fakeMailer
+}
+
+// newSamlTestEnv sets up the connections "corp", which signs users up and
+// links them by email within example.com, and "partner", which does
+// neither. user-1 is linked to testSamlNameID through partner.
+func newSamlTestEnv(t *testing.T) *samlTestEnv {
+	t.Helper()
+
+	metadataURL, _ := url.Parse(testSamlIdPURL + "/metadata")
+	ssoURL, _ := url.Parse(testSamlIdPURL + "/sso")
+	idp := &saml.IdentityProvider{
+		Key:             testSamlCertificates()["idp"].PrivateKey,
+		Certificate:     testSamlCertificates()["idp"].Certificate,
+		MetadataURL:     *metadataURL,
+		SSOURL:          *ssoURL,
+		SignatureMethod: dsig.RSASHA256SignatureMethod,
+	}
+	idpMetadata, err := xml.Marshal(idp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repos := newTestRepositories()
+	repos.samlConnections.connections["connection-1"] = repository.SamlConnection{
+		ID:             "connection-1",
+		Slug:           "corp",
+		IdPEntityID:    idp.Metadata().EntityID,
+		IdPMetadataXML: string(idpMetadata),
+		AcsURL:         testSamlAcsURL,
+		AllowSignUp:    true,
+		LinkByEmail:    true,
+		EmailDomains:   []string{"example.com"},
+	}
+	repos.samlConnections.connections["connection-2"] = repository.SamlConnection{
+		ID:             "connection-2",
+		Slug:           "partner",
+		IdPEntityID:    idp.Metadata().EntityID,
+		IdPMetadataXML: string(idpMetadata),
+		AcsURL:         testIssuer + "/saml/partner/acs",
+	}
+	repos.samlIdentities.identities["identity-1"] = repository.SamlIdentity{
+		ID:           "identity-1",
+		UserID:       "user-1",
+		ConnectionID: "connection-2",
+		NameID:       testSamlNameID,
+	}
+
+	configEnv := newTestConfigEnv()
+	mailer := newFakeMailer()
+	return &samlTestEnv{
+		service: NewSamlService(
+			repos.samlConnections,
+			repos.samlRequests,
+			repos.samlAssertions,
+			repos.samlIdentities,
+			repos.users,
+			repos.roles,
+			repos.sessions,
+			NewEmailOtpService(repos.emailOtps, repos.users, repos.sessions, mailer, configEnv),
+			testSamlCertificates()["sp"],
+			configEnv,
+		).(samlService),
+		idp:    idp,
+		repos:  repos,
+		mailer: mailer,
+	}
+}
+
+// login starts a sign in and returns the ID of the AuthnRequest sent to the
+// IdP, which is also the RelayState.
+func (env *samlTestEnv) login(t *testing.T, slug string) string {
+	t.Helper()
+
+	resp, err := env.service.Login(slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirectTo, err := url.Parse(resp.RedirectTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return redirectTo.Query().Get("RelayState")
+}
+
+// respond builds the IdP's signed response to requestID, mutate can change
+// the request or the assertion before they are signed.
+func (env *samlTestEnv) respond(
+	t *testing.T,
+	slug string,
+	requestID string,
+	mutate func(req *saml.IdpAuthnRequest),
+) model.SamlAcsRequest {
+	t.Helper()
+
+	_, sp, err := env.service.getServiceProvider(slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spMetadata := sp.Metadata()
+
+	idp := *env.idp
+	req := &saml.IdpAuthnRequest{
+		IDP:                     &idp,
+		HTTPRequest:             httptest.NewRequest(http.MethodPost, sp.AcsURL.String(), nil),
+		RelayState:              requestID,
+		Request:                 saml.AuthnRequest{ID: requestID},
+		ServiceProviderMetadata: spMetadata,
+		SPSSODescriptor:         &spMetadata.SPSSODescriptors[0],
+		ACSEndpoint:             &saml.IndexedEndpoint{Binding: saml.HTTPPostBinding, Location: sp.AcsURL.String()},
+		Now:                     saml.TimeNow(),
+	}
+	err = saml.DefaultAssertionMaker{}.MakeAssertion(req, &saml.Session{
+		NameID:       testSamlNameID,
+		NameIDFormat: string(saml.PersistentNameIDFormat),
+		UserName:     testSamlUsername,
+		CustomAttributes: []saml.Attribute{{
+			Name:   "email",
+			Values: []saml.AttributeValue{{Type: "xs:string", Value: testSamlEmail}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mutate != nil {
+		mutate(req)
+	}
+
+	form, err := req.PostBinding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model.SamlAcsRequest{SAMLResponse: form.SAMLResponse, RelayState: form.RelayState}
+}
+
+func TestSamlAcs(t *testing.T) {
+	env := newSamlTestEnv(t)
+
+	requestID := env.login(t, "corp")
+	acsReq := env.respond(t, "corp", requestID, nil)
+	tokenResp, err := env.service.Acs("corp", acsReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenResp.AccessToken == "" {
+		t.Error("no token was issued")
+	}
+
+	identity, err := env.repos.samlIdentities.GetByConnectionAndNameId("connection-1", testSamlNameID)
+	if err != nil {
+		t.Fatal("no identity was linked")
+	}
+	user, err := env.repos.users.GetById(identity.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != testSamlEmail || user.Username != testSamlUsername || !user.VerifyFlag {
+		t.Errorf("user = %s %s verified %v", user.Email, user.Username, user.VerifyFlag)
+	}
+
+	// The request is single use, replaying the whole form fails before
+	// the assertion is looked at.
+	_, err = env.service.Acs("corp", acsReq)
+	assertAppError(t, err, 401, "saml request is invalid or expired")
+}
+
+func TestSamlAcsAsksForMfa(t *testing.T) {
+	env := newSamlTestEnv(t)
+	user := env.repos.users.users["user-1"]
+	user.EmailMfaFlag = true
+	env.repos.users.users["user-1"] = user
+
+	requestID := env.login(t, "partner")
+	tokenResp, err := env.service.Acs("partner", env.respond(t, "partner", requestID, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tokenResp.MfaRequired || tokenResp.AccessToken != "" || len(env.repos.sessions.sessions) != 0 {
+		t.Errorf("token response = %+v, want only an MFA token", tokenResp)
+	}
+	if mail := env.mailer.next(t); mail.to != user.Email {
+		t.Errorf("code was sent to %s, want %s", mail.to, user.Email)
+	}
+}
+
+func TestSamlAcsRejectsRequest(t *testing.T) {
+	env := newSamlTestEnv(t)
+
+	// A request started for another connection.
+	requestID := env.login(t, "partner")
+	_, err := env.service.Acs("corp", env.respond(t, "corp", requestID, nil))
+	assertAppError(t, err, 401, "saml request is invalid or expired")
+
+	// IdP initiated, no request was ever made.
+	_, err = env.service.Acs("corp", env.respond(t, "corp", "id-unknown", nil))
+	assertAppError(t, err, 401, "saml request is invalid or expired")
+
+	requestID = env.login(t, "corp")
+	_, err = env.service.Acs("corp", model.SamlAcsRequest{SAMLResponse: "%%%", RelayState: requestID})
+	assertAppError(t, err, 401, "saml response is invalid")
+}
+
+func TestSamlAcsRejectsAssertion(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(req *saml.IdpAuthnRequest)
+	}{
+		{"signed by an untrusted key", func(req *saml.IdpAuthnRequest) {
+			req.IDP.Key = testSamlCertificates()["other"].PrivateKey
+			req.IDP.Certificate = testSamlCertificates()["other"].Certificate
+		}},
+		{"answers another request", func(req *saml.IdpAuthnRequest) {
+			req.Request.ID = "id-other"
+			req.Assertion.Subject.SubjectConfirmations[0].SubjectConfirmationData.InResponseTo = "id-other"
+		}},
+		{"other audience", func(req *saml.IdpAuthnRequest) {
+			req.Assertion.Conditions.AudienceRestrictions[0].Audience.Value = "https://other.example.com"
+		}},
+		{"other recipient", func(req *saml.IdpAuthnRequest) {
+			confirmation := req.Assertion.Subject.SubjectConfirmations[0].SubjectConfirmationData
+			confirmation.Recipient = "https://other.example.com/acs"
+		}},
+		{"other destination", func(req *saml.IdpAuthnRequest) {
+			req.ACSEndpoint.Location = "https://other.example.com/acs"
+		}},
+		{"other issuer", func(req *saml.IdpAuthnRequest) {
+			req.Assertion.Issuer.Value = "https://other.example.com"
+		}},
+		{"expired", func(req *saml.IdpAuthnRequest) {
+			req.Assertion.Conditions.NotBefore = time.Now().Add(-time.Hour)
+			req.Assertion.Conditions.NotOnOrAfter = time.Now().Add(-30 * time.Minute)
+		}},
+		{"not yet valid", func(req *saml.IdpAuthnRequest) {
+			req.Assertion.Conditions.NotBefore = time.Now().Add(time.Hour)
+			req.Assertion.Conditions.NotOnOrAfter = time.Now().Add(2 * time.Hour)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := newSamlTestEnv(t)
+
+			requestID := env.login(t, "corp")
+			_, err := env.service.Acs("corp", env.respond(t, "corp", requestID, test.mutate))
+			assertAppError(t, err, 401, "saml response is invalid")
+		})
+	}
+}
+
+func TestSamlAcsRejectsTransientSubject(t *testing.T) {
+	env := newSamlTestEnv(t)
+
+	requestID := env.login(t, "partner")
+	acsReq := env.respond(t, "partner", requestID, func(req *saml.IdpAuthnRequest) {
+		req.Assertion.Subject.NameID.Format = string(saml.TransientNameIDFormat)
+	})
+	_, err := env.service.Acs("partner", acsReq)
+	assertAppError(t, err, 401, "saml assertion has a transient subject")
+}
+
+func TestSamlAcsRejectsTamperedResponse(t *testing.T) {
+	env := newSamlTestEnv(t)
+
+	requestID := env.login(t, "corp")
+	acsReq := env.respond(t, "corp", requestID, nil)
+	responseXML, err := base64.StdEncoding.DecodeString(acsReq.SAMLResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The assertion is encrypted for the service provider, move the signed
+	// IssueInstant of the response back a second instead.
+	issueInstant := regexp.MustCompile(`IssueInstant="([^"]+)"`).FindStringSubmatch(string(responseXML))
+	if issueInstant == nil {
+		t.Fatal("the response has no IssueInstant")
+	}
+	issuedAt, err := time.Parse(time.RFC3339Nano, issueInstant[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(
+		string(responseXML),
+		issueInstant[0],
+		`IssueInstant="`+issuedAt.Add(-time.Second).Format(time.RFC3339Nano)+`"`,
+		1,
+	)
+	acsReq.SAMLResponse = base64.StdEncoding.EncodeToString([]byte(tampered))
+
+	_, err = env.service.Acs("corp", acsReq)
+	assertAppError(t, err, 401, "saml response is invalid")
+}
+
+func TestSamlMapAssertion(t *testing.T) {
+	env := newSamlTestEnv(t)
+	connection := &repository.SamlConnection{
+		AttributeMapping: map[string]string{"display_name": "urn:oid:2.16.840.1.113730.3.1.241"},
+		EmailDomains:     []string{"example.com"},
+	}
+
+	assertion := func(nameIDFormat string, attributes ...saml.Attribute) *saml.Assertion {
+		return &saml.Assertion{
+			Subject: &saml.Subject{NameID: &saml.NameID{
+				Format: nameIDFormat,
+				Value:  "Bob@EXAMPLE.com",
+			}},
+			AttributeStatements: []saml.AttributeStatement{{Attributes: attributes}},
+		}
+	}
+	attribute := func(name, friendlyName, value string) saml.Attribute {
+		return saml.Attribute{
+			Name:         name,
+			FriendlyName: friendlyName,
+			Values:       []saml.AttributeValue{{Value: value}},
+		}
+	}
+
+	nameID, profile := env.service.mapAssertion(connection, assertion(
+		string(saml.PersistentNameIDFormat),
+		attribute("email", "", " bob@example.com "),
+		attribute("urn:oid:0.9.2342.19200300.100.1.1", "uid", "bob"),
+		attribute("urn:oid:2.16.840.1.113730.3.1.241", "displayName", "Bob"),
+		attribute("givenName", "", "Robert"),
+	))
+	if nameID != "Bob@EXAMPLE.com" {
+		t.Errorf("nameID = %s", nameID)
+	}
+	want := externalProfile{
+		Subject:       "Bob@EXAMPLE.com",
+		Email:         "bob@example.com",
+		EmailVerified: true,
+		Username:      "bob",
+		DisplayName:   "Bob",
+		FirstName:     "Robert",
+	}
+	if *profile != want {
+		t.Errorf("profile = %+v, want %+v", *profile, want)
+	}
+
+	// Only an email NameID stands in for a missing email attribute, the
+	// domain is matched case-insensitively.
+	_, profile = env.service.mapAssertion(connection, assertion(string(saml.EmailAddressNameIDFormat)))
+	if profile.Email != "Bob@EXAMPLE.com" || !profile.EmailVerified {
+		t.Errorf("email = %s verified %v", profile.Email, profile.EmailVerified)
+	}
+	_, profile = env.service.mapAssertion(connection, assertion(string(saml.PersistentNameIDFormat)))
+	if profile.Email != "" || profile.EmailVerified {
+		t.Errorf("email = %s verified %v", profile.Email, profile.EmailVerified)
+	}
+
+	for _, email := range []string{"bob@evil.com", "bob@sub.example.com", "bob@example.com.evil.com", "bob"} {
+		_, profile = env.service.mapAssertion(connection, assertion("", attribute("email", "", email)))
+		if profile.EmailVerified {
+			t.Errorf("%s is verified", email)
+		}
+	}
+}
+
+func TestSamlResolveUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection repository.SamlConnection
+		user       *repository.User
+		profile    externalProfile
+		wantUser   string
+		wantCode   int
+		wantError  string
+	}{
+		{
+			name:       "links a verified account",
+			connection: repository.SamlConnection{LinkByEmail: true},
+			user:       &repository.User{ID: "user-2", Email: testSamlEmail, VerifyFlag: true},
+			profile:    externalProfile{Email: testSamlEmail, EmailVerified: true},
+			wantUser:   "user-2",
+		},
+		{
+			name:       "linking is disabled",
+			connection: repository.SamlConnection{AllowSignUp: true},
+			user:       &repository.User{ID: "user-2", Email: testSamlEmail, VerifyFlag: true},
+			profile:    externalProfile{Email: testSamlEmail, EmailVerified: true},
+			wantCode:   422,
+			wantError:  "an account with this email already exists",
+		},
+		{
+			name:       "email outside the connection's domains",
+			connection: repository.SamlConnection{LinkByEmail: true},
+			user:       &repository.User{ID: "user-2", Email: testSamlEmail, VerifyFlag: true},
+			profile:    externalProfile{Email: testSamlEmail},
+			wantCode:   422,
+			wantError:  "an account with this email already exists",
+		},
+		{
+			name:       "account email is unverified",
+			connection: repository.SamlConnection{LinkByEmail: true},
+			user:       &repository.User{ID: "user-2", Email: testSamlEmail},
+			profile:    externalProfile{Email: testSamlEmail, EmailVerified: true},
+			wantCode:   422,
+			wantError:  "an account with this email already exists",
+		},
+		{
+			name:       "sign up is disabled",
+			connection: repository.SamlConnection{LinkByEmail: true},
+			profile:    externalProfile{Email: testSamlEmail, EmailVerified: true},
+			wantCode:   401,
+			wantError:  "no account is linked to this identity",
+		},
+		{
+			name:       "sign up without an email",
+			connection: repository.SamlConnection{AllowSignUp: true},
+			profile:    externalProfile{},
+			wantCode:   401,
+			wantError:  "saml assertion has no email",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			env := newSamlTestEnv(t)
+			if test.user != nil {
+				env.repos.users.users[test.user.ID] = *test.user
+			}
+			test.connection.ID = "connection-1"
+
+			user, err := env.service.resolveUser(&test.connection, "name-id", &test.profile)
+			if test.wantError != "" {
+				assertAppError(t, err, test.wantCode, test.wantError)
+				if len(env.repos.samlIdentities.identities) != 1 {
+					t.Error("an identity was linked")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.ID != test.wantUser {
+				t.Errorf("user = %s, want %s", user.ID, test.wantUser)
+			}
+			if _, err := env.repos.samlIdentities.GetByConnectionAndNameId("connection-1", "name-id"); err != nil {
+				t.Error("no identity was linked")
+			}
+		})
+	}
+}
+
+func TestSamlResolveUserSignUp(t *testing.T) {
+	env := newSamlTestEnv(t)
+	connection := &repository.SamlConnection{ID: "connection-1", AllowSignUp: true}
+
+	// The address is only marked verified when the connection vouches for it.
+	user, err := env.service.resolveUser(connection, "name-id-1", &externalProfile{Email: "carol@other.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.VerifyFlag || user.Username != "carol" || user.RoleID != "role-1" {
+		t.Errorf("user = %s role %s verified %v", user.Username, user.RoleID, user.VerifyFlag)
+	}
+
+	// A taken username gets a suffix instead of failing.
+	user, err = env.service.resolveUser(connection, "name-id-2", &externalProfile{
+		Email:         "jdoe@example.org",
+		Username:      "jdoe",
+		EmailVerified: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(user.Username, "jdoe_") || !user.VerifyFlag {
+		t.Errorf("user = %s verified %v", user.Username, user.VerifyFlag)
+	}
+}
+
+func TestSamlResolveUserKnownIdentity(t *testing.T) {
+	env := newSamlTestEnv(t)
+	connection := &repository.SamlConnection{ID: "connection-2"}
+
+	// A linked identity wins over the asserted email, even one that
+	// belongs to another account.
+	env.repos.users.users["user-2"] = repository.User{ID: "user-2", Email: testSamlEmail, VerifyFlag: true}
+	user, err := env.service.resolveUser(connection, testSamlNameID, &externalProfile{Email: testSamlEmail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "user-1" {
+		t.Errorf("user = %s, want user-1", user.ID)
+	}
+	if identity := env.repos.samlIdentities.identities["identity-1"]; identity.Email != testSamlEmail {
+		t.Errorf("identity email = %s, want %s", identity.Email, testSamlEmail)
+	}
+
+	// The same NameID from another connection is another identity.
+	connection.ID = "connection-1"
+	_, err = env.service.resolveUser(connection, testSamlNameID, &externalProfile{Email: "dave@example.com"})
+	assertAppError(t, err, 401, "no account is linked to this identity")
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+)
+
+type ScimService interface {
+	GetUsers(tenant *repository.ScimTenant, query model.QueryScim) (*model.ScimListResponse, error)
+	GetUserById(tenant *repository.ScimTenant, id string) (*model.ScimUser, error)
+	CreateUser(tenant *repository.ScimTenant, body model.ScimUser) (*model.ScimUser, error)
+	ReplaceUser(tenant *repository.ScimTenant, id string, body model.ScimUser) (*model.ScimUser, error)
+	PatchUser(tenant *repository.ScimTenant, id string, body model.ScimPatchRequest) (*model.ScimUser, error)
+	DeleteUser(tenant *repository.ScimTenant, id string) error
+	GetGroups(tenant *repository.ScimTenant, query model.QueryScim) (*model.ScimListResponse, error)
+	GetGroupById(tenant *repository.ScimTenant, id string, query model.QueryScim) (*model.ScimGroup, error)
+	CreateGroup(tenant *repository.ScimTenant, body model.ScimGroup) (*model.ScimGroup, error)
+	ReplaceGroup(tenant *repository.ScimTenant, id string, body model.ScimGroup) (*model.ScimGroup, error)
+	PatchGroup(tenant *repository.ScimTenant, id string, body model.ScimPatchRequest) (*model.ScimGroup, error)
+	DeleteGroup(tenant *repository.ScimTenant, id string) error
+	GetServiceProviderConfig() map[string]any
+	GetResourceTypes() *model.ScimListResponse
+	GetResourceTypeById(id string) (map[string]any, error)
+	GetSchemas() *model.ScimListResponse
+	GetSchemaById(id string) (map[string]any, error)
+}
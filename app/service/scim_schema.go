@@ -0,0 +1,201 @@
+package service
+
+import (
+	"net/http"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+)
+
+// The discovery documents are static, they describe what scimService
+// supports rather than anything configurable.
+
+type scimAttribute struct {
+	name          string
+	attributeType string
+	multiValued   bool
+	required      bool
+	caseExact     bool
+	mutability    string
+	returned      string
+	uniqueness    string
+	subAttributes []scimAttribute
+}
+
+func (a scimAttribute) definition() map[string]any {
+	definition := map[string]any{
+		"name":        a.name,
+		"type":        a.attributeType,
+		"multiValued": a.multiValued,
+		"required":    a.required,
+		"caseExact":   a.caseExact,
+		"mutability":  a.mutability,
+		"returned":    a.returned,
+		"uniqueness":  a.uniqueness,
+	}
+	if a.mutability == "" {
+		definition["mutability"] = "readWrite"
+	}
+	if a.returned == "" {
+		definition["returned"] = "default"
+	}
+	if a.uniqueness == "" {
+		definition["uniqueness"] = "none"
+	}
+	if len(a.subAttributes) > 0 {
+		subAttributes := []map[string]any{}
+		for _, subAttribute := range a.subAttributes {
+			subAttributes = append(subAttributes, subAttribute.definition())
+		}
+		definition["subAttributes"] = subAttributes
+	}
+	return definition
+}
+
+func scimReference(mutability string) []scimAttribute {
+	return []scimAttribute{
+		{name: "value", attributeType: "string", caseExact: true, mutability: mutability},
+		{name: "display", attributeType: "string", mutability: "readOnly"},
+		{name: "$ref", attributeType: "reference", caseExact: true, mutability: "readOnly"},
+	}
+}
+
+var scimUserAttributes = []scimAttribute{
+	{name: "userName", attributeType: "string", required: true, uniqueness: "server"},
+	{name: "externalId", attributeType: "string", caseExact: true},
+	{name: "name", attributeType: "complex", subAttributes: []scimAttribute{
+		{name: "formatted", attributeType: "string", mutability: "readOnly"},
+		{name: "familyName", attributeType: "string"},
+		{name: "givenName", attributeType: "string"},
+	}},
+	{name: "displayName", attributeType: "string"},
+	{name: "active", attributeType: "boolean"},
+	{name: "password", attributeType: "string", mutability: "writeOnly", returned: "never"},
+	{name: "emails", attributeType: "complex", multiValued: true, required: true, subAttributes: []scimAttribute{
+		{name: "value", attributeType: "string", uniqueness: "server"},
+		{name: "type", attributeType: "string"},
+		{name: "primary", attributeType: "boolean"},
+	}},
+	{name: "groups", attributeType: "complex", multiValued: true, mutability: "readOnly", subAttributes: scimReference("readOnly")},
+}
+
+var scimGroupAttributes = []scimAttribute{
+	{name: "displayName", attributeType: "string", required: true, mutability: "immutable", uniqueness: "server"},
+	{name: "members", attributeType: "complex", multiValued: true, subAttributes: scimReference("immutable")},
+}
+
+func (s scimService) GetServiceProviderConfig() map[string]any {
+	return map[string]any{
+		"schemas":          []string{model.ScimSchemaServiceProviderConfig},
+		"documentationUri": "",
+		"patch":            map[string]any{"supported": true},
+		"bulk":             map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]any{"supported": true, "maxResults": scimMaxResults},
+		"changePassword":   map[string]any{"supported": true},
+		"sort":             map[string]any{"supported": false},
+		"etag":             map[string]any{"supported": false},
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "The token issued to the SCIM tenant",
+			"primary":     true,
+		}},
+		"meta": map[string]any{
+			"resourceType": "ServiceProviderConfig",
+			"location":     s.configEnv.Issuer + "/scim/v2/ServiceProviderConfig",
+		},
+	}
+}
+
+func (s scimService) resourceTypes() []map[string]any {
+	return []map[string]any{
+		{
+			"schemas":     []string{model.ScimSchemaResourceType},
+			"id":          "User",
+			"name":        "User",
+			"endpoint":    "/Users",
+			"description": "User account",
+			"schema":      model.ScimSchemaUser,
+			"meta": map[string]any{
+				"resourceType": "ResourceType",
+				"location":     s.location("ResourceTypes", "User"),
+			},
+		},
+		{
+			"schemas":     []string{model.ScimSchemaResourceType},
+			"id":          "Group",
+			"name":        "Group",
+			"endpoint":    "/Groups",
+			"description": "Role, a user is a member of exactly one",
+			"schema":      model.ScimSchemaGroup,
+			"meta": map[string]any{
+				"resourceType": "ResourceType",
+				"location":     s.location("ResourceTypes", "Group"),
+			},
+		},
+	}
+}
+
+func (s scimService) GetResourceTypes() *model.ScimListResponse {
+	resourceTypes := s.resourceTypes()
+	return &model.ScimListResponse{
+		Schemas:      []string{model.ScimSchemaListResponse},
+		TotalResults: len(resourceTypes),
+		StartIndex:   1,
+		ItemsPerPage: len(resourceTypes),
+		Resources:    resourceTypes,
+	}
+}
+
+func (s scimService) GetResourceTypeById(id string) (map[string]any, error) {
+	for _, resourceType := range s.resourceTypes() {
+		if resourceType["id"] == id {
+			return resourceType, nil
+		}
+	}
+	return nil, errs.NewScimError(http.StatusNotFound, "", "resource type not found")
+}
+
+func (s scimService) schemas() []map[string]any {
+	build := func(id string, name string, attributes []scimAttribute) map[string]any {
+		definitions := []map[string]any{}
+		for _, attribute := range attributes {
+			definitions = append(definitions, attribute.definition())
+		}
+		return map[string]any{
+			"schemas":    []string{model.ScimSchemaSchema},
+			"id":         id,
+			"name":       name,
+			"attributes": definitions,
+			"meta": map[string]any{
+				"resourceType": "Schema",
+				"location":     s.location("Schemas", id),
+			},
+		}
+	}
+
+	return []map[string]any{
+		build(model.ScimSchemaUser, "User", scimUserAttributes),
+		build(model.ScimSchemaGroup, "Group", scimGroupAttributes),
+	}
+}
+
+func (s scimService) GetSchemas() *model.ScimListResponse {
+	schemas := s.schemas()
+	return &model.ScimListResponse{
+		Schemas:      []string{model.ScimSchemaListResponse},
+		TotalResults: len(schemas),
+		StartIndex:   1,
+		ItemsPerPage: len(schemas),
+		Resources:    schemas,
+	}
+}
+
+func (s scimService) GetSchemaById(id string) (map[string]any, error) {
+	for _, schema := range s.schemas() {
+		if schema["id"] == id {
+			return schema, nil
+		}
+	}
+	return nil, errs.NewScimError(http.StatusNotFound, "", "schema not found")
+}
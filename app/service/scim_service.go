@@ -0,0 +1,1047 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	zconstant "lazy-auth/app/constant"
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	scimMaxResults  = 100
+	scimDefaultRole = "user"
+	scimAdminRole   = "admin"
+)
+
+var scimUserColumns = map[string]common.ScimColumn{
+	"id":                {Expr: "id::text", CaseExact: true},
+	"externalid":        {Expr: "scim_external_id", CaseExact: true},
+	"username":          {Expr: "username"},
+	"displayname":       {Expr: "display_name"},
+	"name.givenname":    {Expr: "first_name"},
+	"name.familyname":   {Expr: "last_name"},
+	"name.formatted":    {Expr: "CONCAT_WS(' ', first_name, last_name)"},
+	"emails.value":      {Expr: "email"},
+	"emails.type":       {Expr: "'work'"},
+	"emails.primary":    {Expr: "TRUE", Type: common.ScimBool},
+	"active":            {Expr: "(NOT disabled_flag)", Type: common.ScimBool},
+	"groups.value":      {Expr: "role_id", CaseExact: true},
+	"groups.display":    {Expr: "(SELECT name FROM roles WHERE roles.id::text = users.role_id)"},
+	"meta.created":      {Expr: "created_at", Type: common.ScimTime},
+	"meta.lastmodified": {Expr: "updated_at", Type: common.ScimTime},
+}
+
+var scimGroupColumns = map[string]common.ScimColumn{
+	"id":                {Expr: "id::text", CaseExact: true},
+	"displayname":       {Expr: "name"},
+	"meta.created":      {Expr: "created_at", Type: common.ScimTime},
+	"meta.lastmodified": {Expr: "updated_at", Type: common.ScimTime},
+}
+
+type scimService struct {
+	userRepository        repository.UserRepository
+	roleRepository        repository.RoleRepository
+	sessionRepository     repository.SessionRepository
+	logoutService         LogoutService
+	passwordPolicyService PasswordPolicyService
+	passwordHasher        *common.PasswordHasher
+	configEnv             config.ConfigEnv
+}
+
+func NewScimService(
+	userRepository repository.UserRepository,
+	roleRepository repository.RoleRepository,
+	sessionRepository repository.SessionRepository,
+	logoutService LogoutService,
+	passwordPolicyService PasswordPolicyService,
+	passwordHasher *common.PasswordHasher,
+	configEnv config.ConfigEnv,
+) ScimService {
+	return scimService{
+		userRepository:        userRepository,
+		roleRepository:        roleRepository,
+		sessionRepository:     sessionRepository,
+		logoutService:         logoutService,
+		passwordPolicyService: passwordPolicyService,
+		passwordHasher:        passwordHasher,
+		configEnv:             configEnv,
+	}
+}
+
+func scimInvalidValue(detail string) error {
+	return errs.NewScimError(http.StatusBadRequest, "invalidValue", detail)
+}
+
+func scimNotFound(detail string) error {
+	return errs.NewScimError(http.StatusNotFound, "", detail)
+}
+
+func scimUnexpected(err error) error {
+	zlog.Error(err)
+	return errs.NewScimError(http.StatusInternalServerError, "", "unexpected error")
+}
+
+func (s scimService) location(resourceType string, id string) string {
+	return fmt.Sprintf("%s/scim/v2/%s/%s", s.configEnv.Issuer, resourceType, id)
+}
+
+// scimSearch translates the filter and the 1-based page of a list request.
+func scimSearch(
+	query model.QueryScim,
+	columns map[string]common.ScimColumn,
+) (*model.ScimSearch, error) {
+	search := model.ScimSearch{Limit: scimMaxResults}
+
+	if query.Filter != "" {
+		filter, err := common.ParseScimFilter(query.Filter)
+		if err != nil {
+			return nil, errs.NewScimError(http.StatusBadRequest, "invalidFilter", err.Error())
+		}
+		search.Where, search.Args, err = common.ScimFilterToSQL(filter, columns)
+		if err != nil {
+			return nil, errs.NewScimError(http.StatusBadRequest, "invalidFilter", err.Error())
+		}
+	}
+
+	if query.StartIndex > 1 {
+		search.Offset = query.StartIndex - 1
+	}
+	if query.Count != nil {
+		search.Limit = min(max(*query.Count, 0), scimMaxResults)
+	}
+	return &search, nil
+}
+
+func buildScimListResponse(resources any, total int, search *model.ScimSearch, length int) *model.ScimListResponse {
+	return &model.ScimListResponse{
+		Schemas:      []string{model.ScimSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   search.Offset + 1,
+		ItemsPerPage: length,
+		Resources:    resources,
+	}
+}
+
+func scimExcludes(query model.QueryScim, attribute string) bool {
+	for _, excluded := range strings.Split(query.ExcludedAttributes, ",") {
+		if strings.EqualFold(strings.TrimSpace(excluded), attribute) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s scimService) buildScimUser(user repository.User) model.ScimUser {
+	active := !user.DisabledFlag
+	scimUser := model.ScimUser{
+		Schemas:     []string{model.ScimSchemaUser},
+		ID:          user.ID,
+		ExternalID:  user.ScimExternalID,
+		UserName:    user.Username,
+		DisplayName: user.DisplayName,
+		Name: &model.ScimName{
+			Formatted:  strings.TrimSpace(user.FirstName + " " + user.LastName),
+			GivenName:  user.FirstName,
+			FamilyName: user.LastName,
+		},
+		Active: &active,
+		Meta: &model.ScimMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     s.location("Users", user.ID),
+		},
+	}
+
+	if user.Email != "" {
+		scimUser.Emails = []model.ScimMultiValue{{Value: user.Email, Type: "work", Primary: true}}
+	}
+
+	if user.Role.ID != "" {
+		scimUser.Groups = []model.ScimMultiValue{{
+			Value:   user.Role.ID,
+			Display: user.Role.Name,
+			Ref:     s.location("Groups", user.Role.ID),
+		}}
+	}
+	return scimUser
+}
+
+func (s scimService) buildScimGroup(role repository.Role, members []repository.User) model.ScimGroup {
+	return model.ScimGroup{
+		Schemas:     []string{model.ScimSchemaGroup},
+		ID:          role.ID,
+		DisplayName: role.Name,
+		Members: common.Map(members, func(user repository.User) model.ScimMultiValue {
+			return model.ScimMultiValue{
+				Value:   user.ID,
+				Display: user.Username,
+				Ref:     s.location("Users", user.ID),
+			}
+		}),
+		Meta: &model.ScimMeta{
+			ResourceType: "Group",
+			Created:      role.CreatedAt,
+			LastModified: role.UpdatedAt,
+			Location:     s.location("Groups", role.ID),
+		},
+	}
+}
+
+// getTenantUser only finds users provisioned by the tenant, everyone else is
+// invisible to it.
+func (s scimService) getTenantUser(tenant *repository.ScimTenant, id string) (*repository.User, error) {
+	if uuid.Validate(id) != nil {
+		return nil, scimNotFound("user not found")
+	}
+
+	user, err := s.userRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, scimNotFound("user not found")
+		}
+		return nil, scimUnexpected(err)
+	}
+
+	if user.ScimTenantID != tenant.ID {
+		return nil, scimNotFound("user not found")
+	}
+	return user, nil
+}
+
+func (s scimService) GetUsers(
+	tenant *repository.ScimTenant,
+	query model.QueryScim,
+) (*model.ScimListResponse, error) {
+	search, err := scimSearch(query, scimUserColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	users, total, err := s.userRepository.GetManyByScimTenant(tenant.ID, *search)
+	if err != nil {
+		return nil, scimUnexpected(err)
+	}
+
+	resources := common.Map(users, s.buildScimUser)
+	return buildScimListResponse(resources, total, search, len(resources)), nil
+}
+
+func (s scimService) GetUserById(tenant *repository.ScimTenant, id string) (*model.ScimUser, error) {
+	user, err := s.getTenantUser(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+
+	scimUser := s.buildScimUser(*user)
+	return &scimUser, nil
+}
+
+func (s scimService) CreateUser(
+	tenant *repository.ScimTenant,
+	body model.ScimUser,
+) (*model.ScimUser, error) {
+	role, err := s.roleRepository.GetByName(scimDefaultRole)
+	if err != nil {
+		return nil, scimUnexpected(err)
+	}
+
+	user := repository.User{
+		RoleID:       role.ID,
+		Role:         *role,
+		ScimTenantID: tenant.ID,
+	}
+	password := ""
+	err = applyScimUser(&user, body, &password)
+	if err != nil {
+		return nil, err
+	}
+	err = s.setPassword(&user, password)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.userRepository.Create(&user)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errs.NewScimError(http.StatusConflict, "uniqueness", "userName or email already exists")
+		}
+		return nil, scimUnexpected(err)
+	}
+	s.rememberPassword(&user, password)
+
+	scimUser := s.buildScimUser(user)
+	return &scimUser, nil
+}
+
+func (s scimService) ReplaceUser(
+	tenant *repository.ScimTenant,
+	id string,
+	body model.ScimUser,
+) (*model.ScimUser, error) {
+	user, err := s.getTenantUser(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+
+	wasDisabled := user.DisabledFlag
+	password := ""
+	err = applyScimUser(user, body, &password)
+	if err != nil {
+		return nil, err
+	}
+	err = s.setPassword(user, password)
+	if err != nil {
+		return nil, err
+	}
+
+	scimUser, err := s.saveUser(user, wasDisabled)
+	if err != nil {
+		return nil, err
+	}
+	s.rememberPassword(user, password)
+	return scimUser, nil
+}
+
+func (s scimService) PatchUser(
+	tenant *repository.ScimTenant,
+	id string,
+	body model.ScimPatchRequest,
+) (*model.ScimUser, error) {
+	user, err := s.getTenantUser(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+
+	wasDisabled := user.DisabledFlag
+	password := ""
+	for _, operation := range body.Operations {
+		err = patchScimUser(user, operation, &password)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = s.setPassword(user, password)
+	if err != nil {
+		return nil, err
+	}
+
+	scimUser, err := s.saveUser(user, wasDisabled)
+	if err != nil {
+		return nil, err
+	}
+	s.rememberPassword(user, password)
+	return scimUser, nil
+}
+
+// saveUser stores a replaced or patched user and logs them out when the
+// change deactivated them.
+func (s scimService) saveUser(user *repository.User, wasDisabled bool) (*model.ScimUser, error) {
+	if user.Username == "" {
+		return nil, scimInvalidValue("userName is required")
+	}
+	if user.Email == "" {
+		return nil, scimInvalidValue("emails is required")
+	}
+
+	err := s.userRepository.Update(user)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errs.NewScimError(http.StatusConflict, "uniqueness", "userName or email already exists")
+		}
+		return nil, scimUnexpected(err)
+	}
+
+	if user.DisabledFlag && !wasDisabled {
+		err = endUserSessions(s.sessionRepository, s.logoutService, user.ID)
+		if err != nil {
+			zlog.Error(err)
+		}
+	}
+
+	scimUser := s.buildScimUser(*user)
+	return &scimUser, nil
+}
+
+func (s scimService) DeleteUser(tenant *repository.ScimTenant, id string) error {
+	user, err := s.getTenantUser(tenant, id)
+	if err != nil {
+		return err
+	}
+
+	err = endUserSessions(s.sessionRepository, s.logoutService, user.ID)
+	if err != nil {
+		zlog.Error(err)
+	}
+
+	err = s.userRepository.DaleteById(user.ID)
+	if err != nil {
+		return scimUnexpected(err)
+	}
+	return nil
+}
+
+// applyScimUser sets every attribute of a full User resource, as sent by POST
+// and PUT. A new password is returned in password for setPassword.
+func applyScimUser(user *repository.User, body model.ScimUser, password *string) error {
+	user.Username = body.UserName
+	user.DisplayName = body.DisplayName
+	user.ScimExternalID = body.ExternalID
+	user.FirstName = ""
+	user.LastName = ""
+	if body.Name != nil {
+		user.FirstName = body.Name.GivenName
+		user.LastName = body.Name.FamilyName
+	}
+	user.Email = scimPrimaryValue(body.Emails)
+	user.DisabledFlag = body.Active != nil && !*body.Active
+
+	*password = body.Password
+
+	if user.Username == "" {
+		return scimInvalidValue("userName is required")
+	}
+	if user.Email == "" {
+		if !strings.Contains(user.Username, "@") {
+			return scimInvalidValue("emails is required")
+		}
+		user.Email = user.Username
+	}
+	return nil
+}
+
+func scimPrimaryValue(values []model.ScimMultiValue) string {
+	for _, value := range values {
+		if value.Primary {
+			return value.Value
+		}
+	}
+	if len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
+
+// setPassword runs after all other attributes are applied, the policy
+// compares the password to them.
+func (s scimService) setPassword(user *repository.User, password string) error {
+	if password == "" {
+		return nil
+	}
+
+	err := s.passwordPolicyService.CheckPassword(password, user)
+	if err != nil {
+		var appErr errs.AppError
+		if errors.As(err, &appErr) {
+			if violations, ok := appErr.Details.([]model.PasswordPolicyViolation); ok {
+				messages := common.Map(violations, func(violation model.PasswordPolicyViolation) string {
+					return violation.Message
+				})
+				return scimInvalidValue("password " + strings.Join(messages, ", "))
+			}
+		}
+		return scimUnexpected(err)
+	}
+
+	user.PasswordHash, err = s.passwordHasher.Hash(password)
+	if err != nil {
+		return scimUnexpected(err)
+	}
+	user.ChangePasswordAt = time.Now()
+	return nil
+}
+
+// rememberPassword adds a password set by setPassword to the history once
+// the user is saved.
+func (s scimService) rememberPassword(user *repository.User, password string) {
+	if password == "" {
+		return
+	}
+	err := s.passwordPolicyService.RememberPassword(user)
+	if err != nil {
+		zlog.Error(err)
+	}
+}
+
+func patchScimUser(user *repository.User, operation model.ScimPatchOperation, password *string) error {
+	op := strings.ToLower(operation.Op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return scimInvalidValue(fmt.Sprintf("op %s is not supported", operation.Op))
+	}
+
+	if operation.Path == "" {
+		if op == "remove" {
+			return errs.NewScimError(http.StatusBadRequest, "noTarget", "remove needs a path")
+		}
+
+		var values map[string]json.RawMessage
+		err := json.Unmarshal(operation.Value, &values)
+		if err != nil {
+			return scimInvalidValue("value must be an object when path is empty")
+		}
+		for attribute, value := range values {
+			path, err := common.ParseScimPath(attribute)
+			if err != nil {
+				return errs.NewScimError(http.StatusBadRequest, "invalidPath", err.Error())
+			}
+			err = setScimUserAttribute(user, *path, value, password)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	path, err := common.ParseScimPath(operation.Path)
+	if err != nil {
+		return errs.NewScimError(http.StatusBadRequest, "invalidPath", err.Error())
+	}
+
+	if op == "remove" {
+		return removeScimUserAttribute(user, *path)
+	}
+	return setScimUserAttribute(user, *path, operation.Value, password)
+}
+
+// setScimUserAttribute handles add and replace, which are the same for the
+// single-valued attributes we store. Attributes we don't store, like the
+// enterprise extension, are ignored so IdP mappings don't fail provisioning.
+func setScimUserAttribute(
+	user *repository.User,
+	path common.ScimPath,
+	value json.RawMessage,
+	password *string,
+) error {
+	switch path.Attribute {
+	case "username":
+		username, err := scimString(value)
+		if err != nil || username == "" {
+			return scimInvalidValue("userName must be a non-empty string")
+		}
+		user.Username = username
+
+	case "displayname":
+		displayName, err := scimString(value)
+		if err != nil {
+			return scimInvalidValue("displayName must be a string")
+		}
+		user.DisplayName = displayName
+
+	case "externalid":
+		externalID, err := scimString(value)
+		if err != nil {
+			return scimInvalidValue("externalId must be a string")
+		}
+		user.ScimExternalID = externalID
+
+	case "active":
+		active, err := scimBool(value)
+		if err != nil {
+			return scimInvalidValue("active must be a boolean")
+		}
+		user.DisabledFlag = !active
+
+	case "password":
+		newPassword, err := scimString(value)
+		if err != nil || newPassword == "" {
+			return scimInvalidValue("password must be a non-empty string")
+		}
+		*password = newPassword
+
+	case "name":
+		return setScimName(user, path.SubAttribute, value)
+
+	case "emails":
+		email, err := scimEmail(path, value)
+		if err != nil {
+			return err
+		}
+		if email == "" {
+			return scimInvalidValue("emails must have a value")
+		}
+		user.Email = email
+
+	case "groups":
+		return errs.NewScimError(http.StatusBadRequest, "mutability", "groups is read-only, patch the group instead")
+	}
+	return nil
+}
+
+func removeScimUserAttribute(user *repository.User, path common.ScimPath) error {
+	switch path.Attribute {
+	case "displayname":
+		user.DisplayName = ""
+
+	case "externalid":
+		user.ScimExternalID = ""
+
+	case "name":
+		switch path.SubAttribute {
+		case "":
+			user.FirstName = ""
+			user.LastName = ""
+		case "givenname":
+			user.FirstName = ""
+		case "familyname":
+			user.LastName = ""
+		}
+
+	case "username", "emails", "active", "password":
+		return errs.NewScimError(http.StatusBadRequest, "mutability", path.Attribute+" cannot be removed")
+
+	case "groups":
+		return errs.NewScimError(http.StatusBadRequest, "mutability", "groups is read-only, patch the group instead")
+	}
+	return nil
+}
+
+func setScimName(user *repository.User, subAttribute string, value json.RawMessage) error {
+	if subAttribute == "" {
+		var name model.ScimName
+		err := json.Unmarshal(value, &name)
+		if err != nil {
+			return scimInvalidValue("name must be an object")
+		}
+		user.FirstName = name.GivenName
+		user.LastName = name.FamilyName
+		return nil
+	}
+
+	s, err := scimString(value)
+	if err != nil {
+		return scimInvalidValue("name." + subAttribute + " must be a string")
+	}
+	switch subAttribute {
+	case "givenname":
+		user.FirstName = s
+	case "familyname":
+		user.LastName = s
+	}
+	return nil
+}
+
+// scimEmail accepts the email as a whole multi-valued list or as the value
+// of one entry, e.g. emails[type eq "work"].value.
+func scimEmail(path common.ScimPath, value json.RawMessage) (string, error) {
+	if path.SubAttribute != "" {
+		if path.SubAttribute != "value" {
+			return "", nil
+		}
+		email, err := scimString(value)
+		if err != nil {
+			return "", scimInvalidValue("emails value must be a string")
+		}
+		return email, nil
+	}
+
+	var emails []model.ScimMultiValue
+	err := json.Unmarshal(value, &emails)
+	if err != nil {
+		var email model.ScimMultiValue
+		err = json.Unmarshal(value, &email)
+		if err != nil {
+			return "", scimInvalidValue("emails must be a list of values")
+		}
+		emails = []model.ScimMultiValue{email}
+	}
+	return scimPrimaryValue(emails), nil
+}
+
+func scimString(value json.RawMessage) (string, error) {
+	var s string
+	err := json.Unmarshal(value, &s)
+	return s, err
+}
+
+// scimBool also accepts "True" and "False", which Entra ID sends for active.
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if json.Unmarshal(value, &b) == nil {
+		return b, nil
+	}
+
+	s, err := scimString(value)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(s) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, errors.New("not a boolean")
+}
+
+// scimRoleNames are the roles a tenant may use by name, the default role
+// every provisioned user starts with and the ones allowed by an admin.
+func scimRoleNames(tenant *repository.ScimTenant) []string {
+	return append([]string{scimDefaultRole}, tenant.AllowedRoles...)
+}
+
+// getRole only finds the roles the tenant created or may use, everything
+// else is invisible to it.
+func (s scimService) getRole(tenant *repository.ScimTenant, id string) (*repository.Role, error) {
+	if uuid.Validate(id) != nil {
+		return nil, scimNotFound("group not found")
+	}
+
+	role, err := s.roleRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, scimNotFound("group not found")
+		}
+		return nil, scimUnexpected(err)
+	}
+
+	if role.ScimTenantID != tenant.ID && !slices.Contains(scimRoleNames(tenant), role.Name) {
+		return nil, scimNotFound("group not found")
+	}
+	return role, nil
+}
+
+func (s scimService) GetGroups(
+	tenant *repository.ScimTenant,
+	query model.QueryScim,
+) (*model.ScimListResponse, error) {
+	search, err := scimSearch(query, scimGroupColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, total, err := s.roleRepository.GetManyByScim(tenant.ID, scimRoleNames(tenant), *search)
+	if err != nil {
+		return nil, scimUnexpected(err)
+	}
+
+	resources := []model.ScimGroup{}
+	for _, role := range roles {
+		var members []repository.User
+		if !scimExcludes(query, "members") {
+			members, err = s.userRepository.GetByScimTenantAndRoleId(tenant.ID, role.ID)
+			if err != nil {
+				return nil, scimUnexpected(err)
+			}
+		}
+		resources = append(resources, s.buildScimGroup(role, members))
+	}
+	return buildScimListResponse(resources, total, search, len(resources)), nil
+}
+
+func (s scimService) GetGroupById(
+	tenant *repository.ScimTenant,
+	id string,
+	query model.QueryScim,
+) (*model.ScimGroup, error) {
+	role, err := s.getRole(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []repository.User
+	if !scimExcludes(query, "members") {
+		members, err = s.userRepository.GetByScimTenantAndRoleId(tenant.ID, role.ID)
+		if err != nil {
+			return nil, scimUnexpected(err)
+		}
+	}
+
+	group := s.buildScimGroup(*role, members)
+	return &group, nil
+}
+
+func (s scimService) CreateGroup(
+	tenant *repository.ScimTenant,
+	body model.ScimGroup,
+) (*model.ScimGroup, error) {
+	if body.DisplayName == "" {
+		return nil, scimInvalidValue("displayName is required")
+	}
+
+	role, err := s.roleRepository.Create(repository.Role{
+		Name:         body.DisplayName,
+		ScimTenantID: tenant.ID,
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errs.NewScimError(http.StatusConflict, "uniqueness", "group already exists")
+		}
+		return nil, scimUnexpected(err)
+	}
+
+	members, err := s.setMembers(tenant, role, scimMemberIds(body.Members))
+	if err != nil {
+		return nil, err
+	}
+
+	group := s.buildScimGroup(*role, members)
+	return &group, nil
+}
+
+func (s scimService) ReplaceGroup(
+	tenant *repository.ScimTenant,
+	id string,
+	body model.ScimGroup,
+) (*model.ScimGroup, error) {
+	role, err := s.getRole(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkScimGroupName(role, body.DisplayName)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.setMembers(tenant, role, scimMemberIds(body.Members))
+	if err != nil {
+		return nil, err
+	}
+
+	group := s.buildScimGroup(*role, members)
+	return &group, nil
+}
+
+func (s scimService) PatchGroup(
+	tenant *repository.ScimTenant,
+	id string,
+	body model.ScimPatchRequest,
+) (*model.ScimGroup, error) {
+	role, err := s.getRole(tenant, id)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.userRepository.GetByScimTenantAndRoleId(tenant.ID, role.ID)
+	if err != nil {
+		return nil, scimUnexpected(err)
+	}
+	memberIds := common.Map(members, func(user repository.User) string { return user.ID })
+
+	for _, operation := range body.Operations {
+		memberIds, err = patchScimGroup(role, memberIds, operation)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	members, err = s.setMembers(tenant, role, memberIds)
+	if err != nil {
+		return nil, err
+	}
+
+	group := s.buildScimGroup(*role, members)
+	return &group, nil
+}
+
+// DeleteGroup moves the tenant's members back to the default role. Only
+// groups the tenant created can be deleted, and the role itself only goes
+// away once no local user holds it either.
+func (s scimService) DeleteGroup(tenant *repository.ScimTenant, id string) error {
+	role, err := s.getRole(tenant, id)
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(zconstant.GetDefaultRoles(), role.Name) {
+		return errs.NewScimError(http.StatusForbidden, "", "built-in roles cannot be deleted")
+	}
+	if role.ScimTenantID != tenant.ID {
+		return errs.NewScimError(http.StatusForbidden, "", "only groups created by this tenant can be deleted")
+	}
+
+	_, err = s.setMembers(tenant, role, nil)
+	if err != nil {
+		return err
+	}
+
+	total, err := s.userRepository.CountByRoleId(role.ID)
+	if err != nil {
+		return scimUnexpected(err)
+	}
+	if total > 0 {
+		return nil
+	}
+
+	err = s.roleRepository.DeleteById(role.ID)
+	if err != nil {
+		return scimUnexpected(err)
+	}
+	return nil
+}
+
+// checkScimGroupName rejects renames, roles are referenced by name in the
+// rest of the app.
+func checkScimGroupName(role *repository.Role, displayName string) error {
+	if displayName != "" && displayName != role.Name {
+		return errs.NewScimError(http.StatusBadRequest, "mutability", "groups cannot be renamed")
+	}
+	return nil
+}
+
+func scimMemberIds(members []model.ScimMultiValue) []string {
+	return common.Map(members, func(member model.ScimMultiValue) string { return member.Value })
+}
+
+func patchScimGroup(
+	role *repository.Role,
+	memberIds []string,
+	operation model.ScimPatchOperation,
+) ([]string, error) {
+	op := strings.ToLower(operation.Op)
+	if op != "add" && op != "replace" && op != "remove" {
+		return nil, scimInvalidValue(fmt.Sprintf("op %s is not supported", operation.Op))
+	}
+
+	if operation.Path == "" {
+		if op == "remove" {
+			return nil, errs.NewScimError(http.StatusBadRequest, "noTarget", "remove needs a path")
+		}
+
+		var group model.ScimGroup
+		err := json.Unmarshal(operation.Value, &group)
+		if err != nil {
+			return nil, scimInvalidValue("value must be an object when path is empty")
+		}
+		err = checkScimGroupName(role, group.DisplayName)
+		if err != nil {
+			return nil, err
+		}
+		if group.Members == nil {
+			return memberIds, nil
+		}
+		if op == "replace" {
+			return scimMemberIds(group.Members), nil
+		}
+		return append(memberIds, scimMemberIds(group.Members)...), nil
+	}
+
+	path, err := common.ParseScimPath(operation.Path)
+	if err != nil {
+		return nil, errs.NewScimError(http.StatusBadRequest, "invalidPath", err.Error())
+	}
+
+	switch path.Attribute {
+	case "displayname":
+		if op == "remove" {
+			return nil, errs.NewScimError(http.StatusBadRequest, "mutability", "displayName cannot be removed")
+		}
+		displayName, err := scimString(operation.Value)
+		if err != nil {
+			return nil, scimInvalidValue("displayName must be a string")
+		}
+		return memberIds, checkScimGroupName(role, displayName)
+
+	case "members":
+		var values []string
+		if path.Filter != nil {
+			values = common.ScimFilterValues(path.Filter, "value")
+			if len(values) == 0 {
+				return nil, errs.NewScimError(http.StatusBadRequest, "invalidFilter", "members filter must match value with eq")
+			}
+		} else if len(operation.Value) > 0 && string(operation.Value) != "null" {
+			var members []model.ScimMultiValue
+			err := json.Unmarshal(operation.Value, &members)
+			if err != nil {
+				return nil, scimInvalidValue("members must be a list of values")
+			}
+			values = scimMemberIds(members)
+		}
+
+		switch op {
+		case "add":
+			return append(memberIds, values...), nil
+		case "replace":
+			return values, nil
+		}
+		// Removing without a value or filter empties the group.
+		if values == nil {
+			return nil, nil
+		}
+		return slices.DeleteFunc(memberIds, func(id string) bool {
+			return slices.Contains(values, id)
+		}), nil
+	}
+	return memberIds, nil
+}
+
+// setMembers makes memberIds the tenant's members of a role. Users who leave
+// go back to the default role, since a user always holds exactly one role.
+func (s scimService) setMembers(
+	tenant *repository.ScimTenant,
+	role *repository.Role,
+	memberIds []string,
+) ([]repository.User, error) {
+	slices.Sort(memberIds)
+	memberIds = slices.Compact(memberIds)
+
+	if role.Name == scimAdminRole && len(memberIds) > 0 {
+		return nil, errs.NewScimError(http.StatusForbidden, "", "admin membership cannot be provisioned")
+	}
+
+	var members []repository.User
+	if len(memberIds) > 0 {
+		if slices.ContainsFunc(memberIds, func(id string) bool { return uuid.Validate(id) != nil }) {
+			return nil, scimInvalidValue("members must reference users of this tenant")
+		}
+		var err error
+		members, err = s.userRepository.GetByScimTenantAndIds(tenant.ID, memberIds)
+		if err != nil {
+			return nil, scimUnexpected(err)
+		}
+		if len(members) != len(memberIds) {
+			return nil, scimInvalidValue("members must reference users of this tenant")
+		}
+	}
+
+	current, err := s.userRepository.GetByScimTenantAndRoleId(tenant.ID, role.ID)
+	if err != nil {
+		return nil, scimUnexpected(err)
+	}
+
+	var defaultRole *repository.Role
+	for _, user := range current {
+		if slices.Contains(memberIds, user.ID) {
+			continue
+		}
+		if defaultRole == nil {
+			defaultRole, err = s.roleRepository.GetByName(scimDefaultRole)
+			if err != nil {
+				return nil, scimUnexpected(err)
+			}
+		}
+		user.RoleID = defaultRole.ID
+		user.Role = *defaultRole
+		err = s.userRepository.Update(&user)
+		if err != nil {
+			return nil, scimUnexpected(err)
+		}
+	}
+
+	for i := range members {
+		if members[i].RoleID == role.ID {
+			continue
+		}
+		members[i].RoleID = role.ID
+		members[i].Role = *role
+		err = s.userRepository.Update(&members[i])
+		if err != nil {
+			return nil, scimUnexpected(err)
+		}
+	}
+	return members, nil
+}
@@ -0,0 +1,15 @@
+package service
+
+import "lazy-auth/app/model"
+
+type ScimTenantService interface {
+	CreateScimTenant(body model.CreateScimTenantRequest) (*model.ScimTenantTokenResponse, error)
+	GetScimTenants(query model.QueryScimTenant) (*model.ScimTenantPageResponse, error)
+	GetScimTenantById(id string) (*model.ScimTenantResponse, error)
+	UpdateScimTenantById(
+		id string,
+		body model.UpdateScimTenantRequest,
+	) (*model.ScimTenantResponse, error)
+	RotateToken(id string) (*model.ScimTenantTokenResponse, error)
+	DeleteScimTenantById(id string) error
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"errors"
+	"slices"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+
+	"gorm.io/gorm"
+)
+
+type scimTenantService struct {
+	scimTenantRepository repository.ScimTenantRepository
+}
+
+func NewScimTenantService(scimTenantRepository repository.ScimTenantRepository) ScimTenantService {
+	return scimTenantService{scimTenantRepository: scimTenantRepository}
+}
+
+func buildScimTenantResponse(scimTenant repository.ScimTenant) model.ScimTenantResponse {
+	return model.ScimTenantResponse{
+		ID:           scimTenant.ID,
+		Name:         scimTenant.Name,
+		Description:  scimTenant.Description,
+		AllowedRoles: scimTenant.AllowedRoles,
+		DisabledFlag: scimTenant.DisabledFlag,
+		LastAccessAt: scimTenant.LastAccessAt,
+	}
+}
+
+// generateScimToken returns a bearer token and the hash that is stored, the
+// token itself is only shown once.
+func generateScimToken() (string, string, error) {
+	secret, err := common.GenerateSecret(32)
+	if err != nil {
+		return "", "", err
+	}
+	token := "scim_" + secret
+	return token, common.HashToken(token), nil
+}
+
+// checkAllowedRoles keeps the admin role out of reach of SCIM tenants.
+func checkAllowedRoles(allowedRoles []string) error {
+	if slices.Contains(allowedRoles, scimAdminRole) {
+		return errs.NewValidationError("the admin role cannot be allowed for SCIM tenants")
+	}
+	return nil
+}
+
+func (s scimTenantService) CreateScimTenant(
+	scimTenantReq model.CreateScimTenantRequest,
+) (*model.ScimTenantTokenResponse, error) {
+	err := checkAllowedRoles(scimTenantReq.AllowedRoles)
+	if err != nil {
+		return nil, err
+	}
+
+	token, tokenHash, err := generateScimToken()
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	scimTenant := repository.ScimTenant{
+		Name:         scimTenantReq.Name,
+		Description:  scimTenantReq.Description,
+		TokenHash:    tokenHash,
+		AllowedRoles: scimTenantReq.AllowedRoles,
+	}
+
+	err = s.scimTenantRepository.Create(&scimTenant)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errs.NewUnprocessableEntity("SCIM tenant name duplicated")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return &model.ScimTenantTokenResponse{
+		ScimTenantResponse: buildScimTenantResponse(scimTenant),
+		Token:              token,
+	}, nil
+}
+
+func (s scimTenantService) GetScimTenants(
+	query model.QueryScimTenant,
+) (*model.ScimTenantPageResponse, error) {
+	scimTenants, total, err := s.scimTenantRepository.GetMany(query)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	scimTenantsResponse := common.Map(scimTenants, buildScimTenantResponse)
+	meta := common.BuildMetaPagination(&total, query.Limit, query.Offset)
+
+	return &model.ScimTenantPageResponse{Meta: meta, Data: scimTenantsResponse}, nil
+}
+
+func (s scimTenantService) GetScimTenantById(id string) (*model.ScimTenantResponse, error) {
+	scimTenant, err := s.scimTenantRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("SCIM tenant not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	scimTenantResponse := buildScimTenantResponse(*scimTenant)
+	return &scimTenantResponse, nil
+}
+
+func (s scimTenantService) UpdateScimTenantById(
+	id string,
+	scimTenantReq model.UpdateScimTenantRequest,
+) (*model.ScimTenantResponse, error) {
+	scimTenant, err := s.scimTenantRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("SCIM tenant not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	if scimTenantReq.Description != nil {
+		scimTenant.Description = *scimTenantReq.Description
+	}
+
+	if scimTenantReq.AllowedRoles != nil {
+		err = checkAllowedRoles(*scimTenantReq.AllowedRoles)
+		if err != nil {
+			return nil, err
+		}
+		scimTenant.AllowedRoles = *scimTenantReq.AllowedRoles
+	}
+
+	if scimTenantReq.DisabledFlag != nil {
+		scimTenant.DisabledFlag = *scimTenantReq.DisabledFlag
+	}
+
+	err = s.scimTenantRepository.Update(scimTenant)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	scimTenantResponse := buildScimTenantResponse(*scimTenant)
+	return &scimTenantResponse, nil
+}
+
+func (s scimTenantService) RotateToken(id string) (*model.ScimTenantTokenResponse, error) {
+	scimTenant, err := s.scimTenantRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("SCIM tenant not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	token, tokenHash, err := generateScimToken()
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	scimTenant.TokenHash = tokenHash
+
+	err = s.scimTenantRepository.Update(scimTenant)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return &model.ScimTenantTokenResponse{
+		ScimTenantResponse: buildScimTenantResponse(*scimTenant),
+		Token:              token,
+	}, nil
+}
+
+func (s scimTenantService) DeleteScimTenantById(id string) error {
+	_, err := s.scimTenantRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewNotFoundError("SCIM tenant not found")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	err = s.scimTenantRepository.DeleteById(id)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
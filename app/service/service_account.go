@@ -0,0 +1,18 @@
+package service
+
+import "lazy-auth/app/model"
+
+type ServiceAccountService interface {
+	CreateServiceAccount(
+		body model.CreateServiceAccountRequest,
+	) (*model.ServiceAccountSecretResponse, error)
+	GetServiceAccounts(query model.QueryServiceAccount) (*model.ServiceAccountPageResponse, error)
+	GetServiceAccountById(id string) (*model.ServiceAccountResponse, error)
+	UpdateServiceAccountById(
+		id string,
+		body model.UpdateServiceAccountRequest,
+	) (*model.ServiceAccountResponse, error)
+	RotateSecret(id string) (*model.ServiceAccountSecretResponse, error)
+	DeleteServiceAccountById(id string) error
+	IssueToken(body model.ServiceAccountTokenRequest) (*model.AccessTokenResponse, error)
+}
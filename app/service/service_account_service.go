@@ -0,0 +1,324 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const clientAssertionTypeJwtBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+type serviceAccountService struct {
+	serviceAccountRepository  repository.ServiceAccountRepository
+	roleRepository            repository.RoleRepository
+	clientAssertionRepository repository.ClientAssertionRepository
+	configEnv                 config.ConfigEnv
+}
+
+func NewServiceAccountService(
+	serviceAccountRepository repository.ServiceAccountRepository,
+	roleRepository repository.RoleRepository,
+	clientAssertionRepository repository.ClientAssertionRepository,
+	configEnv config.ConfigEnv,
+) ServiceAccountService {
+	return serviceAccountService{
+		serviceAccountRepository:  serviceAccountRepository,
+		roleRepository:            roleRepository,
+		clientAssertionRepository: clientAssertionRepository,
+		configEnv:                 configEnv,
+	}
+}
+
+func buildServiceAccountResponse(serviceAccount repository.ServiceAccount) model.ServiceAccountResponse {
+	return model.ServiceAccountResponse{
+		ID:           serviceAccount.ID,
+		Name:         serviceAccount.Name,
+		Description:  serviceAccount.Description,
+		Role:         serviceAccount.Role.Name,
+		ClientID:     serviceAccount.ClientID,
+		PublicKey:    serviceAccount.PublicKey,
+		DisabledFlag: serviceAccount.DisabledFlag,
+		LastAccessAt: serviceAccount.LastAccessAt,
+	}
+}
+
+func (s serviceAccountService) CreateServiceAccount(
+	serviceAccountReq model.CreateServiceAccountRequest,
+) (*model.ServiceAccountSecretResponse, error) {
+	role, err := s.roleRepository.GetByName(serviceAccountReq.Role)
+	if err != nil {
+		return nil, errs.NewNotFoundError(fmt.Sprintf("Role %s not found", serviceAccountReq.Role))
+	}
+
+	if serviceAccountReq.PublicKey != "" && !common.ValidatePublicKey(serviceAccountReq.PublicKey) {
+		return nil, errs.NewValidationError("public key must be a PEM encoded RSA or EC key")
+	}
+
+	clientSecret, err := common.GenerateSecret(32)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	clientSecretHash, _ := common.HashSecret(clientSecret)
+
+	serviceAccount := repository.ServiceAccount{
+		RoleID:           role.ID,
+		Role:             *role,
+		Name:             serviceAccountReq.Name,
+		Description:      serviceAccountReq.Description,
+		ClientID:         fmt.Sprintf("sa_%s", uuid.NewString()),
+		ClientSecretHash: clientSecretHash,
+		PublicKey:        serviceAccountReq.PublicKey,
+	}
+
+	err = s.serviceAccountRepository.Create(&serviceAccount)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errs.NewUnprocessableEntity("Service account name duplicated")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return &model.ServiceAccountSecretResponse{
+		ServiceAccountResponse: buildServiceAccountResponse(serviceAccount),
+		ClientSecret:           clientSecret,
+	}, nil
+}
+
+func (s serviceAccountService) GetServiceAccounts(
+	query model.QueryServiceAccount,
+) (*model.ServiceAccountPageResponse, error) {
+	serviceAccounts, total, err := s.serviceAccountRepository.GetMany(query)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	serviceAccountsResponse := common.Map(serviceAccounts, buildServiceAccountResponse)
+	meta := common.BuildMetaPagination(&total, query.Limit, query.Offset)
+
+	return &model.ServiceAccountPageResponse{Meta: meta, Data: serviceAccountsResponse}, nil
+}
+
+func (s serviceAccountService) GetServiceAccountById(
+	id string,
+) (*model.ServiceAccountResponse, error) {
+	serviceAccount, err := s.serviceAccountRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("service account not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	serviceAccountResponse := buildServiceAccountResponse(*serviceAccount)
+	return &serviceAccountResponse, nil
+}
+
+func (s serviceAccountService) UpdateServiceAccountById(
+	id string,
+	serviceAccountReq model.UpdateServiceAccountRequest,
+) (*model.ServiceAccountResponse, error) {
+	serviceAccount, err := s.serviceAccountRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("service account not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	if serviceAccountReq.Description != nil {
+		serviceAccount.Description = *serviceAccountReq.Description
+	}
+
+	if serviceAccountReq.Role != nil {
+		role, err := s.roleRepository.GetByName(*serviceAccountReq.Role)
+		if err != nil {
+			return nil, errs.NewNotFoundError(fmt.Sprintf("Role %s not found", *serviceAccountReq.Role))
+		}
+		serviceAccount.RoleID = role.ID
+		serviceAccount.Role = *role
+	}
+
+	if serviceAccountReq.PublicKey != nil {
+		if *serviceAccountReq.PublicKey != "" && !common.ValidatePublicKey(*serviceAccountReq.PublicKey) {
+			return nil, errs.NewValidationError("public key must be a PEM encoded RSA or EC key")
+		}
+		serviceAccount.PublicKey = *serviceAccountReq.PublicKey
+	}
+
+	if serviceAccountReq.DisabledFlag != nil {
+		serviceAccount.DisabledFlag = *serviceAccountReq.DisabledFlag
+	}
+
+	err = s.serviceAccountRepository.Update(serviceAccount)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	serviceAccountResponse := buildServiceAccountResponse(*serviceAccount)
+	return &serviceAccountResponse, nil
+}
+
+func (s serviceAccountService) RotateSecret(id string) (*model.ServiceAccountSecretResponse, error) {
+	serviceAccount, err := s.serviceAccountRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewNotFoundError("service account not found")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	clientSecret, err := common.GenerateSecret(32)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	serviceAccount.ClientSecretHash, _ = common.HashSecret(clientSecret)
+
+	err = s.serviceAccountRepository.Update(serviceAccount)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return &model.ServiceAccountSecretResponse{
+		ServiceAccountResponse: buildServiceAccountResponse(*serviceAccount),
+		ClientSecret:           clientSecret,
+	}, nil
+}
+
+func (s serviceAccountService) DeleteServiceAccountById(id string) error {
+	_, err := s.serviceAccountRepository.GetById(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewNotFoundError("service account not found")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	err = s.serviceAccountRepository.DeleteById(id)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
+
+func (s serviceAccountService) IssueToken(
+	tokenReq model.ServiceAccountTokenRequest,
+) (*model.AccessTokenResponse, error) {
+	serviceAccount, err := s.serviceAccountRepository.GetByClientId(tokenReq.ClientID)
+	if err != nil {
+		return nil, errs.NewUnauthorizedError("client credentials are invalid")
+	}
+
+	if serviceAccount.DisabledFlag {
+		return nil, errs.NewUnauthorizedError("client credentials are invalid")
+	}
+
+	switch {
+	case tokenReq.ClientAssertion != "":
+		if tokenReq.ClientAssertionType != clientAssertionTypeJwtBearer {
+			return nil, errs.NewValidationError("client assertion type is not supported")
+		}
+		err = s.checkAssertion(serviceAccount, tokenReq.ClientAssertion)
+		if err != nil {
+			return nil, err
+		}
+	case tokenReq.ClientSecret != "":
+		ok := common.CheckSecretHash(tokenReq.ClientSecret, serviceAccount.ClientSecretHash)
+		if !ok {
+			return nil, errs.NewUnauthorizedError("client credentials are invalid")
+		}
+	default:
+		return nil, errs.NewValidationError("client secret or client assertion is required")
+	}
+
+	serviceAccount.LastAccessAt = time.Now()
+	err = s.serviceAccountRepository.Update(serviceAccount)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	tokenExpiresAt := common.AddTimeByDuration(s.configEnv.JwtTokenExpiresIn)
+	token := common.GenerateServiceAccountToken(
+		serviceAccount.ID,
+		s.configEnv.JwtTokenSecret,
+		tokenExpiresAt,
+	)
+
+	return &model.AccessTokenResponse{
+		AccessToken:    token,
+		TokenType:      "Bearer",
+		TokenExpiresAt: tokenExpiresAt,
+	}, nil
+}
+
+// checkAssertion accepts a private_key_jwt style assertion whose issuer and
+// subject are the client id and whose audience is this server. Each jti is
+// recorded until the assertion expires so a captured assertion cannot be
+// replayed.
+func (s serviceAccountService) checkAssertion(
+	serviceAccount *repository.ServiceAccount,
+	assertion string,
+) error {
+	invalidErr := errs.NewUnauthorizedError("client credentials are invalid")
+	if serviceAccount.PublicKey == "" {
+		return invalidErr
+	}
+
+	claims, ok := common.ValidateAssertion(assertion, serviceAccount.PublicKey)
+	if !ok {
+		return invalidErr
+	}
+
+	if claims.Issuer != serviceAccount.ClientID || claims.Subject != serviceAccount.ClientID {
+		return invalidErr
+	}
+
+	audience := fmt.Sprintf("%s/api/auth/service-accounts/token", s.configEnv.Issuer)
+	if claims.Audience != s.configEnv.Issuer && claims.Audience != audience {
+		return invalidErr
+	}
+
+	// Assertions are meant to be short-lived, reject anything valid for too long.
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if !expiresAt.Before(time.Now().Add(10 * time.Minute)) {
+		return invalidErr
+	}
+
+	if claims.Id == "" {
+		return invalidErr
+	}
+	err := s.clientAssertionRepository.Create(&repository.ClientAssertion{
+		ClientID:  serviceAccount.ClientID,
+		JTI:       claims.Id,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return errs.NewUnauthorizedError("client assertion was already used")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
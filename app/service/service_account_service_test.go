@@ -0,0 +1,255 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/common"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+const testServiceAccountAudience = testIssuer + "/api/auth/service-accounts/token"
+
+func newTestECKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+type serviceAccountTestEnv struct {
+	service    ServiceAccountService
+	privateKey *ecdsa.PrivateKey
+	otherKey   *ecdsa.PrivateKey
+	publicKey  string
+}
+
+// newServiceAccountTestEnv registers "robot" and "drone", both with the same
+// key pair so jti values can be compared across clients.
+func newServiceAccountTestEnv(t *testing.T) *serviceAccountTestEnv {
+	t.Helper()
+
+	privateKey, publicKey := newTestECKey(t)
+	otherKey, _ := newTestECKey(t)
+	secretHash, err := common.HashSecret("robot-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repos := newTestRepositories()
+	repos.serviceAccounts.serviceAccounts["sa-1"] = repository.ServiceAccount{
+		ID:               "sa-1",
+		ClientID:         "robot",
+		ClientSecretHash: secretHash,
+		PublicKey:        publicKey,
+	}
+	repos.serviceAccounts.serviceAccounts["sa-2"] = repository.ServiceAccount{ID: "sa-2", ClientID: "drone", PublicKey: publicKey}
+	repos.serviceAccounts.serviceAccounts["sa-3"] = repository.ServiceAccount{
+		ID:           "sa-3",
+		ClientID:     "retired",
+		PublicKey:    publicKey,
+		DisabledFlag: true,
+	}
+
+	return &serviceAccountTestEnv{
+		service: NewServiceAccountService(
+			repos.serviceAccounts,
+			repos.roles,
+			repos.clientAssertions,
+			newTestConfigEnv(),
+		),
+		privateKey: privateKey,
+		otherKey:   otherKey,
+		publicKey:  publicKey,
+	}
+}
+
+func (env *serviceAccountTestEnv) assertion(t *testing.T, claims jwt.StandardClaims) string {
+	t.Helper()
+
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(env.privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return assertion
+}
+
+func assertionClaims(clientId string) jwt.StandardClaims {
+	return jwt.StandardClaims{
+		Issuer:    clientId,
+		Subject:   clientId,
+		Audience:  testServiceAccountAudience,
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		Id:        uuid.NewString(),
+	}
+}
+
+func assertionRequest(clientId string, assertion string) model.ServiceAccountTokenRequest {
+	return model.ServiceAccountTokenRequest{
+		ClientID:            clientId,
+		ClientAssertionType: clientAssertionTypeJwtBearer,
+		ClientAssertion:     assertion,
+	}
+}
+
+func TestIssueTokenWithClientAssertion(t *testing.T) {
+	env := newServiceAccountTestEnv(t)
+
+	tokenResp, err := env.service.IssueToken(assertionRequest("robot", env.assertion(t, assertionClaims("robot"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, ok := common.ValidateToken(tokenResp.AccessToken, testJwtTokenSecret)
+	if !ok || claims.SubjectType != common.SubjectTypeServiceAccount || claims.Subject != "sa-1" {
+		t.Errorf("access token claims = %+v", claims)
+	}
+
+	// The issuer alone is accepted as audience too.
+	claims2 := assertionClaims("robot")
+	claims2.Audience = testIssuer
+	_, err = env.service.IssueToken(assertionRequest("robot", env.assertion(t, claims2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIssueTokenRejectsReplayedAssertion(t *testing.T) {
+	env := newServiceAccountTestEnv(t)
+	claims := assertionClaims("robot")
+	assertion := env.assertion(t, claims)
+
+	_, err := env.service.IssueToken(assertionRequest("robot", assertion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.service.IssueToken(assertionRequest("robot", assertion))
+	assertAppError(t, err, http.StatusUnauthorized, "client assertion was already used")
+
+	// A new assertion reusing the jti is a replay as well.
+	claims.ExpiresAt = time.Now().Add(2 * time.Minute).Unix()
+	_, err = env.service.IssueToken(assertionRequest("robot", env.assertion(t, claims)))
+	assertAppError(t, err, http.StatusUnauthorized, "client assertion was already used")
+
+	// jti values only need to be unique per client.
+	droneClaims := assertionClaims("drone")
+	droneClaims.Id = claims.Id
+	_, err = env.service.IssueToken(assertionRequest("drone", env.assertion(t, droneClaims)))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIssueTokenReplayedConcurrently(t *testing.T) {
+	env := newServiceAccountTestEnv(t)
+	assertion := env.assertion(t, assertionClaims("robot"))
+
+	const attempts = 10
+	var wg sync.WaitGroup
+	results := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := env.service.IssueToken(assertionRequest("robot", assertion))
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assertAppError(t, err, http.StatusUnauthorized, "client assertion was already used")
+	}
+	if succeeded != 1 {
+		t.Errorf("%d assertions were accepted, want 1", succeeded)
+	}
+}
+
+func TestIssueTokenRejectsInvalidAssertion(t *testing.T) {
+	env := newServiceAccountTestEnv(t)
+
+	sign := func(change func(*jwt.StandardClaims)) string {
+		claims := assertionClaims("robot")
+		change(&claims)
+		return env.assertion(t, claims)
+	}
+
+	otherKeyAssertion, err := jwt.NewWithClaims(jwt.SigningMethodES256, assertionClaims("robot")).
+		SignedString(env.otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	symmetricAssertion, err := jwt.NewWithClaims(jwt.SigningMethodHS256, assertionClaims("robot")).
+		SignedString([]byte(env.publicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		clientId  string
+		assertion string
+	}{
+		{"no jti", "robot", sign(func(c *jwt.StandardClaims) { c.Id = "" })},
+		{"no expiry", "robot", sign(func(c *jwt.StandardClaims) { c.ExpiresAt = 0 })},
+		{"expired", "robot", sign(func(c *jwt.StandardClaims) { c.ExpiresAt = time.Now().Add(-time.Minute).Unix() })},
+		{"valid for too long", "robot", sign(func(c *jwt.StandardClaims) { c.ExpiresAt = time.Now().Add(time.Hour).Unix() })},
+		{"other audience", "robot", sign(func(c *jwt.StandardClaims) { c.Audience = "https://other.example.com" })},
+		{"other issuer", "robot", sign(func(c *jwt.StandardClaims) { c.Issuer = "drone" })},
+		{"other subject", "robot", sign(func(c *jwt.StandardClaims) { c.Subject = "drone" })},
+		{"assertion of another client", "drone", sign(func(c *jwt.StandardClaims) {})},
+		{"signed with another key", "robot", otherKeyAssertion},
+		{"signed with the public key as secret", "robot", symmetricAssertion},
+		{"disabled client", "retired", sign(func(c *jwt.StandardClaims) { c.Issuer, c.Subject = "retired", "retired" })},
+		{"unknown client", "nobody", sign(func(c *jwt.StandardClaims) { c.Issuer, c.Subject = "nobody", "nobody" })},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := env.service.IssueToken(assertionRequest(test.clientId, test.assertion))
+			assertAppError(t, err, http.StatusUnauthorized, "client credentials are invalid")
+		})
+	}
+
+	tokenReq := assertionRequest("robot", sign(func(c *jwt.StandardClaims) {}))
+	tokenReq.ClientAssertionType = "urn:example:other"
+	_, err = env.service.IssueToken(tokenReq)
+	assertAppError(t, err, http.StatusBadRequest, "client assertion type is not supported")
+}
+
+func TestIssueTokenWithClientSecret(t *testing.T) {
+	env := newServiceAccountTestEnv(t)
+
+	_, err := env.service.IssueToken(model.ServiceAccountTokenRequest{ClientID: "robot", ClientSecret: "robot-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = env.service.IssueToken(model.ServiceAccountTokenRequest{ClientID: "robot", ClientSecret: "wrong"})
+	assertAppError(t, err, http.StatusUnauthorized, "client credentials are invalid")
+
+	_, err = env.service.IssueToken(model.ServiceAccountTokenRequest{ClientID: "robot"})
+	assertAppError(t, err, http.StatusBadRequest, "client secret or client assertion is required")
+}
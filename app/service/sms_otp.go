@@ -0,0 +1,11 @@
+package service
+
+import "lazy-auth/app/model"
+
+type SmsOtpService interface {
+	RequestLoginCode(body model.SmsOtpRequest) error
+	VerifyLoginCode(body model.VerifySmsOtpRequest) (*model.TokenResponse, error)
+	UpdatePhone(userId string, body model.UpdatePhoneRequest) error
+	VerifyPhone(userId string, body model.VerifyPhoneRequest) error
+	RemovePhone(userId string) error
+}
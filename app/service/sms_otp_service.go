@@ -0,0 +1,297 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"lazy-auth/app/errs"
+	"lazy-auth/app/model"
+	"lazy-auth/app/repository"
+	"lazy-auth/app/zlog"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"gorm.io/gorm"
+)
+
+const (
+	smsOtpPurposeLogin  = "login"
+	smsOtpPurposeVerify = "verify"
+)
+
+type smsOtpService struct {
+	smsOtpRepository  repository.SmsOtpRepository
+	userRepository    repository.UserRepository
+	sessionRepository repository.SessionRepository
+	emailOtpService   EmailOtpService
+	smsSender         SMSSender
+	configEnv         config.ConfigEnv
+}
+
+func NewSmsOtpService(
+	smsOtpRepository repository.SmsOtpRepository,
+	userRepository repository.UserRepository,
+	sessionRepository repository.SessionRepository,
+	emailOtpService EmailOtpService,
+	smsSender SMSSender,
+	configEnv config.ConfigEnv,
+) SmsOtpService {
+	return smsOtpService{
+		smsOtpRepository:  smsOtpRepository,
+		userRepository:    userRepository,
+		sessionRepository: sessionRepository,
+		emailOtpService:   emailOtpService,
+		smsSender:         smsSender,
+		configEnv:         configEnv,
+	}
+}
+
+// RequestLoginCode only texts verified numbers and answers the same way
+// whether or not a code was sent.
+func (s smsOtpService) RequestLoginCode(smsOtpReq model.SmsOtpRequest) error {
+	phoneNumber, err := common.NormalizePhoneNumber(smsOtpReq.PhoneNumber, s.configEnv.SmsDefaultCountryCode)
+	if err != nil {
+		return errs.NewValidationError(err.Error())
+	}
+
+	user, err := s.userRepository.GetByPhoneNumber(phoneNumber)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	if !user.PhoneVerifyFlag || user.DisabledFlag {
+		return nil
+	}
+
+	err = s.sendCode(user.ID, smsOtpPurposeLogin, phoneNumber)
+	if err != nil {
+		if errors.Is(err, errOtpRateLimited) {
+			return nil
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
+
+func (s smsOtpService) VerifyLoginCode(
+	verifyReq model.VerifySmsOtpRequest,
+) (*model.TokenResponse, error) {
+	phoneNumber, err := common.NormalizePhoneNumber(verifyReq.PhoneNumber, s.configEnv.SmsDefaultCountryCode)
+	if err != nil {
+		return nil, errs.NewUnauthorizedError("code is invalid")
+	}
+
+	user, err := s.userRepository.GetByPhoneNumber(phoneNumber)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewUnauthorizedError("code is invalid")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	smsOtp, err := s.smsOtpRepository.GetLatest(user.ID, smsOtpPurposeLogin)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errs.NewUnauthorizedError("code is invalid")
+		}
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	err = s.redeem(smsOtp, verifyReq.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	// The code was sent to the number on file, a changed number needs a new one.
+	if smsOtp.PhoneNumber != user.PhoneNumber || !user.PhoneVerifyFlag {
+		return nil, errs.NewUnauthorizedError("code is invalid")
+	}
+
+	user.LastAccessAt = time.Now()
+	err = s.userRepository.Update(user)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+
+	return completeLogin(s.emailOtpService, s.sessionRepository, s.configEnv, user)
+}
+
+// UpdatePhone texts a code to the new number, it replaces the current one
+// once VerifyPhone confirms the code.
+func (s smsOtpService) UpdatePhone(userId string, updateReq model.UpdatePhoneRequest) error {
+	phoneNumber, err := common.NormalizePhoneNumber(updateReq.PhoneNumber, s.configEnv.SmsDefaultCountryCode)
+	if err != nil {
+		return errs.NewValidationError(err.Error())
+	}
+
+	user, err := s.userRepository.GetById(userId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewNotFoundError("user not found")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	owner, err := s.userRepository.GetByPhoneNumber(phoneNumber)
+	if err == nil && owner.ID != user.ID {
+		return errs.NewUnprocessableEntity("Phone number duplicated")
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	err = s.sendCode(user.ID, smsOtpPurposeVerify, phoneNumber)
+	if err != nil {
+		if errors.Is(err, errOtpRateLimited) {
+			return errs.NewTooManyRequestsError("too many codes requested, try again later")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
+
+func (s smsOtpService) VerifyPhone(userId string, verifyReq model.VerifyPhoneRequest) error {
+	user, err := s.userRepository.GetById(userId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewNotFoundError("user not found")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	smsOtp, err := s.smsOtpRepository.GetLatest(user.ID, smsOtpPurposeVerify)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewUnauthorizedError("code is invalid")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	err = s.redeem(smsOtp, verifyReq.Code)
+	if err != nil {
+		return err
+	}
+
+	user.PhoneNumber = smsOtp.PhoneNumber
+	user.PhoneVerifyFlag = true
+	err = s.userRepository.Update(user)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return errs.NewUnprocessableEntity("Phone number duplicated")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
+
+func (s smsOtpService) RemovePhone(userId string) error {
+	user, err := s.userRepository.GetById(userId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewNotFoundError("user not found")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	user.PhoneNumber = ""
+	user.PhoneVerifyFlag = false
+	err = s.userRepository.Update(user)
+	if err != nil {
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
+
+// sendCode stores a new code for the user and texts it to phoneNumber, at
+// most SmsOtpMaxPerHour codes are sent per user.
+func (s smsOtpService) sendCode(userId string, purpose string, phoneNumber string) error {
+	since := time.Now().Add(-time.Hour)
+	err := s.smsOtpRepository.DeleteByUserIdBefore(userId, since)
+	if err != nil {
+		return err
+	}
+
+	total, err := s.smsOtpRepository.CountSince(userId, since)
+	if err != nil {
+		return err
+	}
+	if total >= s.configEnv.SmsOtpMaxPerHour {
+		return errOtpRateLimited
+	}
+
+	code, err := common.GenerateNumericCode(6)
+	if err != nil {
+		return err
+	}
+
+	smsOtp := repository.SmsOtp{
+		UserID:      userId,
+		Purpose:     purpose,
+		PhoneNumber: phoneNumber,
+		CodeHash:    common.HashCode(userId+":"+code, s.configEnv.SecretEncryptionKey),
+		ExpiresAt:   common.AddTimeByDuration(s.configEnv.SmsOtpExpiresIn),
+	}
+	err = s.smsOtpRepository.Create(&smsOtp)
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Your code is %s, it expires in %s.", code, s.configEnv.SmsOtpExpiresIn)
+
+	// Sending in the background keeps the response time the same for
+	// unknown numbers.
+	go func() {
+		err := s.smsSender.Send(phoneNumber, message)
+		if err != nil {
+			zlog.Error(err)
+		}
+	}()
+
+	return nil
+}
+
+// redeem checks a code and burns it. Every check uses up an attempt, the
+// code stops working after SmsOtpMaxAttempts.
+func (s smsOtpService) redeem(smsOtp *repository.SmsOtp, code string) error {
+	err := s.smsOtpRepository.IncrementAttempts(smsOtp.ID, s.configEnv.SmsOtpMaxAttempts)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewUnauthorizedError("code is invalid")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+
+	codeHash := common.HashCode(smsOtp.UserID+":"+code, s.configEnv.SecretEncryptionKey)
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(smsOtp.CodeHash)) != 1 {
+		return errs.NewUnauthorizedError("code is invalid")
+	}
+
+	err = s.smsOtpRepository.MarkUsed(smsOtp.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errs.NewUnauthorizedError("code is invalid")
+		}
+		zlog.Error(err)
+		return errs.NewUnexpectedError()
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"lazy-auth/app/model"
+	"lazy-auth/config"
+)
+
+const testPhoneNumber = "+15555550100"
+
+// fakeSMSSender hands sent messages to the test, the service sends them in
+// the background.
+type fakeSMSSender struct {
+	messages chan string
+}
+
+func (s *fakeSMSSender) Send(to string, message string) error {
+	s.messages <- message
+	return nil
+}
+
+type smsOtpTestEnv struct {
+	service         SmsOtpService
+	emailOtpService EmailOtpService
+	repos           *testRepositories
+	smsSender       *fakeSMSSender
+	mailer          *fakeMailer
+}
+
+// newSmsOtpTestEnv gives "jdoe" the verified number testPhoneNumber.
+func newSmsOtpTestEnv(t *testing.T) *smsOtpTestEnv {
+	t.Helper()
+
+	configEnv := newTestConfigEnv(func(configEnv *config.ConfigEnv) {
+		configEnv.SmsOtpExpiresIn = "5m"
+		configEnv.SmsOtpMaxAttempts = 5
+		configEnv.SmsOtpMaxPerHour = 5
+	})
+
+	repos := newTestRepositories()
+	user := repos.users.users["user-1"]
+	user.PhoneNumber = testPhoneNumber
+	user.PhoneVerifyFlag = true
+	repos.users.users["user-1"] = user
+
+	mailer := newFakeMailer()
+	smsSender := &fakeSMSSender{messages: make(chan string, 10)}
+	emailOtpService := NewEmailOtpService(repos.emailOtps, repos.users, repos.sessions, mailer, configEnv)
+
+	return &smsOtpTestEnv{
+		service: NewSmsOtpService(
+			repos.smsOtps,
+			repos.users,
+			repos.sessions,
+			emailOtpService,
+			smsSender,
+			configEnv,
+		),
+		emailOtpService: emailOtpService,
+		repos:           repos,
+		smsSender:       smsSender,
+		mailer:          mailer,
+	}
+}
+
+// login texts a code to testPhoneNumber and verifies it.
+func (env *smsOtpTestEnv) login(t *testing.T) (*model.TokenResponse, error) {
+	t.Helper()
+
+	err := env.service.RequestLoginCode(model.SmsOtpRequest{PhoneNumber: testPhoneNumber})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var message string
+	select {
+	case message = <-env.smsSender.messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no code was texted")
+	}
+	code := mailedCodePattern.FindString(message)
+	if code == "" {
+		t.Fatalf("no code in %q", message)
+	}
+
+	return env.service.VerifyLoginCode(model.VerifySmsOtpRequest{PhoneNumber: testPhoneNumber, Code: code})
+}
+
+func TestSmsVerifyLoginCode(t *testing.T) {
+	env := newSmsOtpTestEnv(t)
+
+	tokenResp, err := env.login(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenResp.MfaRequired || tokenResp.RefreshToken == "" {
+		t.Errorf("token response = %+v, want a session", tokenResp)
+	}
+
+	_, err = env.service.VerifyLoginCode(model.VerifySmsOtpRequest{PhoneNumber: testPhoneNumber, Code: "000000"})
+	assertAppError(t, err, http.StatusUnauthorized, "code is invalid")
+}
+
+func TestSmsVerifyLoginCodeAsksForMfa(t *testing.T) {
+	env := newSmsOtpTestEnv(t)
+	user := env.repos.users.users["user-1"]
+	user.EmailMfaFlag = true
+	env.repos.users.users["user-1"] = user
+
+	tokenResp, err := env.login(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tokenResp.MfaRequired || tokenResp.AccessToken != "" || len(env.repos.sessions.sessions) != 0 {
+		t.Fatalf("token response = %+v, want only an MFA token", tokenResp)
+	}
+
+	mail := env.mailer.next(t)
+	tokenResp, err = env.emailOtpService.VerifyMfa(model.VerifyMfaRequest{
+		MfaToken: tokenResp.MfaToken,
+		Code:     mailedCodePattern.FindString(mail.body),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenResp.RefreshToken == "" {
+		t.Errorf("token response = %+v, want a session", tokenResp)
+	}
+}
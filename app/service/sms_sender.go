@@ -0,0 +1,6 @@
+package service
+
+// SMSSender delivers text messages such as one-time codes.
+type SMSSender interface {
+	Send(to string, message string) error
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"lazy-auth/app/zlog"
+	"lazy-auth/config"
+
+	"go.uber.org/zap"
+)
+
+// NewSMSSender returns the sender picked by GO_AUTH_SMS_SENDER, "log" writes
+// messages to the log (and GO_AUTH_SMS_FILE when set) for development and
+// "http" posts them to an SMS gateway.
+func NewSMSSender(configEnv config.ConfigEnv) SMSSender {
+	if configEnv.SmsSender == "http" {
+		return httpSMSSender{
+			configEnv:  configEnv,
+			httpClient: &http.Client{Timeout: externalRequestTimeout},
+		}
+	}
+	return &logSMSSender{file: configEnv.SmsFile}
+}
+
+type logSMSSender struct {
+	file string
+	mu   sync.Mutex
+}
+
+func (m *logSMSSender) Send(to string, message string) error {
+	zlog.Info("sms", zap.String("to", to), zap.String("message", message))
+	if m.file == "" {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line, err := json.Marshal(map[string]any{"to": to, "message": message, "sent_at": time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+type httpSMSSender struct {
+	configEnv  config.ConfigEnv
+	httpClient *http.Client
+}
+
+// Send posts {"to", "message"} as JSON, with the gateway token as a bearer
+// token when configured. Any 2xx response counts as accepted.
+func (m httpSMSSender) Send(to string, message string) error {
+	body, err := json.Marshal(map[string]string{"to": to, "message": message})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.configEnv.SmsGatewayURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.configEnv.SmsGatewayToken != "" {
+		req.Header.Set("Authorization", "Bearer "+m.configEnv.SmsGatewayToken)
+	}
+
+	res, err := m.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("sms gateway returned status %d", res.StatusCode)
+	}
+	return nil
+}
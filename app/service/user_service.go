@@ -3,6 +3,7 @@ package service
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"lazy-auth/app/errs"
 	"lazy-auth/app/model"
@@ -14,17 +15,23 @@ import (
 )
 
 type userService struct {
-	userRepository repository.UserRepository
-	roleRepository repository.RoleRepository
+	userRepository        repository.UserRepository
+	roleRepository        repository.RoleRepository
+	passwordPolicyService PasswordPolicyService
+	passwordHasher        *common.PasswordHasher
 }
 
 func NewUserService(
 	userRepository repository.UserRepository,
 	roleRepository repository.RoleRepository,
+	passwordPolicyService PasswordPolicyService,
+	passwordHasher *common.PasswordHasher,
 ) UserService {
 	return userService{
-		userRepository: userRepository,
-		roleRepository: roleRepository,
+		userRepository:        userRepository,
+		roleRepository:        roleRepository,
+		passwordPolicyService: passwordPolicyService,
+		passwordHasher:        passwordHasher,
 	}
 }
 
@@ -37,17 +44,26 @@ func (s userService) CreateUser(
 		return nil, errs.NewNotFoundError(fmt.Sprintf("Role %s not found", roleName))
 	}
 
-	passwordHash, _ := common.HashPassword(userReq.Password)
 	user := repository.User{
-		RoleID:       role.ID,
-		Email:        userReq.Email,
-		Username:     userReq.Username,
-		PasswordHash: passwordHash,
-		DisplayName:  userReq.DisplayName,
-		FirstName:    userReq.FirstName,
-		LastName:     userReq.LastName,
+		RoleID:      role.ID,
+		Email:       userReq.Email,
+		Username:    userReq.Username,
+		DisplayName: userReq.DisplayName,
+		FirstName:   userReq.FirstName,
+		LastName:    userReq.LastName,
 	}
 
+	err = s.passwordPolicyService.CheckPassword(userReq.Password, &user)
+	if err != nil {
+		return nil, err
+	}
+	user.PasswordHash, err = s.passwordHasher.Hash(userReq.Password)
+	if err != nil {
+		zlog.Error(err)
+		return nil, errs.NewUnexpectedError()
+	}
+	user.ChangePasswordAt = time.Now()
+
 	err = s.userRepository.Create(&user)
 	if err != nil {
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
@@ -57,14 +73,24 @@ func (s userService) CreateUser(
 		return nil, errs.NewUnexpectedError()
 	}
 
+	err = s.passwordPolicyService.RememberPassword(&user)
+	if err != nil {
+		zlog.Error(err)
+	}
+
 	userResponse := model.UserResponse{
-		ID:          user.ID,
-		Username:    user.Username,
-		Email:       user.Email,
-		DisplayName: user.DisplayName,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		VerifyFlag:  user.VerifyFlag,
+		ID:                   user.ID,
+		Username:             user.Username,
+		Email:                user.Email,
+		DisplayName:          user.DisplayName,
+		FirstName:            user.FirstName,
+		LastName:             user.LastName,
+		VerifyFlag:           user.VerifyFlag,
+		EmailMfaFlag:         user.EmailMfaFlag,
+		PhoneNumber:          user.PhoneNumber,
+		PhoneVerifyFlag:      user.PhoneVerifyFlag,
+		UsernameConflictFlag: user.UsernameConflictFlag,
+		EmailConflictFlag:    user.EmailConflictFlag,
 	}
 
 	return &userResponse, nil
@@ -79,13 +105,18 @@ func (s userService) GetUsers(query model.QueryUser) (*model.UserPageResponse, e
 
 	rolesResponse := common.Map(users, func(user repository.User) model.UserResponse {
 		return model.UserResponse{
-			ID:          user.ID,
-			Username:    user.Username,
-			Email:       user.Email,
-			DisplayName: user.DisplayName,
-			FirstName:   user.FirstName,
-			LastName:    user.LastName,
-			VerifyFlag:  user.VerifyFlag,
+			ID:                   user.ID,
+			Username:             user.Username,
+			Email:                user.Email,
+			DisplayName:          user.DisplayName,
+			FirstName:            user.FirstName,
+			LastName:             user.LastName,
+			VerifyFlag:           user.VerifyFlag,
+			EmailMfaFlag:         user.EmailMfaFlag,
+			PhoneNumber:          user.PhoneNumber,
+			PhoneVerifyFlag:      user.PhoneVerifyFlag,
+			UsernameConflictFlag: user.UsernameConflictFlag,
+			EmailConflictFlag:    user.EmailConflictFlag,
 		}
 	})
 	meta := common.BuildMetaPagination(&total, query.Limit, query.Offset)
@@ -104,13 +135,18 @@ func (s userService) GetUserById(id string) (*model.UserResponse, error) {
 	}
 
 	userResponse := model.UserResponse{
-		ID:          user.ID,
-		Username:    user.Username,
-		Email:       user.Email,
-		DisplayName: user.DisplayName,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		VerifyFlag:  user.VerifyFlag,
+		ID:                   user.ID,
+		Username:             user.Username,
+		Email:                user.Email,
+		DisplayName:          user.DisplayName,
+		FirstName:            user.FirstName,
+		LastName:             user.LastName,
+		VerifyFlag:           user.VerifyFlag,
+		EmailMfaFlag:         user.EmailMfaFlag,
+		PhoneNumber:          user.PhoneNumber,
+		PhoneVerifyFlag:      user.PhoneVerifyFlag,
+		UsernameConflictFlag: user.UsernameConflictFlag,
+		EmailConflictFlag:    user.EmailConflictFlag,
 	}
 	return &userResponse, nil
 }
@@ -147,13 +183,18 @@ func (s userService) UpdateUserById(
 	}
 
 	userResponse := model.UserResponse{
-		ID:          user.ID,
-		Username:    user.Username,
-		Email:       user.Email,
-		DisplayName: user.DisplayName,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		VerifyFlag:  user.VerifyFlag,
+		ID:                   user.ID,
+		Username:             user.Username,
+		Email:                user.Email,
+		DisplayName:          user.DisplayName,
+		FirstName:            user.FirstName,
+		LastName:             user.LastName,
+		VerifyFlag:           user.VerifyFlag,
+		EmailMfaFlag:         user.EmailMfaFlag,
+		PhoneNumber:          user.PhoneNumber,
+		PhoneVerifyFlag:      user.PhoneVerifyFlag,
+		UsernameConflictFlag: user.UsernameConflictFlag,
+		EmailConflictFlag:    user.EmailConflictFlag,
 	}
 	return &userResponse, nil
 }
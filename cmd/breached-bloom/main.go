@@ -0,0 +1,74 @@
+// Command breached-bloom builds the bloom filter read by
+// GO_AUTH_BREACHED_PASSWORD_MODE=bloom from a Pwned Passwords SHA-1
+// dataset, either a directory of range files or one "HASH:COUNT" file.
+//
+//	go run ./cmd/breached-bloom -source ./pwned -out ./pwned.bloom
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"lazy-auth/common"
+)
+
+func main() {
+	source := flag.String("source", "", "dataset directory or file")
+	out := flag.String("out", "breached-passwords.bloom", "filter file to write")
+	minCount := flag.Int("min-count", 1, "skip hashes seen fewer times than this")
+	falsePositiveRate := flag.Float64("fp-rate", 0.001, "false positive rate")
+	flag.Parse()
+
+	if *source == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// The filter is sized up front, so the dataset is read twice.
+	var expected uint64
+	err := common.ScanPwnedDataset(*source, func(hash string, count int) error {
+		if count >= *minCount {
+			expected++
+		}
+		return nil
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	filter := common.NewBloomFilter(expected, *falsePositiveRate)
+	err = common.ScanPwnedDataset(*source, func(hash string, count int) error {
+		if count < *minCount {
+			return nil
+		}
+		return filter.Add(hash)
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		fail(err)
+	}
+	w := bufio.NewWriter(file)
+	_, err = filter.WriteTo(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	fmt.Printf("wrote %d hashes to %s\n", expected, *out)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
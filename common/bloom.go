@@ -0,0 +1,117 @@
+package common
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+const bloomFilterMagic = "LABF1"
+
+// BloomFilter is a set of SHA-1 hashes that answers "maybe present" or
+// "definitely absent". The hashes are already uniform, so the probe
+// positions are derived from their bytes by double hashing.
+type BloomFilter struct {
+	bits   []byte
+	size   uint64
+	hashes uint32
+}
+
+// NewBloomFilter sizes a filter for expected entries at the given false
+// positive rate.
+func NewBloomFilter(expected uint64, falsePositiveRate float64) *BloomFilter {
+	if expected == 0 {
+		expected = 1
+	}
+	size := uint64(math.Ceil(-float64(expected) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint32(math.Max(1, math.Round(float64(size)/float64(expected)*math.Ln2)))
+	return &BloomFilter{
+		bits:   make([]byte, (size+7)/8),
+		size:   size,
+		hashes: hashes,
+	}
+}
+
+// Add inserts a hex SHA-1 hash.
+func (f *BloomFilter) Add(hash string) error {
+	h1, h2, err := bloomHashes(hash)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < f.hashes; i++ {
+		position := (h1 + uint64(i)*h2) % f.size
+		f.bits[position/8] |= 1 << (position % 8)
+	}
+	return nil
+}
+
+// Contains reports whether a hex SHA-1 hash may have been added.
+func (f *BloomFilter) Contains(hash string) (bool, error) {
+	h1, h2, err := bloomHashes(hash)
+	if err != nil {
+		return false, err
+	}
+	for i := uint32(0); i < f.hashes; i++ {
+		position := (h1 + uint64(i)*h2) % f.size
+		if f.bits[position/8]&(1<<(position%8)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, len(bloomFilterMagic)+4+8)
+	copy(header, bloomFilterMagic)
+	binary.BigEndian.PutUint32(header[len(bloomFilterMagic):], f.hashes)
+	binary.BigEndian.PutUint64(header[len(bloomFilterMagic)+4:], f.size)
+
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(f.bits)
+	return int64(n + m), err
+}
+
+func LoadBloomFilter(path string) (*BloomFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+
+	header := make([]byte, len(bloomFilterMagic)+4+8)
+	_, err = io.ReadFull(r, header)
+	if err != nil || string(header[:len(bloomFilterMagic)]) != bloomFilterMagic {
+		return nil, errors.New("not a bloom filter file")
+	}
+
+	f := BloomFilter{
+		hashes: binary.BigEndian.Uint32(header[len(bloomFilterMagic):]),
+		size:   binary.BigEndian.Uint64(header[len(bloomFilterMagic)+4:]),
+	}
+	if f.size == 0 || f.hashes == 0 {
+		return nil, errors.New("bloom filter is empty")
+	}
+	f.bits = make([]byte, (f.size+7)/8)
+	_, err = io.ReadFull(r, f.bits)
+	if err != nil {
+		return nil, errors.New("bloom filter is truncated")
+	}
+	return &f, nil
+}
+
+func bloomHashes(hash string) (uint64, uint64, error) {
+	sum, err := hex.DecodeString(hash)
+	if err != nil || len(sum) < 16 {
+		return 0, 0, errors.New("invalid SHA-1 hash")
+	}
+	// An odd step visits distinct positions for every probe.
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:16]) | 1, nil
+}
@@ -0,0 +1,103 @@
+package common
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeBloomFilter(t *testing.T, filter *BloomFilter) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	n, err := filter.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo = %d bytes, wrote %d", n, buf.Len())
+	}
+
+	path := filepath.Join(t.TempDir(), "breached.bloom")
+	err = os.WriteFile(path, buf.Bytes(), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBloomFilterRoundTrip(t *testing.T) {
+	added := []string{
+		PwnedPasswordHash("password"),
+		PwnedPasswordHash("123456"),
+		PwnedPasswordHash("qwerty"),
+	}
+	filter := NewBloomFilter(uint64(len(added)), 0.0001)
+	for _, hash := range added {
+		err := filter.Add(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded, err := LoadBloomFilter(writeBloomFilter(t, filter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.size != filter.size || loaded.hashes != filter.hashes || !bytes.Equal(loaded.bits, filter.bits) {
+		t.Fatalf("loaded filter differs: size %d hashes %d", loaded.size, loaded.hashes)
+	}
+
+	for _, hash := range added {
+		ok, err := loaded.Contains(hash)
+		if err != nil || !ok {
+			t.Errorf("Contains(%s) = %v, %v", hash, ok, err)
+		}
+	}
+	for _, password := range []string{"Correct-Horse-1", "Battery-Staple-2", "lazy-auth"} {
+		if ok, _ := loaded.Contains(PwnedPasswordHash(password)); ok {
+			t.Errorf("Contains(%q) = true", password)
+		}
+	}
+
+	// Hashes are hex, so lowercase is the same hash.
+	if ok, _ := loaded.Contains(strings.ToLower(added[0])); !ok {
+		t.Error("Contains of the lowercase hash = false")
+	}
+	if _, err := loaded.Contains("not-a-hash"); err == nil {
+		t.Error("Contains accepted an invalid hash")
+	}
+}
+
+func TestLoadBloomFilterRejectsInvalidFile(t *testing.T) {
+	filter := NewBloomFilter(10, 0.01)
+	var buf bytes.Buffer
+	_, err := filter.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	empty := append([]byte(bloomFilterMagic), make([]byte, 12)...)
+	for name, content := range map[string][]byte{
+		"other format": append([]byte("LABF0"), valid[len(bloomFilterMagic):]...),
+		"short header": valid[:len(bloomFilterMagic)+2],
+		"truncated":    valid[:len(valid)-1],
+		"empty filter": empty,
+	} {
+		path := filepath.Join(t.TempDir(), "breached.bloom")
+		err := os.WriteFile(path, content, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadBloomFilter(path); err == nil {
+			t.Errorf("%s: LoadBloomFilter did not fail", name)
+		}
+	}
+
+	if _, err := LoadBloomFilter(filepath.Join(t.TempDir(), "missing.bloom")); err == nil {
+		t.Error("LoadBloomFilter of a missing file did not fail")
+	}
+}
@@ -3,22 +3,100 @@ package common
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+// HashSecret hashes generated client secrets. They are long and random, so
+// plain bcrypt is enough, user passwords go through PasswordHasher.
+func HashSecret(secret string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(secret), 10)
 	return string(bytes), err
 }
 
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+func CheckSecretHash(secret, hash string) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret))
 	return err == nil
 }
 
+func GenerateSecret(size int) (string, error) {
+	bytes := make([]byte, size)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+const userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+
+// GenerateUserCode returns an 8 character code without vowels, so it is easy
+// to type and cannot spell words (RFC 8628 section 6.1).
+func GenerateUserCode() (string, error) {
+	// Bytes above the largest multiple of the charset size are dropped to
+	// keep the distribution uniform.
+	limit := 256 - 256%len(userCodeCharset)
+	code := make([]byte, 0, 8)
+	buffer := make([]byte, 16)
+	for len(code) < cap(code) {
+		_, err := rand.Read(buffer)
+		if err != nil {
+			return "", err
+		}
+		for _, b := range buffer {
+			if int(b) < limit && len(code) < cap(code) {
+				code = append(code, userCodeCharset[int(b)%len(userCodeCharset)])
+			}
+		}
+	}
+	return string(code), nil
+}
+
+// GenerateNumericCode returns a uniformly random code of digits, for codes
+// that people type in.
+func GenerateNumericCode(digits int) (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", digits, n), nil
+}
+
+// HashCode is for short low-entropy codes, keyed so a leaked table cannot be
+// brute forced offline.
+func HashCode(code string, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HashToken is used for high-entropy tokens that are looked up by value, a
+// fast digest is enough there and keeps the column indexable.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyCodeChallenge checks a PKCE code verifier (RFC 7636), only S256 is supported.
+func VerifyCodeChallenge(codeVerifier, codeChallenge, method string) bool {
+	if method != "S256" || len(codeVerifier) < 43 || len(codeVerifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(codeVerifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(codeChallenge)) == 1
+}
+
 func Encrypt(plaintext, secretKey string) (string, error) {
 	aes, err := aes.NewCipher([]byte(secretKey))
 	if err != nil {
@@ -52,7 +130,15 @@ func Decrypt(hexText, secretKey string) (string, error) {
 	}
 
 	nonceSize := gcm.NonceSize()
-	cipherbyte, _ := hex.DecodeString(hexText)
+	cipherbyte, err := hex.DecodeString(hexText)
+	if err != nil {
+		return "", err
+	}
+	// Values come from clients, one without room for the nonce and tag was not
+	// encrypted by us.
+	if len(cipherbyte) < nonceSize+gcm.Overhead() {
+		return "", errors.New("ciphertext is too short")
+	}
 	ciphertext := string(cipherbyte)
 	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
 
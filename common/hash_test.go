@@ -0,0 +1,59 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	const key = "0123456789abcdef0123456789abcdef"
+
+	encrypted, err := Encrypt("refresh-token", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := Decrypt(encrypted, key)
+	if err != nil || plaintext != "refresh-token" {
+		t.Fatalf("Decrypt = %q, %v", plaintext, err)
+	}
+
+	if _, err := Decrypt(encrypted, strings.Repeat("x", 32)); err == nil {
+		t.Error("Decrypt with another key did not fail")
+	}
+
+	// Client supplied values must fail, not panic.
+	for _, hexText := range []string{
+		"",
+		"not-hex",
+		"00",
+		strings.Repeat("00", 12),
+		strings.Repeat("00", 27),
+		encrypted[:len(encrypted)-2],
+		encrypted + "00",
+	} {
+		if _, err := Decrypt(hexText, key); err == nil {
+			t.Errorf("Decrypt(%q) did not fail", hexText)
+		}
+	}
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// RFC 7636 appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if !VerifyCodeChallenge(verifier, challenge, "S256") {
+		t.Error("RFC 7636 example was rejected")
+	}
+	for _, test := range []struct{ verifier, challenge, method string }{
+		{verifier, challenge, "plain"},
+		{verifier, verifier, "S256"},
+		{verifier + "x", challenge, "S256"},
+		{verifier[:42], challenge, "S256"},
+		{"", "", "S256"},
+	} {
+		if VerifyCodeChallenge(test.verifier, test.challenge, test.method) {
+			t.Errorf("VerifyCodeChallenge(%q, %q, %q) passed", test.verifier, test.challenge, test.method)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package common
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// CanonicalUsername is the form usernames are stored and looked up in, names
+// that only differ in case, width or surrounding spaces are the same user.
+func CanonicalUsername(username string) string {
+	return strings.TrimSpace(strings.ToLower(norm.NFKC.String(username)))
+}
+
+// CanonicalEmail canonicalizes an email like a username. With foldGmail the
+// dots and +tag of Gmail addresses are removed as well, Gmail delivers all
+// of those variants to the same mailbox.
+func CanonicalEmail(email string, foldGmail bool) string {
+	email = CanonicalUsername(email)
+	if !foldGmail {
+		return email
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+	if domain != "gmail.com" && domain != "googlemail.com" {
+		return email
+	}
+
+	local, _, _ = strings.Cut(local, "+")
+	return strings.ReplaceAll(local, ".", "") + "@gmail.com"
+}
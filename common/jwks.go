@@ -0,0 +1,89 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+
+	"lazy-auth/app/model"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// ParseJsonWebKey converts an RSA or EC public JWK into a key usable for
+// signature verification.
+func ParseJsonWebKey(key model.JsonWebKey) (any, error) {
+	switch key.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("unsupported curve")
+		}
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	}
+	return nil, errors.New("unsupported key type")
+}
+
+// ValidateExternalToken verifies a JWT issued by another party against its
+// published key set. Expiry and not-before are enforced, issuer and audience
+// are left to the caller.
+func ValidateExternalToken(tokenString string, keys []model.JsonWebKey) (jwt.MapClaims, bool) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		default:
+			return nil, errors.New("unexpected signing method")
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		for _, key := range keys {
+			if key.Use != "" && key.Use != "sig" {
+				continue
+			}
+			if kid == "" || key.Kid == kid {
+				return ParseJsonWebKey(key)
+			}
+		}
+		return nil, errors.New("signing key not found")
+	})
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+	return claims, true
+}
@@ -1,11 +1,38 @@
 package common
 
 import (
+	"errors"
+	"strings"
 	"time"
 
+	"lazy-auth/app/model"
+
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+const (
+	SubjectTypeUser           = "user"
+	SubjectTypeServiceAccount = "service_account"
+	SubjectTypeClient         = "client"
+
+	// SubjectTypePasswordChange tokens are issued instead of a session when
+	// the password expired, they only permit changing it.
+	SubjectTypePasswordChange = "password_change"
 )
 
+type TokenClaims struct {
+	jwt.StandardClaims
+	SubjectType string `json:"sub_type,omitempty"`
+	ClientID    string `json:"client_id,omitempty"`
+	Scope       string `json:"scope,omitempty"`
+
+	// SessionID binds a delegated token, which has its own id, to the
+	// session of the user it acts for.
+	SessionID string            `json:"sid,omitempty"`
+	Act       *model.ActorClaim `json:"act,omitempty"`
+}
+
 func GenerateToken(
 	userId string,
 	sessionId string,
@@ -21,11 +48,65 @@ func GenerateToken(
 	return tokenString
 }
 
-func ValidateToken(accessToken string, secret string) (*jwt.StandardClaims, bool) {
+func GenerateServiceAccountToken(
+	serviceAccountId string,
+	secret string,
+	expired time.Time,
+) string {
+	token := jwt.NewWithClaims(
+		jwt.GetSigningMethod("HS256"),
+		&TokenClaims{
+			StandardClaims: jwt.StandardClaims{
+				ExpiresAt: expired.Unix(),
+				IssuedAt:  time.Now().Unix(),
+				Id:        uuid.NewString(),
+				Subject:   serviceAccountId,
+			},
+			SubjectType: SubjectTypeServiceAccount,
+		},
+	)
+	tokenString, _ := token.SignedString([]byte(secret))
+
+	return tokenString
+}
+
+func GeneratePasswordChangeToken(
+	userId string,
+	secret string,
+	expired time.Time,
+) string {
+	token := jwt.NewWithClaims(
+		jwt.GetSigningMethod("HS256"),
+		&TokenClaims{
+			StandardClaims: jwt.StandardClaims{
+				ExpiresAt: expired.Unix(),
+				IssuedAt:  time.Now().Unix(),
+				Id:        uuid.NewString(),
+				Subject:   userId,
+			},
+			SubjectType: SubjectTypePasswordChange,
+		},
+	)
+	tokenString, _ := token.SignedString([]byte(secret))
+
+	return tokenString
+}
+
+func SignToken(claims *TokenClaims, secret string) string {
+	token := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), claims)
+	tokenString, _ := token.SignedString([]byte(secret))
+
+	return tokenString
+}
+
+func ValidateToken(accessToken string, secret string) (*TokenClaims, bool) {
 	token, err := jwt.ParseWithClaims(
 		accessToken,
-		&jwt.StandardClaims{},
+		&TokenClaims{},
 		func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, errors.New("unexpected signing method")
+			}
 			return []byte(secret), nil
 		},
 	)
@@ -33,7 +114,51 @@ func ValidateToken(accessToken string, secret string) (*jwt.StandardClaims, bool
 		return nil, false
 	}
 
+	claims := token.Claims.(*TokenClaims)
+	if claims.SubjectType == "" {
+		claims.SubjectType = SubjectTypeUser
+	}
+
+	return claims, true
+}
+
+// ValidateAssertion verifies a client assertion (RFC 7523) signed with the
+// private key matching publicKeyPEM. Both RSA and EC keys are accepted.
+func ValidateAssertion(assertion string, publicKeyPEM string) (*jwt.StandardClaims, bool) {
+	token, err := jwt.ParseWithClaims(
+		assertion,
+		&jwt.StandardClaims{},
+		func(token *jwt.Token) (interface{}, error) {
+			switch token.Method.(type) {
+			case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+				return jwt.ParseRSAPublicKeyFromPEM([]byte(publicKeyPEM))
+			case *jwt.SigningMethodECDSA:
+				return jwt.ParseECPublicKeyFromPEM([]byte(publicKeyPEM))
+			}
+			return nil, errors.New("unexpected signing method")
+		},
+	)
+	if err != nil {
+		return nil, false
+	}
+
 	claims := token.Claims.(*jwt.StandardClaims)
+	if claims.ExpiresAt == 0 {
+		return nil, false
+	}
 
 	return claims, true
 }
+
+func ValidatePublicKey(publicKeyPEM string) bool {
+	if strings.TrimSpace(publicKeyPEM) == "" {
+		return false
+	}
+	if _, err := jwt.ParseRSAPublicKeyFromPEM([]byte(publicKeyPEM)); err == nil {
+		return true
+	}
+	if _, err := jwt.ParseECPublicKeyFromPEM([]byte(publicKeyPEM)); err == nil {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+
+	"lazy-auth/app/model"
+
+	"github.com/golang-jwt/jwt"
+)
+
+type SigningKey struct {
+	KeyID      string
+	PrivateKey *rsa.PrivateKey
+}
+
+// LoadSigningKey reads a PEM encoded RSA private key used for ID tokens. When
+// no path is configured a throwaway key is generated, tokens signed with it do
+// not survive a restart.
+func LoadSigningKey(path string) *SigningKey {
+	var privateKey *rsa.PrivateKey
+	if path == "" {
+		fmt.Println("[OIDC] [WARNING] No signing key configured, generating an ephemeral key.")
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+		privateKey = key
+	} else {
+		keyPEM, err := os.ReadFile(path)
+		if err != nil {
+			panic(err)
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(keyPEM)
+		if err != nil {
+			panic(err)
+		}
+		privateKey = key
+	}
+
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(publicKeyDER)
+
+	return &SigningKey{
+		KeyID:      base64.RawURLEncoding.EncodeToString(sum[:16]),
+		PrivateKey: privateKey,
+	}
+}
+
+func (k *SigningKey) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = k.KeyID
+	return token.SignedString(k.PrivateKey)
+}
+
+// Verify checks the signature of a token issued with this key. Expiry is not
+// enforced because expired ID tokens remain valid as logout hints.
+func (k *SigningKey) Verify(tokenString string) (jwt.MapClaims, bool) {
+	claims := jwt.MapClaims{}
+	parser := jwt.Parser{
+		ValidMethods:         []string{jwt.SigningMethodRS256.Alg()},
+		SkipClaimsValidation: true,
+	}
+	token, err := parser.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
+		return &k.PrivateKey.PublicKey, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+	return claims, true
+}
+
+func (k *SigningKey) JsonWebKey() model.JsonWebKey {
+	publicKey := k.PrivateKey.PublicKey
+	return model.JsonWebKey{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: k.KeyID,
+		N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+	}
+}
+
+// TokenHash computes at_hash / c_hash for RS256 signed ID tokens.
+func TokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
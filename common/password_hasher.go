@@ -0,0 +1,331 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	PasswordHashArgon2id     = "argon2id"
+	PasswordHashScrypt       = "scrypt"
+	PasswordHashBcrypt       = "bcrypt"
+	PasswordHashPbkdf2Sha256 = "pbkdf2-sha256"
+
+	passwordSaltLength = 16
+	passwordKeyLength  = 32
+
+	// bcryptMaxPasswordBytes is what bcrypt reads, longer passwords cannot be
+	// hashed.
+	bcryptMaxPasswordBytes = 72
+)
+
+type PasswordHashParams struct {
+	Algorithm         string
+	BcryptCost        int
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	ScryptLogN        uint8
+	ScryptR           int
+	ScryptP           int
+	Pbkdf2Iterations  int
+}
+
+// PasswordHasher hashes new passwords with the configured algorithm and
+// verifies hashes of every supported one. Hashes are PHC strings such as
+// $argon2id$v=19$m=19456,t=2,p=1$salt$hash, bcrypt keeps its own $2a$ form.
+type PasswordHasher struct {
+	params     PasswordHashParams
+	algorithms map[string]passwordHashAlgorithm
+	dummyHash  string
+}
+
+type passwordHashAlgorithm interface {
+	hash(password string) (string, error)
+	// verify also reports whether encoded uses other parameters than hash
+	// would.
+	verify(password string, encoded string) (bool, bool, error)
+}
+
+func NewPasswordHasher(params PasswordHashParams) *PasswordHasher {
+	h := PasswordHasher{
+		params: params,
+		algorithms: map[string]passwordHashAlgorithm{
+			PasswordHashArgon2id:     argon2idHash{params},
+			PasswordHashScrypt:       scryptHash{params},
+			PasswordHashBcrypt:       bcryptHash{params},
+			PasswordHashPbkdf2Sha256: pbkdf2Hash{params},
+		},
+	}
+	if h.algorithms[params.Algorithm] == nil {
+		panic(fmt.Errorf("unknown password hash algorithm %q", params.Algorithm))
+	}
+
+	dummyHash, err := h.Hash("lazy-auth-dummy-password")
+	if err != nil {
+		panic(err)
+	}
+	h.dummyHash = dummyHash
+	return &h
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	return h.algorithms[h.params.Algorithm].hash(password)
+}
+
+// MaxPasswordBytes is the longest password in bytes the configured algorithm
+// can hash, 0 when there is no limit.
+func (h *PasswordHasher) MaxPasswordBytes() int {
+	if h.params.Algorithm == PasswordHashBcrypt {
+		return bcryptMaxPasswordBytes
+	}
+	return 0
+}
+
+// Verify checks password against encoded. needsRehash is set when the hash
+// matched but was made with another algorithm or other parameters than the
+// configured ones.
+func (h *PasswordHasher) Verify(password string, encoded string) (ok bool, needsRehash bool) {
+	algorithm := passwordHashAlgorithmOf(encoded)
+	if h.algorithms[algorithm] == nil {
+		return false, false
+	}
+
+	ok, outdated, err := h.algorithms[algorithm].verify(password, encoded)
+	if err != nil || !ok {
+		return false, false
+	}
+	return true, outdated || algorithm != h.params.Algorithm
+}
+
+// VerifyDummy costs as much as verifying a real hash, it makes a missing
+// account take as long as a wrong password.
+func (h *PasswordHasher) VerifyDummy(password string) {
+	h.Verify(password, h.dummyHash)
+}
+
+func passwordHashAlgorithmOf(encoded string) string {
+	if strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$") {
+		return PasswordHashBcrypt
+	}
+	parts := strings.SplitN(encoded, "$", 3)
+	if len(parts) < 3 || parts[0] != "" {
+		return ""
+	}
+	return parts[1]
+}
+
+type bcryptHash struct {
+	params PasswordHashParams
+}
+
+func (a bcryptHash) hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), a.params.BcryptCost)
+	return string(bytes), err
+}
+
+func (a bcryptHash) verify(password string, encoded string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err != nil {
+		return false, false, nil
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return true, cost != a.params.BcryptCost, err
+}
+
+type argon2idHash struct {
+	params PasswordHashParams
+}
+
+func (a argon2idHash) hash(password string) (string, error) {
+	salt, err := newPasswordSalt()
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey(
+		[]byte(password),
+		salt,
+		a.params.Argon2Iterations,
+		a.params.Argon2Memory,
+		a.params.Argon2Parallelism,
+		passwordKeyLength,
+	)
+	return fmt.Sprintf(
+		"$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		PasswordHashArgon2id,
+		argon2.Version,
+		a.params.Argon2Memory,
+		a.params.Argon2Iterations,
+		a.params.Argon2Parallelism,
+		encodePasswordBase64(salt),
+		encodePasswordBase64(key),
+	), nil
+}
+
+func (a argon2idHash) verify(password string, encoded string) (bool, bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return false, false, errors.New("invalid argon2id hash")
+	}
+	values, err := parsePasswordHashParams(parts[3], "m", "t", "p")
+	if err != nil || values["m"] > 1<<32-1 || values["t"] > 1<<32-1 || values["p"] > 255 {
+		return false, false, errors.New("invalid argon2id parameters")
+	}
+	salt, key, err := decodePasswordSaltAndKey(parts[4], parts[5])
+	if err != nil {
+		return false, false, err
+	}
+
+	memory, iterations, parallelism := uint32(values["m"]), uint32(values["t"]), uint8(values["p"])
+	candidate := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(key)))
+	outdated := memory != a.params.Argon2Memory ||
+		iterations != a.params.Argon2Iterations ||
+		parallelism != a.params.Argon2Parallelism ||
+		len(key) != passwordKeyLength
+	return subtle.ConstantTimeCompare(candidate, key) == 1, outdated, nil
+}
+
+type scryptHash struct {
+	params PasswordHashParams
+}
+
+func (a scryptHash) hash(password string) (string, error) {
+	salt, err := newPasswordSalt()
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<a.params.ScryptLogN, a.params.ScryptR, a.params.ScryptP, passwordKeyLength)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(
+		"$%s$ln=%d,r=%d,p=%d$%s$%s",
+		PasswordHashScrypt,
+		a.params.ScryptLogN,
+		a.params.ScryptR,
+		a.params.ScryptP,
+		encodePasswordBase64(salt),
+		encodePasswordBase64(key),
+	), nil
+}
+
+func (a scryptHash) verify(password string, encoded string) (bool, bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 {
+		return false, false, errors.New("invalid scrypt hash")
+	}
+	values, err := parsePasswordHashParams(parts[2], "ln", "r", "p")
+	if err != nil || values["ln"] > 62 {
+		return false, false, errors.New("invalid scrypt parameters")
+	}
+	salt, key, err := decodePasswordSaltAndKey(parts[3], parts[4])
+	if err != nil {
+		return false, false, err
+	}
+
+	logN, r, p := uint8(values["ln"]), int(values["r"]), int(values["p"])
+	candidate, err := scrypt.Key([]byte(password), salt, 1<<logN, r, p, len(key))
+	if err != nil {
+		return false, false, err
+	}
+	outdated := logN != a.params.ScryptLogN ||
+		r != a.params.ScryptR ||
+		p != a.params.ScryptP ||
+		len(key) != passwordKeyLength
+	return subtle.ConstantTimeCompare(candidate, key) == 1, outdated, nil
+}
+
+type pbkdf2Hash struct {
+	params PasswordHashParams
+}
+
+func (a pbkdf2Hash) hash(password string) (string, error) {
+	salt, err := newPasswordSalt()
+	if err != nil {
+		return "", err
+	}
+	key := pbkdf2.Key([]byte(password), salt, a.params.Pbkdf2Iterations, passwordKeyLength, sha256.New)
+	return fmt.Sprintf(
+		"$%s$i=%d$%s$%s",
+		PasswordHashPbkdf2Sha256,
+		a.params.Pbkdf2Iterations,
+		encodePasswordBase64(salt),
+		encodePasswordBase64(key),
+	), nil
+}
+
+func (a pbkdf2Hash) verify(password string, encoded string) (bool, bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 {
+		return false, false, errors.New("invalid pbkdf2 hash")
+	}
+	values, err := parsePasswordHashParams(parts[2], "i")
+	if err != nil || values["i"] == 0 || values["i"] > 1<<31-1 {
+		return false, false, errors.New("invalid pbkdf2 parameters")
+	}
+	salt, key, err := decodePasswordSaltAndKey(parts[3], parts[4])
+	if err != nil {
+		return false, false, err
+	}
+
+	iterations := int(values["i"])
+	candidate := pbkdf2.Key([]byte(password), salt, iterations, len(key), sha256.New)
+	outdated := iterations != a.params.Pbkdf2Iterations || len(key) != passwordKeyLength
+	return subtle.ConstantTimeCompare(candidate, key) == 1, outdated, nil
+}
+
+// parsePasswordHashParams reads "m=19456,t=2,p=1", every name is required.
+func parsePasswordHashParams(encoded string, names ...string) (map[string]uint64, error) {
+	values := map[string]uint64{}
+	for _, pair := range strings.Split(encoded, ",") {
+		name, value, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, errors.New("invalid parameter " + pair)
+		}
+		number, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = number
+	}
+	for _, name := range names {
+		if _, ok := values[name]; !ok {
+			return nil, errors.New("missing parameter " + name)
+		}
+	}
+	return values, nil
+}
+
+func newPasswordSalt() ([]byte, error) {
+	salt := make([]byte, passwordSaltLength)
+	_, err := rand.Read(salt)
+	return salt, err
+}
+
+// PHC strings use standard base64 without padding.
+func encodePasswordBase64(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
+
+func decodePasswordSaltAndKey(encodedSalt string, encodedKey string) ([]byte, []byte, error) {
+	salt, err := base64.RawStdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) == 0 {
+		return nil, nil, errors.New("invalid password hash")
+	}
+	return salt, key, nil
+}
@@ -0,0 +1,177 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+// testPasswordHashParams keeps every algorithm cheap, the tests check the
+// encoding and verification, not the strength.
+func testPasswordHashParams(algorithm string) PasswordHashParams {
+	return PasswordHashParams{
+		Algorithm:         algorithm,
+		BcryptCost:        4,
+		Argon2Memory:      64,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+		ScryptLogN:        4,
+		ScryptR:           8,
+		ScryptP:           1,
+		Pbkdf2Iterations:  10,
+	}
+}
+
+var passwordHashAlgorithms = []string{
+	PasswordHashArgon2id,
+	PasswordHashScrypt,
+	PasswordHashBcrypt,
+	PasswordHashPbkdf2Sha256,
+}
+
+func TestPasswordHasherRoundTrip(t *testing.T) {
+	for _, algorithm := range passwordHashAlgorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			h := NewPasswordHasher(testPasswordHashParams(algorithm))
+
+			encoded, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := passwordHashAlgorithmOf(encoded); got != algorithm {
+				t.Fatalf("hash %q is recognized as %q", encoded, got)
+			}
+
+			ok, needsRehash := h.Verify("correct horse", encoded)
+			if !ok || needsRehash {
+				t.Fatalf("Verify = %v, %v, want true, false", ok, needsRehash)
+			}
+
+			ok, _ = h.Verify("correct horsE", encoded)
+			if ok {
+				t.Fatal("wrong password was accepted")
+			}
+		})
+	}
+}
+
+func TestPasswordHasherSaltsEveryHash(t *testing.T) {
+	for _, algorithm := range passwordHashAlgorithms {
+		h := NewPasswordHasher(testPasswordHashParams(algorithm))
+		first, _ := h.Hash("secret")
+		second, _ := h.Hash("secret")
+		if first == second {
+			t.Errorf("%s: two hashes of the same password are equal", algorithm)
+		}
+	}
+}
+
+func TestPasswordHasherNeedsRehash(t *testing.T) {
+	// Hashes of another algorithm still verify, but are flagged.
+	for _, from := range passwordHashAlgorithms {
+		for _, to := range passwordHashAlgorithms {
+			encoded, err := NewPasswordHasher(testPasswordHashParams(from)).Hash("secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ok, needsRehash := NewPasswordHasher(testPasswordHashParams(to)).Verify("secret", encoded)
+			if !ok || needsRehash != (from != to) {
+				t.Errorf("%s hash verified by %s = %v, %v", from, to, ok, needsRehash)
+			}
+		}
+	}
+
+	// So are hashes of the same algorithm with other parameters.
+	changes := map[string]func(*PasswordHashParams){
+		PasswordHashArgon2id:     func(p *PasswordHashParams) { p.Argon2Iterations = 2 },
+		PasswordHashScrypt:       func(p *PasswordHashParams) { p.ScryptLogN = 5 },
+		PasswordHashBcrypt:       func(p *PasswordHashParams) { p.BcryptCost = 5 },
+		PasswordHashPbkdf2Sha256: func(p *PasswordHashParams) { p.Pbkdf2Iterations = 20 },
+	}
+	for algorithm, change := range changes {
+		encoded, _ := NewPasswordHasher(testPasswordHashParams(algorithm)).Hash("secret")
+		params := testPasswordHashParams(algorithm)
+		change(&params)
+		ok, needsRehash := NewPasswordHasher(params).Verify("secret", encoded)
+		if !ok || !needsRehash {
+			t.Errorf("%s with new parameters = %v, %v, want true, true", algorithm, ok, needsRehash)
+		}
+	}
+}
+
+func TestPasswordHasherRejectsMalformedHashes(t *testing.T) {
+	h := NewPasswordHasher(testPasswordHashParams(PasswordHashArgon2id))
+	valid, _ := h.Hash("secret")
+	parts := strings.Split(valid, "$")
+
+	for _, encoded := range []string{
+		"",
+		"secret",
+		"$",
+		"$unknown$x$y",
+		"$argon2id$",
+		"$argon2id$v=19$m=64,t=1,p=1$",
+		"$argon2id$v=18$" + strings.Join(parts[3:], "$"),
+		"$argon2id$v=19$m=64,t=1$" + parts[4] + "$" + parts[5],
+		"$argon2id$v=19$m=64,t=1,p=256$" + parts[4] + "$" + parts[5],
+		"$argon2id$v=19$m=64,t=1,p=1$" + parts[4] + "$",
+		"$argon2id$v=19$m=64,t=1,p=1$" + parts[4] + "$!!!",
+		"$scrypt$ln=63,r=8,p=1$c2FsdA$a2V5",
+		"$scrypt$ln=4,r=8$c2FsdA$a2V5",
+		"$pbkdf2-sha256$i=0$c2FsdA$a2V5",
+		"$pbkdf2-sha256$i=abc$c2FsdA$a2V5",
+		"$pbkdf2-sha256$i=10$c2FsdA",
+		"$2a$04$short",
+	} {
+		ok, needsRehash := h.Verify("secret", encoded)
+		if ok || needsRehash {
+			t.Errorf("Verify(%q) = %v, %v, want false, false", encoded, ok, needsRehash)
+		}
+	}
+}
+
+func TestPasswordHasherVerifiesKnownHashes(t *testing.T) {
+	h := NewPasswordHasher(testPasswordHashParams(PasswordHashArgon2id))
+
+	// Hashes of the password "password" written by Python's hashlib.
+	for _, encoded := range []string{
+		"$pbkdf2-sha256$i=10$c2FsdHNhbHRzYWx0c2FsdA$zisGv7w+FNhC/2GFpMypXq9PiqpmiOFenMxxw5CX6JI",
+		"$scrypt$ln=4,r=8,p=1$c2FsdHNhbHRzYWx0c2FsdA$5f/Vi+XRWGUNGScbsma6KJ4zLFIke/NJsrvr7lQLAyA",
+	} {
+		ok, _ := h.Verify("password", encoded)
+		if !ok {
+			t.Errorf("Verify(%q) failed", encoded)
+		}
+	}
+}
+
+func TestPasswordHasherMaxPasswordBytes(t *testing.T) {
+	for _, algorithm := range passwordHashAlgorithms {
+		want := 0
+		if algorithm == PasswordHashBcrypt {
+			want = 72
+		}
+		if got := NewPasswordHasher(testPasswordHashParams(algorithm)).MaxPasswordBytes(); got != want {
+			t.Errorf("%s: MaxPasswordBytes = %d, want %d", algorithm, got, want)
+		}
+	}
+
+	// Algorithms without a cap hash every byte of a long password.
+	h := NewPasswordHasher(testPasswordHashParams(PasswordHashArgon2id))
+	long := strings.Repeat("a", 100)
+	encoded, err := h.Hash(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := h.Verify(long[:72], encoded); ok {
+		t.Error("argon2id ignored bytes after the 72nd")
+	}
+}
+
+func TestNewPasswordHasherUnknownAlgorithm(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("unknown algorithm did not panic")
+		}
+	}()
+	NewPasswordHasher(testPasswordHashParams("md5"))
+}
@@ -0,0 +1,142 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"lazy-auth/app/model"
+)
+
+// CheckPasswordPolicy returns every rule of the policy the password breaks,
+// nothing when it is accepted. userInputs are values such as the username
+// that the password must not contain when ForbidUserInfo is set.
+func CheckPasswordPolicy(
+	policy model.PasswordPolicy,
+	password string,
+	userInputs []string,
+) []model.PasswordPolicyViolation {
+	violations := []model.PasswordPolicyViolation{}
+	violate := func(code string, format string, args ...any) {
+		violations = append(violations, model.PasswordPolicyViolation{
+			Code:    code,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		violate("too_short", "must be at least %d characters", policy.MinLength)
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		violate("too_long", "must be at most %d characters", policy.MaxLength)
+	} else if policy.MaxBytes > 0 && len(password) > policy.MaxBytes {
+		violate("too_long", "must be at most %d bytes, accented and other non-ASCII characters count as several", policy.MaxBytes)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			symbol = true
+		}
+	}
+	if policy.RequireLowercase && !lower {
+		violate("missing_lowercase", "must contain a lowercase letter")
+	}
+	if policy.RequireUppercase && !upper {
+		violate("missing_uppercase", "must contain an uppercase letter")
+	}
+	if policy.RequireDigit && !digit {
+		violate("missing_digit", "must contain a digit")
+	}
+	if policy.RequireSymbol && !symbol {
+		violate("missing_symbol", "must contain a symbol")
+	}
+
+	if policy.MaxRepeated > 0 && maxRepeatedRunes(password) > policy.MaxRepeated {
+		violate("repeated_characters", "must not repeat a character more than %d times in a row", policy.MaxRepeated)
+	}
+
+	folded := strings.ToLower(password)
+	for _, word := range policy.ForbiddenWords {
+		if word != "" && strings.Contains(folded, strings.ToLower(word)) {
+			violate("forbidden_word", "must not contain %q", word)
+		}
+	}
+	if policy.ForbidUserInfo {
+		for _, input := range userInputs {
+			// Short values such as initials would reject too many passwords.
+			if utf8.RuneCountInString(input) >= 3 && strings.Contains(folded, strings.ToLower(input)) {
+				violate("contains_user_info", "must not contain your name, username or email")
+				break
+			}
+		}
+	}
+
+	if policy.MinEntropy > 0 && PasswordEntropy(password) < policy.MinEntropy {
+		violate("too_weak", "is too easy to guess, use a longer password")
+	}
+
+	return violations
+}
+
+// PasswordEntropy estimates the strength in bits as length times the bits
+// per character of the character classes used. It rates what a brute force
+// attack would face, not a dictionary attack.
+func PasswordEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	return float64(utf8.RuneCountInString(password)) * math.Log2(float64(pool))
+}
+
+func maxRepeatedRunes(password string) int {
+	longest, run := 0, 0
+	var previous rune = -1
+	for _, r := range password {
+		if r == previous {
+			run++
+		} else {
+			run = 1
+			previous = r
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
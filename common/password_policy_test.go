@@ -0,0 +1,115 @@
+package common
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"lazy-auth/app/model"
+)
+
+func violationCodes(violations []model.PasswordPolicyViolation) []string {
+	codes := []string{}
+	for _, violation := range violations {
+		codes = append(codes, violation.Code)
+	}
+	return codes
+}
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	strict := model.PasswordPolicy{
+		MinLength:        8,
+		MaxLength:        20,
+		RequireLowercase: true,
+		RequireUppercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		MaxRepeated:      2,
+		ForbiddenWords:   []string{"Acme"},
+		ForbidUserInfo:   true,
+	}
+	userInputs := []string{"jdoe", "jd", "john@example.com"}
+
+	tests := []struct {
+		name     string
+		policy   model.PasswordPolicy
+		password string
+		want     []string
+	}{
+		{"accepted", strict, "Tr0ub4dor&3", []string{}},
+		{"too short", strict, "Ab1!", []string{"too_short"}},
+		{"too long", strict, "Ab1!" + strings.Repeat("xy", 10), []string{"too_long"}},
+		{"length counts characters", strict, "Ab1!éééé", []string{"repeated_characters"}},
+		{"missing lowercase", strict, "TR0UB4DOR&3", []string{"missing_lowercase"}},
+		{"missing uppercase", strict, "tr0ub4dor&3", []string{"missing_uppercase"}},
+		{"missing digit", strict, "Troubador&x", []string{"missing_digit"}},
+		{"missing symbol", strict, "Tr0ub4dor33", []string{"missing_symbol"}},
+		{"repeated characters", strict, "Tr0ub4dooor&3", []string{"repeated_characters"}},
+		{"forbidden word ignores case", strict, "Tr0ub4-aCMe!", []string{"forbidden_word"}},
+		{"contains username", strict, "Tr0ub-JDoe!", []string{"contains_user_info"}},
+		{"short user info is ignored", strict, "Tr0ub4dor&jd", []string{}},
+		{
+			"several violations",
+			strict,
+			"aaaa",
+			[]string{"too_short", "missing_uppercase", "missing_digit", "missing_symbol", "repeated_characters"},
+		},
+		{"empty policy", model.PasswordPolicy{}, "", []string{}},
+		{"too weak", model.PasswordPolicy{MinEntropy: 50}, "abcdefgh", []string{"too_weak"}},
+		{"strong enough", model.PasswordPolicy{MinEntropy: 50}, "abcdefghijk1", []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := violationCodes(CheckPasswordPolicy(test.policy, test.password, userInputs))
+			if !slices.Equal(got, test.want) {
+				t.Errorf("CheckPasswordPolicy(%q) = %v, want %v", test.password, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckPasswordPolicyMaxBytes(t *testing.T) {
+	// 40 characters, 80 bytes.
+	accented := strings.Repeat("é", 40)
+
+	// Without MaxBytes, as with every hasher but bcrypt, only characters count.
+	got := violationCodes(CheckPasswordPolicy(model.PasswordPolicy{MaxLength: 64}, accented, nil))
+	if len(got) != 0 {
+		t.Errorf("without MaxBytes = %v, want none", got)
+	}
+
+	got = violationCodes(CheckPasswordPolicy(model.PasswordPolicy{MaxLength: 64, MaxBytes: 72}, accented, nil))
+	if !slices.Equal(got, []string{"too_long"}) {
+		t.Errorf("with MaxBytes = %v, want [too_long]", got)
+	}
+
+	got = violationCodes(CheckPasswordPolicy(model.PasswordPolicy{MaxBytes: 72}, strings.Repeat("a", 72), nil))
+	if len(got) != 0 {
+		t.Errorf("72 ASCII characters = %v, want none", got)
+	}
+
+	// Too many characters is reported once, not again for the bytes.
+	got = violationCodes(CheckPasswordPolicy(model.PasswordPolicy{MaxLength: 30, MaxBytes: 72}, accented, nil))
+	if !slices.Equal(got, []string{"too_long"}) {
+		t.Errorf("both limits = %v, want [too_long]", got)
+	}
+}
+
+func TestPasswordEntropy(t *testing.T) {
+	tests := []struct {
+		password string
+		want     float64
+	}{
+		{"", 0},
+		{"aaaa", 4 * math.Log2(26)},
+		{"aA1!", 4 * math.Log2(26+26+10+33)},
+		{"é", math.Log2(100)},
+	}
+	for _, test := range tests {
+		if got := PasswordEntropy(test.password); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("PasswordEntropy(%q) = %f, want %f", test.password, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package common
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// NormalizePhoneNumber returns a phone number in E.164 form. Separators are
+// dropped, a 00 prefix is read as +, and numbers without a country code use
+// defaultCountryCode with their trunk 0 removed.
+func NormalizePhoneNumber(phoneNumber string, defaultCountryCode string) (string, error) {
+	phoneNumber = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')', '\t':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(phoneNumber))
+
+	switch {
+	case strings.HasPrefix(phoneNumber, "+"):
+	case strings.HasPrefix(phoneNumber, "00"):
+		phoneNumber = "+" + phoneNumber[2:]
+	case defaultCountryCode != "":
+		phoneNumber = "+" + strings.TrimPrefix(defaultCountryCode, "+") + strings.TrimPrefix(phoneNumber, "0")
+	default:
+		return "", errors.New("phone number must start with a country code")
+	}
+
+	if !e164Pattern.MatchString(phoneNumber) {
+		return "", errors.New("phone number is invalid")
+	}
+	return phoneNumber, nil
+}
@@ -0,0 +1,105 @@
+package common
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PwnedPasswordHash returns the uppercase hex SHA-1 that Pwned Passwords
+// datasets are keyed by.
+func PwnedPasswordHash(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// FindPwnedSuffix reads "SUFFIX:COUNT" lines, as served by the range API and
+// stored in prefix files, and returns the count of suffix or 0.
+func FindPwnedSuffix(r io.Reader, suffix string) (int, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineSuffix, count, ok := parsePwnedLine(scanner.Text())
+		if ok && strings.EqualFold(lineSuffix, suffix) {
+			return count, nil
+		}
+	}
+	return 0, scanner.Err()
+}
+
+// ScanPwnedDataset calls fn with every full hash of a dataset, either a
+// directory of "<PREFIX>.txt" range files or one file of "HASH:COUNT" lines.
+func ScanPwnedDataset(source string, fn func(hash string, count int) error) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return scanPwnedFile(source, "", fn)
+	}
+
+	files, err := filepath.Glob(filepath.Join(source, "*.txt"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		prefix := strings.TrimSuffix(filepath.Base(file), ".txt")
+		err = scanPwnedFile(file, strings.ToUpper(prefix), fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanPwnedFile(path string, prefix string, fn func(hash string, count int) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		suffix, count, ok := parsePwnedLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		hash := prefix + strings.ToUpper(suffix)
+		if len(hash) != sha1.Size*2 {
+			return fmt.Errorf("%s: %q is not a SHA-1 hash", path, hash)
+		}
+		err = fn(hash, count)
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// parsePwnedLine splits "HASH:COUNT", a missing count is read as 1 so plain
+// hash lists work too.
+func parsePwnedLine(line string) (string, int, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return "", 0, false
+	}
+
+	hash, countStr, found := strings.Cut(line, ":")
+	if !found {
+		return hash, 1, true
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil {
+		return "", 0, false
+	}
+	return hash, count, true
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// PwnedPasswordHash("password") split into range prefix and suffix.
+const (
+	testPwnedPrefix = "5BAA6"
+	testPwnedSuffix = "1E4C9B93F3F0682250B6CF8331B7EE68FD8"
+)
+
+func TestPwnedPasswordHash(t *testing.T) {
+	if hash := PwnedPasswordHash("password"); hash != testPwnedPrefix+testPwnedSuffix {
+		t.Errorf("PwnedPasswordHash = %s", hash)
+	}
+}
+
+func TestFindPwnedSuffix(t *testing.T) {
+	// Range responses are padded with zero count lines.
+	rangeFile := strings.Join([]string{
+		"0018A45C4D1DEF81644B54AB7F969B88D65:10",
+		"",
+		"00D4F6E8FA6EECAD2A3AA415EEC418D38EC:0",
+		strings.ToLower(testPwnedSuffix) + ":9659365",
+		"011053FD0102E94D6AE2F8B83D76FAF94F6:oops",
+	}, "\r\n")
+
+	tests := []struct {
+		suffix string
+		count  int
+	}{
+		{testPwnedSuffix, 9659365},
+		{"0018A45C4D1DEF81644B54AB7F969B88D65", 10},
+		{"00D4F6E8FA6EECAD2A3AA415EEC418D38EC", 0},
+		{"011053FD0102E94D6AE2F8B83D76FAF94F6", 0},
+		{"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", 0},
+	}
+	for _, test := range tests {
+		count, err := FindPwnedSuffix(strings.NewReader(rangeFile), test.suffix)
+		if err != nil || count != test.count {
+			t.Errorf("FindPwnedSuffix(%s) = %d, %v, want %d", test.suffix, count, err, test.count)
+		}
+	}
+}
+
+func TestScanPwnedDataset(t *testing.T) {
+	collect := func(source string) (map[string]int, error) {
+		hashes := map[string]int{}
+		err := ScanPwnedDataset(source, func(hash string, count int) error {
+			hashes[hash] = count
+			return nil
+		})
+		return hashes, err
+	}
+	want := map[string]int{
+		testPwnedPrefix + testPwnedSuffix:          3,
+		"7C4A8D09CA3762AF61E59520943DC26494F8941B": 1,
+	}
+
+	// A range directory, file names are the prefixes.
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, strings.ToLower(testPwnedPrefix)+".txt"), testPwnedSuffix+":3\n")
+	writeTestFile(t, filepath.Join(dir, "7C4A8.txt"), "D09CA3762AF61E59520943DC26494F8941B:1\n")
+	writeTestFile(t, filepath.Join(dir, "README"), "not a range file\n")
+	hashes, err := collect(dir)
+	if err != nil || !reflect.DeepEqual(hashes, want) {
+		t.Errorf("directory: hashes = %v, %v", hashes, err)
+	}
+
+	// One file of full hashes, a missing count is read as 1.
+	file := filepath.Join(t.TempDir(), "pwned.txt")
+	writeTestFile(t, file, testPwnedPrefix+testPwnedSuffix+":3\n\n7c4a8d09ca3762af61e59520943dc26494f8941b\n")
+	hashes, err = collect(file)
+	if err != nil || !reflect.DeepEqual(hashes, want) {
+		t.Errorf("file: hashes = %v, %v", hashes, err)
+	}
+
+	writeTestFile(t, file, "5BAA61E4C9B93F3F:3\n")
+	if _, err := collect(file); err == nil {
+		t.Error("a short hash was accepted")
+	}
+
+	if _, err := collect(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("a missing dataset was accepted")
+	}
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
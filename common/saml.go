@@ -0,0 +1,63 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+type SamlCertificate struct {
+	PrivateKey  *rsa.PrivateKey
+	Certificate *x509.Certificate
+}
+
+// LoadSamlCertificate reads the PEM encoded key pair used to sign SAML
+// messages. When no files are configured a throwaway self-signed certificate
+// is generated, connections must then be re-configured after a restart.
+func LoadSamlCertificate(keyFile string, certificateFile string) *SamlCertificate {
+	if keyFile == "" || certificateFile == "" {
+		fmt.Println("[SAML] [WARNING] No certificate configured, generating an ephemeral certificate.")
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+
+		template := x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: "lazy-auth"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().AddDate(1, 0, 0),
+			KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+		if err != nil {
+			panic(err)
+		}
+		certificate, err := x509.ParseCertificate(der)
+		if err != nil {
+			panic(err)
+		}
+
+		return &SamlCertificate{PrivateKey: key, Certificate: certificate}
+	}
+
+	keyPair, err := tls.LoadX509KeyPair(certificateFile, keyFile)
+	if err != nil {
+		panic(err)
+	}
+	key, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		panic("saml key must be an RSA private key")
+	}
+	certificate, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		panic(err)
+	}
+
+	return &SamlCertificate{PrivateKey: key, Certificate: certificate}
+}
@@ -0,0 +1,462 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ScimFilter is a parsed SCIM filter expression (RFC 7644 section 3.4.2.2).
+type ScimFilter interface {
+	scimFilter()
+}
+
+type scimCompare struct {
+	Attribute string
+	Operator  string
+	Value     any
+}
+
+type scimLogical struct {
+	Operator string
+	Left     ScimFilter
+	Right    ScimFilter
+}
+
+type scimNot struct {
+	Filter ScimFilter
+}
+
+// scimValuePath is a filter on the sub-attributes of a multi-valued
+// attribute, such as emails[type eq "work"].
+type scimValuePath struct {
+	Attribute string
+	Filter    ScimFilter
+}
+
+func (scimCompare) scimFilter()   {}
+func (scimLogical) scimFilter()   {}
+func (scimNot) scimFilter()       {}
+func (scimValuePath) scimFilter() {}
+
+type ScimColumnType int
+
+const (
+	ScimString ScimColumnType = iota
+	ScimBool
+	ScimTime
+)
+
+// ScimColumn maps a SCIM attribute to the SQL expression holding it.
+type ScimColumn struct {
+	Expr      string
+	Type      ScimColumnType
+	CaseExact bool
+}
+
+// ScimPath is a parsed PATCH operation path.
+type ScimPath struct {
+	Attribute    string
+	Filter       ScimFilter
+	SubAttribute string
+}
+
+var scimOperators = []string{"eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le"}
+
+func ParseScimFilter(filter string) (ScimFilter, error) {
+	p, err := newScimParser(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q in filter", p.peek())
+	}
+	return expr, nil
+}
+
+// ParseScimPath parses attrPath or valuePath["."subAttr], with attribute
+// names lowercased and the schema URN removed.
+func ParseScimPath(path string) (*ScimPath, error) {
+	p, err := newScimParser(path)
+	if err != nil {
+		return nil, err
+	}
+	if p.done() {
+		return nil, errors.New("path is empty")
+	}
+
+	scimPath := ScimPath{Attribute: normalizeScimAttribute(p.next())}
+	if p.peek() == "[" {
+		p.next()
+		scimPath.Filter, err = p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != "]" {
+			return nil, errors.New("missing ] in path")
+		}
+		if strings.HasPrefix(p.peek(), ".") {
+			scimPath.SubAttribute = strings.ToLower(strings.TrimPrefix(p.next(), "."))
+		}
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q in path", p.peek())
+	}
+
+	if attribute, subAttribute, ok := strings.Cut(scimPath.Attribute, "."); ok && scimPath.Filter == nil {
+		scimPath.Attribute = attribute
+		scimPath.SubAttribute = subAttribute
+	}
+	return &scimPath, nil
+}
+
+// ScimFilterValues returns the values compared with "attribute eq", for
+// filters like value eq "a" or value eq "b".
+func ScimFilterValues(filter ScimFilter, attribute string) []string {
+	switch f := filter.(type) {
+	case scimCompare:
+		if f.Attribute == attribute && f.Operator == "eq" {
+			if value, ok := f.Value.(string); ok {
+				return []string{value}
+			}
+		}
+	case scimLogical:
+		if f.Operator == "or" {
+			return append(ScimFilterValues(f.Left, attribute), ScimFilterValues(f.Right, attribute)...)
+		}
+	}
+	return nil
+}
+
+// ScimFilterToSQL translates a filter into a WHERE clause over columns,
+// keyed by lowercased attribute path.
+func ScimFilterToSQL(filter ScimFilter, columns map[string]ScimColumn) (string, []any, error) {
+	return scimFilterToSQL(filter, columns, "")
+}
+
+func scimFilterToSQL(filter ScimFilter, columns map[string]ScimColumn, prefix string) (string, []any, error) {
+	switch f := filter.(type) {
+	case scimLogical:
+		left, leftArgs, err := scimFilterToSQL(f.Left, columns, prefix)
+		if err != nil {
+			return "", nil, err
+		}
+		right, rightArgs, err := scimFilterToSQL(f.Right, columns, prefix)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("(%s %s %s)", left, strings.ToUpper(f.Operator), right), append(leftArgs, rightArgs...), nil
+
+	case scimNot:
+		inner, args, err := scimFilterToSQL(f.Filter, columns, prefix)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("(NOT %s)", inner), args, nil
+
+	case scimValuePath:
+		return scimFilterToSQL(f.Filter, columns, f.Attribute+".")
+
+	case scimCompare:
+		attribute := prefix + f.Attribute
+		column, ok := columns[attribute]
+		if !ok {
+			column, ok = columns[attribute+".value"]
+		}
+		if !ok {
+			return "", nil, fmt.Errorf("attribute %s cannot be filtered", attribute)
+		}
+		return scimCompareToSQL(f, column)
+	}
+	return "", nil, errors.New("invalid filter")
+}
+
+func scimCompareToSQL(f scimCompare, column ScimColumn) (string, []any, error) {
+	expr := column.Expr
+
+	if f.Operator == "pr" {
+		if column.Type == ScimString {
+			return fmt.Sprintf("(%s IS NOT NULL AND %s <> '')", expr, expr), nil, nil
+		}
+		return fmt.Sprintf("(%s IS NOT NULL)", expr), nil, nil
+	}
+
+	if f.Value == nil {
+		switch f.Operator {
+		case "eq":
+			return fmt.Sprintf("(%s IS NULL)", expr), nil, nil
+		case "ne":
+			return fmt.Sprintf("(%s IS NOT NULL)", expr), nil, nil
+		}
+		return "", nil, fmt.Errorf("operator %s needs a value", f.Operator)
+	}
+
+	var value any
+	switch column.Type {
+	case ScimBool:
+		b, ok := f.Value.(bool)
+		if !ok || (f.Operator != "eq" && f.Operator != "ne") {
+			return "", nil, fmt.Errorf("attribute %s only supports eq and ne with a boolean", f.Attribute)
+		}
+		value = b
+	case ScimTime:
+		s, ok := f.Value.(string)
+		if !ok {
+			return "", nil, fmt.Errorf("attribute %s needs a date time", f.Attribute)
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return "", nil, fmt.Errorf("attribute %s needs a date time", f.Attribute)
+		}
+		value = t
+	default:
+		s, ok := f.Value.(string)
+		if !ok {
+			return "", nil, fmt.Errorf("attribute %s needs a string", f.Attribute)
+		}
+		value = s
+	}
+
+	if column.Type == ScimString && !column.CaseExact {
+		expr = "LOWER(" + expr + ")"
+		value = strings.ToLower(value.(string))
+	}
+
+	switch f.Operator {
+	case "eq":
+		return fmt.Sprintf("(%s = ?)", expr), []any{value}, nil
+	case "ne":
+		return fmt.Sprintf("(%s <> ?)", expr), []any{value}, nil
+	case "gt":
+		return fmt.Sprintf("(%s > ?)", expr), []any{value}, nil
+	case "ge":
+		return fmt.Sprintf("(%s >= ?)", expr), []any{value}, nil
+	case "lt":
+		return fmt.Sprintf("(%s < ?)", expr), []any{value}, nil
+	case "le":
+		return fmt.Sprintf("(%s <= ?)", expr), []any{value}, nil
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", nil, fmt.Errorf("operator %s needs a string", f.Operator)
+	}
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	switch f.Operator {
+	case "co":
+		s = "%" + s + "%"
+	case "sw":
+		s = s + "%"
+	case "ew":
+		s = "%" + s
+	}
+	return fmt.Sprintf("(%s LIKE ?)", expr), []any{s}, nil
+}
+
+type scimParser struct {
+	tokens []string
+	pos    int
+}
+
+func newScimParser(input string) (*scimParser, error) {
+	tokens, err := tokenizeScimFilter(input)
+	if err != nil {
+		return nil, err
+	}
+	return &scimParser{tokens: tokens}, nil
+}
+
+func (p *scimParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *scimParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *scimParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *scimParser) parseOr() (ScimFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = scimLogical{Operator: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *scimParser) parseAnd() (ScimFilter, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = scimLogical{Operator: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *scimParser) parseFactor() (ScimFilter, error) {
+	if strings.EqualFold(p.peek(), "not") {
+		p.next()
+		if p.peek() != "(" {
+			return nil, errors.New("not must be followed by (")
+		}
+		inner, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return scimNot{Filter: inner}, nil
+	}
+
+	if p.peek() == "(" {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing ) in filter")
+		}
+		return inner, nil
+	}
+
+	token := p.next()
+	if token == "" || strings.ContainsAny(token[:1], `()[]"`) {
+		return nil, errors.New("attribute expected in filter")
+	}
+	attribute := normalizeScimAttribute(token)
+
+	if p.peek() == "[" {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != "]" {
+			return nil, errors.New("missing ] in filter")
+		}
+		return scimValuePath{Attribute: attribute, Filter: inner}, nil
+	}
+
+	operator := strings.ToLower(p.next())
+	if operator == "pr" {
+		return scimCompare{Attribute: attribute, Operator: operator}, nil
+	}
+	if !slices.Contains(scimOperators, operator) {
+		return nil, fmt.Errorf("unknown operator %q in filter", operator)
+	}
+	if p.done() {
+		return nil, errors.New("value expected in filter")
+	}
+
+	value, err := parseScimValue(p.next())
+	if err != nil {
+		return nil, err
+	}
+	return scimCompare{Attribute: attribute, Operator: operator, Value: value}, nil
+}
+
+func parseScimValue(token string) (any, error) {
+	switch strings.ToLower(token) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	if strings.HasPrefix(token, `"`) {
+		var value string
+		if err := json.Unmarshal([]byte(token), &value); err != nil {
+			return nil, fmt.Errorf("invalid string %s in filter", token)
+		}
+		return value, nil
+	}
+
+	var number float64
+	if err := json.Unmarshal([]byte(token), &number); err != nil {
+		return nil, fmt.Errorf("invalid value %s in filter", token)
+	}
+	return number, nil
+}
+
+// tokenizeScimFilter splits on spaces, brackets and parentheses, keeping
+// quoted strings and ".subAttr" after a closing bracket as single tokens.
+func tokenizeScimFilter(input string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(input); j++ {
+				if input[j] == '\\' {
+					j++
+					continue
+				}
+				if input[j] == '"' {
+					break
+				}
+			}
+			if j >= len(input) {
+				return nil, errors.New("unterminated string in filter")
+			}
+			tokens = append(tokens, input[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(input) && !strings.ContainsRune(" \t\n()[]\"", rune(input[j])) {
+				j++
+			}
+			tokens = append(tokens, input[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// normalizeScimAttribute lowercases an attribute path and removes a leading
+// schema URN, so "urn:ietf:params:scim:schemas:core:2.0:User:userName" and
+// "username" are the same.
+func normalizeScimAttribute(attribute string) string {
+	if strings.HasPrefix(strings.ToLower(attribute), "urn:") {
+		if i := strings.LastIndex(attribute, ":"); i >= 0 {
+			attribute = attribute[i+1:]
+		}
+	}
+	return strings.ToLower(attribute)
+}
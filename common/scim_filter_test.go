@@ -0,0 +1,182 @@
+package common
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testScimColumns = map[string]ScimColumn{
+	"id":             {Expr: "id", CaseExact: true},
+	"username":       {Expr: "username"},
+	"name.givenname": {Expr: "first_name"},
+	"emails.value":   {Expr: "email"},
+	"emails.type":    {Expr: "'work'"},
+	"active":         {Expr: "(NOT disabled_flag)", Type: ScimBool},
+	"meta.created":   {Expr: "created_at", Type: ScimTime},
+}
+
+func TestScimFilterToSQL(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		filter   string
+		wantSQL  string
+		wantArgs []any
+	}{
+		{`userName eq "JDoe"`, "(LOWER(username) = ?)", []any{"jdoe"}},
+		{`id eq "AbC"`, "(id = ?)", []any{"AbC"}},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName ne "a"`, "(LOWER(username) <> ?)", []any{"a"}},
+		{`name.givenName sw "Jo"`, "(LOWER(first_name) LIKE ?)", []any{"jo%"}},
+		{`emails co "example"`, "(LOWER(email) LIKE ?)", []any{"%example%"}},
+		{`userName ew "%_\\"`, "(LOWER(username) LIKE ?)", []any{`%\%\_\\`}},
+		{`userName pr`, "(username IS NOT NULL AND username <> '')", nil},
+		{`meta.created pr`, "(created_at IS NOT NULL)", nil},
+		{`userName eq null`, "(username IS NULL)", nil},
+		{`active eq true`, "((NOT disabled_flag) = ?)", []any{true}},
+		{`meta.created gt "2024-01-02T03:04:05Z"`, "(created_at > ?)", []any{created}},
+		{`meta.created le "2024-01-02T03:04:05Z"`, "(created_at <= ?)", []any{created}},
+		{
+			`userName eq "a" or userName eq "b" and active eq false`,
+			"((LOWER(username) = ?) OR ((LOWER(username) = ?) AND ((NOT disabled_flag) = ?)))",
+			[]any{"a", "b", false},
+		},
+		{
+			`(userName eq "a" or userName eq "b") and not (active eq false)`,
+			"(((LOWER(username) = ?) OR (LOWER(username) = ?)) AND (NOT ((NOT disabled_flag) = ?)))",
+			[]any{"a", "b", false},
+		},
+		{
+			`emails[type eq "work" and value co "@example.com"]`,
+			"((LOWER('work') = ?) AND (LOWER(email) LIKE ?))",
+			[]any{"work", "%@example.com%"},
+		},
+		{`USERNAME EQ "x" AND ACTIVE PR`, "((LOWER(username) = ?) AND ((NOT disabled_flag) IS NOT NULL))", []any{"x"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filter, func(t *testing.T) {
+			filter, err := ParseScimFilter(test.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sql, args, err := ScimFilterToSQL(filter, testScimColumns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != test.wantSQL {
+				t.Errorf("sql = %s, want %s", sql, test.wantSQL)
+			}
+			if !reflect.DeepEqual(args, test.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, test.wantArgs)
+			}
+		})
+	}
+}
+
+func TestScimFilterKeepsValuesOutOfSQL(t *testing.T) {
+	filter, err := ParseScimFilter(`userName eq "x') OR 1=1 --"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, args, err := ScimFilterToSQL(filter, testScimColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql != "(LOWER(username) = ?)" || !reflect.DeepEqual(args, []any{"x') or 1=1 --"}) {
+		t.Errorf("got %s %#v", sql, args)
+	}
+}
+
+func TestParseScimFilterErrors(t *testing.T) {
+	for _, filter := range []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName like "a"`,
+		`userName eq "a`,
+		`userName eq "a" and`,
+		`userName eq "a" extra`,
+		`(userName eq "a"`,
+		`not userName eq "a"`,
+		`emails[type eq "work"`,
+		`eq "a"`,
+		`"a" eq "a"`,
+		`userName eq a`,
+	} {
+		if _, err := ParseScimFilter(filter); err == nil {
+			t.Errorf("ParseScimFilter(%q) did not fail", filter)
+		}
+	}
+}
+
+func TestScimFilterToSQLErrors(t *testing.T) {
+	for _, filter := range []string{
+		`password eq "a"`,
+		`emails[password eq "a"]`,
+		`active eq "yes"`,
+		`active gt true`,
+		`userName eq true`,
+		`userName gt null`,
+		`meta.created gt "yesterday"`,
+		`meta.created co "2024"`,
+		`userName eq 1`,
+	} {
+		parsed, err := ParseScimFilter(filter)
+		if err != nil {
+			t.Fatalf("ParseScimFilter(%q): %v", filter, err)
+		}
+		if _, _, err := ScimFilterToSQL(parsed, testScimColumns); err == nil {
+			t.Errorf("ScimFilterToSQL(%q) did not fail", filter)
+		}
+	}
+}
+
+func TestScimFilterValues(t *testing.T) {
+	filter, err := ParseScimFilter(`value eq "a" or value eq "b" or display eq "c"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ScimFilterValues(filter, "value"); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("ScimFilterValues = %v, want [a b]", got)
+	}
+
+	filter, _ = ParseScimFilter(`value eq "a" and value eq "b"`)
+	if got := ScimFilterValues(filter, "value"); got != nil {
+		t.Errorf("ScimFilterValues of and = %v, want nil", got)
+	}
+}
+
+func TestParseScimPath(t *testing.T) {
+	tests := []struct {
+		path             string
+		wantAttribute    string
+		wantSubAttribute string
+		wantFilter       bool
+	}{
+		{"userName", "username", "", false},
+		{"name.givenName", "name", "givenname", false},
+		{"urn:ietf:params:scim:schemas:core:2.0:User:active", "active", "", false},
+		{`members[value eq "123"]`, "members", "", true},
+		{`emails[type eq "work"].value`, "emails", "value", true},
+	}
+	for _, test := range tests {
+		path, err := ParseScimPath(test.path)
+		if err != nil {
+			t.Errorf("ParseScimPath(%q): %v", test.path, err)
+			continue
+		}
+		if path.Attribute != test.wantAttribute ||
+			path.SubAttribute != test.wantSubAttribute ||
+			(path.Filter != nil) != test.wantFilter {
+			t.Errorf("ParseScimPath(%q) = %+v", test.path, path)
+		}
+	}
+
+	for _, path := range []string{"", `members[value eq "1"`, "members extra", `members[value eq "1"] extra`} {
+		if _, err := ParseScimPath(path); err == nil {
+			t.Errorf("ParseScimPath(%q) did not fail", path)
+		}
+	}
+}
@@ -1,25 +1,106 @@
 package config
 
 import (
+	"errors"
+
 	"github.com/spf13/viper"
 	"gopkg.in/validator.v2"
 )
 
 type ConfigEnv struct {
-	Stage                    string `mapstructure:"GO_AUTH_STAGE"                        validate:"nonzero"`
-	Port                     string `mapstructure:"GO_AUTH_PORT"                         validate:"nonzero"`
-	AdminSecret              string `mapstructure:"GO_AUTH_ADMIN_SECRET"                 validate:"nonzero,len=32"`
-	JwtTokenSecret           string `mapstructure:"GO_AUTH_JWT_TOKEN_SECRET"             validate:"nonzero,len=32"`
-	JwtRefreshTokenSecret    string `mapstructure:"GO_AUTH_JWT_REFRESH_TOKEN_SECRET"     validate:"nonzero,len=32"`
-	JwtTokenExpiresIn        string `mapstructure:"GO_AUTH_JWT_TOKEN_EXPIRES_IN"         validate:"nonzero"`
-	JwtRefreshTokenExpiresIn string `mapstructure:"GO_AUTH_JWT_REFRESH_TOKEN_EXPIRES_IN" validate:"nonzero"`
-	DataBaseHost             string `mapstructure:"GO_AUTH_DB_HOST"                      validate:"nonzero"`
-	DataBasePort             string `mapstructure:"GO_AUTH_DB_PORT"                      validate:"nonzero"`
-	DataBaseName             string `mapstructure:"GO_AUTH_DB_NAME"                      validate:"nonzero"`
-	DataBaseUser             string `mapstructure:"GO_AUTH_DB_USER"                      validate:"nonzero"`
-	DataBasePassword         string `mapstructure:"GO_AUTH_DB_PASS"                      validate:"nonzero"`
-	DataBaseAutoMigrate      bool   `mapstructure:"GO_AUTH_DB_AUTO_MIGRATE"`
-	TicketExpiresIn          string `mapstructure:"GO_AUTH_TICKET_EXPIRES_IN"`
+	Stage                    string  `mapstructure:"GO_AUTH_STAGE"                        validate:"nonzero"`
+	Port                     string  `mapstructure:"GO_AUTH_PORT"                         validate:"nonzero"`
+	AdminSecret              string  `mapstructure:"GO_AUTH_ADMIN_SECRET"                 validate:"nonzero,len=32"`
+	JwtTokenSecret           string  `mapstructure:"GO_AUTH_JWT_TOKEN_SECRET"             validate:"nonzero,len=32"`
+	JwtRefreshTokenSecret    string  `mapstructure:"GO_AUTH_JWT_REFRESH_TOKEN_SECRET"     validate:"nonzero,len=32"`
+	JwtTokenExpiresIn        string  `mapstructure:"GO_AUTH_JWT_TOKEN_EXPIRES_IN"         validate:"nonzero"`
+	JwtRefreshTokenExpiresIn string  `mapstructure:"GO_AUTH_JWT_REFRESH_TOKEN_EXPIRES_IN" validate:"nonzero"`
+	DataBaseHost             string  `mapstructure:"GO_AUTH_DB_HOST"                      validate:"nonzero"`
+	DataBasePort             string  `mapstructure:"GO_AUTH_DB_PORT"                      validate:"nonzero"`
+	DataBaseName             string  `mapstructure:"GO_AUTH_DB_NAME"                      validate:"nonzero"`
+	DataBaseUser             string  `mapstructure:"GO_AUTH_DB_USER"                      validate:"nonzero"`
+	DataBasePassword         string  `mapstructure:"GO_AUTH_DB_PASS"                      validate:"nonzero"`
+	DataBaseAutoMigrate      bool    `mapstructure:"GO_AUTH_DB_AUTO_MIGRATE"`
+	TicketExpiresIn          string  `mapstructure:"GO_AUTH_TICKET_EXPIRES_IN"`
+	Issuer                   string  `mapstructure:"GO_AUTH_ISSUER"                       validate:"nonzero"`
+	OAuthCodeExpiresIn       string  `mapstructure:"GO_AUTH_OAUTH_CODE_EXPIRES_IN"`
+	OidcSigningKeyFile       string  `mapstructure:"GO_AUTH_OIDC_SIGNING_KEY_FILE"`
+	DeviceCodeExpiresIn      string  `mapstructure:"GO_AUTH_OAUTH_DEVICE_CODE_EXPIRES_IN"`
+	DeviceVerificationURI    string  `mapstructure:"GO_AUTH_OAUTH_DEVICE_VERIFICATION_URI"`
+	OAuthInitialAccessToken  string  `mapstructure:"GO_AUTH_OAUTH_INITIAL_ACCESS_TOKEN"`
+	SecretEncryptionKey      string  `mapstructure:"GO_AUTH_SECRET_ENCRYPTION_KEY"         validate:"len=32"`
+	SamlKeyFile              string  `mapstructure:"GO_AUTH_SAML_KEY_FILE"`
+	SamlCertificateFile      string  `mapstructure:"GO_AUTH_SAML_CERTIFICATE_FILE"`
+	SamlIdpSsoURL            string  `mapstructure:"GO_AUTH_SAML_IDP_SSO_URL"`
+	LdapURL                  string  `mapstructure:"GO_AUTH_LDAP_URL"`
+	LdapStartTLS             bool    `mapstructure:"GO_AUTH_LDAP_START_TLS"`
+	LdapTLSCAFile            string  `mapstructure:"GO_AUTH_LDAP_TLS_CA_FILE"`
+	LdapTLSSkipVerify        bool    `mapstructure:"GO_AUTH_LDAP_TLS_SKIP_VERIFY"`
+	LdapBindDN               string  `mapstructure:"GO_AUTH_LDAP_BIND_DN"`
+	LdapBindPassword         string  `mapstructure:"GO_AUTH_LDAP_BIND_PASSWORD"`
+	LdapUserDNTemplate       string  `mapstructure:"GO_AUTH_LDAP_USER_DN_TEMPLATE"`
+	LdapBaseDN               string  `mapstructure:"GO_AUTH_LDAP_BASE_DN"`
+	LdapUserFilter           string  `mapstructure:"GO_AUTH_LDAP_USER_FILTER"`
+	LdapUsernameAttribute    string  `mapstructure:"GO_AUTH_LDAP_USERNAME_ATTRIBUTE"`
+	LdapEmailAttribute       string  `mapstructure:"GO_AUTH_LDAP_EMAIL_ATTRIBUTE"`
+	LdapDisplayNameAttribute string  `mapstructure:"GO_AUTH_LDAP_DISPLAY_NAME_ATTRIBUTE"`
+	LdapFirstNameAttribute   string  `mapstructure:"GO_AUTH_LDAP_FIRST_NAME_ATTRIBUTE"`
+	LdapLastNameAttribute    string  `mapstructure:"GO_AUTH_LDAP_LAST_NAME_ATTRIBUTE"`
+	LdapGroupAttribute       string  `mapstructure:"GO_AUTH_LDAP_GROUP_ATTRIBUTE"`
+	LdapGroupBaseDN          string  `mapstructure:"GO_AUTH_LDAP_GROUP_BASE_DN"`
+	LdapGroupFilter          string  `mapstructure:"GO_AUTH_LDAP_GROUP_FILTER"`
+	LdapGroupRoleMapping     string  `mapstructure:"GO_AUTH_LDAP_GROUP_ROLE_MAPPING"`
+	LdapDefaultRole          string  `mapstructure:"GO_AUTH_LDAP_DEFAULT_ROLE"`
+	LdapSyncFilter           string  `mapstructure:"GO_AUTH_LDAP_SYNC_FILTER"`
+	LdapSyncTime             string  `mapstructure:"GO_AUTH_LDAP_SYNC_TIME"`
+	Mailer                   string  `mapstructure:"GO_AUTH_MAILER"`
+	MailFrom                 string  `mapstructure:"GO_AUTH_MAIL_FROM"`
+	SmtpHost                 string  `mapstructure:"GO_AUTH_SMTP_HOST"`
+	SmtpPort                 string  `mapstructure:"GO_AUTH_SMTP_PORT"`
+	SmtpUsername             string  `mapstructure:"GO_AUTH_SMTP_USERNAME"`
+	SmtpPassword             string  `mapstructure:"GO_AUTH_SMTP_PASSWORD"`
+	MagicLinkURL             string  `mapstructure:"GO_AUTH_MAGIC_LINK_URL"`
+	MagicLinkExpiresIn       string  `mapstructure:"GO_AUTH_MAGIC_LINK_EXPIRES_IN"`
+	MagicLinkSameBrowser     bool    `mapstructure:"GO_AUTH_MAGIC_LINK_SAME_BROWSER"`
+	EmailOtpExpiresIn        string  `mapstructure:"GO_AUTH_EMAIL_OTP_EXPIRES_IN"`
+	EmailOtpMaxAttempts      int     `mapstructure:"GO_AUTH_EMAIL_OTP_MAX_ATTEMPTS"`
+	EmailOtpMaxPerHour       int     `mapstructure:"GO_AUTH_EMAIL_OTP_MAX_PER_HOUR"`
+	SmsSender                string  `mapstructure:"GO_AUTH_SMS_SENDER"`
+	SmsFile                  string  `mapstructure:"GO_AUTH_SMS_FILE"`
+	SmsGatewayURL            string  `mapstructure:"GO_AUTH_SMS_GATEWAY_URL"`
+	SmsGatewayToken          string  `mapstructure:"GO_AUTH_SMS_GATEWAY_TOKEN"`
+	SmsDefaultCountryCode    string  `mapstructure:"GO_AUTH_SMS_DEFAULT_COUNTRY_CODE"`
+	SmsOtpExpiresIn          string  `mapstructure:"GO_AUTH_SMS_OTP_EXPIRES_IN"`
+	SmsOtpMaxAttempts        int     `mapstructure:"GO_AUTH_SMS_OTP_MAX_ATTEMPTS"`
+	SmsOtpMaxPerHour         int     `mapstructure:"GO_AUTH_SMS_OTP_MAX_PER_HOUR"`
+	LoginIdentifier          string  `mapstructure:"GO_AUTH_LOGIN_IDENTIFIER"`
+	EmailFoldGmail           bool    `mapstructure:"GO_AUTH_EMAIL_FOLD_GMAIL"`
+	PasswordMinLength        int     `mapstructure:"GO_AUTH_PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength        int     `mapstructure:"GO_AUTH_PASSWORD_MAX_LENGTH"`
+	PasswordRequireLowercase bool    `mapstructure:"GO_AUTH_PASSWORD_REQUIRE_LOWERCASE"`
+	PasswordRequireUppercase bool    `mapstructure:"GO_AUTH_PASSWORD_REQUIRE_UPPERCASE"`
+	PasswordRequireDigit     bool    `mapstructure:"GO_AUTH_PASSWORD_REQUIRE_DIGIT"`
+	PasswordRequireSymbol    bool    `mapstructure:"GO_AUTH_PASSWORD_REQUIRE_SYMBOL"`
+	PasswordMaxRepeated      int     `mapstructure:"GO_AUTH_PASSWORD_MAX_REPEATED"`
+	PasswordMinEntropy       float64 `mapstructure:"GO_AUTH_PASSWORD_MIN_ENTROPY"`
+	PasswordForbiddenWords   string  `mapstructure:"GO_AUTH_PASSWORD_FORBIDDEN_WORDS"`
+	PasswordForbidUserInfo   bool    `mapstructure:"GO_AUTH_PASSWORD_FORBID_USER_INFO"`
+	BreachedPasswordMode     string  `mapstructure:"GO_AUTH_BREACHED_PASSWORD_MODE"`
+	BreachedPasswordFile     string  `mapstructure:"GO_AUTH_BREACHED_PASSWORD_FILE"`
+	BreachedPasswordURL      string  `mapstructure:"GO_AUTH_BREACHED_PASSWORD_URL"`
+	BreachedPasswordMinCount int     `mapstructure:"GO_AUTH_BREACHED_PASSWORD_MIN_COUNT"`
+	PasswordHistory          int     `mapstructure:"GO_AUTH_PASSWORD_HISTORY"`
+	PasswordMaxAgeDays       int     `mapstructure:"GO_AUTH_PASSWORD_MAX_AGE_DAYS"`
+	PasswordChangeExpiresIn  string  `mapstructure:"GO_AUTH_PASSWORD_CHANGE_TOKEN_EXPIRES_IN"`
+	PasswordHasher           string  `mapstructure:"GO_AUTH_PASSWORD_HASHER"`
+	BcryptCost               int     `mapstructure:"GO_AUTH_BCRYPT_COST"`
+	Argon2Memory             uint32  `mapstructure:"GO_AUTH_ARGON2_MEMORY"`
+	Argon2Iterations         uint32  `mapstructure:"GO_AUTH_ARGON2_ITERATIONS"`
+	Argon2Parallelism        uint8   `mapstructure:"GO_AUTH_ARGON2_PARALLELISM"`
+	ScryptLogN               uint8   `mapstructure:"GO_AUTH_SCRYPT_LOG_N"`
+	ScryptR                  int     `mapstructure:"GO_AUTH_SCRYPT_R"`
+	ScryptP                  int     `mapstructure:"GO_AUTH_SCRYPT_P"`
+	Pbkdf2Iterations         int     `mapstructure:"GO_AUTH_PBKDF2_ITERATIONS"`
 }
 
 func ConfigService() (configEnv ConfigEnv) {
@@ -37,6 +118,47 @@ func ConfigService() (configEnv ConfigEnv) {
 	viper.SetDefault("GO_AUTH_DB_PORT", "5432")
 	viper.SetDefault("GO_AUTH_DB_AUTO_MIGRATE", false)
 	viper.SetDefault("GO_AUTH_TICKET_EXPIRES_IN", "1h")
+	viper.SetDefault("GO_AUTH_ISSUER", "http://localhost:3000")
+	viper.SetDefault("GO_AUTH_OAUTH_CODE_EXPIRES_IN", "1m")
+	viper.SetDefault("GO_AUTH_OAUTH_DEVICE_CODE_EXPIRES_IN", "10m")
+	viper.SetDefault("GO_AUTH_LDAP_USER_FILTER", "(uid=%s)")
+	viper.SetDefault("GO_AUTH_LDAP_USERNAME_ATTRIBUTE", "uid")
+	viper.SetDefault("GO_AUTH_LDAP_EMAIL_ATTRIBUTE", "mail")
+	viper.SetDefault("GO_AUTH_LDAP_DISPLAY_NAME_ATTRIBUTE", "displayName")
+	viper.SetDefault("GO_AUTH_LDAP_FIRST_NAME_ATTRIBUTE", "givenName")
+	viper.SetDefault("GO_AUTH_LDAP_LAST_NAME_ATTRIBUTE", "sn")
+	viper.SetDefault("GO_AUTH_LDAP_GROUP_ATTRIBUTE", "memberOf")
+	viper.SetDefault("GO_AUTH_LDAP_DEFAULT_ROLE", "user")
+	viper.SetDefault("GO_AUTH_MAILER", "log")
+	viper.SetDefault("GO_AUTH_SMTP_PORT", "587")
+	viper.SetDefault("GO_AUTH_MAGIC_LINK_EXPIRES_IN", "15m")
+	viper.SetDefault("GO_AUTH_EMAIL_OTP_EXPIRES_IN", "5m")
+	viper.SetDefault("GO_AUTH_EMAIL_OTP_MAX_ATTEMPTS", 5)
+	viper.SetDefault("GO_AUTH_EMAIL_OTP_MAX_PER_HOUR", 5)
+	viper.SetDefault("GO_AUTH_SMS_SENDER", "log")
+	viper.SetDefault("GO_AUTH_SMS_OTP_EXPIRES_IN", "5m")
+	viper.SetDefault("GO_AUTH_SMS_OTP_MAX_ATTEMPTS", 5)
+	viper.SetDefault("GO_AUTH_SMS_OTP_MAX_PER_HOUR", 5)
+	viper.SetDefault("GO_AUTH_LOGIN_IDENTIFIER", "both")
+	viper.SetDefault("GO_AUTH_PASSWORD_MIN_LENGTH", 8)
+	viper.SetDefault("GO_AUTH_PASSWORD_MAX_LENGTH", 64)
+	viper.SetDefault("GO_AUTH_PASSWORD_REQUIRE_LOWERCASE", true)
+	viper.SetDefault("GO_AUTH_PASSWORD_REQUIRE_UPPERCASE", true)
+	viper.SetDefault("GO_AUTH_PASSWORD_REQUIRE_DIGIT", true)
+	viper.SetDefault("GO_AUTH_PASSWORD_FORBID_USER_INFO", true)
+	viper.SetDefault("GO_AUTH_BREACHED_PASSWORD_MODE", "off")
+	viper.SetDefault("GO_AUTH_BREACHED_PASSWORD_URL", "https://api.pwnedpasswords.com/range")
+	viper.SetDefault("GO_AUTH_BREACHED_PASSWORD_MIN_COUNT", 1)
+	viper.SetDefault("GO_AUTH_PASSWORD_CHANGE_TOKEN_EXPIRES_IN", "10m")
+	viper.SetDefault("GO_AUTH_PASSWORD_HASHER", "argon2id")
+	viper.SetDefault("GO_AUTH_BCRYPT_COST", 10)
+	viper.SetDefault("GO_AUTH_ARGON2_MEMORY", 19456)
+	viper.SetDefault("GO_AUTH_ARGON2_ITERATIONS", 2)
+	viper.SetDefault("GO_AUTH_ARGON2_PARALLELISM", 1)
+	viper.SetDefault("GO_AUTH_SCRYPT_LOG_N", 17)
+	viper.SetDefault("GO_AUTH_SCRYPT_R", 8)
+	viper.SetDefault("GO_AUTH_SCRYPT_P", 1)
+	viper.SetDefault("GO_AUTH_PBKDF2_ITERATIONS", 600000)
 
 	err := viper.ReadInConfig()
 	if err != nil {
@@ -48,10 +170,89 @@ func ConfigService() (configEnv ConfigEnv) {
 		panic(err)
 	}
 
+	if configEnv.DeviceVerificationURI == "" {
+		configEnv.DeviceVerificationURI = configEnv.Issuer + "/device"
+	}
+
+	if configEnv.SamlIdpSsoURL == "" {
+		configEnv.SamlIdpSsoURL = configEnv.Issuer + "/saml/idp/sso"
+	}
+
+	if configEnv.MagicLinkURL == "" {
+		configEnv.MagicLinkURL = configEnv.Issuer + "/magic-link"
+	}
+
+	if configEnv.SecretEncryptionKey == "" {
+		configEnv.SecretEncryptionKey = configEnv.JwtRefreshTokenSecret
+	}
+
+	if configEnv.LdapGroupBaseDN == "" {
+		configEnv.LdapGroupBaseDN = configEnv.LdapBaseDN
+	}
+
 	err = validator.Validate(configEnv)
 	if err != nil {
 		panic(err)
 	}
 
+	if configEnv.LdapURL != "" && configEnv.LdapBaseDN == "" {
+		panic(errors.New("GO_AUTH_LDAP_BASE_DN is required when GO_AUTH_LDAP_URL is set"))
+	}
+
+	switch configEnv.Mailer {
+	case "log":
+	case "smtp":
+		if configEnv.SmtpHost == "" || configEnv.MailFrom == "" {
+			panic(errors.New("GO_AUTH_SMTP_HOST and GO_AUTH_MAIL_FROM are required when GO_AUTH_MAILER is smtp"))
+		}
+	default:
+		panic(errors.New("GO_AUTH_MAILER must be log or smtp"))
+	}
+
+	switch configEnv.SmsSender {
+	case "log":
+	case "http":
+		if configEnv.SmsGatewayURL == "" {
+			panic(errors.New("GO_AUTH_SMS_GATEWAY_URL is required when GO_AUTH_SMS_SENDER is http"))
+		}
+	default:
+		panic(errors.New("GO_AUTH_SMS_SENDER must be log or http"))
+	}
+
+	switch configEnv.LoginIdentifier {
+	case "username", "email", "both":
+	default:
+		panic(errors.New("GO_AUTH_LOGIN_IDENTIFIER must be username, email or both"))
+	}
+
+	if configEnv.PasswordMinLength < 1 || configEnv.PasswordMaxLength < configEnv.PasswordMinLength {
+		panic(errors.New("GO_AUTH_PASSWORD_MIN_LENGTH must be at least 1 and at most GO_AUTH_PASSWORD_MAX_LENGTH"))
+	}
+
+	switch configEnv.PasswordHasher {
+	case "argon2id", "scrypt", "bcrypt", "pbkdf2-sha256":
+	default:
+		panic(errors.New("GO_AUTH_PASSWORD_HASHER must be argon2id, scrypt, bcrypt or pbkdf2-sha256"))
+	}
+
+	switch configEnv.BreachedPasswordMode {
+	case "off":
+	case "file", "bloom":
+		if configEnv.BreachedPasswordFile == "" {
+			panic(errors.New("GO_AUTH_BREACHED_PASSWORD_FILE is required when GO_AUTH_BREACHED_PASSWORD_MODE is file or bloom"))
+		}
+	case "http":
+		if configEnv.BreachedPasswordURL == "" {
+			panic(errors.New("GO_AUTH_BREACHED_PASSWORD_URL is required when GO_AUTH_BREACHED_PASSWORD_MODE is http"))
+		}
+	default:
+		panic(errors.New("GO_AUTH_BREACHED_PASSWORD_MODE must be off, file, bloom or http"))
+	}
+
+	// A count of 0 would also match every hash the dataset does not list.
+	if configEnv.BreachedPasswordMinCount < 1 {
+		panic(errors.New("GO_AUTH_BREACHED_PASSWORD_MIN_COUNT must be at least 1"))
+	}
+
 	return configEnv
 }
@@ -33,7 +33,29 @@ func InitDatabase(configEnv config.ConfigEnv) *gorm.DB {
 			&repository.Role{},
 			&repository.User{},
 			&repository.Session{},
+			&repository.ServiceAccount{},
+			&repository.ClientAssertion{},
+			&repository.OAuthClient{},
+			&repository.OAuthCode{},
+			&repository.OAuthConsent{},
+			&repository.OAuthDeviceCode{},
+			&repository.RevokedToken{},
+			&repository.LogoutDelivery{},
+			&repository.IdentityProvider{},
+			&repository.UserIdentity{},
+			&repository.SamlConnection{},
+			&repository.SamlRequest{},
+			&repository.SamlAssertion{},
+			&repository.SamlIdentity{},
+			&repository.SamlServiceProvider{},
+			&repository.LdapSyncRun{},
+			&repository.ScimTenant{},
+			&repository.MagicLink{},
+			&repository.EmailOtp{},
+			&repository.SmsOtp{},
+			&repository.PasswordHistory{},
 		)
+		migrateUserIdentifiers(db, configEnv)
 	}
 
 	// Initial role
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"fmt"
+
+	"lazy-auth/app/repository"
+	"lazy-auth/common"
+	"lazy-auth/config"
+
+	"gorm.io/gorm"
+)
+
+// legacyUserIdentifierIndexes are the exact and lower() unique indexes that
+// the username and email keys replace.
+var legacyUserIdentifierIndexes = []string{
+	"idx_username",
+	"idx_email",
+	"idx_users_username_lower",
+	"idx_users_email_lower",
+}
+
+// migrateUserIdentifiers fills the username and email keys of users that
+// predate them, oldest user first. Usernames and emails themselves are left
+// as entered. A newer user whose username or email collides is flagged with
+// username_conflict_flag or email_conflict_flag and logged, that username or
+// email cannot be used to sign in until an admin changes one of them.
+func migrateUserIdentifiers(db *gorm.DB, configEnv config.ConfigEnv) {
+	var users []repository.User
+	tx := db.Unscoped().
+		Select("id", "username", "email", "username_key", "email_key", "username_conflict_flag", "email_conflict_flag").
+		Order("created_at").
+		Find(&users)
+	if tx.Error != nil {
+		fmt.Println("[MIGRATE] [ERROR] Cannot load users:", tx.Error)
+		return
+	}
+
+	usernameKeys := map[string]bool{}
+	emailKeys := map[string]bool{}
+	for _, user := range users {
+		if user.UsernameKey != "" && !user.UsernameConflictFlag {
+			usernameKeys[user.UsernameKey] = true
+		}
+		if user.EmailKey != "" && !user.EmailConflictFlag {
+			emailKeys[user.EmailKey] = true
+		}
+	}
+
+	for _, user := range users {
+		updates := map[string]any{}
+
+		if user.UsernameKey == "" {
+			usernameKey := common.CanonicalUsername(user.Username)
+			if usernameKeys[usernameKey] {
+				fmt.Printf(
+					"[MIGRATE] [WARNING] username %q of user %s belongs to an older account, flagged with username_conflict_flag\n",
+					user.Username,
+					user.ID,
+				)
+				updates["username_conflict_flag"] = true
+			}
+			usernameKeys[usernameKey] = true
+			updates["username_key"] = usernameKey
+		}
+
+		if user.EmailKey == "" && user.Email != "" {
+			emailKey := common.CanonicalEmail(user.Email, configEnv.EmailFoldGmail)
+			if emailKeys[emailKey] {
+				fmt.Printf(
+					"[MIGRATE] [WARNING] email %q of user %s belongs to an older account, flagged with email_conflict_flag\n",
+					user.Email,
+					user.ID,
+				)
+				updates["email_conflict_flag"] = true
+			}
+			emailKeys[emailKey] = true
+			updates["email_key"] = emailKey
+		}
+
+		if len(updates) == 0 {
+			continue
+		}
+		tx := db.Unscoped().Model(&repository.User{}).Where("id = ?", user.ID).UpdateColumns(updates)
+		if tx.Error != nil {
+			fmt.Printf("[MIGRATE] [ERROR] Cannot update identifiers of user %s: %v\n", user.ID, tx.Error)
+		}
+	}
+
+	for _, index := range legacyUserIdentifierIndexes {
+		db.Exec("DROP INDEX IF EXISTS " + index)
+	}
+}
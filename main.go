@@ -12,41 +12,210 @@ import (
 	"lazy-auth/database"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gin-gonic/gin/binding"
-	"github.com/go-playground/validator/v10"
 )
 
 func main() {
 	config := config.ConfigService()
 	db := database.InitDatabase(config)
+	signingKey := common.LoadSigningKey(config.OidcSigningKeyFile)
+	samlCertificate := common.LoadSamlCertificate(config.SamlKeyFile, config.SamlCertificateFile)
+	passwordHasher := common.NewPasswordHasher(common.PasswordHashParams{
+		Algorithm:         config.PasswordHasher,
+		BcryptCost:        config.BcryptCost,
+		Argon2Memory:      config.Argon2Memory,
+		Argon2Iterations:  config.Argon2Iterations,
+		Argon2Parallelism: config.Argon2Parallelism,
+		ScryptLogN:        config.ScryptLogN,
+		ScryptR:           config.ScryptR,
+		ScryptP:           config.ScryptP,
+		Pbkdf2Iterations:  config.Pbkdf2Iterations,
+	})
 
 	roleRepository := repository.NewRoleRepository(db)
 	sessionRepository := repository.NewSessionRepository(db)
-	userRepository := repository.NewUserRepository(db)
+	userRepository := repository.NewUserRepository(db, config)
+	serviceAccountRepository := repository.NewServiceAccountRepository(db)
+	clientAssertionRepository := repository.NewClientAssertionRepository(db)
+	oauthClientRepository := repository.NewOAuthClientRepository(db)
+	oauthCodeRepository := repository.NewOAuthCodeRepository(db)
+	oauthConsentRepository := repository.NewOAuthConsentRepository(db)
+	oauthDeviceCodeRepository := repository.NewOAuthDeviceCodeRepository(db)
+	revokedTokenRepository := repository.NewRevokedTokenRepository(db)
+	logoutDeliveryRepository := repository.NewLogoutDeliveryRepository(db)
+	identityProviderRepository := repository.NewIdentityProviderRepository(db)
+	userIdentityRepository := repository.NewUserIdentityRepository(db)
+	samlConnectionRepository := repository.NewSamlConnectionRepository(db)
+	samlRequestRepository := repository.NewSamlRequestRepository(db)
+	samlAssertionRepository := repository.NewSamlAssertionRepository(db)
+	samlIdentityRepository := repository.NewSamlIdentityRepository(db)
+	samlServiceProviderRepository := repository.NewSamlServiceProviderRepository(db)
+	ldapSyncRunRepository := repository.NewLdapSyncRunRepository(db)
+	scimTenantRepository := repository.NewScimTenantRepository(db)
+	magicLinkRepository := repository.NewMagicLinkRepository(db)
+	emailOtpRepository := repository.NewEmailOtpRepository(db)
+	passwordHistoryRepository := repository.NewPasswordHistoryRepository(db)
+	smsOtpRepository := repository.NewSmsOtpRepository(db)
 
+	mailer := service.NewMailer(config)
+	smsSender := service.NewSMSSender(config)
+
+	logoutService := service.NewLogoutService(
+		oauthClientRepository,
+		sessionRepository,
+		logoutDeliveryRepository,
+		signingKey,
+		config,
+	)
+	logoutService.StartDeliveryWorker()
+
+	ldapService := service.NewLdapService(userRepository, roleRepository, config)
+	breachedPasswordChecker := service.NewBreachedPasswordChecker(config)
+	passwordPolicyService := service.NewPasswordPolicyService(
+		passwordHistoryRepository,
+		breachedPasswordChecker,
+		passwordHasher,
+		config,
+	)
+	ldapSyncService := service.NewLdapSyncService(
+		ldapSyncRunRepository,
+		userRepository,
+		roleRepository,
+		sessionRepository,
+		logoutService,
+		config,
+	)
+	ldapSyncService.StartScheduler()
+
+	emailOtpService := service.NewEmailOtpService(
+		emailOtpRepository,
+		userRepository,
+		sessionRepository,
+		mailer,
+		config,
+	)
+	smsOtpService := service.NewSmsOtpService(
+		smsOtpRepository,
+		userRepository,
+		sessionRepository,
+		emailOtpService,
+		smsSender,
+		config,
+	)
 	authService := service.NewAuthService(
 		userRepository,
 		roleRepository,
 		sessionRepository,
+		logoutService,
+		ldapService,
+		emailOtpService,
+		passwordPolicyService,
+		passwordHasher,
+		config,
+	)
+	magicLinkService := service.NewMagicLinkService(
+		magicLinkRepository,
+		userRepository,
+		sessionRepository,
+		mailer,
+		config,
+	)
+	userService := service.NewUserService(
+		userRepository,
+		roleRepository,
+		passwordPolicyService,
+		passwordHasher,
+	)
+	serviceAccountService := service.NewServiceAccountService(
+		serviceAccountRepository,
+		roleRepository,
+		clientAssertionRepository,
+		config,
+	)
+	oauthClientService := service.NewOAuthClientService(oauthClientRepository, config)
+	identityProviderService := service.NewIdentityProviderService(identityProviderRepository, config)
+	federationService := service.NewFederationService(
+		identityProviderRepository,
+		userIdentityRepository,
+		samlIdentityRepository,
+		userRepository,
+		roleRepository,
+		sessionRepository,
+		emailOtpService,
+		passwordPolicyService,
+		config,
+	)
+	samlConnectionService := service.NewSamlConnectionService(samlConnectionRepository, config)
+	samlService := service.NewSamlService(
+		samlConnectionRepository,
+		samlRequestRepository,
+		samlAssertionRepository,
+		samlIdentityRepository,
+		userRepository,
+		roleRepository,
+		sessionRepository,
+		emailOtpService,
+		samlCertificate,
+		config,
+	)
+	samlServiceProviderService := service.NewSamlServiceProviderService(samlServiceProviderRepository)
+	samlIdpService := service.NewSamlIdpService(
+		samlServiceProviderRepository,
+		userRepository,
+		samlCertificate,
+		config,
+	)
+	scimTenantService := service.NewScimTenantService(scimTenantRepository)
+	scimService := service.NewScimService(
+		userRepository,
+		roleRepository,
+		sessionRepository,
+		logoutService,
+		passwordPolicyService,
+		passwordHasher,
+		config,
+	)
+	oauthService := service.NewOAuthService(
+		oauthClientRepository,
+		oauthCodeRepository,
+		oauthConsentRepository,
+		oauthDeviceCodeRepository,
+		sessionRepository,
+		userRepository,
+		revokedTokenRepository,
+		signingKey,
 		config,
 	)
-	userService := service.NewUserService(userRepository, roleRepository)
 
 	secretGuard := middleware.NewSecretGuard(config)
-	tokenGuard := middleware.NewTokenGuard(sessionRepository, config)
+	tokenGuard := middleware.NewTokenGuard(sessionRepository, serviceAccountRepository, config)
 	roleGuard := middleware.NewRoleGuard(userRepository)
+	scimGuard := middleware.NewScimGuard(scimTenantRepository)
 
 	authHandler := handler.NewAuthHandler(authService)
+	passwordPolicyHandler := handler.NewPasswordPolicyHandler(passwordPolicyService)
+	magicLinkHandler := handler.NewMagicLinkHandler(magicLinkService)
+	emailOtpHandler := handler.NewEmailOtpHandler(emailOtpService)
+	smsOtpHandler := handler.NewSmsOtpHandler(smsOtpService)
 	userHandler := handler.NewUserHandler(userService)
+	serviceAccountHandler := handler.NewServiceAccountHandler(serviceAccountService)
+	oauthHandler := handler.NewOAuthHandler(oauthService)
+	logoutHandler := handler.NewLogoutHandler(logoutService)
+	identityProviderHandler := handler.NewIdentityProviderHandler(identityProviderService)
+	federationHandler := handler.NewFederationHandler(federationService)
+	samlConnectionHandler := handler.NewSamlConnectionHandler(samlConnectionService)
+	samlHandler := handler.NewSamlHandler(samlService)
+	samlServiceProviderHandler := handler.NewSamlServiceProviderHandler(samlServiceProviderService)
+	samlIdpHandler := handler.NewSamlIdpHandler(samlIdpService)
+	ldapSyncHandler := handler.NewLdapSyncHandler(ldapSyncService)
+	scimTenantHandler := handler.NewScimTenantHandler(scimTenantService)
+	scimHandler := handler.NewScimHandler(scimService)
+	oauthClientHandler := handler.NewOAuthClientHandler(oauthClientService)
 
 	if config.Stage == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	r := gin.Default()
-	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
-		v.RegisterValidation("password", common.PasswordValidate)
-	}
 
 	api := r.Group("/api")
 	{
@@ -62,12 +231,26 @@ func main() {
 		api.POST("/auth/logout", authHandler.Logout)
 		api.POST("/auth/forgot-password", authHandler.ForgotPassword)
 		api.POST("/auth/reset-password", authHandler.ResetPassword)
-		api.POST("/auth/change-password", tokenGuard.ValidateToken(), authHandler.ChangePassword)
+		api.GET("/auth/password-policy", passwordPolicyHandler.GetPasswordPolicy)
+		api.POST("/auth/magic-link", magicLinkHandler.RequestMagicLink)
+		api.POST("/auth/magic-link/consume", magicLinkHandler.ConsumeMagicLink)
+		api.POST("/auth/email-otp", emailOtpHandler.RequestLoginCode)
+		api.POST("/auth/email-otp/verify", emailOtpHandler.VerifyLoginCode)
+		api.POST("/auth/mfa/verify", emailOtpHandler.VerifyMfa)
+		api.POST("/auth/sms-otp", smsOtpHandler.RequestLoginCode)
+		api.POST("/auth/sms-otp/verify", smsOtpHandler.VerifyLoginCode)
+		api.POST("/auth/change-password", tokenGuard.ValidatePasswordChangeToken(), authHandler.ChangePassword)
+		api.POST("/auth/service-accounts/token", serviceAccountHandler.IssueToken)
+		api.GET("/auth/providers", federationHandler.GetLoginProviders)
+		api.GET("/auth/providers/:slug/authorize", federationHandler.Authorize)
+		api.POST("/auth/providers/:slug/callback", federationHandler.Callback)
+		api.GET("/auth/saml/:slug/login", samlHandler.Login)
+		api.POST("/auth/saml/:slug/acs", samlHandler.Acs)
 
 		// User
 		api.GET(
 			"/users",
-			tokenGuard.ValidateToken(),
+			tokenGuard.ValidateAnyToken(),
 			roleGuard.ValidateRole("admin"),
 			userHandler.GetUsers,
 		)
@@ -75,6 +258,157 @@ func main() {
 		api.POST("/users/admin", secretGuard.ValidateSecret(), userHandler.CreateUserAdmin)
 		api.GET("/users/me", tokenGuard.ValidateToken(), userHandler.GetMe)
 		api.PATCH("/users/me", tokenGuard.ValidateToken(), userHandler.UpdateMe)
+		api.POST("/users/me/mfa/email/code", tokenGuard.ValidateToken(), emailOtpHandler.SendSetupCode)
+		api.PUT("/users/me/mfa/email", tokenGuard.ValidateToken(), emailOtpHandler.UpdateEmailMfa)
+		api.PUT("/users/me/phone", tokenGuard.ValidateToken(), smsOtpHandler.UpdatePhone)
+		api.POST("/users/me/phone/verify", tokenGuard.ValidateToken(), smsOtpHandler.VerifyPhone)
+		api.DELETE("/users/me/phone", tokenGuard.ValidateToken(), smsOtpHandler.RemovePhone)
+		api.GET("/users/me/identities", tokenGuard.ValidateToken(), federationHandler.GetMyIdentities)
+		api.GET(
+			"/users/me/identities/:slug/authorize",
+			tokenGuard.ValidateToken(),
+			federationHandler.LinkAuthorize,
+		)
+		api.POST(
+			"/users/me/identities/:slug/callback",
+			tokenGuard.ValidateToken(),
+			federationHandler.LinkCallback,
+		)
+		api.DELETE("/users/me/identities/:id", tokenGuard.ValidateToken(), federationHandler.UnlinkIdentity)
+
+		// Service account
+		serviceAccounts := api.Group(
+			"/service-accounts",
+			tokenGuard.ValidateAnyToken(),
+			roleGuard.ValidateRole("admin"),
+		)
+		serviceAccounts.GET("", serviceAccountHandler.GetServiceAccounts)
+		serviceAccounts.POST("", serviceAccountHandler.CreateServiceAccount)
+		serviceAccounts.GET("/:id", serviceAccountHandler.GetServiceAccount)
+		serviceAccounts.PATCH("/:id", serviceAccountHandler.UpdateServiceAccount)
+		serviceAccounts.DELETE("/:id", serviceAccountHandler.DeleteServiceAccount)
+		serviceAccounts.POST("/:id/rotate-secret", serviceAccountHandler.RotateSecret)
+
+		// OAuth client
+		oauthClients := api.Group(
+			"/oauth/clients",
+			tokenGuard.ValidateAnyToken(),
+			roleGuard.ValidateRole("admin"),
+		)
+		oauthClients.GET("", oauthClientHandler.GetClients)
+		oauthClients.POST("", oauthClientHandler.CreateClient)
+		oauthClients.GET("/:id", oauthClientHandler.GetClient)
+		oauthClients.PATCH("/:id", oauthClientHandler.UpdateClient)
+		oauthClients.DELETE("/:id", oauthClientHandler.DeleteClient)
+		oauthClients.POST("/:id/rotate-secret", oauthClientHandler.RotateSecret)
+
+		// Identity provider
+		identityProviders := api.Group(
+			"/identity-providers",
+			tokenGuard.ValidateAnyToken(),
+			roleGuard.ValidateRole("admin"),
+		)
+		identityProviders.GET("", identityProviderHandler.GetProviders)
+		identityProviders.POST("", identityProviderHandler.CreateProvider)
+		identityProviders.GET("/:id", identityProviderHandler.GetProvider)
+		identityProviders.PATCH("/:id", identityProviderHandler.UpdateProvider)
+		identityProviders.DELETE("/:id", identityProviderHandler.DeleteProvider)
+
+		// SAML connection
+		samlConnections := api.Group(
+			"/saml/connections",
+			tokenGuard.ValidateAnyToken(),
+			roleGuard.ValidateRole("admin"),
+		)
+		samlConnections.GET("", samlConnectionHandler.GetConnections)
+		samlConnections.POST("", samlConnectionHandler.CreateConnection)
+		samlConnections.GET("/:id", samlConnectionHandler.GetConnection)
+		samlConnections.PATCH("/:id", samlConnectionHandler.UpdateConnection)
+		samlConnections.DELETE("/:id", samlConnectionHandler.DeleteConnection)
+
+		// SAML service provider
+		samlServiceProviders := api.Group(
+			"/saml/service-providers",
+			tokenGuard.ValidateAnyToken(),
+			roleGuard.ValidateRole("admin"),
+		)
+		samlServiceProviders.GET("", samlServiceProviderHandler.GetServiceProviders)
+		samlServiceProviders.POST("", samlServiceProviderHandler.CreateServiceProvider)
+		samlServiceProviders.GET("/:id", samlServiceProviderHandler.GetServiceProvider)
+		samlServiceProviders.PATCH("/:id", samlServiceProviderHandler.UpdateServiceProvider)
+		samlServiceProviders.DELETE("/:id", samlServiceProviderHandler.DeleteServiceProvider)
+
+		api.POST("/saml/idp/sso", tokenGuard.ValidateToken(), samlIdpHandler.Sso)
+
+		// LDAP sync
+		ldapSync := api.Group(
+			"/ldap/sync",
+			tokenGuard.ValidateAnyToken(),
+			roleGuard.ValidateRole("admin"),
+		)
+		ldapSync.GET("", ldapSyncHandler.GetStatus)
+		ldapSync.POST("", ldapSyncHandler.Sync)
+		ldapSync.GET("/runs", ldapSyncHandler.GetRuns)
+		ldapSync.GET("/runs/:id", ldapSyncHandler.GetRun)
+
+		// SCIM tenant
+		scimTenants := api.Group(
+			"/scim/tenants",
+			tokenGuard.ValidateAnyToken(),
+			roleGuard.ValidateRole("admin"),
+		)
+		scimTenants.GET("", scimTenantHandler.GetScimTenants)
+		scimTenants.POST("", scimTenantHandler.CreateScimTenant)
+		scimTenants.GET("/:id", scimTenantHandler.GetScimTenant)
+		scimTenants.PATCH("/:id", scimTenantHandler.UpdateScimTenant)
+		scimTenants.DELETE("/:id", scimTenantHandler.DeleteScimTenant)
+		scimTenants.POST("/:id/rotate-token", scimTenantHandler.RotateToken)
+	}
+
+	r.GET("/.well-known/openid-configuration", oauthHandler.GetOpenIDConfiguration)
+
+	r.GET("/saml/:slug/metadata", samlHandler.GetMetadata)
+	r.GET("/saml/idp/metadata", samlIdpHandler.GetMetadata)
+
+	scim := r.Group("/scim/v2", scimGuard.ValidateScimToken())
+	{
+		scim.GET("/ServiceProviderConfig", scimHandler.GetServiceProviderConfig)
+		scim.GET("/ResourceTypes", scimHandler.GetResourceTypes)
+		scim.GET("/ResourceTypes/:id", scimHandler.GetResourceType)
+		scim.GET("/Schemas", scimHandler.GetSchemas)
+		scim.GET("/Schemas/:id", scimHandler.GetSchema)
+
+		scim.GET("/Users", scimHandler.GetUsers)
+		scim.POST("/Users", scimHandler.CreateUser)
+		scim.GET("/Users/:id", scimHandler.GetUser)
+		scim.PUT("/Users/:id", scimHandler.ReplaceUser)
+		scim.PATCH("/Users/:id", scimHandler.PatchUser)
+		scim.DELETE("/Users/:id", scimHandler.DeleteUser)
+
+		scim.GET("/Groups", scimHandler.GetGroups)
+		scim.POST("/Groups", scimHandler.CreateGroup)
+		scim.GET("/Groups/:id", scimHandler.GetGroup)
+		scim.PUT("/Groups/:id", scimHandler.ReplaceGroup)
+		scim.PATCH("/Groups/:id", scimHandler.PatchGroup)
+		scim.DELETE("/Groups/:id", scimHandler.DeleteGroup)
+	}
+
+	oauth := r.Group("/oauth")
+	{
+		oauth.GET("/authorize", tokenGuard.ValidateToken(), oauthHandler.Authorize)
+		oauth.POST("/authorize", tokenGuard.ValidateToken(), oauthHandler.Decide)
+		oauth.POST("/token", oauthHandler.Token)
+		oauth.POST("/register", oauthClientHandler.RegisterClient)
+		oauth.POST("/device_authorization", oauthHandler.AuthorizeDevice)
+		oauth.GET("/device", tokenGuard.ValidateToken(), oauthHandler.GetDeviceVerification)
+		oauth.POST("/device", tokenGuard.ValidateToken(), oauthHandler.VerifyDevice)
+		oauth.POST("/introspect", oauthHandler.Introspect)
+		oauth.POST("/revoke", oauthHandler.Revoke)
+		oauth.GET("/end_session", logoutHandler.EndSession)
+		oauth.POST("/end_session", logoutHandler.EndSession)
+		oauth.GET("/jwks", oauthHandler.GetJwks)
+		oauth.GET("/userinfo", tokenGuard.ValidateScopedToken(), oauthHandler.GetUserInfo)
+		oauth.POST("/userinfo", tokenGuard.ValidateScopedToken(), oauthHandler.GetUserInfo)
 	}
 
 	r.Run(fmt.Sprintf(":%v", config.Port))